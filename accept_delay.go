@@ -6,7 +6,10 @@
 
 package fastnet
 
-import "time"
+import (
+	"sync/atomic"
+	"time"
+)
 
 const (
 	maxDelay = 1 * time.Second
@@ -18,8 +21,9 @@ func init() {
 	AcceptDelay = &acceptDelay{duration: 0}
 }
 
+// acceptDelay 多个accept协程共享同一个退避时间，所有读写都使用原子操作
 type acceptDelay struct {
-	duration time.Duration
+	duration int64 // 当前的退避时间 time.Duration
 }
 
 func (d *acceptDelay) Delay() {
@@ -28,22 +32,35 @@ func (d *acceptDelay) Delay() {
 }
 
 func (d *acceptDelay) Reset() {
-	d.duration = 0
+	// 大部分时候退避时间已经是0，先读再写避免多个协程频繁写同一个缓存行
+	if atomic.LoadInt64(&d.duration) != 0 {
+		atomic.StoreInt64(&d.duration, 0)
+	}
+}
+
+// Duration 获取当前的退避时间
+func (d *acceptDelay) Duration() time.Duration {
+	return time.Duration(atomic.LoadInt64(&d.duration))
 }
 
 func (d *acceptDelay) Up() {
-	if d.duration == 0 {
-		d.duration = 5 * time.Millisecond
-		return
-	}
-	d.duration = 2 * d.duration
-	if d.duration > maxDelay {
-		d.duration = maxDelay
+	for {
+		old := atomic.LoadInt64(&d.duration)
+		next := 2 * old
+		if old == 0 {
+			next = int64(5 * time.Millisecond)
+		}
+		if next > int64(maxDelay) {
+			next = int64(maxDelay)
+		}
+		if atomic.CompareAndSwapInt64(&d.duration, old, next) {
+			return
+		}
 	}
 }
 
 func (d *acceptDelay) do() {
-	if d.duration > 0 {
-		time.Sleep(d.duration)
+	if duration := d.Duration(); duration > 0 {
+		time.Sleep(duration)
 	}
 }
@@ -0,0 +1,21 @@
+/**
+* @File: accept_error.go
+* @Author: Jason Woo
+* @Date: 2026/10/16 12:03
+**/
+
+package fastnet
+
+import (
+	"errors"
+	"syscall"
+)
+
+// AcceptErrorFunc Accept出错(监听关闭除外)时的回调，返回true时按退避时间等待后继续Accept，返回false时停止当前的acceptLoop
+// 回调中可以告警、主动关闭部分链接释放文件描述符，或者自行等待更长的时间后再返回
+type AcceptErrorFunc func(err error) (retry bool)
+
+// IsTooManyOpenFiles 判断是否是进程或系统的文件描述符耗尽(EMFILE/ENFILE)，这是Accept最常见的生产故障
+func IsTooManyOpenFiles(err error) bool {
+	return errors.Is(err, syscall.EMFILE) || errors.Is(err, syscall.ENFILE)
+}
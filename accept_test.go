@@ -0,0 +1,158 @@
+/**
+* @File: accept_test.go
+* @Author: Jason Woo
+* @Date: 2026/10/16 21:40
+**/
+
+package fastnet
+
+import (
+	"fmt"
+	"github.com/dyowoo/fastnet/xconf"
+	"net"
+	"os"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// 启动concurrency个acceptLoop，返回监听地址，测试结束时等待所有acceptLoop退出
+func startAcceptLoops(tb testing.TB, s *Server, concurrency int) string {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		tb.Fatal(err)
+	}
+
+	s.exitChan = make(chan struct{})
+	var wg sync.WaitGroup
+	for i := 0; i < concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			s.acceptLoop(ln)
+		}()
+	}
+	tb.Cleanup(func() {
+		close(s.exitChan)
+		_ = ln.Close()
+		wg.Wait()
+	})
+
+	return ln.Addr().String()
+}
+
+// 客户端主动复位链接，避免大量TIME_WAIT占满本地端口
+func dialAndReset(tb testing.TB, addr string) {
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	_ = conn.(*net.TCPConn).SetLinger(0)
+	_ = conn.Close()
+}
+
+func TestAcceptConcurrencyRespectsMaxConn(t *testing.T) {
+	s := NewUserConfServer(&xconf.Config{MaxConn: 5, HideLogo: true}).(*Server)
+	// 不启动链接的读写，链接会一直保留在链接管理中
+	addr := startAcceptLoops(t, s, 8)
+
+	var wg sync.WaitGroup
+	conns := make(chan net.Conn, 20)
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			conn, err := net.Dial("tcp", addr)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			conns <- conn
+		}()
+	}
+	wg.Wait()
+	close(conns)
+	defer func() {
+		for conn := range conns {
+			_ = conn.Close()
+		}
+	}()
+
+	waitFor(t, func() bool { return s.connMgr.Len() == 5 })
+	// 等待多余的链接被拒绝
+	time.Sleep(50 * time.Millisecond)
+	if n := s.connMgr.Len(); n != 5 {
+		t.Fatalf("conn count = %d, want 5", n)
+	}
+}
+
+// BenchmarkAcceptConcurrency 对比不同Accept协程数量下的链接接入速度
+func BenchmarkAcceptConcurrency(b *testing.B) {
+	for _, concurrency := range []int{1, 4} {
+		b.Run(fmt.Sprintf("accept-%d", concurrency), func(b *testing.B) {
+			s := NewUserConfServer(&xconf.Config{MaxConn: 1 << 30, HideLogo: true}).(*Server)
+			var accepted int64
+			s.SetOnConnStart(func(conn IConnection) {
+				atomic.AddInt64(&accepted, 1)
+				conn.Stop()
+			})
+			addr := startAcceptLoops(b, s, concurrency)
+
+			b.ResetTimer()
+			b.RunParallel(func(pb *testing.PB) {
+				for pb.Next() {
+					dialAndReset(b, addr)
+				}
+			})
+			for atomic.LoadInt64(&accepted) < int64(b.N) {
+				time.Sleep(time.Millisecond)
+			}
+		})
+	}
+}
+
+// Accept总是返回指定错误的监听
+type errListener struct {
+	err error
+}
+
+func (l *errListener) Accept() (net.Conn, error) { return nil, l.err }
+func (l *errListener) Close() error              { return nil }
+func (l *errListener) Addr() net.Addr            { return &net.TCPAddr{} }
+
+func TestOnAcceptErrorStopsAcceptLoop(t *testing.T) {
+	s := NewServer().(*Server)
+	s.exitChan = make(chan struct{})
+	defer close(s.exitChan)
+
+	var calls int
+	var tooManyFiles bool
+	s.SetOnAcceptError(func(err error) bool {
+		calls++
+		tooManyFiles = IsTooManyOpenFiles(err)
+		return calls < 3
+	})
+
+	ln := &errListener{err: &net.OpError{Op: "accept", Net: "tcp", Err: os.NewSyscallError("accept", syscall.EMFILE)}}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		s.acceptLoop(ln)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("acceptLoop does not stop when OnAcceptError returns false")
+	}
+	AcceptDelay.Reset()
+
+	if calls != 3 {
+		t.Fatalf("OnAcceptError calls = %d, want 3", calls)
+	}
+	if !tooManyFiles {
+		t.Fatal("EMFILE should be reported by IsTooManyOpenFiles")
+	}
+}
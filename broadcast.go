@@ -0,0 +1,62 @@
+/**
+* @File: broadcast.go
+* @Author: Jason Woo
+* @Date: 2026/10/16 12:51
+**/
+
+package fastnet
+
+import (
+	"github.com/dyowoo/fastnet/xlog"
+	"time"
+)
+
+// BroadcastResult 广播的结果
+type BroadcastResult struct {
+	Sent    []uint64         // 消息已进入发送队列的链接ID
+	Skipped map[uint64]error // 被跳过的链接ID及原因，队列在超时时间内没有空位时为ErrSendBuffTimeout
+}
+
+// BroadcastWithDeadline 向所有链接广播一条消息，整个广播最多等待timeout
+// 每个链接通过有缓冲队列发送，队列已满时等待到广播的截止时间，之后队列仍然已满的链接直接跳过并记录在结果中，
+// 无论有多少接收过慢的链接，广播的总耗时都不超过timeout，timeout小于等于0时队列已满的链接直接跳过
+func (s *Server) BroadcastWithDeadline(msgID uint32, data []byte, timeout time.Duration) BroadcastResult {
+	result := BroadcastResult{Skipped: make(map[uint64]error)}
+	deadline := time.Now().Add(timeout)
+
+	s.connMgr.RangeConn(func(connID uint64, conn IConnection) bool {
+		// 截止时间已过时剩余时间小于等于0，只尝试放入不等待
+		result.send(conn, msgID, data, time.Until(deadline))
+		return true
+	})
+	result.report(msgID)
+
+	return result
+}
+
+// BroadcastByTag 向所有带有标签key=value的链接广播一条消息，与SendBuffMsg一样通过有缓冲队列发送
+func (s *Server) BroadcastByTag(key, value string, msgID uint32, data []byte) BroadcastResult {
+	result := BroadcastResult{Skipped: make(map[uint64]error)}
+
+	for _, conn := range s.connMgr.GetByTag(key, value) {
+		result.send(conn, msgID, data, sendBuffTimeout)
+	}
+	result.report(msgID)
+
+	return result
+}
+
+func (r *BroadcastResult) send(conn IConnection, msgID uint32, data []byte, timeout time.Duration) {
+	if err := conn.SendBuffMsgWithTimeout(msgID, data, timeout); err != nil {
+		r.Skipped[conn.GetConnID()] = err
+	} else {
+		r.Sent = append(r.Sent, conn.GetConnID())
+	}
+}
+
+func (r *BroadcastResult) report(msgID uint32) {
+	if len(r.Skipped) > 0 {
+		xlog.WarnF("broadcast msgID = %s skipped %d of %d connections", msgIDString(msgID),
+			len(r.Skipped), len(r.Skipped)+len(r.Sent))
+	}
+}
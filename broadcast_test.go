@@ -0,0 +1,89 @@
+/**
+* @File: broadcast_test.go
+* @Author: Jason Woo
+* @Date: 2026/10/16 12:51
+**/
+
+package fastnet
+
+import (
+	"context"
+	"github.com/dyowoo/fastnet/xconf"
+	"io"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestBroadcastWithDeadlineSkipsSlowConn(t *testing.T) {
+	s := NewUserConfServer(&xconf.Config{MaxMsgChanLen: 2, HideLogo: true}).(*Server)
+	newConn := func(connID uint64) (*Connection, net.Conn) {
+		local, remote := net.Pipe()
+		conn := newServerConn(s, local, connID).(*Connection)
+		conn.ctx, conn.cancel = context.WithCancel(context.Background())
+		t.Cleanup(func() {
+			conn.cancel()
+			_ = remote.Close()
+			s.GetConnMgr().Remove(conn)
+		})
+		return conn, remote
+	}
+
+	fast, remote := newConn(1)
+	go func() { _, _ = io.Copy(io.Discard, remote) }()
+	// 对端不读取数据，写协程阻塞在写出上，队列很快被占满
+	var slow []*Connection
+	for connID := uint64(2); connID <= 5; connID++ {
+		conn, _ := newConn(connID)
+		slow = append(slow, conn)
+	}
+
+	var result BroadcastResult
+	for i := 0; i < 4; i++ {
+		result = s.BroadcastWithDeadline(1, []byte("tick"), 10*time.Millisecond)
+	}
+
+	// 多个慢链接共用一个截止时间，总耗时不会按慢链接的个数累加
+	timeout := 100 * time.Millisecond
+	start := time.Now()
+	result = s.BroadcastWithDeadline(1, []byte("tick"), timeout)
+	if elapsed := time.Since(start); elapsed >= 2*timeout {
+		t.Fatalf("broadcast took %v, want about %v for %d slow conns", elapsed, timeout, len(slow))
+	}
+
+	if len(result.Sent) != 1 || result.Sent[0] != fast.GetConnID() {
+		t.Fatalf("sent = %v, want [%d]", result.Sent, fast.GetConnID())
+	}
+	for _, conn := range slow {
+		if err := result.Skipped[conn.GetConnID()]; err != ErrSendBuffTimeout {
+			t.Fatalf("skipped slow conn %d err = %v, want ErrSendBuffTimeout", conn.GetConnID(), err)
+		}
+	}
+
+	// 不等待时队列已满的链接立即被跳过
+	result = s.BroadcastWithDeadline(1, []byte("tick"), 0)
+	if _, ok := result.Skipped[slow[0].GetConnID()]; !ok {
+		t.Fatal("slow conn should be skipped without waiting")
+	}
+}
+
+func TestBroadcastByTag(t *testing.T) {
+	s := NewServer().(*Server)
+	conns := addPipeConns(t, s, 3)
+	for _, conn := range conns {
+		conn.(*Connection).ctx, conn.(*Connection).cancel = context.WithCancel(context.Background())
+		defer conn.(*Connection).cancel()
+	}
+	conns[0].SetTag("tier", "premium")
+	conns[2].SetTag("tier", "premium")
+
+	result := s.BroadcastByTag("tier", "premium", 1, []byte("notice"))
+	if len(result.Sent) != 2 || len(result.Skipped) != 0 {
+		t.Fatalf("sent = %v, skipped = %v, want 2 sent", result.Sent, result.Skipped)
+	}
+	for _, connID := range result.Sent {
+		if connID == conns[1].GetConnID() {
+			t.Fatal("untagged conn should not receive the broadcast")
+		}
+	}
+}
@@ -58,6 +58,7 @@ func (c *Chain) GetIMessage() IMessage {
 }
 
 // ProceedWithIMessage Next 通过IMessage和解码后数据进入下一个责任链任务
+// 后续拦截器可以通过GetDecodeResult读取内置解码器设置的统一的解码结果
 func (c *Chain) ProceedWithIMessage(message IMessage, response IcReq) IcResp {
 	if message == nil || response == nil {
 		return c.Proceed(c.Request())
@@ -13,16 +13,33 @@ import (
 	"github.com/dyowoo/fastnet/xlog"
 	"github.com/gorilla/websocket"
 	"net"
+	"net/http"
+	"sync"
 	"time"
 )
 
+const (
+	reconnectMinDelay = time.Second      // 自动重连失败后第一次重试的等待时间
+	reconnectMaxDelay = 30 * time.Second // 自动重连失败后重试的最长等待时间，每次失败等待时间翻倍
+)
+
 type IClient interface {
 	Restart()
 	Start()
 	Stop()
 	AddRouter(msgID uint32, router IRouter)
+	AddRouterSlices(msgID uint32, router ...RouterHandler) IRouterSlices
 	Conn() IConnection
 
+	// SetHandshake 设置该Client的连接握手函数，在OnConnStart之前执行
+	SetHandshake(HandshakeFunc)
+
+	// GetHandshake 获取该Client的连接握手函数
+	GetHandshake() HandshakeFunc
+
+	// SetDialFunc 设置建立链接的方法，默认使用标准库
+	SetDialFunc(DialFunc)
+
 	// SetOnConnStart 设置该Client的连接创建时Hook函数
 	SetOnConnStart(func(IConnection))
 
@@ -35,6 +52,12 @@ type IClient interface {
 	// GetOnConnStop 设置该Client的连接断开时的Hook函数
 	GetOnConnStop() func(IConnection)
 
+	// SetOnConnStopE 设置该Client的连接断开时带关闭原因的Hook函数
+	SetOnConnStopE(ConnStopReasonFunc)
+
+	// GetOnConnStopE 获取该Client的连接断开时带关闭原因的Hook函数
+	GetOnConnStopE() ConnStopReasonFunc
+
 	// GetPacket 获取Client绑定的数据协议封包方式
 	GetPacket() IDataPack
 
@@ -47,15 +70,31 @@ type IClient interface {
 	// StartHeartbeat Start 启动心跳检测
 	StartHeartbeat(time.Duration)
 
+	// StartHeartbeatWithOption 启动心跳检测(自定义回调)
+	StartHeartbeatWithOption(time.Duration, *HeartbeatOption)
+
 	// StartHeartBeatWithOption 自定义回调
+	// Deprecated: 请使用 StartHeartbeatWithOption
 	StartHeartBeatWithOption(time.Duration, *HeartbeatOption)
 
+	// GetHeartbeat 获取心跳检测器
+	GetHeartbeat() IHeartbeatChecker
+
+	// SetAutoReconnect 设置心跳检测到服务端不存活时是否自动重连
+	SetAutoReconnect(bool)
+
+	// SetPanicHandler 设置业务处理发生panic时的回调
+	SetPanicHandler(PanicHandler)
+
 	// GetLengthField Get the length field of this Client
 	GetLengthField() *LengthField
 
 	// SetDecoder 设置解码器
 	SetDecoder(IDecoder)
 
+	// GetDecoder 获取解码器
+	GetDecoder() IDecoder
+
 	// AddInterceptor 添加拦截器
 	AddInterceptor(IInterceptor)
 
@@ -67,6 +106,9 @@ type IClient interface {
 
 	// GetName 获取客户端Client名称
 	GetName() string
+
+	// GetConfig 获取Client使用的配置
+	GetConfig() *xconf.Config
 }
 
 type Client struct {
@@ -74,30 +116,62 @@ type Client struct {
 	ip               string                 // 目标链接服务器的IP
 	port             int                    // 目标链接服务器的端口
 	version          string                 // tcp,websocket,客户端版本 tcp,websocket
-	conn             IConnection            // 链接实例
+	conn             IConnection            // 链接实例，由lock保护，重连时会被替换
+	handshake        HandshakeFunc          // 该client的连接握手函数
+	dialFunc         DialFunc               // 建立链接的方法，为nil时使用标准库
 	onConnStart      func(conn IConnection) // 该client的连接创建时Hook函数
 	onConnStop       func(conn IConnection) // 该client的连接断开时的Hook函数
+	onConnStopE      ConnStopReasonFunc     // 该client的连接断开时带关闭原因的Hook函数
 	packet           IDataPack              // 数据报文封包方式
-	exitChan         chan struct{}          // 异步捕获链接关闭状态
+	exit             *clientExit            // 异步捕获链接关闭状态，由lock保护，每次Restart创建新的实例
 	msgHandler       IMsgHandle             // 消息管理模块
 	decoder          IDecoder               // 断粘包解码器
 	heartbeatChecker IHeartbeatChecker      // 心跳检测器
 	useTLS           bool                   // 使用TLS
 	dialer           *websocket.Dialer
 	errChan          chan error
+	config           *xconf.Config // 创建时的配置，之后不再读取全局配置
+	routerSlicesMode bool          // 路由模式
+	autoReconnect    bool          // 心跳检测到服务端不存活时自动重连
+	stopped          bool          // 已经调用过Stop，由lock保护
+	lock             sync.Mutex    // 保护conn、exit和stopped，重连在心跳检测的协程中执行
+}
+
+// clientExit 通知一次Restart启动的协程退出，可以被Stop和重连重复关闭
+type clientExit struct {
+	ch   chan struct{}
+	once sync.Once
+}
+
+func newClientExit() *clientExit {
+	return &clientExit{ch: make(chan struct{})}
+}
+
+func (e *clientExit) close() {
+	e.once.Do(func() { close(e.ch) })
 }
 
 func NewClient(ip string, port int, opts ...ClientOption) IClient {
+	xconf.EnsureLoaded()
+	config := xconf.GlobalObject
+	if err := checkTCPConfig(config); err != nil {
+		panic(err)
+	}
+
 	c := &Client{
 		// 默认名称，可以使用WithNameClient的Option修改
 		name:       "FastClientTcp",
 		ip:         ip,
 		port:       port,
-		msgHandler: newMsgHandle(),
+		msgHandler: newClientMsgHandle(config),
 		packet:     Factory().NewPack(FastDataPack),
 		decoder:    NewTLVDecoder(),
 		version:    "tcp",
-		errChan:    make(chan error),
+		errChan:    make(chan error, 1),
+
+		config: config,
+
+		routerSlicesMode: config.RouterSlicesMode,
 	}
 
 	//  应用Option设置
@@ -109,18 +183,28 @@ func NewClient(ip string, port int, opts ...ClientOption) IClient {
 }
 
 func NewWsClient(ip string, port int, opts ...ClientOption) IClient {
+	xconf.EnsureLoaded()
+	config := xconf.GlobalObject
+	if err := checkTCPConfig(config); err != nil {
+		panic(err)
+	}
+
 	c := &Client{
 		// 默认名称，可以使用WithNameClient的Option修改
 		name: "FastClientWs",
 		ip:   ip,
 		port: port,
 
-		msgHandler: newMsgHandle(),
+		msgHandler: newClientMsgHandle(config),
 		packet:     Factory().NewPack(FastDataPack),
 		decoder:    NewTLVDecoder(),
 		version:    "websocket",
 		dialer:     &websocket.Dialer{},
-		errChan:    make(chan error),
+		errChan:    make(chan error, 1),
+
+		config: config,
+
+		routerSlicesMode: config.RouterSlicesMode,
 	}
 
 	// 应用Option设置
@@ -140,76 +224,157 @@ func NewTLSClient(ip string, port int, opts ...ClientOption) IClient {
 }
 
 // Restart 重新启动客户端，发送请求且建立连接
+// 建立链接失败时将错误发送到GetErrChan，不会重试
 func (c *Client) Restart() {
-	c.exitChan = make(chan struct{})
+	c.restart(false)
+}
 
-	// 客户端将协程池关闭
-	xconf.GlobalObject.WorkerPoolSize = 0
+// 启动协程建立链接，retry为true时建立链接失败后按指数退避一直重试，直到成功或者客户端被停止
+func (c *Client) restart(retry bool) {
+	exit := newClientExit()
+	c.lock.Lock()
+	if c.stopped {
+		c.lock.Unlock()
+		return
+	}
+	c.exit = exit
+	c.lock.Unlock()
 
 	go func() {
-		addr := &net.TCPAddr{
-			IP:   net.ParseIP(c.ip),
-			Port: c.port,
-			Zone: "", //for ipv6, ignore
+		conn, ok := c.dialWithRetry(exit, retry)
+		if !ok {
+			return
 		}
 
-		// 创建原始Socket，得到net.Conn
-		switch c.version {
-		case "websocket":
-			wsAddr := fmt.Sprintf("ws://%s:%d", c.ip, c.port)
-
-			// 创建原始Socket，得到net.Conn
-			wsConn, _, err := c.dialer.Dial(wsAddr, nil)
-			if err != nil {
-				xlog.ErrorF("wsClient connect to server failed, err:%v", err)
-				c.errChan <- err
-				return
-			}
-
-			c.conn = newWsClientConn(c, wsConn)
-		default:
-			var conn net.Conn
-			var err error
-			if c.useTLS {
-				config := &tls.Config{
-					// 这里是跳过证书验证，因为证书签发机构的CA证书是不被认证的
-					InsecureSkipVerify: true,
-				}
-
-				conn, err = tls.Dial("tcp", fmt.Sprintf("%v:%v", net.ParseIP(c.ip), c.port), config)
-				if err != nil {
-					xlog.ErrorF("tls client connect to server failed, err:%v", err)
-					c.errChan <- err
-					return
-				}
-			} else {
-				conn, err = net.DialTCP("tcp", nil, addr)
-				if err != nil {
-					xlog.ErrorF("client connect to server failed, err:%v", err)
-					c.errChan <- err
-					return
-				}
-			}
-
-			c.conn = newClientConn(c, conn)
+		c.lock.Lock()
+		// 等待重试期间客户端被停止或者重新启动，丢弃新建立的链接
+		if c.stopped || c.exit != exit {
+			c.lock.Unlock()
+			conn.Stop()
+			return
 		}
+		c.conn = conn
+		c.lock.Unlock()
 
-		xlog.InfoF("[start] Client LocalAddr: %s, RemoteAddr: %s\n", c.conn.LocalAddr(), c.conn.RemoteAddr())
+		xlog.InfoF("[start] Client LocalAddr: %s, RemoteAddr: %s\n", conn.LocalAddr(), conn.RemoteAddr())
+
+		applyConnTCPOptions(conn, c.config)
 
 		if c.heartbeatChecker != nil {
-			// 创建链接成功，绑定链接与心跳检测器
-			c.heartbeatChecker.BindConn(c.conn)
+			// 创建链接成功，为每个链接克隆一个心跳检测器并绑定
+			c.heartbeatChecker.Clone().BindConn(conn)
 		}
 
-		go c.conn.Start()
+		go conn.Start()
 
 		select {
-		case <-c.exitChan:
+		case <-exit.ch:
 			xlog.InfoF("client exit.")
 		}
 	}()
 }
 
+// 建立链接，失败时将错误发送到errChan，retry为true时按指数退避重试，exit被关闭时停止重试并返回false
+func (c *Client) dialWithRetry(exit *clientExit, retry bool) (IConnection, bool) {
+	delay := reconnectMinDelay
+	for {
+		conn, err := c.dial()
+		if err == nil {
+			return conn, true
+		}
+		c.reportErr(err)
+		if !retry {
+			return nil, false
+		}
+
+		xlog.InfoF("[reconnect] client remoteAddr: %s:%d, retry after %v", c.ip, c.port, delay)
+		timer := time.NewTimer(delay)
+		select {
+		case <-exit.ch:
+			timer.Stop()
+			return nil, false
+		case <-timer.C:
+		}
+		if delay *= 2; delay > reconnectMaxDelay {
+			delay = reconnectMaxDelay
+		}
+	}
+}
+
+// 创建原始Socket，得到链接实例
+func (c *Client) dial() (IConnection, error) {
+	switch c.version {
+	case "websocket":
+		wsAddr := fmt.Sprintf("ws://%s:%d", c.ip, c.port)
+
+		// 创建原始Socket，得到net.Conn
+		wsConn, resp, err := c.dialer.Dial(wsAddr, nil)
+		if err != nil {
+			xlog.ErrorF("wsClient connect to server failed, err:%v", err)
+			return nil, err
+		}
+
+		var header http.Header
+		if resp != nil {
+			header = resp.Header.Clone()
+		}
+		return newWsClientConn(c, wsConn, header), nil
+	default:
+		var conn net.Conn
+		var err error
+		if c.dialFunc != nil {
+			conn, err = c.dialFunc("tcp", net.JoinHostPort(c.ip, fmt.Sprint(c.port)))
+			if err != nil {
+				xlog.ErrorF("client connect to server failed, err:%v", err)
+				return nil, err
+			}
+			if c.useTLS {
+				// 这里是跳过证书验证，因为证书签发机构的CA证书是不被认证的
+				conn = tls.Client(conn, &tls.Config{InsecureSkipVerify: true})
+			}
+		} else if c.useTLS {
+			config := &tls.Config{
+				// 这里是跳过证书验证，因为证书签发机构的CA证书是不被认证的
+				InsecureSkipVerify: true,
+			}
+
+			conn, err = tls.Dial("tcp", fmt.Sprintf("%v:%v", net.ParseIP(c.ip), c.port), config)
+			if err != nil {
+				xlog.ErrorF("tls client connect to server failed, err:%v", err)
+				return nil, err
+			}
+		} else {
+			addr := &net.TCPAddr{
+				IP:   net.ParseIP(c.ip),
+				Port: c.port,
+				Zone: "", //for ipv6, ignore
+			}
+			conn, err = net.DialTCP("tcp", nil, addr)
+			if err != nil {
+				xlog.ErrorF("client connect to server failed, err:%v", err)
+				return nil, err
+			}
+		}
+
+		return newClientConn(c, conn), nil
+	}
+}
+
+// 将建立链接的错误发送到errChan，没有协程及时接收时丢弃，重连的协程不会因此阻塞
+func (c *Client) reportErr(err error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if c.stopped {
+		return
+	}
+	select {
+	case c.errChan <- err:
+	default:
+		xlog.ErrorF("client errChan is full, drop err: %v", err)
+	}
+}
+
 // Start 启动客户端，发送请求且建立链接
 func (c *Client) Start() {
 	// 将解码器添加到拦截器
@@ -221,47 +386,121 @@ func (c *Client) Start() {
 }
 
 // StartHeartbeat 启动心跳检测, interval: 每次发送心跳的时间间隔
+// 客户端定时向服务端发送心跳，既可以检测服务端是否存活，也可以防止NAT映射过期
 func (c *Client) StartHeartbeat(interval time.Duration) {
-	checker := NewHeartbeatChecker(interval)
+	c.StartHeartbeatWithOption(interval, nil)
+}
+
+// StartHeartbeatWithOption 启动心跳检测(自定义回调)
+func (c *Client) StartHeartbeatWithOption(interval time.Duration, option *HeartbeatOption) {
+	checker := newHeartbeatCheckerWithOption(interval, option, c.routerSlicesMode, c.config.HeartbeatJitter)
+
+	// 服务端不存活时先执行用户的回调，再根据配置自动重连
+	notAlive := OnRemoteNotAlive(notAliveDefaultFunc)
+	if option != nil && option.OnRemoteNotAlive != nil {
+		notAlive = option.OnRemoteNotAlive
+	}
+	checker.SetOnRemoteNotAlive(func(conn IConnection, missedBeats int) {
+		notAlive(conn, missedBeats)
+		if c.autoReconnect {
+			c.reconnect()
+		}
+	})
 
 	// 添加心跳检测的路由
-	c.AddRouter(checker.MsgID(), checker.Router())
+	if c.routerSlicesMode {
+		c.AddRouterSlices(checker.MsgID(), checker.RouterSlices()...)
+	} else {
+		c.AddRouter(checker.MsgID(), checker.Router())
+	}
 
 	// client绑定心跳检测器
 	c.heartbeatChecker = checker
 }
 
 // StartHeartBeatWithOption 启动心跳检测(自定义回调)
+// Deprecated: 请使用 StartHeartbeatWithOption
 func (c *Client) StartHeartBeatWithOption(interval time.Duration, option *HeartbeatOption) {
-	checker := NewHeartbeatChecker(interval)
+	c.StartHeartbeatWithOption(interval, option)
+}
+
+// 关闭当前链接并重新建立连接，建立链接失败时一直重试，直到成功或者客户端被停止
+func (c *Client) reconnect() {
+	xlog.InfoF("[reconnect] client remoteAddr: %s:%d", c.ip, c.port)
 
-	if option != nil {
-		checker.SetHeartbeatMsgFunc(option.MakeMsg)
-		checker.SetOnRemoteNotAlive(option.OnRemoteNotAlive)
-		checker.BindRouter(option.HeartbeatMsgID, option.Router)
+	c.lock.Lock()
+	conn, exit := c.conn, c.exit
+	c.lock.Unlock()
+
+	if conn != nil {
+		conn.Stop()
+	}
+	if exit != nil {
+		exit.close()
 	}
 
-	c.AddRouter(checker.MsgID(), checker.Router())
+	c.restart(true)
+}
 
-	c.heartbeatChecker = checker
+func (c *Client) GetHeartbeat() IHeartbeatChecker {
+	return c.heartbeatChecker
+}
+
+func (c *Client) SetAutoReconnect(autoReconnect bool) {
+	c.autoReconnect = autoReconnect
 }
 
 func (c *Client) Stop() {
-	xlog.InfoF("[stop] client localAddr: %s, remoteAddr: %s\n", c.conn.LocalAddr(), c.conn.RemoteAddr())
-	c.conn.Stop()
-	c.exitChan <- struct{}{}
-	close(c.exitChan)
+	c.lock.Lock()
+	if c.stopped {
+		c.lock.Unlock()
+		return
+	}
+	c.stopped = true
+	conn, exit := c.conn, c.exit
 	close(c.errChan)
+	c.lock.Unlock()
+
+	if conn != nil {
+		xlog.InfoF("[stop] client localAddr: %s, remoteAddr: %s\n", conn.LocalAddr(), conn.RemoteAddr())
+		conn.Stop()
+	}
+	if exit != nil {
+		exit.close()
+	}
 }
 
 func (c *Client) AddRouter(msgID uint32, router IRouter) {
 	c.msgHandler.AddRouter(msgID, router)
 }
 
+func (c *Client) AddRouterSlices(msgID uint32, router ...RouterHandler) IRouterSlices {
+	return c.msgHandler.AddRouterSlices(msgID, router...)
+}
+
 func (c *Client) Conn() IConnection {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
 	return c.conn
 }
 
+// SetDialFunc 设置建立链接的方法，websocket客户端同时用于建立底层的tcp链接
+func (c *Client) SetDialFunc(dialFunc DialFunc) {
+	c.dialFunc = dialFunc
+	if c.dialer != nil {
+		c.dialer.NetDial = dialFunc
+	}
+}
+
+func (c *Client) SetHandshake(handshake HandshakeFunc) {
+	c.handshake = handshake
+}
+
+func (c *Client) GetHandshake() HandshakeFunc {
+	return c.handshake
+}
+
 func (c *Client) SetOnConnStart(hookFunc func(IConnection)) {
 	c.onConnStart = hookFunc
 }
@@ -278,11 +517,20 @@ func (c *Client) GetOnConnStop() func(IConnection) {
 	return c.onConnStop
 }
 
+func (c *Client) SetOnConnStopE(hookFunc ConnStopReasonFunc) {
+	c.onConnStopE = hookFunc
+}
+
+func (c *Client) GetOnConnStopE() ConnStopReasonFunc {
+	return c.onConnStopE
+}
+
 func (c *Client) GetPacket() IDataPack {
 	return c.packet
 }
 
 func (c *Client) SetPacket(packet IDataPack) {
+	bindConfig(packet, c.config)
 	c.packet = packet
 }
 
@@ -290,6 +538,11 @@ func (c *Client) GetMsgHandler() IMsgHandle {
 	return c.msgHandler
 }
 
+// SetPanicHandler 设置业务处理发生panic时的回调，默认只记录日志
+func (c *Client) SetPanicHandler(handler PanicHandler) {
+	c.msgHandler.SetPanicHandler(handler)
+}
+
 func (c *Client) AddInterceptor(interceptor IInterceptor) {
 	c.msgHandler.AddInterceptor(interceptor)
 }
@@ -297,6 +550,10 @@ func (c *Client) AddInterceptor(interceptor IInterceptor) {
 func (c *Client) SetDecoder(decoder IDecoder) {
 	c.decoder = decoder
 }
+func (c *Client) GetDecoder() IDecoder {
+	return c.decoder
+}
+
 func (c *Client) GetLengthField() *LengthField {
 	if c.decoder != nil {
 		return c.decoder.GetLengthField()
@@ -315,3 +572,7 @@ func (c *Client) SetName(name string) {
 func (c *Client) GetName() string {
 	return c.name
 }
+
+func (c *Client) GetConfig() *xconf.Config {
+	return c.config
+}
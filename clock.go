@@ -0,0 +1,56 @@
+/**
+* @File: clock.go
+* @Author: Jason Woo
+* @Date: 2026/10/16 12:52
+**/
+
+package fastnet
+
+import "time"
+
+// clock 时间来源，心跳检测、链接存活判断和发送限速通过它获取当前时间和定时器，
+// 测试中替换为手动推进的时钟，不需要真实地等待
+type clock interface {
+	Now() time.Time                         // 当前时间
+	NewTicker(d time.Duration) ticker       // 创建周期为d的定时器
+	After(d time.Duration) <-chan time.Time // d之后触发一次
+}
+
+// ticker 周期定时器
+type ticker interface {
+	C() <-chan time.Time // 定时器的触发通道
+	Stop()               // 停止定时器
+}
+
+// systemClock 默认的时钟，直接使用标准库
+var systemClock clock = realClock{}
+
+type realClock struct{}
+
+func (realClock) Now() time.Time {
+	return time.Now()
+}
+
+func (realClock) NewTicker(d time.Duration) ticker {
+	return realTicker{time.NewTicker(d)}
+}
+
+func (realClock) After(d time.Duration) <-chan time.Time {
+	return time.After(d)
+}
+
+type realTicker struct {
+	*time.Ticker
+}
+
+func (t realTicker) C() <-chan time.Time {
+	return t.Ticker.C
+}
+
+// 返回c，为nil时返回systemClock，用于零值可用的结构体
+func clockOrSystem(c clock) clock {
+	if c == nil {
+		return systemClock
+	}
+	return c
+}
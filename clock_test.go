@@ -0,0 +1,148 @@
+/**
+* @File: clock_test.go
+* @Author: Jason Woo
+* @Date: 2026/10/16 12:52
+**/
+
+package fastnet
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeClock 手动推进的时钟，Advance时触发到期的定时器
+type fakeClock struct {
+	lock    sync.Mutex
+	now     time.Time
+	waiters []*fakeWaiter
+}
+
+type fakeWaiter struct {
+	clock   *fakeClock
+	at      time.Time     // 下一次触发的时间
+	period  time.Duration // 周期定时器的周期，After为0
+	c       chan time.Time
+	stopped bool
+}
+
+func newFakeClock() *fakeClock {
+	return &fakeClock{now: time.Unix(1700000000, 0)}
+}
+
+func (f *fakeClock) Now() time.Time {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	return f.now
+}
+
+func (f *fakeClock) NewTicker(d time.Duration) ticker {
+	return f.add(d, d)
+}
+
+func (f *fakeClock) After(d time.Duration) <-chan time.Time {
+	return f.add(d, 0).c
+}
+
+func (f *fakeClock) add(d, period time.Duration) *fakeWaiter {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	w := &fakeWaiter{clock: f, at: f.now.Add(d), period: period, c: make(chan time.Time, 1)}
+	f.waiters = append(f.waiters, w)
+	return w
+}
+
+// Advance 推进时间，到期的定时器各触发一次，与time.Ticker一样来不及接收的触发会被丢弃
+func (f *fakeClock) Advance(d time.Duration) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	f.now = f.now.Add(d)
+	waiters := f.waiters[:0]
+	for _, w := range f.waiters {
+		if w.stopped {
+			continue
+		}
+		if !w.at.After(f.now) {
+			select {
+			case w.c <- f.now:
+			default:
+			}
+			if w.period == 0 {
+				continue
+			}
+			for !w.at.After(f.now) {
+				w.at = w.at.Add(w.period)
+			}
+		}
+		waiters = append(waiters, w)
+	}
+	f.waiters = waiters
+}
+
+// Waiters 尚未触发或停止的定时器数量，用于等待被测协程创建定时器
+func (f *fakeClock) Waiters() int {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	n := 0
+	for _, w := range f.waiters {
+		if !w.stopped {
+			n++
+		}
+	}
+	return n
+}
+
+func (w *fakeWaiter) C() <-chan time.Time {
+	return w.c
+}
+
+func (w *fakeWaiter) Stop() {
+	w.clock.lock.Lock()
+	w.stopped = true
+	w.clock.lock.Unlock()
+}
+
+func TestSendShaperWithFakeClock(t *testing.T) {
+	clk := newFakeClock()
+	shaper := sendShaper{clock: clk}
+	shaper.setRate(1000)
+	ctx := context.Background()
+
+	if !shaper.wait(ctx, 1000) {
+		t.Fatal("burst wait should succeed")
+	}
+
+	// 令牌用完后需要等待500ms，时间推进之前不会返回
+	done := make(chan bool, 1)
+	go func() { done <- shaper.wait(ctx, 500) }()
+	waitFor(t, func() bool { return clk.Waiters() == 1 })
+
+	clk.Advance(499 * time.Millisecond)
+	select {
+	case <-done:
+		t.Fatal("wait returned before the tokens are refilled")
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	clk.Advance(time.Millisecond)
+	select {
+	case ok := <-done:
+		if !ok {
+			t.Fatal("wait should succeed")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("wait does not return after the clock advances")
+	}
+
+	// 距离上一次统计1秒之后才更新发送速率
+	shaper.currentRate(0)
+	clk.Advance(2 * time.Second)
+	if rate := shaper.currentRate(4000); rate != 2000 {
+		t.Fatalf("rate = %v, want 2000", rate)
+	}
+}
@@ -0,0 +1,84 @@
+/**
+* @File: close_reason.go
+* @Author: Jason Woo
+* @Date: 2026/10/16 11:54
+**/
+
+package fastnet
+
+import (
+	"errors"
+	"github.com/gorilla/websocket"
+	"io"
+	"net"
+	"sync/atomic"
+	"time"
+)
+
+// CloseReason 链接关闭的原因
+type CloseReason int32
+
+const (
+	CloseReasonNone             CloseReason = iota // 链接未关闭
+	CloseReasonLocal                               // 本端调用Stop主动关闭
+	CloseReasonPeerClosed                          // 对端关闭了链接
+	CloseReasonReadError                           // 读取数据出错
+	CloseReasonHeartbeatTimeout                    // 心跳超时，对端不再存活
+	CloseReasonIdleTimeout                         // 链接空闲超时，由业务自行回收空闲链接时使用
+	CloseReasonServerShutdown                      // 服务器停止
+	CloseReasonProtocolError                       // 对端发送的数据不符合协议，例如半包超过上限
+	CloseReasonHandshakeFailed                     // 握手失败被拒绝，不会触发OnConnStop
+	CloseReasonKicked                              // 被业务踢下线，例如封禁、强制下线
+	CloseReasonWriteError                          // 向socket写数据出错，写出失败后链接的数据流已不完整
+	CloseReasonLifetimeExceeded                    // 链接超过了配置的最长存活时间MaxConnLifetime
+	CloseReasonHandshakeTimeout                    // 没有在FirstMessageTimeout内收到第一条完整的消息
+)
+
+// kickFlushTimeout Kick等待最后一条消息写出的最长时间
+const kickFlushTimeout = 3 * time.Second
+
+var closeReasonNames = map[CloseReason]string{
+	CloseReasonNone:             "none",
+	CloseReasonLocal:            "local",
+	CloseReasonPeerClosed:       "peer-closed",
+	CloseReasonReadError:        "read-error",
+	CloseReasonHeartbeatTimeout: "heartbeat-timeout",
+	CloseReasonIdleTimeout:      "idle-timeout",
+	CloseReasonServerShutdown:   "server-shutdown",
+	CloseReasonProtocolError:    "protocol-error",
+	CloseReasonHandshakeFailed:  "handshake-failed",
+	CloseReasonKicked:           "kicked",
+	CloseReasonWriteError:       "write-error",
+	CloseReasonLifetimeExceeded: "lifetime-exceeded",
+	CloseReasonHandshakeTimeout: "handshake-timeout",
+}
+
+func (r CloseReason) String() string {
+	if name, ok := closeReasonNames[r]; ok {
+		return name
+	}
+	return "unknown"
+}
+
+// 只记录第一次关闭的原因，之后由关闭引起的读写错误不会覆盖真正的原因
+type closeReason int32
+
+func (r *closeReason) set(reason CloseReason) {
+	atomic.CompareAndSwapInt32((*int32)(r), int32(CloseReasonNone), int32(reason))
+}
+
+func (r *closeReason) load() CloseReason {
+	return CloseReason(atomic.LoadInt32((*int32)(r)))
+}
+
+// 根据读取错误判断链接关闭的原因
+func readCloseReason(err error) CloseReason {
+	var closeErr *websocket.CloseError
+	if errors.Is(err, io.EOF) || errors.Is(err, net.ErrClosed) || errors.As(err, &closeErr) {
+		return CloseReasonPeerClosed
+	}
+	return CloseReasonReadError
+}
+
+// ConnStopReasonFunc 链接断开时带关闭原因的Hook函数
+type ConnStopReasonFunc func(conn IConnection, reason CloseReason)
@@ -0,0 +1,305 @@
+/**
+* @File: close_reason_test.go
+* @Author: Jason Woo
+* @Date: 2026/10/16 11:54
+**/
+
+package fastnet
+
+import (
+	"io"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestConnStopReason(t *testing.T) {
+	cases := []struct {
+		name string
+		stop func(conn IConnection, remote net.Conn)
+		want CloseReason
+	}{
+		{"peer-closed", func(_ IConnection, remote net.Conn) { _ = remote.Close() }, CloseReasonPeerClosed},
+		{"local", func(conn IConnection, _ net.Conn) { conn.Stop() }, CloseReasonLocal},
+		{"heartbeat", func(conn IConnection, _ net.Conn) { notAliveDefaultFunc(conn, 3) }, CloseReasonHeartbeatTimeout},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			s := NewServer().(*Server)
+			started, stopped := make(chan struct{}), make(chan CloseReason, 1)
+			s.SetOnConnStart(func(IConnection) { close(started) })
+			var plainHookCalled bool
+			s.SetOnConnStop(func(IConnection) { plainHookCalled = true })
+			s.SetOnConnStopE(func(conn IConnection, reason CloseReason) { stopped <- reason })
+
+			local, remote := net.Pipe()
+			defer remote.Close()
+			conn := newServerConn(s, local, 1)
+			go conn.Start()
+			<-started
+
+			tc.stop(conn, remote)
+
+			select {
+			case reason := <-stopped:
+				if reason != tc.want {
+					t.Fatalf("reason = %s, want %s", reason, tc.want)
+				}
+			case <-time.After(time.Second):
+				t.Fatal("OnConnStopE is not called")
+			}
+			if !plainHookCalled {
+				t.Fatal("OnConnStop should still be called")
+			}
+			if conn.CloseReason() != tc.want {
+				t.Fatalf("conn.CloseReason() = %s, want %s", conn.CloseReason(), tc.want)
+			}
+		})
+	}
+}
+
+func TestConnKickFlushesBeforeStop(t *testing.T) {
+	s := NewServer().(*Server)
+	started, stopped := make(chan struct{}), make(chan CloseReason, 1)
+	s.SetOnConnStart(func(IConnection) { close(started) })
+	s.SetOnConnStopE(func(conn IConnection, reason CloseReason) { stopped <- reason })
+
+	local, remote := net.Pipe()
+	defer remote.Close()
+	conn := newServerConn(s, local, 1)
+	go conn.Start()
+	<-started
+
+	if err := conn.SendBuffMsg(1, []byte("queued")); err != nil {
+		t.Fatal(err)
+	}
+	kicked := make(chan error, 1)
+	go func() { kicked <- conn.Kick(2, []byte("bye"), CloseReasonKicked) }()
+
+	// 队列中的消息先于最后一条消息写出
+	for _, want := range []uint32{1, 2} {
+		msg := readReply(t, s, remote)
+		if msg.GetMsgID() != want {
+			t.Fatalf("msgID = %d, want %d", msg.GetMsgID(), want)
+		}
+	}
+	if err := <-kicked; err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case reason := <-stopped:
+		if reason != CloseReasonKicked {
+			t.Fatalf("reason = %s, want %s", reason, CloseReasonKicked)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("OnConnStopE is not called")
+	}
+	if err := conn.SendMsg(3, nil); err == nil {
+		t.Fatal("SendMsg after Kick should fail")
+	}
+}
+
+func TestConnKickAfterShapedWriter(t *testing.T) {
+	s := NewServer().(*Server)
+	started := make(chan struct{})
+	s.SetOnConnStart(func(IConnection) { close(started) })
+
+	local, remote := net.Pipe()
+	defer remote.Close()
+	conn := newServerConn(s, local, 1)
+	go conn.Start()
+	<-started
+
+	// 写协程取出消息后等待限速，最后一条消息仍然排在所有已入队的消息之后
+	conn.SetSendRateLimit(1000)
+	for i := 0; i < 3; i++ {
+		if err := conn.SendBuffMsg(1, make([]byte, 600)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	kicked := make(chan error, 1)
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		kicked <- conn.Kick(2, []byte("bye"), CloseReasonKicked)
+	}()
+
+	for _, want := range []uint32{1, 1, 1, 2} {
+		msg := readReply(t, s, remote)
+		if msg.GetMsgID() != want {
+			t.Fatalf("msgID = %d, want %d", msg.GetMsgID(), want)
+		}
+	}
+	if err := <-kicked; err != nil {
+		t.Fatal(err)
+	}
+}
+
+// 读取正常、写出总是失败的链接，模拟对端只关闭了读方向的半死链接
+type writeFailConn struct {
+	net.Conn
+}
+
+func (c writeFailConn) Write([]byte) (int, error) {
+	return 0, io.ErrClosedPipe
+}
+
+func TestConnWriteErrorClosesConn(t *testing.T) {
+	sends := map[string]func(conn IConnection) error{
+		"SendMsg":     func(conn IConnection) error { return conn.SendMsg(1, []byte("lost")) },
+		"SendBuffMsg": func(conn IConnection) error { return conn.SendBuffMsg(1, []byte("lost")) },
+		"SendMsgBatch": func(conn IConnection) error {
+			return conn.SendMsgBatch([]OutMsg{{MsgID: 1, Data: []byte("lost")}})
+		},
+	}
+
+	for name, send := range sends {
+		t.Run(name, func(t *testing.T) {
+			s := NewServer().(*Server)
+			started, stopped := make(chan struct{}), make(chan CloseReason, 1)
+			s.SetOnConnStart(func(IConnection) { close(started) })
+			s.SetOnConnStopE(func(conn IConnection, reason CloseReason) { stopped <- reason })
+
+			local, remote := net.Pipe()
+			defer remote.Close()
+			conn := newServerConn(s, writeFailConn{local}, 1)
+			go conn.Start()
+			<-started
+
+			// 有缓冲发送只负责入队，写出失败发生在写协程中
+			_ = send(conn)
+
+			select {
+			case reason := <-stopped:
+				if reason != CloseReasonWriteError {
+					t.Fatalf("reason = %s, want %s", reason, CloseReasonWriteError)
+				}
+			case <-time.After(time.Second):
+				t.Fatal("OnConnStopE is not called after write error")
+			}
+			waitFor(t, func() bool { return s.GetConnMgr().Len() == 0 })
+			if conn.Context().Err() == nil {
+				t.Fatal("conn context should be canceled after write error")
+			}
+			// 读循环随链接关闭退出，对端读到EOF
+			if _, err := remote.Read(make([]byte, 1)); err == nil {
+				t.Fatal("peer should see the conn closed")
+			}
+		})
+	}
+}
+
+func TestConnLifetimeExceeded(t *testing.T) {
+	s := NewServer().(*Server)
+	started, stopped := make(chan struct{}), make(chan CloseReason, 1)
+	s.SetOnConnStart(func(IConnection) { close(started) })
+	s.SetOnConnStopE(func(conn IConnection, reason CloseReason) { stopped <- reason })
+
+	local, remote := net.Pipe()
+	defer remote.Close()
+	conn := newServerConn(s, local, 1)
+	go conn.Start()
+	<-started
+
+	reaper := newLifetimeReaper(time.Hour)
+	if d := reaper.interval(); d != time.Minute {
+		t.Fatalf("check interval = %v, want %v", d, time.Minute)
+	}
+
+	// 没有超过最长存活时间的链接不受影响
+	reaper.reap(s.connMgr, conn.ConnectedAt().Add(30*time.Minute))
+	if len(reaper.closing) != 0 {
+		t.Fatal("conn should not be closed before its lifetime")
+	}
+
+	if err := conn.SendBuffMsg(1, []byte("queued")); err != nil {
+		t.Fatal(err)
+	}
+	reaper.reap(s.connMgr, conn.ConnectedAt().Add(time.Hour))
+
+	// 关闭前先写出有缓冲队列中的消息
+	msg := readReply(t, s, remote)
+	if msg.GetMsgID() != 1 {
+		t.Fatalf("msgID = %d, want 1", msg.GetMsgID())
+	}
+
+	select {
+	case reason := <-stopped:
+		if reason != CloseReasonLifetimeExceeded {
+			t.Fatalf("reason = %s, want %s", reason, CloseReasonLifetimeExceeded)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("conn is not closed after its lifetime")
+	}
+
+	// 链接移除后不再记录
+	waitFor(t, func() bool { return s.connMgr.Len() == 0 })
+	reaper.reap(s.connMgr, time.Now())
+	if len(reaper.closing) != 0 {
+		t.Fatalf("closing = %v, want empty", reaper.closing)
+	}
+}
+
+func TestFirstMessageTimeout(t *testing.T) {
+	s := NewServer().(*Server)
+	s.config.FirstMessageTimeout = 1
+	stopped := make(chan CloseReason, 2)
+	s.SetOnConnStopE(func(conn IConnection, reason CloseReason) { stopped <- reason })
+
+	// 只发送了消息头的一部分
+	slowLocal, slowRemote := net.Pipe()
+	defer slowRemote.Close()
+	startTestConn(t, s, slowLocal, 1)
+	if _, err := slowRemote.Write([]byte{0, 0}); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case reason := <-stopped:
+		if reason != CloseReasonHandshakeTimeout {
+			t.Fatalf("reason = %s, want %s", reason, CloseReasonHandshakeTimeout)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("conn is not closed after first message timeout")
+	}
+
+	// 及时发送了完整消息的链接不再受读超时限制
+	local, remote := net.Pipe()
+	defer remote.Close()
+	startTestConn(t, s, local, 2)
+	packed, _ := s.GetPacket().Pack(NewMsgPackage(1, []byte("hello")))
+	if _, err := remote.Write(packed); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case reason := <-stopped:
+		t.Fatalf("conn closed with reason %s after first message", reason)
+	case <-time.After(1500 * time.Millisecond):
+	}
+}
+
+func TestFirstMessageTimeoutAfterHandshakeWithoutRead(t *testing.T) {
+	s := NewServer().(*Server)
+	s.config.FirstMessageTimeout = 1
+	stopped := make(chan CloseReason, 1)
+	s.SetOnConnStopE(func(conn IConnection, reason CloseReason) { stopped <- reason })
+	// 握手函数没有读取对端的消息，不能视为已经收到第一条消息
+	s.SetHandshake(func(conn IConnection) error {
+		return nil
+	})
+
+	local, remote := net.Pipe()
+	defer remote.Close()
+	startTestConn(t, s, local, 1)
+
+	select {
+	case reason := <-stopped:
+		if reason != CloseReasonHandshakeTimeout {
+			t.Fatalf("reason = %s, want %s", reason, CloseReasonHandshakeTimeout)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("conn is not closed after first message timeout")
+	}
+}
@@ -0,0 +1,185 @@
+/**
+* @File: codec.go
+* @Author: Jason Woo
+* @Date: 2026/10/16 11:56
+**/
+
+package fastnet
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/dyowoo/fastnet/xlog"
+	"sync"
+)
+
+// ICodec 消息数据的编解码器，类型化路由使用它将消息数据解析为处理函数需要的类型
+type ICodec interface {
+	Marshal(v interface{}) ([]byte, error)      // 编码
+	Unmarshal(data []byte, v interface{}) error // 解码
+}
+
+// JSONCodec 使用JSON编解码，默认的编解码器
+type JSONCodec struct{}
+
+func (JSONCodec) Marshal(v interface{}) ([]byte, error) {
+	return json.Marshal(v)
+}
+
+func (JSONCodec) Unmarshal(data []byte, v interface{}) error {
+	return json.Unmarshal(data, v)
+}
+
+// ContentType 消息数据的编码类型，由带内容类型的协议头(ProtocolHeader.ContentType)携带
+// 同一个链接上的消息可以使用不同的编码，Request.Bind和类型化路由按消息的编码类型选择编解码器:
+//
+//	fastnet.RegisterCodec(fastnet.ContentTypeProtobuf, ProtobufCodec{})
+//
+// 没有携带编码类型的消息使用SetCodec设置的编解码器
+type ContentType uint8
+
+const (
+	ContentTypeDefault  ContentType = 0 // 没有指定编码类型，使用SetCodec设置的编解码器
+	ContentTypeJSON     ContentType = 1 // JSON，内置JSONCodec
+	ContentTypeProtobuf ContentType = 2 // protobuf，框架不内置实现，需要通过RegisterCodec注册
+)
+
+var ErrUnknownContentType = errors.New("unknown content type") // 消息的编码类型没有注册编解码器
+
+var codecs = struct {
+	sync.RWMutex
+	byType map[ContentType]ICodec
+}{byType: map[ContentType]ICodec{
+	ContentTypeJSON: JSONCodec{},
+}}
+
+// RegisterCodec 注册编码类型对应的编解码器，已注册的类型会被替换
+// ContentTypeDefault始终使用SetCodec设置的编解码器，不能注册
+func RegisterCodec(contentType ContentType, codec ICodec) {
+	if contentType == ContentTypeDefault || codec == nil {
+		panic(fmt.Sprintf("invalid codec registration, content type = %d", contentType))
+	}
+
+	codecs.Lock()
+	defer codecs.Unlock()
+
+	codecs.byType[contentType] = codec
+}
+
+// GetCodecByContentType 获取编码类型对应的已注册的编解码器
+func GetCodecByContentType(contentType ContentType) (ICodec, bool) {
+	codecs.RLock()
+	defer codecs.RUnlock()
+
+	codec, ok := codecs.byType[contentType]
+	return codec, ok
+}
+
+// 按消息的编码类型选择编解码器，没有编码类型时使用mh的编解码器
+func codecFor(mh IMsgHandle, msg IMessage) (ICodec, error) {
+	return codecForType(mh, MsgContentType(msg))
+}
+
+func codecForType(mh IMsgHandle, contentType ContentType) (ICodec, error) {
+	if contentType == ContentTypeDefault {
+		if mh != nil && mh.GetCodec() != nil {
+			return mh.GetCodec(), nil
+		}
+		return JSONCodec{}, nil
+	}
+
+	codec, ok := GetCodecByContentType(contentType)
+	if !ok {
+		return nil, fmt.Errorf("%w: %d", ErrUnknownContentType, contentType)
+	}
+
+	return codec, nil
+}
+
+// 将请求的消息数据解析到v中
+func bindData(mh IMsgHandle, request IRequest, v interface{}) error {
+	codec, err := codecFor(mh, request.GetMessage())
+	if err != nil {
+		return err
+	}
+
+	return codec.Unmarshal(request.GetData(), v)
+}
+
+// SendTyped 使用contentType对应的编解码器编码v，并以该编码类型发送给conn
+// ContentTypeDefault使用链接所属MsgHandler的编解码器(SetCodec)，封包方式需要使用带内容类型的协议头，接收方才能按编码类型解码
+func SendTyped(conn IConnection, msgID uint32, contentType ContentType, v interface{}) error {
+	codec, err := codecForType(conn.GetMsgHandler(), contentType)
+	if err != nil {
+		return err
+	}
+	data, err := codec.Marshal(v)
+	if err != nil {
+		return err
+	}
+
+	return conn.SendMsgWithContentType(msgID, contentType, data)
+}
+
+// ReplyTyped 使用与请求消息相同的编码类型编码v，回复给请求所属的链接，对端用什么编码发来就用什么编码回复
+func ReplyTyped(request IRequest, msgID uint32, v interface{}) error {
+	conn := request.GetConnection()
+	if conn == nil {
+		return errors.New("reply to a request without connection")
+	}
+
+	return SendTyped(conn, msgID, MsgContentType(request.GetMessage()), v)
+}
+
+// BindErrorFunc 类型化路由解析消息数据失败时的回调，回调返回后该消息不再继续处理
+type BindErrorFunc func(request IRequest, err error)
+
+// BindErrorLog 记录日志后丢弃该消息，默认的处理方式
+func BindErrorLog(request IRequest, err error) {
+	xlog.ErrorF("bind msg data error, msgID = %s, err = %v", msgIDString(request.GetMsgID()), err)
+}
+
+// BindErrorDrop 直接丢弃该消息
+func BindErrorDrop(IRequest, error) {}
+
+// BindErrorReply 使用replyMsgID回复错误信息后丢弃该消息
+func BindErrorReply(replyMsgID uint32) BindErrorFunc {
+	return func(request IRequest, err error) {
+		BindErrorLog(request, err)
+
+		conn := request.GetConnection()
+		if conn == nil {
+			return
+		}
+		if err := conn.SendMsg(replyMsgID, []byte(err.Error())); err != nil {
+			xlog.ErrorF("reply bind error, msgID = %s, err = %v", msgIDString(replyMsgID), err)
+		}
+	}
+}
+
+// SetCodec 设置类型化路由使用的编解码器，为nil时使用JSONCodec
+// 消息携带了编码类型时优先使用RegisterCodec注册的编解码器
+func (mh *MsgHandle) SetCodec(codec ICodec) {
+	if codec == nil {
+		codec = JSONCodec{}
+	}
+	mh.codec = codec
+}
+
+func (mh *MsgHandle) GetCodec() ICodec {
+	return mh.codec
+}
+
+// SetBindErrorHandler 设置类型化路由解析消息数据失败时的回调，为nil时使用BindErrorLog
+func (mh *MsgHandle) SetBindErrorHandler(handler BindErrorFunc) {
+	if handler == nil {
+		handler = BindErrorLog
+	}
+	mh.bindErrorHandler = handler
+}
+
+// HandleBindError 将解析消息数据失败的请求交给回调处理
+func (mh *MsgHandle) HandleBindError(request IRequest, err error) {
+	mh.bindErrorHandler(request, err)
+}
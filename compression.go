@@ -0,0 +1,322 @@
+/**
+* @File: compression.go
+* @Author: Jason Woo
+* @Date: 2026/10/16 12:30
+**/
+
+package fastnet
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+)
+
+// 按链接协商的消息压缩
+// 客户端在握手时发送自己支持的压缩算法，服务端从中选择一个回复，双方之后发送的每条消息都使用该算法压缩，
+// 不支持压缩的客户端发送空列表即可，服务端对它不压缩，不需要全局的压缩开关:
+//
+//	// 服务端，按优先级选择压缩算法，第二个参数为协商完成后继续执行的握手函数，可以为nil
+//	s.SetHandshake(CompressionHandshake(nil, CompressionDeflate))
+//	// 客户端
+//	c.SetHandshake(ClientCompressionHandshake(nil, CompressionDeflate, CompressionGzip))
+//
+// 协商之后每条消息的数据以1字节的标记开头：0表示未压缩，1表示已压缩，压缩后不能变小的数据不压缩
+// 协商使用的消息ID为CompressionMsgID，消息数据为逗号分隔的算法名称
+
+// CompressionMsgID 压缩算法协商消息，只在握手期间使用，业务不应使用
+const CompressionMsgID uint32 = 99995
+
+// 内置的压缩算法名称
+const (
+	CompressionDeflate = "deflate"
+	CompressionGzip    = "gzip"
+)
+
+// 压缩数据的标记
+const (
+	compressFlagRaw  byte = 0
+	compressFlagData byte = 1
+)
+
+var (
+	ErrCompressionNegotiation = errors.New("compression negotiation failed")      // 握手期间没有收到合法的协商消息
+	ErrUnknownCompression     = errors.New("unknown compression")                 // 压缩算法没有注册
+	ErrDecompressedTooLarge   = errors.New("decompressed data exceeds the limit") // 解压后的数据超过MaxPacketSize
+)
+
+// ICompressor 压缩算法，需要支持并发调用
+type ICompressor interface {
+	Name() string                                        // 协商时使用的算法名称
+	Compress(data []byte) ([]byte, error)                // 压缩数据
+	Decompress(data []byte, maxSize int) ([]byte, error) // 解压数据，maxSize大于0时解压后的数据不能超过该长度
+}
+
+var compressors = struct {
+	sync.RWMutex
+	byName map[string]ICompressor
+}{byName: map[string]ICompressor{
+	CompressionDeflate: newFlateCompressor(CompressionDeflate, false),
+	CompressionGzip:    newFlateCompressor(CompressionGzip, true),
+}}
+
+// RegisterCompressor 注册压缩算法，同名的算法会被替换
+func RegisterCompressor(compressor ICompressor) {
+	compressors.Lock()
+	defer compressors.Unlock()
+
+	compressors.byName[compressor.Name()] = compressor
+}
+
+// GetCompressor 按名称获取已注册的压缩算法
+func GetCompressor(name string) (ICompressor, bool) {
+	compressors.RLock()
+	defer compressors.RUnlock()
+
+	compressor, ok := compressors.byName[name]
+	return compressor, ok
+}
+
+// 基于compress/flate的压缩算法，gzip在deflate的基础上增加了头部和校验
+type flateCompressor struct {
+	name    string
+	gzip    bool
+	writers sync.Pool
+}
+
+func newFlateCompressor(name string, gzip bool) *flateCompressor {
+	return &flateCompressor{name: name, gzip: gzip}
+}
+
+func (fc *flateCompressor) Name() string {
+	return fc.name
+}
+
+type compressWriter interface {
+	io.WriteCloser
+	Reset(w io.Writer)
+}
+
+func (fc *flateCompressor) Compress(data []byte) ([]byte, error) {
+	var buf bytes.Buffer
+
+	w, ok := fc.writers.Get().(compressWriter)
+	if ok {
+		w.Reset(&buf)
+	} else if fc.gzip {
+		w = gzip.NewWriter(&buf)
+	} else {
+		w, _ = flate.NewWriter(&buf, flate.DefaultCompression)
+	}
+	defer fc.writers.Put(w)
+
+	if _, err := w.Write(data); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+func (fc *flateCompressor) Decompress(data []byte, maxSize int) ([]byte, error) {
+	var r io.ReadCloser
+	if fc.gzip {
+		gr, err := gzip.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return nil, err
+		}
+		r = gr
+	} else {
+		r = flate.NewReader(bytes.NewReader(data))
+	}
+	defer func() { _ = r.Close() }()
+
+	// 多读取一个字节，判断解压后的数据是否超过限制
+	src := io.Reader(r)
+	if maxSize > 0 {
+		src = io.LimitReader(r, int64(maxSize)+1)
+	}
+	out, err := io.ReadAll(src)
+	if err != nil {
+		return nil, err
+	}
+	if maxSize > 0 && len(out) > maxSize {
+		return nil, ErrDecompressedTooLarge
+	}
+
+	return out, nil
+}
+
+// 压缩消息数据并加上标记，压缩失败或压缩后没有变小时发送原始数据
+func compressMsgData(compressor ICompressor, data []byte) []byte {
+	if compressed, err := compressor.Compress(data); err == nil && len(compressed) < len(data) {
+		return append([]byte{compressFlagData}, compressed...)
+	}
+
+	return append([]byte{compressFlagRaw}, data...)
+}
+
+// 去掉标记并按需解压消息数据
+func decompressMsgData(compressor ICompressor, data []byte, maxSize int) ([]byte, error) {
+	if len(data) == 0 {
+		return nil, fmt.Errorf("%w: missing compression flag", ErrCompressionNegotiation)
+	}
+
+	switch data[0] {
+	case compressFlagRaw:
+		return data[1:], nil
+	case compressFlagData:
+		return compressor.Decompress(data[1:], maxSize)
+	default:
+		return nil, fmt.Errorf("invalid compression flag %d", data[0])
+	}
+}
+
+// compressedPack 协商了压缩算法的链接使用的封包方式，封包之前压缩消息数据
+// 拆包只解析包头，消息数据在交给路由之前解压
+type compressedPack struct {
+	IDataPack
+	compressor ICompressor
+}
+
+func (p *compressedPack) Pack(msg IMessage) ([]byte, error) {
+	compressed := NewMsgPackage(msg.GetMsgID(), compressMsgData(p.compressor, msg.GetData()))
+	// 只替换消息数据，协议版本和编码类型等包头字段保持不变
+	compressed.SetVersion(MsgVersion(msg))
+	compressed.SetContentType(MsgContentType(msg))
+
+	return p.IDataPack.Pack(compressed)
+}
+
+// 链接实现该接口，用于设置协商结果和解压收到的消息
+type compressionOwner interface {
+	setCompressor(compressor ICompressor) error
+	decompressMsg(data []byte) ([]byte, error)
+}
+
+// 解压请求的消息数据，链接没有协商压缩算法时不做任何事情，解压失败时返回false，消息被丢弃
+func decompressRequest(request IRequest) bool {
+	conn := request.GetConnection()
+	if conn == nil || conn.Compression() == "" {
+		return true
+	}
+	owner, ok := conn.(compressionOwner)
+	if !ok {
+		return true
+	}
+
+	data, err := owner.decompressMsg(request.GetData())
+	if err != nil {
+		ReportDecodeError(request, err, request.GetData())
+		return false
+	}
+	request.GetMessage().SetData(data)
+	request.GetMessage().SetDataLen(uint32(len(data)))
+
+	return true
+}
+
+// CompressionHandshake 服务端的压缩算法协商握手函数，读取客户端支持的算法，按preferred的顺序选择第一个双方都支持的算法
+// preferred为空时不压缩，只回复协商结果；next不为nil时协商完成后继续执行，next中收发的消息已经压缩
+// 客户端必须先发送协商消息(不支持压缩时发送空列表)，否则链接被拒绝
+func CompressionHandshake(next HandshakeFunc, preferred ...string) HandshakeFunc {
+	return func(conn IConnection) error {
+		msg, err := conn.ReadMsg()
+		if err != nil {
+			return err
+		}
+		if msg.GetMsgID() != CompressionMsgID {
+			return fmt.Errorf("%w: first msgID = %s", ErrCompressionNegotiation, msgIDString(msg.GetMsgID()))
+		}
+
+		offered := strings.Split(string(msg.GetData()), ",")
+		chosen := ""
+		for _, name := range preferred {
+			if _, ok := GetCompressor(name); ok && containsString(offered, name) {
+				chosen = name
+				break
+			}
+		}
+
+		// 协商结果本身不压缩
+		if err = conn.SendMsg(CompressionMsgID, []byte(chosen)); err != nil {
+			return err
+		}
+		if err = setConnCompression(conn, chosen); err != nil {
+			return err
+		}
+
+		if next != nil {
+			return next(conn)
+		}
+		return nil
+	}
+}
+
+// ClientCompressionHandshake 客户端的压缩算法协商握手函数，发送supported中已注册的算法，使用服务端选择的算法
+// supported为空时表示不支持压缩；next不为nil时协商完成后继续执行
+func ClientCompressionHandshake(next HandshakeFunc, supported ...string) HandshakeFunc {
+	return func(conn IConnection) error {
+		offered := make([]string, 0, len(supported))
+		for _, name := range supported {
+			if _, ok := GetCompressor(name); ok {
+				offered = append(offered, name)
+			}
+		}
+		if err := conn.SendMsg(CompressionMsgID, []byte(strings.Join(offered, ","))); err != nil {
+			return err
+		}
+
+		msg, err := conn.ReadMsg()
+		if err != nil {
+			return err
+		}
+		chosen := string(msg.GetData())
+		if msg.GetMsgID() != CompressionMsgID || (chosen != "" && !containsString(offered, chosen)) {
+			return fmt.Errorf("%w: server replied msgID = %s, compression = %q",
+				ErrCompressionNegotiation, msgIDString(msg.GetMsgID()), chosen)
+		}
+		if err = setConnCompression(conn, chosen); err != nil {
+			return err
+		}
+
+		if next != nil {
+			return next(conn)
+		}
+		return nil
+	}
+}
+
+// 设置链接协商的压缩算法，name为空时不压缩
+func setConnCompression(conn IConnection, name string) error {
+	if name == "" {
+		return nil
+	}
+
+	compressor, ok := GetCompressor(name)
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrUnknownCompression, name)
+	}
+	owner, ok := conn.(compressionOwner)
+	if !ok {
+		return fmt.Errorf("%w: connection does not support compression", ErrCompressionNegotiation)
+	}
+
+	return owner.setCompressor(compressor)
+}
+
+func containsString(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
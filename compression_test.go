@@ -0,0 +1,146 @@
+/**
+* @File: compression_test.go
+* @Author: Jason Woo
+* @Date: 2026/10/16 12:30
+**/
+
+package fastnet
+
+import (
+	"bytes"
+	"errors"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestCompressMsgData(t *testing.T) {
+	for _, name := range []string{CompressionDeflate, CompressionGzip} {
+		compressor, _ := GetCompressor(name)
+		data := bytes.Repeat([]byte("fastnet "), 100)
+
+		packed := compressMsgData(compressor, data)
+		if packed[0] != compressFlagData || len(packed) >= len(data) {
+			t.Fatalf("%s: compressed %d bytes to %d", name, len(data), len(packed))
+		}
+		got, err := decompressMsgData(compressor, packed, 4096)
+		if err != nil || !bytes.Equal(got, data) {
+			t.Fatalf("%s: decompress = %d bytes, %v", name, len(got), err)
+		}
+		if _, err = decompressMsgData(compressor, packed, 100); !errors.Is(err, ErrDecompressedTooLarge) {
+			t.Fatalf("%s: decompress over limit err = %v", name, err)
+		}
+
+		// 压缩后不能变小的数据原样发送
+		packed = compressMsgData(compressor, []byte("hi"))
+		if packed[0] != compressFlagRaw || string(packed[1:]) != "hi" {
+			t.Fatalf("%s: small data packed = %q", name, packed)
+		}
+	}
+}
+
+func TestCompressedPackKeepsHeaderFields(t *testing.T) {
+	compressor, _ := GetCompressor(CompressionGzip)
+	header := ProtocolHeader{Magic: []byte("FN"), Version: 1, ContentType: true}
+	dp := NewDataPackWithHeader(header)
+	pack := &compressedPack{IDataPack: dp, compressor: compressor}
+
+	msg := NewMsgPackage(1, bytes.Repeat([]byte("fastnet "), 100))
+	msg.SetContentType(ContentTypeJSON)
+	data, err := pack.Pack(msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := dp.Unpack(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ct := MsgContentType(got); ct != ContentTypeJSON {
+		t.Fatalf("content type = %d, want %d", ct, ContentTypeJSON)
+	}
+}
+
+// 用两个Server的链接模拟服务端和客户端，双方同时执行握手
+func startHandshakePair(t *testing.T, server, client *Server) (IConnection, IConnection) {
+	serverRaw, clientRaw := net.Pipe()
+	conns := make(chan IConnection, 2)
+	for _, side := range []struct {
+		s   *Server
+		raw net.Conn
+	}{{server, serverRaw}, {client, clientRaw}} {
+		side.s.SetOnConnStart(func(conn IConnection) { conns <- conn })
+		conn := newServerConn(side.s, side.raw, 1)
+		go conn.Start()
+		t.Cleanup(conn.Stop)
+	}
+
+	var started []IConnection
+	for len(started) < 2 {
+		select {
+		case conn := <-conns:
+			started = append(started, conn)
+		case <-time.After(time.Second):
+			t.Fatal("handshake does not finish")
+		}
+	}
+	if started[0].GetName() != server.ServerName() {
+		started[0], started[1] = started[1], started[0]
+	}
+
+	return started[0], started[1]
+}
+
+func TestCompressionNegotiation(t *testing.T) {
+	server := NewServer().(*Server)
+	server.name = "server"
+	server.SetHandshake(CompressionHandshake(nil, CompressionGzip, CompressionDeflate))
+	server.AddInterceptor(server.GetDecoder())
+	received := make(chan []byte, 1)
+	server.AddRouterSlices(1, func(request IRequest) {
+		received <- append([]byte(nil), request.GetData()...)
+	})
+	server.GetMsgHandler().StartWorkerPool()
+	defer server.GetMsgHandler().StopWorkerPool()
+
+	data := bytes.Repeat([]byte("fastnet "), 200)
+	cases := []struct {
+		name      string
+		supported []string
+		want      string
+	}{
+		{"capable", []string{CompressionDeflate}, CompressionDeflate},
+		{"incapable", nil, ""},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			client := NewServer().(*Server)
+			client.name = "client"
+			client.SetHandshake(ClientCompressionHandshake(nil, tc.supported...))
+			serverConn, clientConn := startHandshakePair(t, server, client)
+
+			if serverConn.Compression() != tc.want || clientConn.Compression() != tc.want {
+				t.Fatalf("compression = %q/%q, want %q", serverConn.Compression(), clientConn.Compression(), tc.want)
+			}
+
+			before := serverConn.BytesRead()
+			if err := clientConn.SendMsg(1, data); err != nil {
+				t.Fatal(err)
+			}
+			select {
+			case got := <-received:
+				if !bytes.Equal(got, data) {
+					t.Fatalf("received %d bytes, want %d", len(got), len(data))
+				}
+			case <-time.After(time.Second):
+				t.Fatal("message is not routed")
+			}
+
+			// 只对支持压缩的对端压缩
+			wire := serverConn.BytesRead() - before
+			if compressed := wire < uint64(len(data)); compressed != (tc.want != "") {
+				t.Fatalf("%d bytes on the wire for %d bytes of data", wire, len(data))
+			}
+		})
+	}
+}
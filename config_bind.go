@@ -0,0 +1,43 @@
+/**
+* @File: config_bind.go
+* @Author: Jason Woo
+* @Date: 2026/10/16 14:03
+**/
+
+package fastnet
+
+import "github.com/dyowoo/fastnet/xconf"
+
+// 封包方式和断粘包解码器实现该接口，由所属的Server或Client绑定自己的配置，MaxPacketSize等参数按所属实例的配置生效
+// 同一个实例被多个Server共用时以最后一次绑定的配置为准
+type configBinder interface {
+	bindConfig(config *xconf.Config)
+}
+
+// 为封包方式或断粘包解码器绑定配置，没有实现configBinder的自定义实现不受影响
+func bindConfig(v interface{}, config *xconf.Config) {
+	if binder, ok := v.(configBinder); ok && config != nil {
+		binder.bindConfig(config)
+	}
+}
+
+// boundConfig 嵌入到封包方式和断粘包解码器中，保存绑定的配置，没有绑定时使用全局配置
+type boundConfig struct {
+	config *xconf.Config
+}
+
+func (b *boundConfig) bindConfig(config *xconf.Config) {
+	b.config = config
+}
+
+func (b *boundConfig) conf() *xconf.Config {
+	if b.config == nil {
+		return xconf.GlobalObject
+	}
+	return b.config
+}
+
+// 断粘包解码器累积数据的缓冲区，第一次解码时按FrameBuffInitCap分配
+func (b *boundConfig) newFrameBuff() []byte {
+	return make([]byte, 0, b.conf().FrameBuffInitCap)
+}
@@ -0,0 +1,114 @@
+/**
+* @File: conn_lifetime.go
+* @Author: Jason Woo
+* @Date: 2026/10/16 13:22
+**/
+
+package fastnet
+
+import (
+	"github.com/dyowoo/fastnet/xlog"
+	"time"
+)
+
+// 链接的最长存活时间：配置MaxConnLifetime后，服务端链接建立超过该时间时被关闭，客户端重连后重新认证并重新分配到负载较低的实例
+// 由每个Server的一个回收协程定期扫描所有链接，不为每个链接创建定时器
+// 关闭前先等待有缓冲队列中的消息写出(最多kickFlushTimeout)，然后以CloseReasonLifetimeExceeded关闭
+
+const (
+	minLifetimeCheckInterval = 100 * time.Millisecond // 扫描间隔的下限
+	maxLifetimeCheckInterval = time.Minute            // 扫描间隔的上限
+)
+
+// lifetimeReaper 关闭超过最长存活时间的链接
+type lifetimeReaper struct {
+	lifetime time.Duration       // 链接的最长存活时间
+	closing  map[uint64]struct{} // 正在关闭的链接，避免下一次扫描时重复关闭
+}
+
+func newLifetimeReaper(lifetime time.Duration) *lifetimeReaper {
+	return &lifetimeReaper{
+		lifetime: lifetime,
+		closing:  make(map[uint64]struct{}),
+	}
+}
+
+// 扫描间隔为最长存活时间的1/10，关闭链接的时间误差不超过该间隔
+func (r *lifetimeReaper) interval() time.Duration {
+	interval := r.lifetime / 10
+	if interval < minLifetimeCheckInterval {
+		return minLifetimeCheckInterval
+	}
+	if interval > maxLifetimeCheckInterval {
+		return maxLifetimeCheckInterval
+	}
+	return interval
+}
+
+// 定期扫描，直到exit被关闭
+func (r *lifetimeReaper) run(connMgr IConnManager, clk clock, exit <-chan struct{}) {
+	ticker := clk.NewTicker(r.interval())
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C():
+			r.reap(connMgr, clk.Now())
+		case <-exit:
+			return
+		}
+	}
+}
+
+// 关闭所有在now时已经超过最长存活时间的链接
+func (r *lifetimeReaper) reap(connMgr IConnManager, now time.Time) {
+	alive := make(map[uint64]struct{}, len(r.closing))
+
+	connMgr.RangeConn(func(connID uint64, conn IConnection) bool {
+		if now.Sub(conn.ConnectedAt()) < r.lifetime {
+			return true
+		}
+
+		alive[connID] = struct{}{}
+		if _, ok := r.closing[connID]; !ok {
+			r.closing[connID] = struct{}{}
+			go closeExpiredConn(conn, r.lifetime)
+		}
+		return true
+	})
+
+	// 已经从链接管理中移除的链接不再记录
+	for connID := range r.closing {
+		if _, ok := alive[connID]; !ok {
+			delete(r.closing, connID)
+		}
+	}
+}
+
+// 等待有缓冲队列中的消息写出后关闭链接，对端不读取数据时最多等待kickFlushTimeout
+func closeExpiredConn(conn IConnection, lifetime time.Duration) {
+	xlog.InfoF("connID = %d exceeded max lifetime %v, close it", conn.GetConnID(), lifetime)
+
+	flushed := make(chan struct{})
+	go func() {
+		_ = conn.Flush()
+		close(flushed)
+	}()
+
+	select {
+	case <-flushed:
+	case <-time.After(kickFlushTimeout):
+	}
+
+	conn.StopWithReason(CloseReasonLifetimeExceeded)
+}
+
+// 配置了MaxConnLifetime时启动链接的回收协程，服务器的上下文取消时退出
+func (s *Server) startLifetimeReaper() {
+	lifetime := s.config.MaxConnLifetimeDuration()
+	if lifetime <= 0 {
+		return
+	}
+
+	go newLifetimeReaper(lifetime).run(s.connMgr, systemClock, s.ctx.Done())
+}
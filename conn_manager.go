@@ -12,32 +12,83 @@ import (
 	"sync"
 )
 
+// IConnManager 链接管理模块
+// 注意: 链接标签(SetTag/RemoveTag/GetTag/GetByTag)等方法是后来加入接口的，之前自定义的IConnManager实现需要补充这些方法，
+// 可以嵌入*ConnManager复用默认实现，只覆盖需要定制的方法
 type IConnManager interface {
 	Add(IConnection)                                                       // Add connection
 	Remove(IConnection)                                                    // Remove connection
 	Get(uint64) (IConnection, error)                                       // Get a connection by ConnID
+	GetConn(connID uint64) (IConnection, bool)                             // Get a connection by ConnID, ok is false if not found
 	Len() int                                                              // Get current number of connections
 	ClearConn()                                                            // Remove and stop all connections
 	GetAllConnID() []uint64                                                // Get all connection IDs
 	Range(func(uint64, IConnection, interface{}) error, interface{}) error // Traverse all connections
+	RangeConn(func(connID uint64, conn IConnection) bool)                  // Traverse a snapshot of all connections, stop when the callback returns false
+	SetTag(conn IConnection, key, value string)                            // Set a tag on a managed connection and index it
+	RemoveTag(conn IConnection, key string)                                // Remove a tag from a connection
+	GetTag(connID uint64, key string) (string, bool)                       // Get a tag of a connection
+	GetByTag(key, value string) []IConnection                              // Get all connections tagged with key=value
+	SetOnAdd(func(IConnection))                                            // Set the callback invoked after a connection is added
+	SetOnRemove(func(IConnection))                                         // Set the callback invoked after a connection is removed
 }
 
 type ConnManager struct {
 	connections map[uint64]IConnection
 	connLock    sync.RWMutex
+	tags        map[uint64]map[string]string                 // 每个链接的标签
+	tagIndex    map[string]map[string]map[uint64]IConnection // 标签索引 key -> value -> 链接
+	onAdd       func(IConnection)                            // 链接加入管理器之后的回调
+	onRemove    func(IConnection)                            // 链接从管理器移除之后的回调
+	hookSeq     uint64                                       // 下一个回调的序号，由connLock保护
+	hookTurn    uint64                                       // 当前可以执行的回调序号，由hookLock保护
+	hookLock    sync.Mutex                                   // 保证回调的执行顺序与链接加入、移除的顺序一致
+	hookCond    *sync.Cond
 }
 
 func newConnManager() *ConnManager {
-	return &ConnManager{
+	connMgr := &ConnManager{
 		connections: make(map[uint64]IConnection),
 	}
+	connMgr.hookCond = sync.NewCond(&connMgr.hookLock)
+
+	return connMgr
+}
+
+// 管理器事件：SetOnAdd/SetOnRemove用于在管理器之外维护链接索引(例如在Redis中维护userID到connID的映射)，
+// 与Server的OnConnStart/OnConnStop不同，它们描述的是链接在管理器中的加入和移除，而不是链接的生命周期
+//
+// 服务端链接在创建时加入管理器，OnAdd在握手和OnConnStart之前执行；
+// 链接停止时先执行OnConnStop再从管理器移除，OnRemove在OnConnStop之后执行，ClearConn移除的链接同样会触发OnRemove
+//
+// 回调不持有链接集合的锁，可以调用Get/Len/Range等方法，但不能调用Add/Remove/ClearConn
+// 所有回调依次执行，执行顺序与链接加入、移除的顺序一致，同一个链接的OnAdd总是在OnRemove之前执行
+
+// SetOnAdd 设置链接加入管理器之后的回调，默认为nil
+func (connMgr *ConnManager) SetOnAdd(hookFunc func(IConnection)) {
+	connMgr.connLock.Lock()
+	defer connMgr.connLock.Unlock()
+
+	connMgr.onAdd = hookFunc
+}
+
+// SetOnRemove 设置链接从管理器移除之后的回调，默认为nil
+func (connMgr *ConnManager) SetOnRemove(hookFunc func(IConnection)) {
+	connMgr.connLock.Lock()
+	defer connMgr.connLock.Unlock()
+
+	connMgr.onRemove = hookFunc
 }
 
 func (connMgr *ConnManager) Add(conn IConnection) {
 
 	connMgr.connLock.Lock()
 	connMgr.connections[conn.GetConnID()] = conn
+	onAdd := connMgr.onAdd
+	// 在connLock内取得回调序号，回调的顺序与修改链接集合的顺序一致
+	seq := connMgr.nextHookSeqLocked(onAdd != nil)
 	connMgr.connLock.Unlock()
+	connMgr.runHook(seq, func() { onAdd(conn) }, onAdd != nil)
 
 	xlog.InfoF("connection add to connManager successfully: conn num = %d", connMgr.Len())
 }
@@ -45,23 +96,67 @@ func (connMgr *ConnManager) Add(conn IConnection) {
 func (connMgr *ConnManager) Remove(conn IConnection) {
 
 	connMgr.connLock.Lock()
+	_, managed := connMgr.connections[conn.GetConnID()]
 	delete(connMgr.connections, conn.GetConnID()) //删除连接信息
+	connMgr.untagLocked(conn.GetConnID())
+	// 已经被移除(例如ClearConn之后链接停止)的链接不再触发回调
+	onRemove := connMgr.onRemove
+	hasHook := managed && onRemove != nil
+	seq := connMgr.nextHookSeqLocked(hasHook)
 	connMgr.connLock.Unlock()
+	connMgr.runHook(seq, func() { onRemove(conn) }, hasHook)
 
 	xlog.InfoF("connection remove connID=%d successfully: conn num = %d", conn.GetConnID(), connMgr.Len())
 }
 
-func (connMgr *ConnManager) Get(connID uint64) (IConnection, error) {
-	connMgr.connLock.RLock()
-	defer connMgr.connLock.RUnlock()
+// 为一次管理器事件分配回调序号，调用方需持有connLock
+func (connMgr *ConnManager) nextHookSeqLocked(hasHook bool) uint64 {
+	if !hasHook {
+		return 0
+	}
+	seq := connMgr.hookSeq
+	connMgr.hookSeq++
+
+	return seq
+}
+
+// 按序号依次执行管理器事件的回调，调用方不能持有connLock，
+// 否则回调中调用Len/Get/Range时会与等待执行的Add/Remove互相等待
+func (connMgr *ConnManager) runHook(seq uint64, hook func(), hasHook bool) {
+	if !hasHook {
+		return
+	}
+
+	connMgr.hookLock.Lock()
+	for connMgr.hookTurn != seq {
+		connMgr.hookCond.Wait()
+	}
+	defer func() {
+		connMgr.hookTurn++
+		connMgr.hookCond.Broadcast()
+		connMgr.hookLock.Unlock()
+	}()
+
+	hook()
+}
 
-	if conn, ok := connMgr.connections[connID]; ok {
+func (connMgr *ConnManager) Get(connID uint64) (IConnection, error) {
+	if conn, ok := connMgr.GetConn(connID); ok {
 		return conn, nil
 	}
 
 	return nil, errors.New("connection not found")
 }
 
+// GetConn 根据ConnID获取链接，链接不存在时ok为false
+func (connMgr *ConnManager) GetConn(connID uint64) (IConnection, bool) {
+	connMgr.connLock.RLock()
+	defer connMgr.connLock.RUnlock()
+
+	conn, ok := connMgr.connections[connID]
+	return conn, ok
+}
+
 func (connMgr *ConnManager) Len() int {
 	connMgr.connLock.RLock()
 	length := len(connMgr.connections)
@@ -73,22 +168,33 @@ func (connMgr *ConnManager) Len() int {
 func (connMgr *ConnManager) ClearConn() {
 	connMgr.connLock.Lock()
 
+	removed := make([]IConnection, 0, len(connMgr.connections))
 	for connID, conn := range connMgr.connections {
 		//停止
-		conn.Stop()
+		conn.StopWithReason(CloseReasonServerShutdown)
 		delete(connMgr.connections, connID)
+		removed = append(removed, conn)
 	}
+	connMgr.tags, connMgr.tagIndex = nil, nil
+	onRemove := connMgr.onRemove
+	seq := connMgr.nextHookSeqLocked(onRemove != nil)
 	connMgr.connLock.Unlock()
 
+	connMgr.runHook(seq, func() {
+		for _, conn := range removed {
+			onRemove(conn)
+		}
+	}, onRemove != nil)
+
 	xlog.InfoF("clear all connections successfully: conn num = %d", connMgr.Len())
 }
 
 func (connMgr *ConnManager) GetAllConnID() []uint64 {
-	ids := make([]uint64, 0, len(connMgr.connections))
-
 	connMgr.connLock.RLock()
 	defer connMgr.connLock.RUnlock()
 
+	ids := make([]uint64, 0, len(connMgr.connections))
+
 	for id := range connMgr.connections {
 		ids = append(ids, id)
 	}
@@ -96,10 +202,31 @@ func (connMgr *ConnManager) GetAllConnID() []uint64 {
 	return ids
 }
 
+// Range 遍历所有链接，回调返回的错误不会中断遍历，返回最后一次回调的结果
+// 与RangeConn一样遍历的是链接集合的快照，新代码建议使用RangeConn
 func (connMgr *ConnManager) Range(cb func(uint64, IConnection, interface{}) error, args interface{}) (err error) {
-	for connID, conn := range connMgr.connections {
+	connMgr.RangeConn(func(connID uint64, conn IConnection) bool {
 		err = cb(connID, conn, args)
-	}
+		return true
+	})
 
 	return err
 }
+
+// RangeConn 遍历所有链接，回调返回false时停止遍历
+// 遍历的是调用RangeConn时链接集合的快照，回调执行时不持有锁，回调中可以安全地调用Add/Remove/Get或停止链接
+// 遍历过程中新加入的链接不会被访问，已经移除的链接仍可能被访问，回调中可通过IsAlive判断链接是否已关闭
+func (connMgr *ConnManager) RangeConn(cb func(connID uint64, conn IConnection) bool) {
+	connMgr.connLock.RLock()
+	conns := make([]IConnection, 0, len(connMgr.connections))
+	for _, conn := range connMgr.connections {
+		conns = append(conns, conn)
+	}
+	connMgr.connLock.RUnlock()
+
+	for _, conn := range conns {
+		if !cb(conn.GetConnID(), conn) {
+			return
+		}
+	}
+}
@@ -0,0 +1,265 @@
+/**
+* @File: conn_manager_test.go
+* @Author: Jason Woo
+* @Date: 2026/10/16 12:08
+**/
+
+package fastnet
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"sort"
+	"sync"
+	"testing"
+)
+
+// 创建n个加入链接管理但未启动的链接
+func addPipeConns(t *testing.T, s *Server, n int) []IConnection {
+	conns := make([]IConnection, 0, n)
+	for i := 1; i <= n; i++ {
+		local, remote := net.Pipe()
+		t.Cleanup(func() {
+			_ = local.Close()
+			_ = remote.Close()
+		})
+		conns = append(conns, newServerConn(s, local, uint64(i)))
+	}
+
+	return conns
+}
+
+func TestConnManagerRangeStopsEarly(t *testing.T) {
+	s := NewServer().(*Server)
+	addPipeConns(t, s, 5)
+
+	var visited int
+	s.GetConnMgr().RangeConn(func(connID uint64, conn IConnection) bool {
+		if connID != conn.GetConnID() {
+			t.Errorf("connID = %d, conn.GetConnID() = %d", connID, conn.GetConnID())
+		}
+		visited++
+		return visited < 2
+	})
+	if visited != 2 {
+		t.Fatalf("visited = %d, want 2", visited)
+	}
+}
+
+func TestConnManagerRangeWithArgs(t *testing.T) {
+	s := NewServer().(*Server)
+	addPipeConns(t, s, 3)
+
+	errStop := errors.New("stop")
+	var visited int
+	err := s.GetConnMgr().Range(func(connID uint64, conn IConnection, args interface{}) error {
+		if args.(string) != "args" {
+			t.Errorf("args = %v", args)
+		}
+		visited++
+		return errStop
+	}, "args")
+	if visited != 3 || err != errStop {
+		t.Fatalf("visited = %d, err = %v, want 3 and errStop", visited, err)
+	}
+}
+
+func TestConnManagerRangeConcurrentModify(t *testing.T) {
+	s := NewServer().(*Server)
+	conns := addPipeConns(t, s, 20)
+	connMgr := s.GetConnMgr()
+
+	// 回调中移除链接不会死锁，遍历的仍是调用时的快照
+	var visited int
+	connMgr.RangeConn(func(connID uint64, conn IConnection) bool {
+		connMgr.Remove(conn)
+		visited++
+		return true
+	})
+	if visited != 20 || connMgr.Len() != 0 {
+		t.Fatalf("visited = %d, len = %d, want 20 and 0", visited, connMgr.Len())
+	}
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for _, conn := range conns {
+			connMgr.Add(conn)
+			connMgr.Remove(conn)
+		}
+	}()
+	for i := 0; i < 100; i++ {
+		connMgr.RangeConn(func(connID uint64, conn IConnection) bool { return true })
+	}
+	wg.Wait()
+}
+
+func TestConnManagerGetConn(t *testing.T) {
+	s := NewServer().(*Server)
+	conns := addPipeConns(t, s, 3)
+	connMgr := s.GetConnMgr()
+
+	conn, ok := connMgr.GetConn(2)
+	if !ok || conn != conns[1] {
+		t.Fatalf("GetConn(2) = %v, %v, want conn 2", conn, ok)
+	}
+
+	connMgr.Remove(conns[1])
+	if _, ok = connMgr.GetConn(2); ok {
+		t.Fatal("GetConn should not find a removed connection")
+	}
+}
+
+// 按标签查找到的链接ID，升序排列
+func connIDsByTag(connMgr IConnManager, key, value string) []uint64 {
+	var ids []uint64
+	for _, conn := range connMgr.GetByTag(key, value) {
+		ids = append(ids, conn.GetConnID())
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	return ids
+}
+
+func TestConnManagerTags(t *testing.T) {
+	s := NewServer().(*Server)
+	conns := addPipeConns(t, s, 3)
+	connMgr := s.GetConnMgr()
+
+	conns[0].SetTag("tier", "premium")
+	conns[1].SetTag("tier", "premium")
+	conns[2].SetTag("tier", "free")
+	if ids := connIDsByTag(connMgr, "tier", "premium"); fmt.Sprint(ids) != "[1 2]" {
+		t.Fatalf("premium conns = %v, want [1 2]", ids)
+	}
+
+	// 重新设置标签时从旧值的索引中移除
+	conns[1].SetTag("tier", "free")
+	if value, ok := conns[1].GetTag("tier"); !ok || value != "free" {
+		t.Fatalf("GetTag = %q, %v, want free", value, ok)
+	}
+	if ids := connIDsByTag(connMgr, "tier", "premium"); fmt.Sprint(ids) != "[1]" {
+		t.Fatalf("premium conns after retag = %v, want [1]", ids)
+	}
+
+	conns[2].RemoveTag("tier")
+	if ids := connIDsByTag(connMgr, "tier", "free"); fmt.Sprint(ids) != "[2]" {
+		t.Fatalf("free conns after RemoveTag = %v, want [2]", ids)
+	}
+
+	// 链接移除后不再被查到，之后设置的标签被忽略
+	connMgr.Remove(conns[0])
+	conns[0].SetTag("tier", "premium")
+	if ids := connIDsByTag(connMgr, "tier", "premium"); len(ids) != 0 {
+		t.Fatalf("premium conns after Remove = %v, want none", ids)
+	}
+	if _, ok := conns[0].GetTag("tier"); ok {
+		t.Fatal("removed conn should have no tags")
+	}
+}
+
+func TestConnManagerTagsConcurrent(t *testing.T) {
+	s := NewServer().(*Server)
+	conns := addPipeConns(t, s, 20)
+	connMgr := s.GetConnMgr()
+
+	var wg sync.WaitGroup
+	for i, conn := range conns {
+		wg.Add(1)
+		go func(i int, conn IConnection) {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				conn.SetTag("region", fmt.Sprint(j%3))
+				_ = connMgr.GetByTag("region", "0")
+			}
+			if i%2 == 0 {
+				connMgr.Remove(conn)
+			}
+		}(i, conn)
+	}
+	wg.Wait()
+
+	// 每个留下的链接只出现在最后一次设置的值下
+	total := 0
+	for _, value := range []string{"0", "1", "2"} {
+		total += len(connMgr.GetByTag("region", value))
+	}
+	if ids := connIDsByTag(connMgr, "region", "0"); total != 10 || len(ids) != 10 {
+		t.Fatalf("indexed conns = %d, region=0 conns = %v, want 10", total, ids)
+	}
+}
+
+func TestConnManagerHooks(t *testing.T) {
+	s := NewServer().(*Server)
+	connMgr := s.GetConnMgr()
+
+	var events []string
+	s.SetOnConnStop(func(conn IConnection) {
+		events = append(events, fmt.Sprintf("stop:%d", conn.GetConnID()))
+	})
+	connMgr.SetOnAdd(func(conn IConnection) {
+		// 回调中可以访问链接管理器
+		events = append(events, fmt.Sprintf("add:%d/%d", conn.GetConnID(), connMgr.Len()))
+	})
+	connMgr.SetOnRemove(func(conn IConnection) {
+		events = append(events, fmt.Sprintf("remove:%d/%d", conn.GetConnID(), connMgr.Len()))
+	})
+
+	conns := addPipeConns(t, s, 2)
+	conns[0].(*Connection).finalizer()
+	// 已经移除的链接不会重复触发OnRemove
+	connMgr.Remove(conns[0])
+	connMgr.Remove(conns[1])
+
+	want := "[add:1/1 add:2/2 stop:1 remove:1/1 remove:2/0]"
+	if got := fmt.Sprint(events); got != want {
+		t.Fatalf("events = %s, want %s", got, want)
+	}
+}
+
+func TestConnManagerHooksConcurrent(t *testing.T) {
+	s := NewServer().(*Server)
+	connMgr := s.GetConnMgr()
+	conns := addPipeConns(t, s, 8)
+	for _, conn := range conns {
+		connMgr.Remove(conn)
+	}
+
+	// 回调中访问链接管理器时，并发的Add/Remove不能与回调互相等待
+	var mu sync.Mutex
+	live := make(map[uint64]bool)
+	connMgr.SetOnAdd(func(conn IConnection) {
+		_ = connMgr.Len()
+		connMgr.RangeConn(func(uint64, IConnection) bool { return true })
+		mu.Lock()
+		live[conn.GetConnID()] = true
+		mu.Unlock()
+	})
+	connMgr.SetOnRemove(func(conn IConnection) {
+		_, _ = connMgr.GetConn(conn.GetConnID())
+		mu.Lock()
+		if !live[conn.GetConnID()] {
+			t.Errorf("remove %d before add", conn.GetConnID())
+		}
+		delete(live, conn.GetConnID())
+		mu.Unlock()
+	})
+
+	var wg sync.WaitGroup
+	for _, conn := range conns {
+		wg.Add(1)
+		go func(conn IConnection) {
+			defer wg.Done()
+			for i := 0; i < 50; i++ {
+				connMgr.Add(conn)
+				connMgr.Remove(conn)
+			}
+		}(conn)
+	}
+	wg.Wait()
+
+	if len(live) != 0 || connMgr.Len() != 0 {
+		t.Fatalf("live = %v, len = %d, want empty", live, connMgr.Len())
+	}
+}
@@ -0,0 +1,37 @@
+/**
+* @File: conn_reserve.go
+* @Author: Jason Woo
+* @Date: 2026/10/16 13:30
+**/
+
+package fastnet
+
+import "time"
+
+// 链接数上限的槽位预留：Accept或websocket升级之前预留一个槽位，链接加入链接管理(或建立失败)之后释放
+// 检查链接数时同时计入已经预留的槽位，多个accept协程和并发的升级请求都不会使链接数超过MaxConn
+// 每个等待Accept的协程持有一个槽位，AcceptConcurrency大于1时链接数可能在达到MaxConn之前就暂停接入，最多相差AcceptConcurrency-1
+
+// 预留一个链接槽位，链接数加上已预留的槽位达到MaxConn时返回false，同时通知达到上限和恢复的事件
+// 预留成功后必须调用releaseConnSlot
+func (s *Server) reserveConnSlot() bool {
+	s.acceptLock.Lock()
+	current := s.connMgr.Len()
+	if current+s.connReserved >= s.config.MaxConn {
+		s.acceptLock.Unlock()
+		s.maxConnEvents.reached(current, time.Now())
+		return false
+	}
+	s.connReserved++
+	s.acceptLock.Unlock()
+
+	s.maxConnEvents.recovered(current)
+	return true
+}
+
+// 释放预留的槽位，链接已经加入链接管理时由链接管理计数，先加入再释放，链接数不会短暂超过MaxConn
+func (s *Server) releaseConnSlot() {
+	s.acceptLock.Lock()
+	s.connReserved--
+	s.acceptLock.Unlock()
+}
@@ -0,0 +1,140 @@
+/**
+* @File: conn_tags.go
+* @Author: Jason Woo
+* @Date: 2026/10/16 12:54
+**/
+
+package fastnet
+
+import "sync"
+
+// 链接标签：为链接设置任意的key=value标签(例如region=us、tier=premium)，按标签查找或广播
+// 服务端链接的标签保存在所属的ConnManager中并建立索引，按标签查找不需要遍历所有链接:
+//
+//	conn.SetTag("tier", "premium")
+//	s.BroadcastByTag("tier", "premium", msgID, data)
+//
+// 索引与链接的加入、移除在同一把锁下更新，已经移除的链接不会再被查到，移除之后设置的标签被忽略
+
+// SetTag 设置链接的标签并更新索引，链接不在管理器中时忽略
+func (connMgr *ConnManager) SetTag(conn IConnection, key, value string) {
+	connMgr.connLock.Lock()
+	defer connMgr.connLock.Unlock()
+
+	connID := conn.GetConnID()
+	if connMgr.connections[connID] != conn {
+		return
+	}
+
+	connMgr.removeTagLocked(connID, key)
+
+	if connMgr.tags == nil {
+		connMgr.tags = make(map[uint64]map[string]string)
+		connMgr.tagIndex = make(map[string]map[string]map[uint64]IConnection)
+	}
+	if connMgr.tags[connID] == nil {
+		connMgr.tags[connID] = make(map[string]string)
+	}
+	connMgr.tags[connID][key] = value
+
+	values := connMgr.tagIndex[key]
+	if values == nil {
+		values = make(map[string]map[uint64]IConnection)
+		connMgr.tagIndex[key] = values
+	}
+	if values[value] == nil {
+		values[value] = make(map[uint64]IConnection)
+	}
+	values[value][connID] = conn
+}
+
+// RemoveTag 移除链接的标签
+func (connMgr *ConnManager) RemoveTag(conn IConnection, key string) {
+	connMgr.connLock.Lock()
+	defer connMgr.connLock.Unlock()
+
+	connMgr.removeTagLocked(conn.GetConnID(), key)
+}
+
+// GetTag 获取链接的标签
+func (connMgr *ConnManager) GetTag(connID uint64, key string) (string, bool) {
+	connMgr.connLock.RLock()
+	defer connMgr.connLock.RUnlock()
+
+	value, ok := connMgr.tags[connID][key]
+	return value, ok
+}
+
+// GetByTag 获取所有带有标签key=value的链接
+func (connMgr *ConnManager) GetByTag(key, value string) []IConnection {
+	connMgr.connLock.RLock()
+	defer connMgr.connLock.RUnlock()
+
+	matched := connMgr.tagIndex[key][value]
+	conns := make([]IConnection, 0, len(matched))
+	for _, conn := range matched {
+		conns = append(conns, conn)
+	}
+
+	return conns
+}
+
+// 从索引中移除链接的一个标签，调用方需持有connLock
+func (connMgr *ConnManager) removeTagLocked(connID uint64, key string) {
+	value, ok := connMgr.tags[connID][key]
+	if !ok {
+		return
+	}
+
+	delete(connMgr.tags[connID], key)
+	if len(connMgr.tags[connID]) == 0 {
+		delete(connMgr.tags, connID)
+	}
+
+	values := connMgr.tagIndex[key]
+	delete(values[value], connID)
+	if len(values[value]) == 0 {
+		delete(values, value)
+	}
+	if len(values) == 0 {
+		delete(connMgr.tagIndex, key)
+	}
+}
+
+// 从索引中移除链接的所有标签，调用方需持有connLock
+func (connMgr *ConnManager) untagLocked(connID uint64) {
+	for key := range connMgr.tags[connID] {
+		connMgr.removeTagLocked(connID, key)
+	}
+}
+
+// tagSet 不属于任何ConnManager的链接(客户端链接)自己保存的标签
+type tagSet struct {
+	lock sync.RWMutex
+	tags map[string]string
+}
+
+func (ts *tagSet) set(key, value string) {
+	ts.lock.Lock()
+	defer ts.lock.Unlock()
+
+	if ts.tags == nil {
+		ts.tags = make(map[string]string)
+	}
+	ts.tags[key] = value
+}
+
+func (ts *tagSet) get(key string) (string, bool) {
+	ts.lock.RLock()
+	defer ts.lock.RUnlock()
+
+	value, ok := ts.tags[key]
+	return value, ok
+}
+
+func (ts *tagSet) remove(key string) {
+	ts.lock.Lock()
+	defer ts.lock.Unlock()
+
+	delete(ts.tags, key)
+}
@@ -0,0 +1,36 @@
+/**
+* @File: conn_value.go
+* @Author: Jason Woo
+* @Date: 2026/10/16 13:12
+**/
+
+package fastnet
+
+// 链接级别的类型化数据：在链接属性之上提供泛型的存取方法，保存会话、认证信息等结构化状态时不需要手动做类型断言:
+//
+//	SetConnValue(conn, "session", &Session{UserID: 1})
+//	session, ok := GetConnValue[*Session](conn, "session")
+//
+// 与SetProperty/GetProperty共用同一份存储，链接停止并执行完OnConnStop之后所有属性被清空
+
+// SetConnValue 将val保存为链接的属性key
+func SetConnValue[T any](conn IConnection, key string, val T) {
+	conn.SetProperty(key, val)
+}
+
+// GetConnValue 获取链接的属性key，属性不存在或类型不是T时返回T的零值和false
+func GetConnValue[T any](conn IConnection, key string) (T, bool) {
+	var zero T
+
+	value, err := conn.GetProperty(key)
+	if err != nil {
+		return zero, false
+	}
+
+	val, ok := value.(T)
+	if !ok {
+		return zero, false
+	}
+
+	return val, true
+}
@@ -0,0 +1,57 @@
+/**
+* @File: conn_value_test.go
+* @Author: Jason Woo
+* @Date: 2026/10/16 13:12
+**/
+
+package fastnet
+
+import (
+	"net"
+	"testing"
+)
+
+type testSession struct {
+	UserID uint64
+}
+
+func TestConnValue(t *testing.T) {
+	s := NewServer().(*Server)
+	var inStop bool
+	s.SetOnConnStop(func(conn IConnection) {
+		_, inStop = GetConnValue[*testSession](conn, "session")
+	})
+
+	local, remote := net.Pipe()
+	defer func() { _ = remote.Close() }()
+	conn := newServerConn(s, local, 1).(*Connection)
+
+	SetConnValue(conn, "session", &testSession{UserID: 42})
+	SetConnValue(conn, "count", 3)
+
+	session, ok := GetConnValue[*testSession](conn, "session")
+	if !ok || session.UserID != 42 {
+		t.Fatalf("session = %+v, %v", session, ok)
+	}
+	if count, ok := GetConnValue[int](conn, "count"); !ok || count != 3 {
+		t.Fatalf("count = %d, %v", count, ok)
+	}
+
+	// 类型不匹配和不存在的属性都返回零值
+	if v, ok := GetConnValue[string](conn, "count"); ok || v != "" {
+		t.Fatalf("mismatched type = %q, %v", v, ok)
+	}
+	if v, ok := GetConnValue[*testSession](conn, "missing"); ok || v != nil {
+		t.Fatalf("missing value = %v, %v", v, ok)
+	}
+
+	// OnConnStop中仍然可以读取，链接停止后属性被清空
+	conn.finalizer()
+
+	if !inStop {
+		t.Fatal("value should be readable in OnConnStop")
+	}
+	if _, ok := GetConnValue[*testSession](conn, "session"); ok {
+		t.Fatal("value should be cleared after the connection stops")
+	}
+}
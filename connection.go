@@ -9,14 +9,25 @@ package fastnet
 import (
 	"context"
 	"errors"
+	"fmt"
 	"github.com/dyowoo/fastnet/xconf"
 	"github.com/dyowoo/fastnet/xlog"
 	"github.com/gorilla/websocket"
+	"io"
 	"net"
+	"net/http"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
+// SendBuffMsg等待有缓冲队列空位的时间
+const sendBuffTimeout = 5 * time.Millisecond
+
+var ErrSendBuffTimeout = errors.New("send buff msg timeout") // 有缓冲队列在超时时间内没有空位，通常是对端接收过慢
+
+// IConnection 链接
+// 所有发送方法都可以在任意协程中并发调用，每条消息都会被完整地写出，不同消息之间的字节不会交错
 type IConnection interface {
 	Start()                                      // Start 启动连接，让当前连接开始工作
 	Stop()                                       // Stop 停止连接，结束当前连接状态
@@ -26,45 +37,120 @@ type IConnection interface {
 	GetWsConn() *websocket.Conn                  // 从当前连接中获取原始的websocket连接
 	GetConnID() uint64                           // 获取当前连接ID
 	GetMsgHandler() IMsgHandle                   // 获取消息处理器
-	GetWorkerID() uint32                         // 获取workerId
+	GetWorkerID() uint32                         // 获取负责处理该链接的workerID，可配合MsgHandler().WorkerQueueDepth诊断Worker负载
 	RemoteAddr() net.Addr                        // 获取链接远程地址信息
 	LocalAddr() net.Addr                         // 获取链接本地地址信息
 	RemoteAddrString() string                    // 获取链接远程地址信息
 	LocalAddrString() string                     // 获取链接本地地址信息
+	Network() string                             // 获取链接的网络类型 tcp/unix/websocket
+	ConnectedAt() time.Time                      // 获取链接建立的时间
+	Subprotocol() string                         // 获取websocket协商的子协议，tcp链接返回""
+	RequestHeader() http.Header                  // 获取websocket建立链接时的HTTP头(服务端为请求头，客户端为响应头)的副本，tcp链接返回nil
+	GetHTTPRequestInfo() *HTTPRequestInfo        // 获取websocket升级请求的头、Cookie、查询参数等信息的副本，tcp链接和客户端链接返回nil
+	Compression() string                         // 获取握手时协商的压缩算法名称，没有压缩时返回""
 	Send(data []byte) error                      // Send 直接发送数据
 	SendToQueue(data []byte) error               // Send 发送到队列
 	SendMsg(msgID uint32, data []byte) error     // 直接将Message数据发送数据给远程的TCP客户端(无缓冲)
 	SendBuffMsg(msgID uint32, data []byte) error // 直接将Message数据发送给远程的TCP客户端(有缓冲)
+	Flush() error                                // 阻塞等待之前进入有缓冲队列的消息全部写出
+	SendMsgBatch(msgs []OutMsg) error            // 按顺序封包并一次写出多条消息，部分失败时返回*BatchSendError
+	ReadMsg() (IMessage, error)                  // 同步读取一条完整的消息，只能在握手函数中调用
 	SetProperty(key string, value interface{})   // Set connection property
 	GetProperty(key string) (interface{}, error) // Get connection property
 	RemoveProperty(key string)                   // Remove connection property
 	IsAlive() bool                               // 判断当前连接是否存活
 	SetHeartbeat(checker IHeartbeatChecker)      // 设置心跳检测器
+	Pause()                                      // 暂停读取对端数据，依靠TCP流控让对端减速，发送不受影响
+	Resume()                                     // 恢复读取对端数据
+	IsPaused() bool                              // 当前是否暂停读取
+	StartRecording(w io.Writer)                  // 开始将收到的每一帧录制到w，可通过ReplayInto回放，已经在录制时替换为新的w
+	StopRecording()                              // 停止录制，返回之后不会再写入w
+
+	// 标签，服务端链接的标签由所属的ConnManager建立索引
+	SetTag(key, value string)         // 设置标签，同一个key只保留最后一次设置的值
+	GetTag(key string) (string, bool) // 获取标签
+	RemoveTag(key string)             // 移除标签
+
+	// 有缓冲发送，队列已满时最多等待timeout，超时返回ErrSendBuffTimeout
+	SendBuffMsgWithTimeout(msgID uint32, data []byte, timeout time.Duration) error
+
+	// 流式发送大数据，从r中逐个分片读取size字节并写出，接收方还原为一条msgID的消息，发送期间持有写锁
+	SendStream(msgID uint32, r io.Reader, size int64) error
+
+	// 发送带编码类型的消息，使用带内容类型的协议头时接收方按编码类型选择编解码器，可通过SendTyped直接发送结构体
+	SendMsgWithContentType(msgID uint32, contentType ContentType, data []byte) error
+
+	// websocket帧类型，tcp链接没有帧类型
+	SendMsgWithType(messageType int, msgID uint32, data []byte) error // 使用指定的帧类型发送消息，tcp链接与SendMsg相同
+	SetWsMessageType(messageType int)                                 // 设置发送消息默认使用的帧类型(websocket.BinaryMessage/TextMessage)
+
+	// 流量统计
+	BytesRead() uint64    // 累计从对端读取的字节数，websocket链接包括帧头
+	BytesWritten() uint64 // 累计写出到对端的字节数，websocket链接包括帧头
+
+	// 关闭原因
+	StopWithReason(reason CloseReason) // 停止连接并记录关闭原因
+	CloseReason() CloseReason          // 获取链接关闭的原因，链接未关闭时返回CloseReasonNone
+
+	Kick(msgID uint32, data []byte, reason CloseReason) error // 发送最后一条消息，等待写出后以指定的原因关闭链接
+
+	// 应用层Ping，与定时心跳相互独立
+	Ping(timeout time.Duration) (time.Duration, error) // 发送Ping并等待对端回复，返回往返时间
+	RTT() time.Duration                                // 最近一次Ping测量的往返时间，没有测量过时返回0
+
+	// 发送限速
+	SetSendRateLimit(bytesPerSec int) // 限制有缓冲发送(SendBuffMsg/SendToQueue)写出的速率，小于等于0时不限制
+	SendRate() float64                // 最近一段时间写出到对端的平均速率(字节/秒)，统计间隔至少1秒
 }
 
 // Connection (用于处理Tcp连接的读写业务 一个连接对应一个Connection)
 type Connection struct {
+	bytes            byteCounter            // 当前链接的收发字节数，原子操作访问，需放在结构体开头
+	totalBytes       *byteCounter           // 所属Server的收发字节数，Client的链接为nil
 	conn             net.Conn               // 当前连接的socket TCP套接字
 	connID           uint64                 // 当前连接的ID
 	workerID         uint32                 // 负责处理该链接的workerID
 	msgHandler       IMsgHandle             // 消息管理MsgID和对应处理方法的消息管理模块
+	config           *xconf.Config          // 链接使用的配置，服务端链接为所属Server的配置，客户端链接为全局配置
 	ctx              context.Context        // 告知该链接已经退出
 	cancel           context.CancelFunc     // 停止的channel
 	msgBuffChan      chan []byte            // 有缓冲管道，用于读、写两个goroutine之间的消息通信
 	msgLock          sync.RWMutex           // 用户收发消息的Lock
+	writerOnce       sync.Once              // 保证有缓冲管道和写协程只创建一次
 	property         map[string]interface{} // 链接属性
 	propertyLock     sync.Mutex             // 保护当前property的锁
 	isClosed         bool                   // 当前连接的关闭状态
 	connManager      IConnManager           // 当前链接是属于哪个Connection Manager的
 	onConnStart      func(conn IConnection) // 当前连接创建时Hook函数
 	onConnStop       func(conn IConnection) // 当前连接断开时的Hook函数
+	onConnStopE      ConnStopReasonFunc     // 当前连接断开时带关闭原因的Hook函数
+	closeReason      closeReason            // 链接关闭的原因
+	ping             pingState              // 应用层Ping的状态
+	fragments        fragmentAssembler      // 分片消息的还原器
+	shaper           sendShaper             // 有缓冲发送的限速
 	packet           IDataPack              // 数据报文封包方式
-	lastActivityTime time.Time              // 最后一次活动时间
+	lastActivityTime atomic.Int64           // 最后一次活动时间(UnixNano)，读协程、心跳协程和Resume会并发访问
 	frameDecoder     IFrameDecoder          // 断粘包解码器
 	heartbeatChecker IHeartbeatChecker      // 心跳检测器
 	name             string                 // 链接名称，默认与创建链接的Server/Client的Name一致
 	localAddr        string                 // 当前链接的本地地址
 	remoteAddr       string                 // 当前链接的远程地址
+	connectedAt      time.Time              // 链接建立的时间
+	resumeChan       chan struct{}          // 暂停读取时不为nil，恢复读取时关闭
+	pauseLock        sync.Mutex             // 保护resumeChan
+	writeLock        sync.Mutex             // 保证同一时刻只有一个协程向socket写数据
+	handshake        HandshakeFunc          // 读循环启动之前执行的握手函数
+	handshaking      bool                   // 是否正在执行握手函数
+	rejected         bool                   // 握手失败被拒绝的链接不会触发OnConnStop
+	firstMsgPending  bool                   // 是否仍在等待对端第一条完整的消息，设置了FirstMessageTimeout时有效
+	onDecodeError    DecodeErrorFunc        // 解码失败时的回调
+	onFrameDropped   FrameDroppedFunc       // 断粘包丢弃数据时的回调
+	compressor       ICompressor            // 握手时协商的压缩算法，为nil时不压缩
+	sendProgress     flushState             // 有缓冲发送的进度，用于Flush
+	clock            clock                  // 判断链接是否存活使用的时间来源
+	tags             tagSet                 // 不属于ConnManager时链接自己保存的标签
+	recorder         frameRecorder          // 入站帧的录制，默认关闭
+	baseCtx          context.Context        // 链接上下文的父上下文，服务端链接为所属Server的上下文，为nil时使用context.Background()
 }
 
 // 创建一个Server服务端特性的连接的方法
@@ -78,21 +164,32 @@ func newServerConn(server IServer, conn net.Conn, connID uint64) IConnection {
 		name:        server.ServerName(),
 		localAddr:   conn.LocalAddr().String(),
 		remoteAddr:  conn.RemoteAddr().String(),
+		connectedAt: time.Now(),
+		clock:       systemClock,
 	}
 
-	lengthField := server.GetLengthField()
-	if lengthField != nil {
-		c.frameDecoder = NewFrameDecoder(*lengthField)
-	}
+	c.frameDecoder = newFrameDecoderFor(server.GetDecoder(), server.GetConfig())
 
 	// 从server继承过来的属性
 	c.packet = server.GetPacket()
+	c.handshake = server.GetHandshake()
 	c.onConnStart = server.GetOnConnStart()
 	c.onConnStop = server.GetOnConnStop()
+	c.onConnStopE = server.GetOnConnStopE()
+	c.onDecodeError = server.GetOnDecodeError()
+	c.onFrameDropped = server.GetOnFrameDropped()
+	if owner, ok := server.(totalBytesOwner); ok {
+		c.totalBytes = owner.totalBytes()
+	}
 	c.msgHandler = server.GetMsgHandler()
+	c.config = server.GetConfig()
+	c.fragments.config = c.config
+	c.bindFrameDropHandler()
 
 	// 将当前的Connection与Server的ConnManager绑定
 	c.connManager = server.GetConnMgr()
+	// 服务器停止时链接和请求的上下文随之取消
+	c.baseCtx = server.Context()
 
 	// 将新创建的Conn添加到链接管理中
 	server.GetConnMgr().Add(c)
@@ -111,18 +208,20 @@ func newClientConn(client IClient, conn net.Conn) IConnection {
 		name:        client.GetName(),
 		localAddr:   conn.LocalAddr().String(),
 		remoteAddr:  conn.RemoteAddr().String(),
+		connectedAt: time.Now(),
+		clock:       systemClock,
 	}
 
-	lengthField := client.GetLengthField()
-	if lengthField != nil {
-		c.frameDecoder = NewFrameDecoder(*lengthField)
-	}
+	c.frameDecoder = newFrameDecoderFor(client.GetDecoder(), client.GetConfig())
 
 	//  从client继承过来的属性
 	c.packet = client.GetPacket()
+	c.handshake = client.GetHandshake()
 	c.onConnStart = client.GetOnConnStart()
 	c.onConnStop = client.GetOnConnStop()
+	c.onConnStopE = client.GetOnConnStopE()
 	c.msgHandler = client.GetMsgHandler()
+	c.config = client.GetConfig()
 
 	return c
 }
@@ -136,14 +235,18 @@ func (c *Connection) StartWriter() {
 		select {
 		case data, ok := <-c.msgBuffChan:
 			if ok {
-				if _, err := c.conn.Write(data); err != nil {
+				if !c.shaper.wait(c.ctx, len(data)) {
+					return
+				}
+				if err := c.write(data); err != nil {
 					xlog.ErrorF("send buff data error:, %s conn writer exit", err)
-					break
+					return
 				}
+				c.sendProgress.done()
 
 			} else {
 				xlog.ErrorF("msgBuffChan is closed")
-				break
+				return
 			}
 		case <-c.ctx.Done():
 			return
@@ -151,6 +254,15 @@ func (c *Connection) StartWriter() {
 	}
 }
 
+// startWriterOnce 第一次有缓冲发送时创建有缓冲管道并启动写协程，并发的首次发送也只会创建一个
+// 没有调用有缓冲发送的链接不分配管道也不启动写协程，调用方需要持有msgLock的读锁
+func (c *Connection) startWriterOnce() {
+	c.writerOnce.Do(func() {
+		c.msgBuffChan = make(chan []byte, c.config.MaxMsgChanLen)
+		go c.StartWriter()
+	})
+}
+
 // StartReader (读消息Goroutine，用于从客户端中读取数据)
 func (c *Connection) StartReader() {
 	xlog.InfoF("[reader goroutine is running]")
@@ -162,20 +274,40 @@ func (c *Connection) StartReader() {
 		}
 	}()
 
+	// 内置的断粘包解码器会复制数据，读缓冲区可以在多次读取之间复用
+	// 一次读取尽量多的数据，其中包含的多个完整包在下一次读取之前全部解码并分发
+	reuseBuffer := copiesFrames(c.frameDecoder)
+	var buffer []byte
+	if reuseBuffer {
+		buffer = make([]byte, c.config.IOReadBuffSize)
+	}
+
 	for {
 		select {
 		case <-c.ctx.Done():
 			return
 		default:
-			buffer := make([]byte, xconf.GlobalObject.IOReadBuffSize)
+			// 暂停读取时阻塞等待恢复，未读取的数据保留在系统的接收缓冲区中
+			if !c.waitResume() {
+				return
+			}
+
+			// 没有断粘包解码器时消息直接引用读缓冲区，自定义的解码器返回的包也可能引用读缓冲区，每次读取使用新的缓冲区
+			if !reuseBuffer {
+				buffer = make([]byte, c.config.IOReadBuffSize)
+			}
 
 			// 从conn的IO中读取数据到内存缓冲buffer中
 			n, err := c.conn.Read(buffer)
 			if err != nil {
 				xlog.ErrorF("read msg head [read dataLen=%d], error = %s", n, err)
+				c.checkFirstMessageTimeout(err)
+				c.closeReason.set(readCloseReason(err))
 				return
 			}
 
+			c.addBytesRead(n)
+
 			// 正常读取到对端数据，更新心跳检测Active状态
 			if n > 0 && c.heartbeatChecker != nil {
 				c.updateActivity()
@@ -185,17 +317,24 @@ func (c *Connection) StartReader() {
 			if c.frameDecoder != nil {
 				// 为读取到的0-n个字节的数据进行解码
 				bufArrays := c.frameDecoder.Decode(buffer[0:n])
+				if c.frameAccumExceeded() || c.frameRejected() {
+					return
+				}
 				if bufArrays == nil {
 					continue
 				}
+				c.firstMessageReceived()
 				for _, bytes := range bufArrays {
-					msg := NewMessage(uint32(len(bytes)), bytes)
+					c.recorder.record(c.connID, bytes)
+					msg := AcquireMessage(uint32(len(bytes)), bytes)
 					// 得到当前客户端请求的Request数据
 					req := NewRequest(c, msg)
 					c.msgHandler.Execute(req)
 				}
 			} else {
-				msg := NewMessage(uint32(n), buffer[0:n])
+				c.firstMessageReceived()
+				c.recorder.record(c.connID, buffer[0:n])
+				msg := AcquireMessage(uint32(n), buffer[0:n])
 				// 得到当前客户端请求的Request数据
 				req := NewRequest(c, msg)
 				c.msgHandler.Execute(req)
@@ -211,7 +350,22 @@ func (c *Connection) Start() {
 			xlog.ErrorF("Connection Start() error: %v", err)
 		}
 	}()
-	c.ctx, c.cancel = context.WithCancel(context.Background())
+	baseCtx := c.baseCtx
+	if baseCtx == nil {
+		baseCtx = context.Background()
+	}
+	c.ctx, c.cancel = context.WithCancel(baseCtx)
+
+	// 首条消息的读超时同样限制握手函数中的读取
+	c.armFirstMessageDeadline()
+
+	// 在读循环启动之前完成握手，握手失败则拒绝该链接
+	if !c.doHandshake() {
+		c.closeReason.set(CloseReasonHandshakeFailed)
+		c.cancel()
+		c.finalizer()
+		return
+	}
 
 	// 按照用户传递进来的创建连接时需要处理的业务，执行钩子方法
 	c.callOnConnStart()
@@ -237,9 +391,95 @@ func (c *Connection) Start() {
 
 // Stop 停止连接，结束当前连接状态
 func (c *Connection) Stop() {
+	c.StopWithReason(CloseReasonLocal)
+}
+
+// StopWithReason 停止连接并记录关闭原因，链接已经关闭时不会覆盖之前的原因
+func (c *Connection) StopWithReason(reason CloseReason) {
+	c.closeReason.set(reason)
 	c.cancel()
 }
 
+// CloseReason 获取链接关闭的原因，链接未关闭时返回CloseReasonNone
+func (c *Connection) CloseReason() CloseReason {
+	return c.closeReason.load()
+}
+
+// SetSendRateLimit 限制有缓冲发送写出的速率，用于在带宽受限时保证多个链接之间的公平
+// 只有写协程按速率等待，队列积压时SendBuffMsg按原有逻辑超时返回错误，不会阻塞业务处理函数
+// 直接发送(SendMsg等)不受限制
+func (c *Connection) SetSendRateLimit(bytesPerSec int) {
+	c.shaper.setRate(bytesPerSec)
+}
+
+// SendRate 最近一段时间写出到对端的平均速率(字节/秒)，包括所有发送方式，两次调用间隔不足1秒时返回上一次的结果
+func (c *Connection) SendRate() float64 {
+	return c.shaper.currentRate(c.BytesWritten())
+}
+
+// Ping 发送保留的Ping控制消息并等待对端回复Pong，返回往返时间
+// 对端同样需要使用fastnet(或按相同的约定回复PongMsgID)，超时返回ErrPingTimeout
+func (c *Connection) Ping(timeout time.Duration) (time.Duration, error) {
+	return c.ping.ping(c, timeout)
+}
+
+// RTT 最近一次Ping测量的往返时间，没有测量过时返回0
+func (c *Connection) RTT() time.Duration {
+	return c.ping.lastRTT()
+}
+
+func (c *Connection) receivePong(data []byte) {
+	c.ping.pong(data)
+}
+
+func (c *Connection) receiveFragment(data []byte) (uint32, []byte, bool) {
+	return c.fragments.receive(c.connID, data)
+}
+
+// Kick 发送最后一条消息，等待写出后以指定的原因关闭链接，用于封禁、强制下线等操作
+// 有缓冲队列中尚未写出的消息会先于该消息写出，写出最多等待kickFlushTimeout，写出失败时仍然会关闭链接
+// 注意：对端仍有未被读取的数据时，关闭socket可能导致对端收到RST而丢弃最后一条消息
+func (c *Connection) Kick(msgID uint32, data []byte, reason CloseReason) error {
+	// 持有写锁期间其他协程无法发送消息，保证最后一条消息之后不会再写出数据
+	c.msgLock.Lock()
+	if c.isClosed == true {
+		c.msgLock.Unlock()
+		return errors.New("connection closed when kick")
+	}
+	err := c.flushAndWrite(msgID, data)
+	c.msgLock.Unlock()
+
+	if err != nil {
+		xlog.ErrorF("kick connID = %d, msg ID = %s, err = %+v", c.connID, msgIDString(msgID), err)
+	}
+	c.StopWithReason(reason)
+
+	return err
+}
+
+// 写出有缓冲队列中尚未发送的消息，然后写出指定的消息，需要持有msgLock
+func (c *Connection) flushAndWrite(msgID uint32, data []byte) error {
+	msg, err := c.packet.Pack(NewMsgPackage(msgID, data))
+	if err != nil {
+		return err
+	}
+
+	_ = c.conn.SetWriteDeadline(time.Now().Add(kickFlushTimeout))
+
+	// 有写协程时交给写协程写出，保证排在所有已入队的消息之后
+	if c.msgBuffChan != nil {
+		return flushFinalMsg(c.ctx, c.msgBuffChan, &c.sendProgress, msg)
+	}
+
+	c.writeLock.Lock()
+	defer c.writeLock.Unlock()
+
+	n, err := c.conn.Write(msg)
+	c.addBytesWritten(n)
+
+	return err
+}
+
 func (c *Connection) GetConnection() net.Conn {
 	return c.conn
 }
@@ -271,7 +511,7 @@ func (c *Connection) Send(data []byte) error {
 		return errors.New("connection closed when send msg")
 	}
 
-	_, err := c.conn.Write(data)
+	err := c.write(data)
 	if err != nil {
 		xlog.ErrorF("sendMsg err data = %+v, err = %+v", data, err)
 		return err
@@ -280,16 +520,34 @@ func (c *Connection) Send(data []byte) error {
 	return nil
 }
 
+// write 所有向socket写数据的操作都经过该方法，同一时刻只有一个协程在写，并发发送的消息不会交错
+func (c *Connection) write(data []byte) error {
+	c.writeLock.Lock()
+	defer c.writeLock.Unlock()
+
+	n, err := c.conn.Write(data)
+	c.addBytesWritten(n)
+	if err != nil {
+		c.closeOnWriteError(err)
+	}
+	return err
+}
+
+// 写出失败后对端收到的数据流已不完整，关闭链接，避免半死的链接继续占用链接数
+// 只取消ctx，由Start所在的协程完成关闭，调用方可以持有msgLock
+func (c *Connection) closeOnWriteError(err error) {
+	if c.cancel == nil {
+		return
+	}
+	xlog.ErrorF("connID = %d write err: %v, close conn", c.connID, err)
+	c.StopWithReason(CloseReasonWriteError)
+}
+
 func (c *Connection) SendToQueue(data []byte) error {
 	c.msgLock.RLock()
 	defer c.msgLock.RUnlock()
 
-	if c.msgBuffChan == nil {
-		c.msgBuffChan = make(chan []byte, xconf.GlobalObject.MaxMsgChanLen)
-		// 开启用于写回客户端数据流程的Goroutine
-		// 此方法只读取MsgBuffChan中的数据没调用SendBuffMsg可以分配内存和启用协程
-		go c.StartWriter()
-	}
+	c.startWriterOnce()
 
 	idleTimeout := time.NewTimer(5 * time.Millisecond)
 	defer idleTimeout.Stop()
@@ -303,8 +561,11 @@ func (c *Connection) SendToQueue(data []byte) error {
 		return errors.New("pack data is nil")
 	}
 
+	// 先记录入队再放入队列，写协程写出后的计数不会先于入队计数，放入失败时撤销
+	c.sendProgress.enqueued()
 	select {
 	case <-idleTimeout.C:
+		c.sendProgress.cancelled()
 		return errors.New("send buff msg timeout")
 	case c.msgBuffChan <- data:
 		return nil
@@ -312,7 +573,20 @@ func (c *Connection) SendToQueue(data []byte) error {
 }
 
 // SendMsg 直接将Message数据发送数据给远程的TCP客户端
+// 配置了FragmentSize时，超过该长度的数据会拆分为多个分片连续写出，对端还原后交给路由
 func (c *Connection) SendMsg(msgID uint32, data []byte) error {
+	return c.SendMsgWithContentType(msgID, ContentTypeDefault, data)
+}
+
+// SendMsgWithContentType 发送带编码类型的消息，封包方式使用带内容类型的协议头时编码类型写入包头
+// 带编码类型的消息不拆分分片，分片还原后的消息不携带编码类型
+func (c *Connection) SendMsgWithContentType(msgID uint32, contentType ContentType, data []byte) error {
+	if contentType == ContentTypeDefault {
+		if fragments := c.fragments.split(msgID, data); fragments != nil {
+			return c.SendMsgBatch(fragments)
+		}
+	}
+
 	c.msgLock.RLock()
 	defer c.msgLock.RUnlock()
 	if c.isClosed == true {
@@ -320,34 +594,116 @@ func (c *Connection) SendMsg(msgID uint32, data []byte) error {
 	}
 
 	// Pack data and send it
-	msg, err := c.packet.Pack(NewMsgPackage(msgID, data))
+	m := NewMsgPackage(msgID, data)
+	m.SetContentType(contentType)
+	msg, err := c.packet.Pack(m)
 	if err != nil {
-		xlog.ErrorF("pack error msg ID = %d", msgID)
+		xlog.ErrorF("pack error msg ID = %s", msgIDString(msgID))
 		return errors.New("pack error msg ")
 	}
 
-	_, err = c.conn.Write(msg)
+	err = c.write(msg)
 	if err != nil {
-		xlog.ErrorF("sendMsg err msg ID = %d, data = %+v, err = %+v", msgID, string(msg), err)
+		xlog.ErrorF("sendMsg err msg ID = %s, data = %+v, err = %+v", msgIDString(msgID), string(msg), err)
 		return err
 	}
 
 	return nil
 }
 
-func (c *Connection) SendBuffMsg(msgID uint32, data []byte) error {
+// ReadMsg 按照链接的封包方式同步读取一条完整的消息
+// 只能在握手函数中调用，读循环启动之后所有消息都交由路由处理
+func (c *Connection) ReadMsg() (IMessage, error) {
+	if !c.handshaking {
+		return nil, ErrReadMsgNotInHandshake
+	}
+
+	msg, err := readMsgFrom(c.conn, c.packet)
+	if err != nil {
+		return nil, err
+	}
+	c.firstMessageReceived()
+	if c.compressor == nil {
+		return msg, nil
+	}
+
+	data, err := c.decompressMsg(msg.GetData())
+	if err != nil {
+		return nil, err
+	}
+	msg.SetData(data)
+	msg.SetDataLen(uint32(len(data)))
+
+	return msg, nil
+}
+
+// SendMsgWithType tcp链接没有帧类型，与SendMsg相同
+func (c *Connection) SendMsgWithType(_ int, msgID uint32, data []byte) error {
+	return c.SendMsg(msgID, data)
+}
+
+// SetWsMessageType tcp链接没有帧类型，忽略
+func (c *Connection) SetWsMessageType(int) {}
+
+// SendMsgBatch 按顺序将多条消息封包后通过一次writev写出，减少逐条SendMsg的加锁和系统调用开销
+// 任意一条封包失败时整批都不发送，写出失败时返回的*BatchSendError记录了已完整发送的条数
+func (c *Connection) SendMsgBatch(msgs []OutMsg) error {
+	if len(msgs) == 0 {
+		return nil
+	}
+
 	c.msgLock.RLock()
 	defer c.msgLock.RUnlock()
+	if c.isClosed == true {
+		return errors.New("connection closed when send msg batch")
+	}
 
-	if c.msgBuffChan == nil {
-		c.msgBuffChan = make(chan []byte, xconf.GlobalObject.MaxMsgChanLen)
-		// 开启用于写回客户端数据流程的Goroutine
-		// 此方法只读取MsgBuffChan中的数据没调用SendBuffMsg可以分配内存和启用协程
-		go c.StartWriter()
+	packed, err := packBatch(c.packet, msgs)
+	if err != nil {
+		xlog.ErrorF("sendMsgBatch err = %+v", err)
+		return err
 	}
 
-	idleTimeout := time.NewTimer(5 * time.Millisecond)
-	defer idleTimeout.Stop()
+	c.writeLock.Lock()
+	n, err := writeBatch(c.conn, packed)
+	c.writeLock.Unlock()
+	c.addBytesWritten(int(n))
+	if err != nil {
+		xlog.ErrorF("sendMsgBatch err = %+v", err)
+		c.closeOnWriteError(err)
+		return err
+	}
+
+	return nil
+}
+
+// Flush 阻塞等待调用之前通过SendBuffMsg/SendToQueue进入有缓冲队列的消息全部写出到socket
+// 消息仍由写协程按入队顺序写出，Flush只等待不插队，设置了SetSendRateLimit时同样受限速影响
+// 适合按帧(tick)批量发送：一帧内多次SendBuffMsg只入队不阻塞业务，帧结束时Flush保证这一帧的消息都已发出
+// 没有使用过有缓冲发送时直接返回nil，链接关闭或写出失败(写出失败会关闭链接)时返回ErrFlushConnClosed
+func (c *Connection) Flush() error {
+	c.msgLock.RLock()
+	closed, ctx := c.isClosed, c.ctx
+	c.msgLock.RUnlock()
+
+	if closed || ctx == nil || ctx.Err() != nil {
+		return ErrFlushConnClosed
+	}
+
+	return c.sendProgress.wait(ctx)
+}
+
+func (c *Connection) SendBuffMsg(msgID uint32, data []byte) error {
+	return c.SendBuffMsgWithTimeout(msgID, data, sendBuffTimeout)
+}
+
+// SendBuffMsgWithTimeout 将消息放入有缓冲队列，队列已满时最多等待timeout，超时返回ErrSendBuffTimeout
+// timeout小于等于0时不等待，队列已满时立即返回，适合广播等不能被个别慢链接拖慢的场景
+func (c *Connection) SendBuffMsgWithTimeout(msgID uint32, data []byte, timeout time.Duration) error {
+	c.msgLock.RLock()
+	defer c.msgLock.RUnlock()
+
+	c.startWriterOnce()
 
 	if c.isClosed == true {
 		return errors.New("connection closed when send buff msg")
@@ -355,13 +711,31 @@ func (c *Connection) SendBuffMsg(msgID uint32, data []byte) error {
 
 	msg, err := c.packet.Pack(NewMsgPackage(msgID, data))
 	if err != nil {
-		xlog.ErrorF("pack error msg ID = %d", msgID)
+		xlog.ErrorF("pack error msg ID = %s", msgIDString(msgID))
 		return errors.New("pack error msg ")
 	}
 
+	// 先记录入队再放入队列，写协程写出后的计数不会先于入队计数，放入失败时撤销
+	c.sendProgress.enqueued()
+
+	// 队列有空位时直接放入，不创建定时器
+	select {
+	case c.msgBuffChan <- msg:
+		return nil
+	default:
+	}
+	if timeout <= 0 {
+		c.sendProgress.cancelled()
+		return ErrSendBuffTimeout
+	}
+
+	idleTimeout := time.NewTimer(timeout)
+	defer idleTimeout.Stop()
+
 	select {
 	case <-idleTimeout.C:
-		return errors.New("send buff msg timeout")
+		c.sendProgress.cancelled()
+		return ErrSendBuffTimeout
 	case c.msgBuffChan <- msg:
 		return nil
 	}
@@ -395,6 +769,39 @@ func (c *Connection) RemoveProperty(key string) {
 	delete(c.property, key)
 }
 
+func (c *Connection) clearProperties() {
+	c.propertyLock.Lock()
+	defer c.propertyLock.Unlock()
+
+	c.property = nil
+}
+
+// SetTag 设置链接的标签，服务端链接由所属的ConnManager建立索引，可通过GetByTag按标签查找
+func (c *Connection) SetTag(key, value string) {
+	if c.connManager != nil {
+		c.connManager.SetTag(c, key, value)
+		return
+	}
+	c.tags.set(key, value)
+}
+
+// GetTag 获取链接的标签
+func (c *Connection) GetTag(key string) (string, bool) {
+	if c.connManager != nil {
+		return c.connManager.GetTag(c.connID, key)
+	}
+	return c.tags.get(key)
+}
+
+// RemoveTag 移除链接的标签
+func (c *Connection) RemoveTag(key string) {
+	if c.connManager != nil {
+		c.connManager.RemoveTag(c, key)
+		return
+	}
+	c.tags.remove(key)
+}
+
 func (c *Connection) Context() context.Context {
 	return c.ctx
 }
@@ -424,11 +831,35 @@ func (c *Connection) finalizer() {
 		close(c.msgBuffChan)
 	}
 
+	// OnConnStop已经执行完，释放链接上保存的属性
+	c.clearProperties()
+
 	c.isClosed = true
 
 	xlog.InfoF("conn stop()...connID = %d", c.connID)
 }
 
+// 执行握手函数，握手失败时返回false
+func (c *Connection) doHandshake() bool {
+	if c.handshake == nil {
+		return true
+	}
+
+	c.handshaking = true
+	err := c.handshake(c)
+	c.handshaking = false
+
+	if err != nil {
+		xlog.ErrorF("connID = %d, remote = %s handshake failed: %v", c.connID, c.remoteAddr, err)
+		c.checkFirstMessageTimeout(err)
+		c.rejected = true
+		return false
+	}
+
+	// 握手函数没有通过ReadMsg读到完整的消息时，首条消息的读超时继续限制读循环
+	return true
+}
+
 func (c *Connection) callOnConnStart() {
 	if c.onConnStart != nil {
 		xlog.InfoF("callOnConnStart....")
@@ -437,22 +868,120 @@ func (c *Connection) callOnConnStart() {
 }
 
 func (c *Connection) callOnConnStop() {
+	if c.rejected {
+		return
+	}
 	if c.onConnStop != nil {
 		xlog.InfoF("callOnConnStop....")
 		c.onConnStop(c)
 	}
+	if c.onConnStopE != nil {
+		c.onConnStopE(c, c.CloseReason())
+	}
 }
 
 func (c *Connection) IsAlive() bool {
 	if c.isClosed {
 		return false
 	}
+	// 暂停读取期间无法收到对端的心跳，不应被认为已经死亡
+	if c.IsPaused() {
+		return true
+	}
 	// 检查连接最后一次活动时间，如果超过心跳间隔，则认为连接已经死亡
-	return time.Now().Sub(c.lastActivityTime) < xconf.GlobalObject.HeartbeatMaxDuration()
+	return c.clock.Now().Sub(time.Unix(0, c.lastActivityTime.Load())) < c.config.HeartbeatMaxDuration()
+}
+
+// BytesRead 累计从对端读取的字节数
+func (c *Connection) BytesRead() uint64 {
+	return c.bytes.loadRead()
+}
+
+// BytesWritten 累计写出到对端的字节数
+func (c *Connection) BytesWritten() uint64 {
+	return c.bytes.loadWritten()
+}
+
+// 记录从对端读取的字节数，同时计入所属Server的统计
+func (c *Connection) addBytesRead(n int) {
+	c.bytes.addRead(n)
+	if c.totalBytes != nil {
+		c.totalBytes.addRead(n)
+	}
+}
+
+// 记录写出到对端的字节数，同时计入所属Server的统计
+func (c *Connection) addBytesWritten(n int) {
+	c.bytes.addWritten(n)
+	if c.totalBytes != nil {
+		c.totalBytes.addWritten(n)
+	}
+}
+
+// 未设置OnFrameDropped回调时不给断粘包解码器设置handler，丢弃数据时没有额外开销
+func (c *Connection) bindFrameDropHandler() {
+	if c.onFrameDropped == nil {
+		return
+	}
+
+	if notifier, ok := c.frameDecoder.(IFrameDropNotifier); ok {
+		notifier.SetDropHandler(c.reportFrameDropped)
+	}
+}
+
+func (c *Connection) reportDecodeError(err error, raw []byte) {
+	if c.onDecodeError != nil {
+		c.onDecodeError(c.connID, err, raw)
+	}
+}
+
+func (c *Connection) reportFrameDropped(reason string) {
+	if c.onFrameDropped != nil {
+		c.onFrameDropped(c.connID, reason)
+	}
+}
+
+// 断粘包缓冲区累积的半包超过上限时返回true，通常是对端发送了包头却迟迟不发送包体
+func (c *Connection) frameAccumExceeded() bool {
+	limit := c.config.MaxFrameAccumSize()
+	buffered, ok := c.frameDecoder.(IFrameBuffered)
+	if limit <= 0 || !ok {
+		return false
+	}
+
+	if n := buffered.Buffered(); n > limit {
+		xlog.ErrorF("connID = %d, remote = %s, partial frame buffered %d bytes exceeds limit %d, close connection",
+			c.connID, c.remoteAddr, n, limit)
+		c.reportFrameDropped(fmt.Sprintf("partial frame buffered %d bytes exceeds limit %d", n, limit))
+		c.closeReason.set(CloseReasonProtocolError)
+		return true
+	}
+
+	return false
+}
+
+// 断粘包解码器判断数据不符合协议时返回true，通常是对端使用了错误的协议
+func (c *Connection) frameRejected() bool {
+	rejecter, ok := c.frameDecoder.(IFrameRejecter)
+	if !ok {
+		return false
+	}
+
+	if err := rejecter.Rejected(); err != nil {
+		xlog.ErrorF("connID = %d, remote = %s, frame rejected: %v, close connection", c.connID, c.remoteAddr, err)
+		c.reportDecodeError(err, nil)
+		c.closeReason.set(CloseReasonProtocolError)
+		return true
+	}
+
+	return false
 }
 
 func (c *Connection) updateActivity() {
-	c.lastActivityTime = time.Now()
+	c.lastActivityTime.Store(c.clock.Now().UnixNano())
+	if c.heartbeatChecker != nil {
+		c.heartbeatChecker.ResetMissedBeats()
+	}
 }
 
 func (c *Connection) SetHeartbeat(checker IHeartbeatChecker) {
@@ -467,6 +996,51 @@ func (c *Connection) RemoteAddrString() string {
 	return c.remoteAddr
 }
 
+func (c *Connection) Network() string {
+	return c.conn.LocalAddr().Network()
+}
+
+func (c *Connection) ConnectedAt() time.Time {
+	return c.connectedAt
+}
+
+func (c *Connection) Subprotocol() string {
+	return ""
+}
+
+func (c *Connection) RequestHeader() http.Header {
+	return nil
+}
+
+func (c *Connection) GetHTTPRequestInfo() *HTTPRequestInfo {
+	return nil
+}
+
+func (c *Connection) Compression() string {
+	c.msgLock.RLock()
+	defer c.msgLock.RUnlock()
+
+	if c.compressor == nil {
+		return ""
+	}
+	return c.compressor.Name()
+}
+
+// 设置协商的压缩算法，之后发送的消息都经过压缩，只在握手期间调用
+func (c *Connection) setCompressor(compressor ICompressor) error {
+	c.msgLock.Lock()
+	defer c.msgLock.Unlock()
+
+	c.compressor = compressor
+	c.packet = &compressedPack{IDataPack: c.packet, compressor: compressor}
+	return nil
+}
+
+// 解压收到的消息数据，解压后的数据不超过MaxPacketSize
+func (c *Connection) decompressMsg(data []byte) ([]byte, error) {
+	return decompressMsgData(c.compressor, data, int(c.config.MaxPacketSize))
+}
+
 func (c *Connection) GetName() string {
 	return c.name
 }
@@ -474,3 +1048,53 @@ func (c *Connection) GetName() string {
 func (c *Connection) GetMsgHandler() IMsgHandle {
 	return c.msgHandler
 }
+
+// Pause 暂停读取对端数据，正在进行中的读取会完成并继续分发
+// 暂停期间对端发送的数据保留在系统的接收缓冲区中，缓冲区满后TCP流控会使对端减速
+// 暂停期间SendMsg等发送方法不受影响，心跳检测也不会将该链接判定为死亡
+func (c *Connection) Pause() {
+	c.pauseLock.Lock()
+	defer c.pauseLock.Unlock()
+
+	if c.resumeChan == nil {
+		c.resumeChan = make(chan struct{})
+	}
+}
+
+// Resume 恢复读取对端数据
+func (c *Connection) Resume() {
+	c.pauseLock.Lock()
+	defer c.pauseLock.Unlock()
+
+	if c.resumeChan != nil {
+		close(c.resumeChan)
+		c.resumeChan = nil
+		// 重新开始计算心跳超时时间
+		c.lastActivityTime.Store(c.clock.Now().UnixNano())
+	}
+}
+
+func (c *Connection) IsPaused() bool {
+	c.pauseLock.Lock()
+	defer c.pauseLock.Unlock()
+
+	return c.resumeChan != nil
+}
+
+// 暂停读取时阻塞等待恢复，链接关闭时返回false
+func (c *Connection) waitResume() bool {
+	c.pauseLock.Lock()
+	resumeChan := c.resumeChan
+	c.pauseLock.Unlock()
+
+	if resumeChan == nil {
+		return true
+	}
+
+	select {
+	case <-resumeChan:
+		return true
+	case <-c.ctx.Done():
+		return false
+	}
+}
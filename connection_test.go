@@ -0,0 +1,93 @@
+/**
+* @File: connection_test.go
+* @Author: Jason Woo
+* @Date: 2026/10/16 14:33
+**/
+
+package fastnet
+
+import (
+	"net"
+	"testing"
+	"time"
+)
+
+func TestConnPauseResume(t *testing.T) {
+	s := NewServer().(*Server)
+	s.AddInterceptor(s.GetDecoder())
+	s.GetMsgHandler().StartWorkerPool()
+	defer s.GetMsgHandler().StopWorkerPool()
+
+	handled := make(chan uint32, 2)
+	s.AddRouterSlices(1, func(request IRequest) { handled <- 1 })
+	s.AddRouterSlices(2, func(request IRequest) { handled <- 2 })
+
+	// 启动之前暂停，读循环一开始就等待恢复
+	local, remote := net.Pipe()
+	defer func() { _ = remote.Close() }()
+	conn := newServerConn(s, local, 1).(*Connection)
+	conn.Pause()
+	if !conn.IsPaused() {
+		t.Fatal("conn is not paused")
+	}
+	go conn.Start()
+	t.Cleanup(conn.Stop)
+
+	send := func(msgID uint32) {
+		packed, _ := s.GetPacket().Pack(NewMsgPackage(msgID, []byte("data")))
+		_, _ = remote.Write(packed)
+	}
+	expect := func(msgID uint32) {
+		t.Helper()
+		select {
+		case got := <-handled:
+			if got != msgID {
+				t.Fatalf("handled msgID = %d, want %d", got, msgID)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("msgID = %d is not handled", msgID)
+		}
+	}
+
+	// 暂停期间的数据在恢复之前不会被读取
+	go send(1)
+	select {
+	case msgID := <-handled:
+		t.Fatalf("msgID = %d handled while paused", msgID)
+	case <-time.After(100 * time.Millisecond):
+	}
+	if !conn.IsAlive() {
+		t.Fatal("paused conn should be considered alive")
+	}
+
+	conn.Resume()
+	if conn.IsPaused() {
+		t.Fatal("conn is still paused after Resume")
+	}
+	expect(1)
+	send(2)
+	expect(2)
+}
+
+func TestConnStopWhilePaused(t *testing.T) {
+	s := NewServer().(*Server)
+	started, stopped := make(chan struct{}), make(chan struct{})
+	s.SetOnConnStart(func(IConnection) { close(started) })
+	s.SetOnConnStop(func(IConnection) { close(stopped) })
+
+	local, remote := net.Pipe()
+	defer func() { _ = remote.Close() }()
+	conn := newServerConn(s, local, 1).(*Connection)
+	conn.Pause()
+	go conn.Start()
+	<-started
+
+	// 读循环阻塞在等待恢复时，关闭链接不会被暂停卡住
+	conn.Stop()
+
+	select {
+	case <-stopped:
+	case <-time.After(time.Second):
+		t.Fatal("paused conn does not stop")
+	}
+}
@@ -12,9 +12,17 @@ type IDataPack interface {
 	Unpack([]byte) (IMessage, error)   // 拆包方法
 }
 
+// 内置的封包方式
+// FastDataPack 与 FastDataPackLittleEndian 的字段顺序相同，只有字节序不同；
+// FastDataPackOld 的字段顺序和字节序都与 FastDataPack 不同，用于兼容旧版协议
 const (
-	FastDataPack    string = "fastnet_pack_tlv_big_endian"
-	FastDataPackOld string = "fastnet_pack_ltv_little_endian"
+	FastDataPack             string = "fastnet_pack_tlv_big_endian"    // MsgID|DataLen|Data 大端，默认封包方式，配合NewTLVDecoder使用
+	FastDataPackLittleEndian string = "fastnet_pack_tlv_little_endian" // MsgID|DataLen|Data 小端，配合NewTLVDecoder(binary.LittleEndian)使用
+	FastDataPackOld          string = "fastnet_pack_ltv_little_endian" // DataLen|MsgID|Data 小端，配合NewLTVLittleDecoder使用
+	FastDataPackVarint       string = "fastnet_pack_varint"            // 消息ID和长度均为varint编码的紧凑包头，需配合NewVarintDecoder使用
+	FastDataPackJSON         string = "fastnet_pack_json_envelope"     // {"msgId":1,"data":...} JSON信封，只用于websocket直通模式，配合NewJSONEnvelopeDecoder使用
+	FastDataPackCRC32        string = "fastnet_pack_tlv_crc32"         // MsgID|DataLen|Data|CRC32 大端，配合NewTLVChecksumDecoder(ChecksumCRC32)使用
+	FastDataPackAdler32      string = "fastnet_pack_tlv_adler32"       // MsgID|DataLen|Data|Adler32 大端，配合NewTLVChecksumDecoder(ChecksumAdler32)使用
 )
 
 const (
@@ -0,0 +1,204 @@
+/**
+* @File: data_pack_checksum.go
+* @Author: Jason Woo
+* @Date: 2026/10/16 13:05
+**/
+
+package fastnet
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/adler32"
+	"hash/crc32"
+	"math"
+)
+
+// +---------------+---------------+---------------+---------------+
+// |    MsgID      |    DataLen    |     Data      |   Checksum    |
+// | uint32(4byte) | uint32(4byte) |     n byte    | uint32(4byte) |
+// +---------------+---------------+---------------+---------------+
+// 在TLV封包之后追加对整帧(包头和数据)的校验和，用于经过不可靠中间设备的tcp链路
+// 与FastDataPack的线上格式不兼容，需要两端同时使用，服务端配合NewTLVChecksumDecoder使用
+
+// ChecksumLen 校验和的长度
+const ChecksumLen = 4
+
+var (
+	ErrChecksumMismatch = errors.New("frame checksum mismatch")    // 整帧校验和不一致，数据在传输中被修改
+	ErrUnknownChecksum  = errors.New("unknown checksum algorithm") // 不支持的校验和算法
+)
+
+// Checksum 整帧校验和的算法
+type Checksum uint8
+
+const (
+	ChecksumCRC32   Checksum = iota + 1 // IEEE CRC32
+	ChecksumAdler32                     // Adler-32，计算比CRC32快，对短数据的检错能力较弱
+)
+
+func (c Checksum) String() string {
+	switch c {
+	case ChecksumCRC32:
+		return "crc32"
+	case ChecksumAdler32:
+		return "adler32"
+	}
+	return fmt.Sprintf("checksum(%d)", uint8(c))
+}
+
+func (c Checksum) valid() bool {
+	return c == ChecksumCRC32 || c == ChecksumAdler32
+}
+
+func (c Checksum) sum(data []byte) uint32 {
+	if c == ChecksumAdler32 {
+		return adler32.Checksum(data)
+	}
+	return crc32.ChecksumIEEE(data)
+}
+
+// 校验frame末尾的校验和，frame包含校验和
+func (c Checksum) check(frame []byte, order binary.ByteOrder) bool {
+	n := len(frame) - ChecksumLen
+	return c.sum(frame[:n]) == order.Uint32(frame[n:])
+}
+
+// DataPackChecksum 带整帧校验和的TLV封包方式
+type DataPackChecksum struct {
+	DataPack
+	checksum Checksum
+}
+
+// NewDataPackWithChecksum 带整帧校验和的封包拆包实例初始化方法，算法不支持时panic
+// order 包头和校验和的字节序，不传时使用大端
+func NewDataPackWithChecksum(checksum Checksum, order ...binary.ByteOrder) IDataPack {
+	if !checksum.valid() {
+		panic(fmt.Errorf("%w: %v", ErrUnknownChecksum, checksum))
+	}
+
+	return &DataPackChecksum{
+		DataPack: *NewDataPack(order...).(*DataPack),
+		checksum: checksum,
+	}
+}
+
+// Checksum 获取校验和的算法
+func (dp *DataPackChecksum) Checksum() Checksum {
+	return dp.checksum
+}
+
+// Pack 封包方法，在TLV帧之后追加校验和
+func (dp *DataPackChecksum) Pack(msg IMessage) ([]byte, error) {
+	frame, err := dp.DataPack.Pack(msg)
+	if err != nil {
+		return nil, err
+	}
+
+	trailer := make([]byte, ChecksumLen)
+	dp.ByteOrder().PutUint32(trailer, dp.checksum.sum(frame))
+
+	return append(frame, trailer...), nil
+}
+
+// 数据之后的校验和长度，握手时读取完整的帧用于校验
+func (dp *DataPackChecksum) trailerLen() uint32 {
+	return ChecksumLen
+}
+
+// Unpack 拆包方法
+// binaryData只有包头时只解析包头；包含完整的帧时同时校验校验和，不一致时返回ErrChecksumMismatch，返回的消息包含数据
+func (dp *DataPackChecksum) Unpack(binaryData []byte) (IMessage, error) {
+	msg, err := dp.DataPack.Unpack(binaryData)
+	if err != nil {
+		return nil, err
+	}
+
+	frameLen := uint64(defaultHeaderLen) + uint64(msg.GetDataLen()) + ChecksumLen
+	if uint64(len(binaryData)) < frameLen {
+		return msg, nil
+	}
+
+	frame := binaryData[:frameLen]
+	if !dp.checksum.check(frame, dp.ByteOrder()) {
+		return nil, ErrChecksumMismatch
+	}
+	msg.SetData(frame[defaultHeaderLen : frameLen-ChecksumLen])
+
+	return msg, nil
+}
+
+// TLVChecksumDecoder 与DataPackChecksum配套的解码器，校验和不一致的帧被丢弃并上报OnDecodeError
+type TLVChecksumDecoder struct {
+	TLVDecoder
+	checksum   Checksum
+	maxDataLen uint32 // Value的最大长度，超过时整帧被丢弃，为0时只受Length字段的取值范围限制
+}
+
+// NewTLVChecksumDecoder 带整帧校验和的TLV解码器，算法不支持时panic
+// order 包头和校验和的字节序，不传时使用大端，需与对端使用的DataPack字节序一致
+func NewTLVChecksumDecoder(checksum Checksum, order ...binary.ByteOrder) IDecoder {
+	if !checksum.valid() {
+		panic(fmt.Errorf("%w: %v", ErrUnknownChecksum, checksum))
+	}
+
+	return &TLVChecksumDecoder{
+		TLVDecoder: *NewTLVDecoder(order...).(*TLVDecoder),
+		checksum:   checksum,
+	}
+}
+
+func (cd *TLVChecksumDecoder) GetLengthField() *LengthField {
+	// Length只表示Value的长度，之后还有4字节的校验和
+	lengthField := cd.TLVDecoder.GetLengthField()
+	lengthField.MaxFrameLength = math.MaxUint32 + TlvHeaderSize + ChecksumLen
+	if cd.maxDataLen > 0 {
+		lengthField.MaxFrameLength = uint64(cd.maxDataLen) + TlvHeaderSize + ChecksumLen
+	}
+	lengthField.LengthAdjustment = ChecksumLen
+
+	return lengthField
+}
+
+func (cd *TLVChecksumDecoder) Intercept(chain IChain) IcResp {
+	message := chain.GetIMessage()
+	if message == nil {
+		return chain.ProceedWithIMessage(message, nil)
+	}
+
+	data := message.GetData()
+
+	// 读取的数据不超过包头和校验和，直接进入下一层
+	if len(data) < TlvHeaderSize+ChecksumLen {
+		return chain.ProceedWithIMessage(message, nil)
+	}
+
+	// 数据不足一个完整的包(没有经过断粘包解码器)，直接进入下一层
+	frameLen := uint64(TlvHeaderSize) + uint64(cd.byteOrder().Uint32(data[4:8])) + ChecksumLen
+	if uint64(len(data)) < frameLen {
+		return chain.ProceedWithIMessage(message, nil)
+	}
+
+	frame := data[:frameLen]
+	// 校验和不一致，丢弃该消息
+	if !cd.checksum.check(frame, cd.byteOrder()) {
+		ReportDecodeError(chain.Request(), ErrChecksumMismatch, data)
+		return nil
+	}
+
+	tlvData := cd.decode(frame[:frameLen-ChecksumLen])
+
+	// 将解码后的数据重新设置到IMessage中, Router需要MsgID来寻址
+	message.SetMsgID(tlvData.Tag)
+	message.SetData(tlvData.Value)
+	message.SetDataLen(tlvData.Length)
+
+	// 将解码后的数据进入下一层
+	return proceedDecoded(chain, message, *tlvData, &DecodeResult{
+		MsgID: tlvData.Tag,
+		Body:  tlvData.Value,
+		Raw:   frame,
+		Crc:   frame[frameLen-ChecksumLen:],
+	})
+}
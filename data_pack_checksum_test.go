@@ -0,0 +1,91 @@
+/**
+* @File: data_pack_checksum_test.go
+* @Author: Jason Woo
+* @Date: 2026/10/16 13:05
+**/
+
+package fastnet
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+func TestDataPackChecksumRoundTrip(t *testing.T) {
+	for _, kind := range []string{FastDataPackCRC32, FastDataPackAdler32} {
+		dp := Factory().NewPack(kind)
+		packed, err := dp.Pack(NewMsgPackage(7, []byte("hello")))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(packed) != TlvHeaderSize+5+ChecksumLen {
+			t.Fatalf("%s: packed len = %d", kind, len(packed))
+		}
+
+		// 只有包头时只解析包头
+		head, err := dp.Unpack(packed[:dp.GetHeadLen()])
+		if err != nil || head.GetMsgID() != 7 || head.GetDataLen() != 5 {
+			t.Fatalf("%s: Unpack head = %v, %v", kind, head, err)
+		}
+
+		msg, err := dp.Unpack(packed)
+		if err != nil || msg.GetMsgID() != 7 || string(msg.GetData()) != "hello" {
+			t.Fatalf("%s: Unpack frame = %v, %v", kind, msg, err)
+		}
+
+		msg, err = readMsgFrom(bytes.NewReader(packed), dp)
+		if err != nil || string(msg.GetData()) != "hello" {
+			t.Fatalf("%s: readMsgFrom = %v, %v", kind, msg, err)
+		}
+
+		// 修改数据中的一个字节
+		corrupted := append([]byte(nil), packed...)
+		corrupted[TlvHeaderSize] ^= 0xFF
+		if _, err = dp.Unpack(corrupted); !errors.Is(err, ErrChecksumMismatch) {
+			t.Fatalf("%s: Unpack corrupted frame err = %v", kind, err)
+		}
+		if _, err = readMsgFrom(bytes.NewReader(corrupted), dp); !errors.Is(err, ErrChecksumMismatch) {
+			t.Fatalf("%s: readMsgFrom corrupted frame err = %v", kind, err)
+		}
+	}
+}
+
+func TestTLVChecksumDecoderDropsCorruptedFrame(t *testing.T) {
+	s := NewServer().(*Server)
+	decoder := NewTLVChecksumDecoder(ChecksumCRC32)
+	var decodeErr error
+	s.SetOnDecodeError(func(connID uint64, err error, raw []byte) {
+		decodeErr = err
+	})
+
+	dp := NewDataPackWithChecksum(ChecksumCRC32)
+	good, _ := dp.Pack(NewMsgPackage(7, []byte("good")))
+	bad, _ := dp.Pack(NewMsgPackage(7, []byte("bad!")))
+	bad[len(bad)-1] ^= 0xFF
+
+	conn, _ := newPipeConn(t, s, 1)
+
+	// 断粘包解码器按长度字段加上校验和的长度断包
+	frames := newFrameDecoderFor(decoder, nil).Decode(append(bad, good...))
+	if len(frames) != 2 {
+		t.Fatalf("got %d frames, want 2", len(frames))
+	}
+
+	var handled []string
+	for _, frame := range frames {
+		capture := &captureInterceptor{}
+		request := NewRequest(conn, NewRawMessage(uint32(len(frame)), frame))
+		NewChain([]IInterceptor{decoder, capture}, 0, request).Proceed(request)
+		if capture.request != nil {
+			handled = append(handled, string(capture.request.GetData()))
+		}
+	}
+
+	if !errors.Is(decodeErr, ErrChecksumMismatch) {
+		t.Fatalf("decode error = %v, want ErrChecksumMismatch", decodeErr)
+	}
+	if len(handled) != 1 || handled[0] != "good" {
+		t.Fatalf("handled = %q, want only the good frame", handled)
+	}
+}
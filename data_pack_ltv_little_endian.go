@@ -10,11 +10,12 @@ import (
 	"bytes"
 	"encoding/binary"
 	"errors"
-	"github.com/dyowoo/fastnet/xconf"
 )
 
 // DataPackLtv 小端方式
-type DataPackLtv struct{}
+type DataPackLtv struct {
+	boundConfig
+}
 
 // NewDataPackLtv 封包拆包实例初始化方法
 func NewDataPackLtv() IDataPack {
@@ -51,7 +52,7 @@ func (dp *DataPackLtv) Unpack(binaryData []byte) (IMessage, error) {
 	dataBuff := bytes.NewReader(binaryData)
 
 	// 只解压head的信息，得到dataLen和msgID
-	msg := &Message{}
+	msg := AcquireMessage(0, nil)
 
 	if err := binary.Read(dataBuff, binary.LittleEndian, &msg.DataLen); err != nil {
 		return nil, err
@@ -62,7 +63,7 @@ func (dp *DataPackLtv) Unpack(binaryData []byte) (IMessage, error) {
 	}
 
 	// 判断dataLen的长度是否超出我们允许的最大包长度
-	if xconf.GlobalObject.MaxPacketSize > 0 && msg.GetDataLen() > xconf.GlobalObject.MaxPacketSize {
+	if maxSize := dp.conf().MaxPacketSize; maxSize > 0 && msg.GetDataLen() > maxSize {
 		return nil, errors.New("too large msg data received")
 	}
 
@@ -0,0 +1,191 @@
+/**
+* @File: data_pack_test.go
+* @Author: Jason Woo
+* @Date: 2026/10/16 18:55
+**/
+
+package fastnet
+
+import (
+	"encoding/binary"
+	"errors"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestDataPackByteOrder(t *testing.T) {
+	cases := []struct {
+		kind    string
+		order   binary.ByteOrder
+		decoder IDecoder
+	}{
+		{kind: FastDataPack, order: binary.BigEndian, decoder: NewTLVDecoder()},
+		{kind: FastDataPackLittleEndian, order: binary.LittleEndian, decoder: NewTLVDecoder(binary.LittleEndian)},
+	}
+
+	for _, c := range cases {
+		dp := Factory().NewPack(c.kind)
+		packed, err := dp.Pack(NewMsgPackage(0x01020304, []byte("hello")))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := c.order.Uint32(packed[0:4]); got != 0x01020304 {
+			t.Fatalf("%s: msgID in head = %#x", c.kind, got)
+		}
+
+		msg, err := dp.Unpack(packed)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if msg.GetMsgID() != 0x01020304 || msg.GetDataLen() != 5 {
+			t.Fatalf("%s: Unpack = (%#x, %d)", c.kind, msg.GetMsgID(), msg.GetDataLen())
+		}
+
+		frames := newFrameDecoderFor(c.decoder, nil).Decode(packed)
+		if len(frames) != 1 {
+			t.Fatalf("%s: got %d frames", c.kind, len(frames))
+		}
+		tlv := c.decoder.(*TLVDecoder).decode(frames[0])
+		if tlv.Tag != 0x01020304 || string(tlv.Value) != "hello" {
+			t.Fatalf("%s: decoded tag = %#x, value = %s", c.kind, tlv.Tag, tlv.Value)
+		}
+	}
+}
+
+func TestZeroDataPackUsesBigEndian(t *testing.T) {
+	dp := &DataPack{}
+	if dp.ByteOrder() != binary.BigEndian {
+		t.Fatalf("byte order = %v, want big endian", dp.ByteOrder())
+	}
+	data, err := dp.Pack(NewMsgPackage(1, []byte("ping")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if binary.BigEndian.Uint32(data) != 1 {
+		t.Fatalf("packed head = %x, want big endian msgID", data[:4])
+	}
+	if msg, err := dp.Unpack(data); err != nil || msg.GetMsgID() != 1 {
+		t.Fatalf("unpack = %v, %v", msg, err)
+	}
+}
+
+func TestNewMessagePackUnpack(t *testing.T) {
+	dp := NewDataPack()
+	data, err := dp.Pack(NewMessage(7, []byte("hello")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	msg, err := dp.Unpack(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if msg.GetMsgID() != 7 || msg.GetDataLen() != 5 {
+		t.Fatalf("msgID = %d, dataLen = %d, want 7, 5", msg.GetMsgID(), msg.GetDataLen())
+	}
+
+	// 旧版本NewMessage(len, data)的行为
+	raw := NewRawMessage(uint32(len(data)), data)
+	if raw.GetMsgID() != 0 || raw.GetDataLen() != uint32(len(data)) {
+		t.Fatalf("raw msgID = %d, dataLen = %d", raw.GetMsgID(), raw.GetDataLen())
+	}
+}
+
+func TestDataPackWithHeader(t *testing.T) {
+	header := ProtocolHeader{Magic: []byte("FN"), Version: 2, Accepted: []uint8{1, 2}}
+	dp := NewDataPackWithHeader(header)
+	if dp.GetHeadLen() != 11 {
+		t.Fatalf("head len = %d, want 11", dp.GetHeadLen())
+	}
+
+	packed, err := dp.Pack(NewMsgPackage(7, []byte("hello")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(packed[:3]) != "FN\x02" {
+		t.Fatalf("header prefix = %q", packed[:3])
+	}
+	msg, err := dp.Unpack(packed[:dp.GetHeadLen()])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if msg.GetMsgID() != 7 || msg.GetDataLen() != 5 || MsgVersion(msg) != 2 {
+		t.Fatalf("Unpack = (%d, %d, v%d)", msg.GetMsgID(), msg.GetDataLen(), MsgVersion(msg))
+	}
+
+	// 接受旧版本，拒绝未知版本和错误的魔数
+	old := NewDataPackWithHeader(ProtocolHeader{Magic: []byte("FN"), Version: 1})
+	oldPacked, _ := old.Pack(NewMsgPackage(7, nil))
+	if msg, err = dp.Unpack(oldPacked); err != nil || MsgVersion(msg) != 1 {
+		t.Fatalf("Unpack v1 = %v, %v", msg, err)
+	}
+	if _, err = dp.Unpack([]byte("FN\x03\x00\x00\x00\x07\x00\x00\x00\x00")); !errors.Is(err, ErrUnsupportedVersion) {
+		t.Fatalf("Unpack v3 err = %v, want ErrUnsupportedVersion", err)
+	}
+	if _, err = dp.Unpack([]byte("GET / HTTP")); !errors.Is(err, ErrBadMagic) {
+		t.Fatalf("Unpack wrong protocol err = %v, want ErrBadMagic", err)
+	}
+
+	// 断粘包解码器按包头之后的长度字段断包，第一个包头不符合时拒绝之后的所有数据
+	decoder := NewTLVDecoderWithHeader(header)
+	frameDecoder := newFrameDecoderFor(decoder, nil)
+	if frames := frameDecoder.Decode(append(append([]byte(nil), packed...), oldPacked...)); len(frames) != 2 {
+		t.Fatalf("got %d frames, want 2", len(frames))
+	}
+	frameDecoder = newFrameDecoderFor(decoder, nil)
+	if frames := frameDecoder.Decode([]byte("G")); frames != nil || frameDecoder.(IFrameRejecter).Rejected() != nil {
+		t.Fatal("incomplete header should not be rejected")
+	}
+	frameDecoder.Decode([]byte("ET / HTTP/1.1\r\n"))
+	if err = frameDecoder.(IFrameRejecter).Rejected(); !errors.Is(err, ErrBadMagic) {
+		t.Fatalf("Rejected = %v, want ErrBadMagic", err)
+	}
+}
+
+func TestHeaderDecoderRejectsWrongProtocol(t *testing.T) {
+	header := ProtocolHeader{Magic: []byte("FN"), Version: 1}
+	s := NewServer().(*Server)
+	s.SetPacket(NewDataPackWithHeader(header))
+	s.SetDecoder(NewTLVDecoderWithHeader(header))
+	s.AddInterceptor(s.GetDecoder())
+	s.GetMsgHandler().StartWorkerPool()
+	defer s.GetMsgHandler().StopWorkerPool()
+
+	versions := make(chan uint8, 1)
+	s.AddRouterSlices(1, func(request IRequest) {
+		versions <- MsgVersion(request.GetMessage())
+	})
+	stopped := make(chan CloseReason, 1)
+	s.SetOnConnStopE(func(conn IConnection, reason CloseReason) { stopped <- reason })
+
+	local, remote := net.Pipe()
+	defer remote.Close()
+	startTestConn(t, s, local, 1)
+
+	packed, _ := s.GetPacket().Pack(NewMsgPackage(1, []byte("ping")))
+	if _, err := remote.Write(packed); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case v := <-versions:
+		if v != 1 {
+			t.Fatalf("version = %d, want 1", v)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("message with a valid header is not routed")
+	}
+
+	local2, remote2 := net.Pipe()
+	defer remote2.Close()
+	startTestConn(t, s, local2, 2)
+	go func() { _, _ = remote2.Write([]byte("GET / HTTP/1.1\r\n\r\n")) }()
+
+	select {
+	case reason := <-stopped:
+		if reason != CloseReasonProtocolError {
+			t.Fatalf("reason = %s, want %s", reason, CloseReasonProtocolError)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("conn speaking the wrong protocol is not closed")
+	}
+}
@@ -10,20 +10,43 @@ import (
 	"bytes"
 	"encoding/binary"
 	"errors"
-	"github.com/dyowoo/fastnet/xconf"
+	"io"
 )
 
 var defaultHeaderLen uint32 = 8
 
-type DataPack struct{}
+// DataPack TLV封包方式 MsgID(4byte)|DataLen(4byte)|Data
+// 字节序可配置，默认为大端，通过NewDataPackWithHeader创建时包头之前有魔数和协议版本
+type DataPack struct {
+	boundConfig
+	order  binary.ByteOrder // 包头的字节序
+	header *ProtocolHeader  // 包头前缀，为nil时没有魔数和协议版本
+}
 
 // NewDataPack 封包拆包实例初始化方法
-func NewDataPack() IDataPack {
-	return &DataPack{}
+// order 包头的字节序，不传时使用大端(binary.BigEndian)，只改变字节序，不改变字段顺序
+func NewDataPack(order ...binary.ByteOrder) IDataPack {
+	dp := &DataPack{order: binary.BigEndian}
+	if len(order) > 0 && order[0] != nil {
+		dp.order = order[0]
+	}
+
+	return dp
+}
+
+// ByteOrder 获取包头的字节序，零值的DataPack使用大端
+func (dp *DataPack) ByteOrder() binary.ByteOrder {
+	if dp.order == nil {
+		return binary.BigEndian
+	}
+	return dp.order
 }
 
 // GetHeadLen 获取包头长度方法
 func (dp *DataPack) GetHeadLen() uint32 {
+	if dp.header != nil {
+		return defaultHeaderLen + uint32(dp.header.Len())
+	}
 	return defaultHeaderLen
 }
 
@@ -32,15 +55,19 @@ func (dp *DataPack) Pack(msg IMessage) ([]byte, error) {
 	// 创建一个存放bytes字节的缓冲
 	dataBuff := bytes.NewBuffer([]byte{})
 
-	if err := binary.Write(dataBuff, binary.BigEndian, msg.GetMsgID()); err != nil {
+	if dp.header != nil {
+		dp.header.write(dataBuff, msg)
+	}
+
+	if err := binary.Write(dataBuff, dp.ByteOrder(), msg.GetMsgID()); err != nil {
 		return nil, err
 	}
 
-	if err := binary.Write(dataBuff, binary.BigEndian, msg.GetDataLen()); err != nil {
+	if err := binary.Write(dataBuff, dp.ByteOrder(), msg.GetDataLen()); err != nil {
 		return nil, err
 	}
 
-	if err := binary.Write(dataBuff, binary.BigEndian, msg.GetData()); err != nil {
+	if err := binary.Write(dataBuff, dp.ByteOrder(), msg.GetData()); err != nil {
 		return nil, err
 	}
 
@@ -52,18 +79,32 @@ func (dp *DataPack) Unpack(binaryData []byte) (IMessage, error) {
 	dataBuff := bytes.NewReader(binaryData)
 
 	// 只解压head的信息，得到dataLen和msgID
-	msg := &Message{}
+	msg := AcquireMessage(0, nil)
+
+	// 先校验魔数和协议版本，对端使用了错误的协议时不再解析之后的字段
+	if dp.header != nil {
+		if len(binaryData) < dp.header.Len() {
+			return nil, io.ErrUnexpectedEOF
+		}
+		version, err := dp.header.check(binaryData)
+		if err != nil {
+			return nil, err
+		}
+		msg.version = version
+		msg.contentType = dp.header.contentType(binaryData)
+		dataBuff = bytes.NewReader(binaryData[dp.header.Len():])
+	}
 
-	if err := binary.Read(dataBuff, binary.BigEndian, &msg.ID); err != nil {
+	if err := binary.Read(dataBuff, dp.ByteOrder(), &msg.ID); err != nil {
 		return nil, err
 	}
 
-	if err := binary.Read(dataBuff, binary.BigEndian, &msg.DataLen); err != nil {
+	if err := binary.Read(dataBuff, dp.ByteOrder(), &msg.DataLen); err != nil {
 		return nil, err
 	}
 
 	// 判断dataLen的长度是否超出我们允许的最大包长度
-	if xconf.GlobalObject.MaxPacketSize > 0 && msg.GetDataLen() > xconf.GlobalObject.MaxPacketSize {
+	if maxSize := dp.conf().MaxPacketSize; maxSize > 0 && msg.GetDataLen() > maxSize {
 		return nil, errors.New("too large msg data received")
 	}
 
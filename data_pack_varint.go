@@ -0,0 +1,155 @@
+/**
+* @File: data_pack_varint.go
+* @Author: Jason Woo
+* @Date: 2026/10/16 18:10
+**/
+
+package fastnet
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+	"math"
+)
+
+// +---------------+---------------+---------------+
+// |    MsgID      |    DataLen    |     Data      |
+// | uvarint(1-5)  | uvarint(1-5)  |     n byte    |
+// +---------------+---------------+---------------+
+// 小于128的MsgID和长度只占1个字节，适合大量小消息的场景
+
+// VarintMaxHeadLen varint包头的最大长度
+const VarintMaxHeadLen = 2 * binary.MaxVarintLen32
+
+var (
+	ErrVarintOverflow = errors.New("varint value overflows uint32")   // varint的值超出uint32范围
+	ErrTooLargeMsg    = errors.New("too large msg data received")     // 数据长度超过MaxPacketSize
+	errVarintNeedMore = errors.New("varint head is not complete yet") // 包头还不完整
+)
+
+// DataPackVarint 消息ID和数据长度使用varint编码的封包方式
+// 包头长度不固定，GetHeadLen返回的是包头的最大长度，从流中拆包请使用UnpackFrom
+type DataPackVarint struct {
+	boundConfig
+}
+
+// NewDataPackVarint 封包拆包实例初始化方法
+func NewDataPackVarint() IDataPack {
+	return &DataPackVarint{}
+}
+
+// GetHeadLen 获取包头的最大长度
+func (dp *DataPackVarint) GetHeadLen() uint32 {
+	return VarintMaxHeadLen
+}
+
+// Pack 封包方法
+func (dp *DataPackVarint) Pack(msg IMessage) ([]byte, error) {
+	data := msg.GetData()
+	buf := make([]byte, 0, VarintMaxHeadLen+len(data))
+	buf = binary.AppendUvarint(buf, uint64(msg.GetMsgID()))
+	buf = binary.AppendUvarint(buf, uint64(msg.GetDataLen()))
+	buf = append(buf, data...)
+
+	return buf, nil
+}
+
+// Unpack 拆包方法，从binaryData的开头解析出包头，binaryData中可以包含包头之后的数据
+// 包头不完整时返回io.ErrUnexpectedEOF
+func (dp *DataPackVarint) Unpack(binaryData []byte) (IMessage, error) {
+	msgID, dataLen, _, err := decodeVarintHead(binaryData, dp.conf().MaxPacketSize)
+	if err == errVarintNeedMore {
+		return nil, io.ErrUnexpectedEOF
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	msg := AcquireMessage(dataLen, nil)
+	msg.ID = msgID
+	return msg, nil
+}
+
+// UnpackFrom 从流中逐字节读取包头并拆包，只读取包头，不读取数据
+func (dp *DataPackVarint) UnpackFrom(r io.ByteReader) (IMessage, error) {
+	msgID, err := readUvarint32(r)
+	if err != nil {
+		return nil, err
+	}
+
+	dataLen, err := readUvarint32(r)
+	if err == io.EOF {
+		// 已经读取了消息ID，包头不完整
+		return nil, io.ErrUnexpectedEOF
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err = checkPacketSize(dataLen, dp.conf().MaxPacketSize); err != nil {
+		return nil, err
+	}
+
+	return &Message{ID: msgID, DataLen: dataLen}, nil
+}
+
+// decodeVarintHead 从buf的开头解析varint包头，返回包头的长度，数据长度超过maxSize(大于0时)返回ErrTooLargeMsg
+// buf中的数据不足一个完整包头时返回errVarintNeedMore
+func decodeVarintHead(buf []byte, maxSize uint32) (msgID uint32, dataLen uint32, headLen int, err error) {
+	msgID, n, err := uvarint32(buf)
+	if err != nil {
+		return 0, 0, 0, err
+	}
+
+	dataLen, m, err := uvarint32(buf[n:])
+	if err != nil {
+		return 0, 0, 0, err
+	}
+
+	if err = checkPacketSize(dataLen, maxSize); err != nil {
+		return 0, 0, 0, err
+	}
+
+	return msgID, dataLen, n + m, nil
+}
+
+func uvarint32(buf []byte) (uint32, int, error) {
+	value, n := binary.Uvarint(buf)
+	if n == 0 {
+		// 数据不足时，已有的字节都带有后续标记且不超过最大长度才是真正的半包
+		if len(buf) >= binary.MaxVarintLen32 {
+			return 0, 0, ErrVarintOverflow
+		}
+		return 0, 0, errVarintNeedMore
+	}
+	if n < 0 || n > binary.MaxVarintLen32 || value > math.MaxUint32 {
+		return 0, 0, ErrVarintOverflow
+	}
+
+	return uint32(value), n, nil
+}
+
+// 从流中读取一个varint，没有读到任何字节时返回io.EOF，读到一半时返回io.ErrUnexpectedEOF
+func readUvarint32(r io.ByteReader) (uint32, error) {
+	value, err := binary.ReadUvarint(r)
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		return 0, err
+	}
+	if err != nil {
+		return 0, ErrVarintOverflow
+	}
+	if value > math.MaxUint32 {
+		return 0, ErrVarintOverflow
+	}
+
+	return uint32(value), nil
+}
+
+// 判断dataLen的长度是否超出我们允许的最大包长度，maxSize为0时不限制
+func checkPacketSize(dataLen uint32, maxSize uint32) error {
+	if maxSize > 0 && dataLen > maxSize {
+		return ErrTooLargeMsg
+	}
+	return nil
+}
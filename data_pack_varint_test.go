@@ -0,0 +1,114 @@
+/**
+* @File: data_pack_varint_test.go
+* @Author: Jason Woo
+* @Date: 2026/10/16 18:40
+**/
+
+package fastnet
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"io"
+	"math"
+	"testing"
+)
+
+func TestDataPackVarintRoundTrip(t *testing.T) {
+	dp := Factory().NewPack(FastDataPackVarint).(*DataPackVarint)
+
+	cases := []struct {
+		msgID   uint32
+		dataLen int
+		headLen int
+	}{
+		{msgID: 0, dataLen: 0, headLen: 2},
+		{msgID: 127, dataLen: 127, headLen: 2},
+		{msgID: 128, dataLen: 128, headLen: 4},
+		{msgID: math.MaxUint32, dataLen: 1, headLen: 6},
+	}
+
+	for _, c := range cases {
+		data := bytes.Repeat([]byte{'x'}, c.dataLen)
+		packed, err := dp.Pack(NewMsgPackage(c.msgID, data))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(packed) != c.headLen+c.dataLen {
+			t.Fatalf("msgID %d: packed len = %d, want %d", c.msgID, len(packed), c.headLen+c.dataLen)
+		}
+
+		msg, err := dp.Unpack(packed)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if msg.GetMsgID() != c.msgID || msg.GetDataLen() != uint32(c.dataLen) {
+			t.Fatalf("Unpack = (%d, %d), want (%d, %d)", msg.GetMsgID(), msg.GetDataLen(), c.msgID, c.dataLen)
+		}
+
+		msg, err = dp.UnpackFrom(bufio.NewReader(bytes.NewReader(packed)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if msg.GetMsgID() != c.msgID || msg.GetDataLen() != uint32(c.dataLen) {
+			t.Fatalf("UnpackFrom = (%d, %d), want (%d, %d)", msg.GetMsgID(), msg.GetDataLen(), c.msgID, c.dataLen)
+		}
+	}
+}
+
+func TestDataPackVarintBoundary(t *testing.T) {
+	dp := NewDataPackVarint()
+
+	// 包头不完整
+	if _, err := dp.Unpack([]byte{0x80}); !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := dp.(*DataPackVarint).UnpackFrom(bytes.NewReader([]byte{0x01})); !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// 超出uint32范围
+	overflow := []byte{0xff, 0xff, 0xff, 0xff, 0x7f, 0x00}
+	if _, err := dp.Unpack(overflow); !errors.Is(err, ErrVarintOverflow) {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// 超过MaxPacketSize
+	tooLarge := []byte{0x01, 0xff, 0xff, 0xff, 0xff, 0x0f}
+	if _, err := dp.Unpack(tooLarge); !errors.Is(err, ErrTooLargeMsg) {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+func TestVarintFrameDecoder(t *testing.T) {
+	dp := NewDataPackVarint()
+	var stream []byte
+	for i, size := range []int{0, 1, 200, 3} {
+		packed, _ := dp.Pack(NewMsgPackage(uint32(i+126), bytes.Repeat([]byte{byte(i)}, size)))
+		stream = append(stream, packed...)
+	}
+
+	check := func(frames [][]byte) {
+		if len(frames) != 4 {
+			t.Fatalf("got %d frames, want 4", len(frames))
+		}
+		for i, frame := range frames {
+			msgID, dataLen, headLen, err := decodeVarintHead(frame, 0)
+			if err != nil || msgID != uint32(i+126) || len(frame) != headLen+int(dataLen) {
+				t.Fatalf("frame %d: msgID = %d, len = %d, err = %v", i, msgID, len(frame), err)
+			}
+		}
+	}
+
+	// 逐字节输入
+	decoder := NewVarintDecoder().(IFrameDecoderBuilder).NewFrameDecoder()
+	var frames [][]byte
+	for _, b := range stream {
+		frames = append(frames, decoder.Decode([]byte{b})...)
+	}
+	check(frames)
+
+	// 一次输入全部数据
+	check(NewVarintDecoder().(IFrameDecoderBuilder).NewFrameDecoder().Decode(stream))
+}
@@ -6,7 +6,107 @@
 
 package fastnet
 
+import (
+	"errors"
+	"github.com/dyowoo/fastnet/xconf"
+)
+
+var ErrIncompleteFrame = errors.New("incomplete frame") // 交给解码器的数据不是一个完整的包，通常是断粘包配置与协议不一致
+
 type IDecoder interface {
 	IInterceptor
 	GetLengthField() *LengthField
 }
+
+// IFrameDecoderBuilder 帧格式无法用固定位置的LengthField描述时(例如varint长度头)，解码器可以实现该接口
+// 为每个链接创建独立的断粘包解码器，实现该接口时GetLengthField可以返回nil
+type IFrameDecoderBuilder interface {
+	NewFrameDecoder() IFrameDecoder
+}
+
+// 根据解码器为链接创建断粘包解码器，解码器为nil或没有帧格式时返回nil
+func newFrameDecoderFor(decoder IDecoder, config *xconf.Config) IFrameDecoder {
+	if decoder == nil {
+		return nil
+	}
+
+	var frameDecoder IFrameDecoder
+	if builder, ok := decoder.(IFrameDecoderBuilder); ok {
+		frameDecoder = builder.NewFrameDecoder()
+	} else if lengthField := decoder.GetLengthField(); lengthField != nil {
+		frameDecoder = NewFrameDecoder(*lengthField)
+	}
+	// 按链接所属Server或Client的配置分配缓冲区、检查包长度
+	bindConfig(frameDecoder, config)
+
+	return frameDecoder
+}
+
+// DecodeResult 解码器解码一个完整的包得到的结果，随请求沿责任链向下传递
+// 后续的拦截器和路由通过GetDecodeResult读取，不需要知道具体是哪一个解码器
+type DecodeResult struct {
+	MsgID   uint32      // 消息ID，HTLV协议为功能码
+	Body    []byte      // 消息体
+	Raw     []byte      // 解码前的完整数据
+	Crc     []byte      // CRC校验值，协议没有校验时为nil
+	Version uint8       // 协议头中的版本号，没有协议头时为0
+	Detail  interface{} // 解码器各自的解码结构，与request.GetResponse()相同，例如HtlvCrcDecoder中的头码，一般不需要使用
+}
+
+// 请求实现该接口，保存解码器设置的解码结果
+type decodeResultHolder interface {
+	setDecodeResult(result *DecodeResult)
+	getDecodeResult() *DecodeResult
+}
+
+// GetDecodeResult 获取解码器为该请求设置的解码结果，解码器没有解码该请求时ok为false
+// 内置解码器传给下一层的解码后数据(request.GetResponse())仍是各自原有的类型，例如HtlvCrcDecoder，已有的类型断言不受影响
+// 自定义解码器也可以直接将*DecodeResult作为解码后数据传给下一层
+func GetDecodeResult(request IRequest) (result *DecodeResult, ok bool) {
+	if request == nil {
+		return nil, false
+	}
+	if holder, isHolder := request.(decodeResultHolder); isHolder {
+		if result = holder.getDecodeResult(); result != nil {
+			return result, true
+		}
+	}
+
+	result, ok = request.GetResponse().(*DecodeResult)
+	return result, ok
+}
+
+// 内置解码器设置请求的解码结果后进入下一层，response为解码器原有的解码后数据
+func proceedDecoded(chain IChain, message IMessage, response IcReq, result *DecodeResult) IcResp {
+	result.Detail = response
+	if holder, ok := chain.Request().(decodeResultHolder); ok {
+		holder.setDecodeResult(result)
+	}
+
+	return chain.ProceedWithIMessage(message, response)
+}
+
+// DecodeErrorFunc 解码器解码失败时的回调，raw为解码失败的原始数据，回调中不应长期持有raw
+type DecodeErrorFunc func(connID uint64, err error, raw []byte)
+
+// FrameDroppedFunc 断粘包时丢弃数据的回调，reason为丢弃的原因
+type FrameDroppedFunc func(connID uint64, reason string)
+
+// 链接实现该接口，将解码事件上报给Server设置的回调
+type decodeEventReporter interface {
+	reportDecodeError(err error, raw []byte)
+	reportFrameDropped(reason string)
+}
+
+// ReportDecodeError 供解码器在解码失败时调用，request为chain.Request()
+// 未设置OnDecodeError回调时不做任何事情
+func ReportDecodeError(request IcReq, err error, raw []byte) {
+	req, ok := request.(IRequest)
+	if !ok || req.GetConnection() == nil {
+		return
+	}
+
+	if reporter, ok := req.GetConnection().(decodeEventReporter); ok {
+		reporter.reportDecodeError(err, raw)
+	}
+}
@@ -0,0 +1,177 @@
+/**
+* @File: decoder_config.go
+* @Author: Jason Woo
+* @Date: 2026/10/16 12:07
+**/
+
+package fastnet
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"github.com/dyowoo/fastnet/xconf"
+	"math"
+	"strings"
+)
+
+var ErrInvalidDecoderConfig = errors.New("invalid decoder config") // 配置文件中的解码器参数不合法
+
+// LengthFieldDecoder 由LengthField描述长度字段的通用解码器，只负责断粘包
+// 帧没有消息ID，交给MsgID为0的路由处理，也可以在后续的拦截器中设置MsgID
+type LengthFieldDecoder struct {
+	lengthField LengthField
+}
+
+func NewLengthFieldDecoder(lf LengthField) IDecoder {
+	return &LengthFieldDecoder{lengthField: lf}
+}
+
+func (ld *LengthFieldDecoder) GetLengthField() *LengthField {
+	lf := ld.lengthField
+	return &lf
+}
+
+// Intercept 帧本身就是消息数据，直接进入下一层
+func (ld *LengthFieldDecoder) Intercept(chain IChain) IcResp {
+	return chain.ProceedWithIMessage(chain.GetIMessage(), nil)
+}
+
+// NewDecoderFromConfig 根据配置中的Decoder及其参数创建解码器，参数组合不合法时返回ErrInvalidDecoderConfig
+// Decoder为none时返回nil，不使用解码器
+func NewDecoderFromConfig(config *xconf.Config) (IDecoder, error) {
+	order, err := parseByteOrder(config.DecoderByteOrder)
+	if err != nil {
+		return nil, err
+	}
+
+	name := strings.ToLower(config.Decoder)
+	if name != xconf.DecoderLengthField && (config.LengthFieldOffset != 0 || config.LengthFieldLength != 0 ||
+		config.LengthAdjustment != 0 || config.InitialBytesToStrip != 0) {
+		return nil, fmt.Errorf("%w: length field parameters require decoder %q, got %q",
+			ErrInvalidDecoderConfig, xconf.DecoderLengthField, config.Decoder)
+	}
+	if config.DecoderByteOrder != "" && !decoderUsesByteOrder(name) {
+		return nil, fmt.Errorf("%w: DecoderByteOrder is not used by decoder %q", ErrInvalidDecoderConfig, config.Decoder)
+	}
+	if name != xconf.DecoderFixed && config.FixedFrameSize != 0 {
+		return nil, fmt.Errorf("%w: FixedFrameSize requires decoder %q, got %q",
+			ErrInvalidDecoderConfig, xconf.DecoderFixed, config.Decoder)
+	}
+
+	switch name {
+	case xconf.DecoderNone:
+		return nil, nil
+	case "", xconf.DecoderTLV:
+		return NewTLVDecoder(order), nil
+	case xconf.DecoderLTV:
+		return NewLTVLittleDecoder(), nil
+	case xconf.DecoderHTLVCRC:
+		return NewHTLVCRCDecoder(), nil
+	case xconf.DecoderTLVCRC32:
+		return newTLVChecksumDecoderFromConfig(config, ChecksumCRC32, order), nil
+	case xconf.DecoderTLVAdler32:
+		return newTLVChecksumDecoderFromConfig(config, ChecksumAdler32, order), nil
+	case xconf.DecoderVarint:
+		return NewVarintDecoder(), nil
+	case xconf.DecoderLengthField:
+		return newLengthFieldDecoderFromConfig(config, order)
+	case xconf.DecoderDelimiter:
+		if config.FrameDelimiter == "" {
+			return nil, fmt.Errorf("%w: FrameDelimiter is empty", ErrInvalidDecoderConfig)
+		}
+		return NewDelimiterDecoder([]byte(config.FrameDelimiter)), nil
+	case xconf.DecoderFixed:
+		if config.FixedFrameSize <= 0 {
+			return nil, fmt.Errorf("%w: FixedFrameSize = %d, must be positive", ErrInvalidDecoderConfig, config.FixedFrameSize)
+		}
+		if config.MaxPacketSize > 0 && uint32(config.FixedFrameSize) > config.MaxPacketSize {
+			return nil, fmt.Errorf("%w: FixedFrameSize = %d exceeds MaxPacketSize = %d",
+				ErrInvalidDecoderConfig, config.FixedFrameSize, config.MaxPacketSize)
+		}
+		return NewFixedLengthDecoder(config.FixedFrameSize), nil
+	}
+
+	return nil, fmt.Errorf("%w: unknown decoder %q", ErrInvalidDecoderConfig, config.Decoder)
+}
+
+// ltv固定为小端，htlv-crc和varint没有多字节的定长字段，分隔符和定长解码器不解析长度，只有以下解码器按DecoderByteOrder解析
+func decoderUsesByteOrder(name string) bool {
+	switch name {
+	case "", xconf.DecoderTLV, xconf.DecoderTLVCRC32, xconf.DecoderTLVAdler32, xconf.DecoderLengthField:
+		return true
+	}
+	return false
+}
+
+// 校验和解码器的最大帧长度由MaxPacketSize决定，超过的帧在读入缓冲区之前就被丢弃
+func newTLVChecksumDecoderFromConfig(config *xconf.Config, checksum Checksum, order binary.ByteOrder) IDecoder {
+	decoder := NewTLVChecksumDecoder(checksum, order).(*TLVChecksumDecoder)
+	decoder.maxDataLen = config.MaxPacketSize
+
+	return decoder
+}
+
+// 创建与解码器线上格式一致的封包方式，例如校验和解码器对应同一算法和字节序的校验和封包
+// 其他解码器使用默认的TLV封包方式
+func newPacketForDecoder(decoder IDecoder) IDataPack {
+	switch d := decoder.(type) {
+	case *TLVChecksumDecoder:
+		return NewDataPackWithChecksum(d.checksum, d.byteOrder())
+	case *TLVDecoder:
+		return NewDataPack(d.byteOrder())
+	}
+
+	return Factory().NewPack(FastDataPack)
+}
+
+func newLengthFieldDecoderFromConfig(config *xconf.Config, order binary.ByteOrder) (IDecoder, error) {
+	switch config.LengthFieldLength {
+	case 1, 2, 3, 4, 8:
+	default:
+		return nil, fmt.Errorf("%w: LengthFieldLength = %d (expected: 1, 2, 3, 4, or 8)",
+			ErrInvalidDecoderConfig, config.LengthFieldLength)
+	}
+	if config.LengthFieldOffset < 0 {
+		return nil, fmt.Errorf("%w: LengthFieldOffset = %d, must not be negative", ErrInvalidDecoderConfig, config.LengthFieldOffset)
+	}
+	if config.InitialBytesToStrip < 0 {
+		return nil, fmt.Errorf("%w: InitialBytesToStrip = %d, must not be negative", ErrInvalidDecoderConfig, config.InitialBytesToStrip)
+	}
+
+	lengthFieldEnd := config.LengthFieldOffset + config.LengthFieldLength
+	if lengthFieldEnd+config.LengthAdjustment < 0 {
+		return nil, fmt.Errorf("%w: LengthAdjustment = %d makes frame shorter than the length field",
+			ErrInvalidDecoderConfig, config.LengthAdjustment)
+	}
+
+	// 帧的最大长度为长度字段之前的部分、长度字段、长度之外的附加部分加上MaxPacketSize，没有设置MaxPacketSize时不限制
+	maxFrameLength := math.MaxUint32 + uint64(lengthFieldEnd)
+	if config.MaxPacketSize > 0 {
+		maxFrameLength = uint64(config.MaxPacketSize) + uint64(lengthFieldEnd)
+		if config.LengthAdjustment > 0 {
+			maxFrameLength += uint64(config.LengthAdjustment)
+		}
+	}
+
+	return NewLengthFieldDecoder(LengthField{
+		Order:               order,
+		MaxFrameLength:      maxFrameLength,
+		LengthFieldOffset:   config.LengthFieldOffset,
+		LengthFieldLength:   config.LengthFieldLength,
+		LengthAdjustment:    config.LengthAdjustment,
+		InitialBytesToStrip: config.InitialBytesToStrip,
+	}), nil
+}
+
+// 解析配置中的字节序，为空时使用大端
+func parseByteOrder(order string) (binary.ByteOrder, error) {
+	switch strings.ToLower(order) {
+	case "", "big":
+		return binary.BigEndian, nil
+	case "little":
+		return binary.LittleEndian, nil
+	}
+
+	return nil, fmt.Errorf("%w: unknown byte order %q (expected: big or little)", ErrInvalidDecoderConfig, order)
+}
@@ -0,0 +1,140 @@
+/**
+* @File: decoder_config_test.go
+* @Author: Jason Woo
+* @Date: 2026/10/16 12:07
+**/
+
+package fastnet
+
+import (
+	"encoding/binary"
+	"errors"
+	"github.com/dyowoo/fastnet/xconf"
+	"testing"
+)
+
+func TestNewDecoderFromConfigInvalid(t *testing.T) {
+	cases := map[string]xconf.Config{
+		"unknown decoder":        {Decoder: "protobuf"},
+		"unknown byte order":     {Decoder: xconf.DecoderTLV, DecoderByteOrder: "middle"},
+		"bad length size":        {Decoder: xconf.DecoderLengthField, LengthFieldLength: 5},
+		"negative strip":         {Decoder: xconf.DecoderLengthField, LengthFieldLength: 2, InitialBytesToStrip: -1},
+		"length params with tlv": {Decoder: xconf.DecoderTLV, LengthFieldLength: 2},
+		"empty delimiter":        {Decoder: xconf.DecoderDelimiter},
+		"zero frame size":        {Decoder: xconf.DecoderFixed},
+		"frame size too large":   {Decoder: xconf.DecoderFixed, FixedFrameSize: 100, MaxPacketSize: 10},
+		"byte order with ltv":    {Decoder: xconf.DecoderLTV, DecoderByteOrder: "big"},
+		"byte order with htlv":   {Decoder: xconf.DecoderHTLVCRC, DecoderByteOrder: "little"},
+		"byte order with varint": {Decoder: xconf.DecoderVarint, DecoderByteOrder: "little"},
+	}
+
+	for name, config := range cases {
+		config := config
+		if _, err := NewDecoderFromConfig(&config); !errors.Is(err, ErrInvalidDecoderConfig) {
+			t.Errorf("%s: err = %v, want ErrInvalidDecoderConfig", name, err)
+		}
+	}
+}
+
+func TestLengthFieldDecoderFromConfig(t *testing.T) {
+	// Length(2字节小端) + Value
+	decoder, err := NewDecoderFromConfig(&xconf.Config{
+		Decoder:             xconf.DecoderLengthField,
+		DecoderByteOrder:    "little",
+		LengthFieldLength:   2,
+		InitialBytesToStrip: 2,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	frame := make([]byte, 2, 7)
+	binary.LittleEndian.PutUint16(frame, 5)
+	frame = append(frame, "hello"...)
+
+	frames := newFrameDecoderFor(decoder, nil).Decode(append(frame, frame[:3]...))
+	if len(frames) != 1 || string(frames[0]) != "hello" {
+		t.Fatalf("frames = %q, want [hello]", frames)
+	}
+
+	// 最大帧长度受MaxPacketSize限制
+	decoder, err = NewDecoderFromConfig(&xconf.Config{
+		Decoder:           xconf.DecoderLengthField,
+		LengthFieldLength: 4,
+		MaxPacketSize:     1024,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := decoder.GetLengthField().MaxFrameLength; got != 1024+4 {
+		t.Fatalf("MaxFrameLength = %d, want %d", got, 1024+4)
+	}
+}
+
+func TestDelimiterAndFixedDecoderFromConfig(t *testing.T) {
+	decoder, err := NewDecoderFromConfig(&xconf.Config{Decoder: xconf.DecoderDelimiter, FrameDelimiter: "\r\n"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	frameDecoder := newFrameDecoderFor(decoder, nil)
+	// 分隔符被拆分在两次读取中
+	frames := frameDecoder.Decode([]byte("ping\r"))
+	frames = append(frames, frameDecoder.Decode([]byte("\npong\r\nrest"))...)
+	if len(frames) != 2 || string(frames[0]) != "ping" || string(frames[1]) != "pong" {
+		t.Fatalf("delimiter frames = %q, want [ping pong]", frames)
+	}
+	if n := frameDecoder.(IFrameBuffered).Buffered(); n != 4 {
+		t.Fatalf("buffered = %d, want 4", n)
+	}
+
+	decoder, err = NewDecoderFromConfig(&xconf.Config{Decoder: xconf.DecoderFixed, FixedFrameSize: 3})
+	if err != nil {
+		t.Fatal(err)
+	}
+	frames = newFrameDecoderFor(decoder, nil).Decode([]byte("abcdefg"))
+	if len(frames) != 2 || string(frames[0]) != "abc" || string(frames[1]) != "def" {
+		t.Fatalf("fixed frames = %q, want [abc def]", frames)
+	}
+}
+
+func TestServerDecoderFromConfig(t *testing.T) {
+	config := *xconf.GlobalObject
+	config.HideLogo = true
+	config.DecoderByteOrder = "little"
+
+	s := newServerWithConfig(&config).(*Server)
+	tlv, ok := s.GetDecoder().(*TLVDecoder)
+	if !ok || tlv.byteOrder() != binary.LittleEndian {
+		t.Fatalf("decoder = %#v, want little endian TLVDecoder", s.GetDecoder())
+	}
+	if dp, ok := s.GetPacket().(*DataPack); !ok || dp.order != binary.LittleEndian {
+		t.Fatalf("packet = %#v, want little endian DataPack", s.GetPacket())
+	}
+
+	// 校验和解码器使用同一算法的校验和封包，最大帧长度由MaxPacketSize决定
+	config.Decoder = xconf.DecoderTLVAdler32
+	config.MaxPacketSize = 1024
+	s = newServerWithConfig(&config).(*Server)
+	dp, ok := s.GetPacket().(*DataPackChecksum)
+	if !ok || dp.Checksum() != ChecksumAdler32 || dp.order != binary.LittleEndian {
+		t.Fatalf("packet = %#v, want little endian adler32 DataPackChecksum", s.GetPacket())
+	}
+	if got := s.GetDecoder().GetLengthField().MaxFrameLength; got != 1024+TlvHeaderSize+ChecksumLen {
+		t.Fatalf("MaxFrameLength = %d, want %d", got, 1024+TlvHeaderSize+ChecksumLen)
+	}
+	frame, err := s.GetPacket().Pack(NewMsgPackage(1, []byte("ping")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.GetPacket().Unpack(frame); err != nil {
+		t.Fatal(err)
+	}
+
+	config.Decoder = "unknown"
+	defer func() {
+		if recover() == nil {
+			t.Fatal("newServerWithConfig should panic on invalid decoder config")
+		}
+	}()
+	newServerWithConfig(&config)
+}
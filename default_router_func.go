@@ -7,60 +7,68 @@
 package fastnet
 
 import (
-	"bytes"
-	"fmt"
 	"github.com/dyowoo/fastnet/xlog"
-	"path"
-	"runtime"
-	"strings"
+	"runtime/debug"
 	"time"
 )
 
 const (
-	StackBegin = 3 // 开始追踪堆栈信息的层数
-	StackEnd   = 5 // 追踪到最后的层数
+	// StackBegin 开始追踪堆栈信息的层数
+	// Deprecated: RouterRecovery已改为通过debug.Stack()记录完整堆栈
+	StackBegin = 3
+	// StackEnd 追踪到最后的层数
+	// Deprecated: RouterRecovery已改为通过debug.Stack()记录完整堆栈
+	StackEnd = 5
 )
 
 // RouterRecovery
 // 用来存放一些RouterSlicesMode下的路由可用的默认中间件
 // 如果使用NewDefaultRouterSlicesServer方法初始化的获得的server将自带这个函数
-// 作用是接收业务执行上产生的panic并且尝试记录现场信息
+// 作用是接收业务执行上产生的panic，并将panic值和完整堆栈交给MsgHandler的panic回调(默认记录日志)
 func RouterRecovery(request IRequest) {
 	defer func() {
 		if err := recover(); err != nil {
-			panicInfo := getInfo(StackBegin)
-			xlog.ErrorF("msgId:%d handler panic: info:%s err:%v", request.GetMsgID(), panicInfo, err)
+			handleRouterPanic(request, err, debug.Stack())
 		}
-
 	}()
 
 	request.RouterSlicesNext()
 }
 
-// RouterTime 简单累计所有路由组的耗时，不启用
-func RouterTime(request IRequest) {
-	now := time.Now()
-	request.RouterSlicesNext()
-	duration := time.Since(now)
-	fmt.Println(duration.String())
-}
+// RouterRecoveryWithReply 与RouterRecovery相同，并在业务发生panic时向对端回复一条错误消息，避免对端一直等待回复
+// msgID 回复的错误消息ID
+// data  回复的错误消息内容
+func RouterRecoveryWithReply(msgID uint32, data []byte) RouterHandler {
+	return func(request IRequest) {
+		defer func() {
+			if err := recover(); err != nil {
+				handleRouterPanic(request, err, debug.Stack())
 
-func getInfo(ship int) string {
-	info := new(bytes.Buffer)
-
-	// 也可以不指定终点层数即i := ship;; i++ 通过if！ok 结束循环，但是会一直追到最底层报错信息
-	for i := ship; i <= StackEnd; i++ {
-		pc, file, lineNo, ok := runtime.Caller(i)
-		if !ok {
-			break
-		}
-		funcName := runtime.FuncForPC(pc).Name()
-		fileName := path.Base(file)
-		funcName = strings.Split(funcName, ".")[1]
+				if conn := request.GetConnection(); conn != nil {
+					if sendErr := conn.SendMsg(msgID, data); sendErr != nil {
+						xlog.ErrorF("msgId:%s send panic reply error: %v", msgIDString(request.GetMsgID()), sendErr)
+					}
+				}
+			}
+		}()
 
-		_, _ = fmt.Fprintf(info, "funcName:%s fileName:%s LineNo:%d\n", funcName, fileName, lineNo)
+		request.RouterSlicesNext()
 	}
+}
 
-	return info.String()
+// 将路由中间件捕获的panic交给链接所属MsgHandler的panic回调
+func handleRouterPanic(request IRequest, recovered interface{}, stack []byte) {
+	if conn := request.GetConnection(); conn != nil && conn.GetMsgHandler() != nil {
+		conn.GetMsgHandler().HandlePanic(request, recovered, stack)
+		return
+	}
+	DefaultPanicHandler(request, recovered, stack)
+}
 
+// RouterTime 简单累计所有路由组的耗时，不启用
+func RouterTime(request IRequest) {
+	now := time.Now()
+	request.RouterSlicesNext()
+	duration := time.Since(now)
+	xlog.InfoF("msgID = %s, router cost %s", msgIDString(request.GetMsgID()), duration)
 }
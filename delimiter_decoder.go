@@ -0,0 +1,90 @@
+/**
+* @File: delimiter_decoder.go
+* @Author: Jason Woo
+* @Date: 2026/10/16 12:07
+**/
+
+package fastnet
+
+import (
+	"bytes"
+	"sync"
+)
+
+// DelimiterDecoder 按分隔符断包的解码器，适用于文本行协议等没有长度字段的协议
+// 帧中不包含分隔符，帧没有消息ID，交给MsgID为0的路由处理，也可以在后续的拦截器中设置MsgID
+// 使用方式:
+//
+//	s.SetDecoder(NewDelimiterDecoder([]byte("\r\n")))
+type DelimiterDecoder struct {
+	delimiter []byte
+}
+
+func NewDelimiterDecoder(delimiter []byte) IDecoder {
+	return &DelimiterDecoder{delimiter: append([]byte(nil), delimiter...)}
+}
+
+// GetLengthField 分隔符协议没有长度字段，断粘包由NewFrameDecoder创建的解码器处理
+func (dd *DelimiterDecoder) GetLengthField() *LengthField {
+	return nil
+}
+
+// NewFrameDecoder 为每个链接创建按分隔符断包的解码器
+func (dd *DelimiterDecoder) NewFrameDecoder() IFrameDecoder {
+	return &DelimiterFrameDecoder{delimiter: dd.delimiter}
+}
+
+// Intercept 帧本身就是消息数据，直接进入下一层
+func (dd *DelimiterDecoder) Intercept(chain IChain) IcResp {
+	return chain.ProceedWithIMessage(chain.GetIMessage(), nil)
+}
+
+// DelimiterFrameDecoder 按分隔符断包，未收到分隔符的数据一直累积，累积的大小由链接按MaxFrameAccumSize限制
+type DelimiterFrameDecoder struct {
+	boundConfig
+	delimiter []byte
+	in        []byte
+	lock      sync.Mutex
+}
+
+// Buffered 当前累积的尚未收到分隔符的字节数
+func (d *DelimiterFrameDecoder) Buffered() int {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	return len(d.in)
+}
+
+func (d *DelimiterFrameDecoder) copiesFrames() bool { return true }
+
+func (d *DelimiterFrameDecoder) Decode(buff []byte) [][]byte {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	// 只需从上次未找到分隔符的位置继续查找
+	from := len(d.in) - len(d.delimiter) + 1
+	if from < 0 {
+		from = 0
+	}
+	if d.in == nil {
+		d.in = d.newFrameBuff()
+	}
+	d.in = append(d.in, buff...)
+	resp := make([][]byte, 0)
+
+	for {
+		idx := bytes.Index(d.in[from:], d.delimiter)
+		if idx < 0 {
+			break
+		}
+		idx += from
+
+		frame := make([]byte, idx)
+		copy(frame, d.in[:idx])
+		resp = append(resp, frame)
+		d.in = d.in[idx+len(d.delimiter):]
+		from = 0
+	}
+
+	return resp
+}
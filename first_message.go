@@ -0,0 +1,77 @@
+/**
+* @File: first_message.go
+* @Author: Jason Woo
+* @Date: 2026/10/16 13:26
+**/
+
+package fastnet
+
+import (
+	"errors"
+	"net"
+	"time"
+)
+
+// 首条消息超时：配置FirstMessageTimeout后，对端必须在建立链接之后的该时间内发送一条完整的消息(包括握手函数读取的消息)，
+// 否则以CloseReasonHandshakeTimeout关闭链接，防止慢速发送(slow-loris)的客户端长期占用链接和Bind模式下的worker
+// 通过读超时实现，收到第一条完整的消息后取消读超时，之后的空闲由心跳检测负责
+
+// 读取错误是否为读超时
+func isTimeoutErr(err error) bool {
+	var netErr net.Error
+	return errors.As(err, &netErr) && netErr.Timeout()
+}
+
+// 在握手和读循环之前设置首条消息的读超时，从链接建立时开始计时
+func (c *Connection) armFirstMessageDeadline() {
+	// 只限制服务端链接，客户端链接不属于任何ConnManager
+	timeout := c.config.FirstMessageTimeoutDuration()
+	if timeout <= 0 || c.connManager == nil {
+		return
+	}
+
+	c.firstMsgPending = true
+	_ = c.conn.SetReadDeadline(c.connectedAt.Add(timeout))
+}
+
+// 收到第一条完整的消息后取消读超时
+func (c *Connection) firstMessageReceived() {
+	if !c.firstMsgPending {
+		return
+	}
+
+	c.firstMsgPending = false
+	_ = c.conn.SetReadDeadline(time.Time{})
+}
+
+// 等待首条消息期间发生读超时时，以HandshakeTimeout作为关闭原因
+func (c *Connection) checkFirstMessageTimeout(err error) {
+	if c.firstMsgPending && isTimeoutErr(err) {
+		c.closeReason.set(CloseReasonHandshakeTimeout)
+	}
+}
+
+func (c *WsConnection) armFirstMessageDeadline() {
+	timeout := c.config.FirstMessageTimeoutDuration()
+	if timeout <= 0 || c.connManager == nil {
+		return
+	}
+
+	c.firstMsgPending = true
+	_ = c.conn.SetReadDeadline(c.connectedAt.Add(timeout))
+}
+
+func (c *WsConnection) firstMessageReceived() {
+	if !c.firstMsgPending {
+		return
+	}
+
+	c.firstMsgPending = false
+	_ = c.conn.SetReadDeadline(time.Time{})
+}
+
+func (c *WsConnection) checkFirstMessageTimeout(err error) {
+	if c.firstMsgPending && isTimeoutErr(err) {
+		c.closeReason.set(CloseReasonHandshakeTimeout)
+	}
+}
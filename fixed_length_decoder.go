@@ -0,0 +1,81 @@
+/**
+* @File: fixed_length_decoder.go
+* @Author: Jason Woo
+* @Date: 2026/10/16 12:07
+**/
+
+package fastnet
+
+import (
+	"sync"
+)
+
+// FixedLengthDecoder 按固定长度断包的解码器，每frameSize个字节为一帧
+// 帧没有消息ID，交给MsgID为0的路由处理，也可以在后续的拦截器中设置MsgID
+// 使用方式:
+//
+//	s.SetDecoder(NewFixedLengthDecoder(16))
+type FixedLengthDecoder struct {
+	frameSize int
+}
+
+func NewFixedLengthDecoder(frameSize int) IDecoder {
+	return &FixedLengthDecoder{frameSize: frameSize}
+}
+
+// GetLengthField 固定长度协议没有长度字段，断粘包由NewFrameDecoder创建的解码器处理
+func (fd *FixedLengthDecoder) GetLengthField() *LengthField {
+	return nil
+}
+
+// NewFrameDecoder 为每个链接创建按固定长度断包的解码器
+func (fd *FixedLengthDecoder) NewFrameDecoder() IFrameDecoder {
+	return &FixedLengthFrameDecoder{frameSize: fd.frameSize}
+}
+
+// Intercept 帧本身就是消息数据，直接进入下一层
+func (fd *FixedLengthDecoder) Intercept(chain IChain) IcResp {
+	return chain.ProceedWithIMessage(chain.GetIMessage(), nil)
+}
+
+// FixedLengthFrameDecoder 按固定长度断包
+type FixedLengthFrameDecoder struct {
+	boundConfig
+	frameSize int
+	in        []byte
+	lock      sync.Mutex
+}
+
+// Buffered 当前累积的尚未组成完整帧的字节数
+func (d *FixedLengthFrameDecoder) Buffered() int {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	return len(d.in)
+}
+
+func (d *FixedLengthFrameDecoder) copiesFrames() bool { return true }
+
+func (d *FixedLengthFrameDecoder) Decode(buff []byte) [][]byte {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	if d.in == nil {
+		d.in = d.newFrameBuff()
+	}
+	d.in = append(d.in, buff...)
+	resp := make([][]byte, 0)
+
+	if d.frameSize <= 0 {
+		return resp
+	}
+
+	for len(d.in) >= d.frameSize {
+		frame := make([]byte, d.frameSize)
+		copy(frame, d.in[:d.frameSize])
+		resp = append(resp, frame)
+		d.in = d.in[d.frameSize:]
+	}
+
+	return resp
+}
@@ -0,0 +1,37 @@
+/**
+* @File: fixture_test.go
+* @Author: Jason Woo
+* @Date: 2026/10/16 14:33
+**/
+
+package fastnet
+
+import (
+	"net"
+	"testing"
+)
+
+// newPipeConn 创建一个属于s、没有启动的服务端链接，返回链接和net.Pipe的对端
+// 测试结束时从ConnManager中移除链接并关闭两端
+func newPipeConn(tb testing.TB, s *Server, connID uint64) (IConnection, net.Conn) {
+	local, remote := net.Pipe()
+	conn := newServerConn(s, local, connID)
+	tb.Cleanup(func() {
+		s.GetConnMgr().Remove(conn)
+		_ = local.Close()
+		_ = remote.Close()
+	})
+
+	return conn, remote
+}
+
+// readReply 从对端按s的封包方式读取一条完整的消息，读取失败时结束测试
+func readReply(tb testing.TB, s *Server, remote net.Conn) IMessage {
+	tb.Helper()
+	msg, err := readMsgFrom(remote, s.GetPacket())
+	if err != nil {
+		tb.Fatal(err)
+	}
+
+	return msg
+}
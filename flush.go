@@ -0,0 +1,101 @@
+/**
+* @File: flush.go
+* @Author: Jason Woo
+* @Date: 2026/10/16 12:36
+**/
+
+package fastnet
+
+import (
+	"context"
+	"errors"
+	"sync"
+)
+
+var ErrFlushConnClosed = errors.New("connection closed while flushing") // 等待有缓冲队列写出期间链接关闭
+
+// flushState 有缓冲发送的进度，Flush据此等待调用之前入队的消息全部写出
+type flushState struct {
+	lock     sync.Mutex
+	queued   uint64        // 累计入队的消息数
+	written  uint64        // 写协程累计写出的消息数
+	progress chan struct{} // 有协程在等待时不为nil，写协程每写出一条消息后关闭并重置
+}
+
+// 消息即将放入有缓冲队列，需要在放入之前调用，否则写协程可能先于入队计数写出该消息
+func (f *flushState) enqueued() {
+	f.lock.Lock()
+	f.queued++
+	f.lock.Unlock()
+}
+
+// 调用enqueued之后消息没有放入队列(队列已满超时等)，撤销入队计数
+func (f *flushState) cancelled() {
+	f.lock.Lock()
+	f.queued--
+	f.notifyLocked()
+	f.lock.Unlock()
+}
+
+// 写协程写出了一条队列中的消息
+func (f *flushState) done() {
+	f.lock.Lock()
+	f.written++
+	f.notifyLocked()
+	f.lock.Unlock()
+}
+
+// 唤醒等待中的Flush，需要持有lock
+func (f *flushState) notifyLocked() {
+	if f.progress != nil {
+		close(f.progress)
+		f.progress = nil
+	}
+}
+
+// 等待调用时已经入队的消息全部写出，ctx结束(链接关闭，包括写出失败导致的关闭)时返回错误
+func (f *flushState) wait(ctx context.Context) error {
+	f.lock.Lock()
+	target := f.queued
+	f.lock.Unlock()
+
+	for {
+		f.lock.Lock()
+		// 等待期间撤销的入队不会被写出，已经没有待写出的消息时同样返回
+		if f.written >= target || f.written >= f.queued {
+			f.lock.Unlock()
+			return nil
+		}
+		if f.progress == nil {
+			f.progress = make(chan struct{})
+		}
+		progress := f.progress
+		f.lock.Unlock()
+
+		select {
+		case <-progress:
+		case <-ctx.Done():
+			return ErrFlushConnClosed
+		}
+	}
+}
+
+// 将Kick的最后一条消息放入有缓冲队列，等待写协程按入队顺序写出，最多等待kickFlushTimeout
+// 写协程可能已经取出一条消息正在等待限速或写锁，绕过写协程直接写出会让这条消息排在最后一条消息之后
+func flushFinalMsg(ctx context.Context, queue chan []byte, progress *flushState, msg []byte) error {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	ctx, cancel := context.WithTimeout(ctx, kickFlushTimeout)
+	defer cancel()
+
+	progress.enqueued()
+	select {
+	case queue <- msg:
+	case <-ctx.Done():
+		progress.cancelled()
+		return ErrSendBuffTimeout
+	}
+
+	return progress.wait(ctx)
+}
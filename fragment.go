@@ -0,0 +1,212 @@
+/**
+* @File: fragment.go
+* @Author: Jason Woo
+* @Date: 2026/10/16 12:02
+**/
+
+package fastnet
+
+import (
+	"encoding/binary"
+	"github.com/dyowoo/fastnet/xconf"
+	"github.com/dyowoo/fastnet/xlog"
+	"sync"
+	"time"
+)
+
+// 分片传输超过FragmentSize的消息，对路由透明
+// 发送方SendMsg将数据拆分为多条保留的FragmentMsgID消息连续写出，接收方全部收到后还原为原始消息再交给路由
+// 每个分片的数据以分片头开始，分片头之后是原始数据的一部分:
+//
+//	| 原始MsgID(4) | 分片组ID(4) | 分片序号(2) | 分片总数(2) | 数据 |
+//
+// 接收方只有配置了MaxFragmentedSize才会还原分片，超时未收齐的分片组会被丢弃
+
+const (
+	FragmentMsgID uint32 = 99996 // 分片消息，由框架内部处理，不会交给路由，业务不应使用
+
+	fragmentHeadLen   = 12    // 分片头长度
+	maxFragmentCount  = 65535 // 一条消息最多拆分的分片数量
+	maxPendingFragSet = 16    // 每个链接同时还原中的分片组数量上限
+)
+
+// 链接实现该接口，收到分片时交给链接的分片还原器
+type fragmentReceiver interface {
+	receiveFragment(data []byte) (msgID uint32, payload []byte, ok bool)
+}
+
+// split 按配置的FragmentSize拆分消息，不需要拆分时返回nil
+func (a *fragmentAssembler) split(msgID uint32, data []byte) []OutMsg {
+	size := int(a.conf().FragmentSize)
+	if size <= 0 || len(data) <= size {
+		return nil
+	}
+
+	total := (len(data) + size - 1) / size
+	if total > maxFragmentCount {
+		return nil
+	}
+
+	fragID := a.nextFragID()
+	msgs := make([]OutMsg, 0, total)
+	for i := 0; i < total; i++ {
+		end := (i + 1) * size
+		if end > len(data) {
+			end = len(data)
+		}
+		chunk := data[i*size : end]
+
+		frag := make([]byte, fragmentHeadLen+len(chunk))
+		binary.BigEndian.PutUint32(frag[0:], msgID)
+		binary.BigEndian.PutUint32(frag[4:], fragID)
+		binary.BigEndian.PutUint16(frag[8:], uint16(i))
+		binary.BigEndian.PutUint16(frag[10:], uint16(total))
+		copy(frag[fragmentHeadLen:], chunk)
+
+		msgs = append(msgs, OutMsg{MsgID: FragmentMsgID, Data: frag})
+	}
+
+	return msgs
+}
+
+// 还原中的分片组
+type fragmentSet struct {
+	msgID    uint32
+	total    int            // 分片总数，由对端声明
+	chunks   map[int][]byte // 已收到的分片，按收到的数量分配，不按对端声明的总数预先分配
+	size     int
+	deadline time.Time
+}
+
+// fragmentAssembler 链接的分片状态，发送时分配分片组ID，接收时还原分片组
+type fragmentAssembler struct {
+	lock   sync.Mutex
+	nextID uint32                  // 发送方下一个分片组ID
+	sets   map[uint32]*fragmentSet // 接收方还原中的分片组
+	config *xconf.Config           // 分片相关的配置，为nil时使用全局配置
+}
+
+func (a *fragmentAssembler) conf() *xconf.Config {
+	if a.config == nil {
+		return xconf.GlobalObject
+	}
+	return a.config
+}
+
+func (a *fragmentAssembler) nextFragID() uint32 {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+
+	a.nextID++
+	return a.nextID
+}
+
+// receive 收到一个分片，分片组全部收齐时返回还原后的消息
+func (a *fragmentAssembler) receive(connID uint64, data []byte) (uint32, []byte, bool) {
+	maxSize := int(a.conf().MaxFragmentedSize)
+	if maxSize <= 0 {
+		xlog.ErrorF("connID = %d, fragment received but MaxFragmentedSize is not configured, drop it", connID)
+		return 0, nil, false
+	}
+	if len(data) < fragmentHeadLen {
+		xlog.ErrorF("connID = %d, invalid fragment length %d", connID, len(data))
+		return 0, nil, false
+	}
+
+	msgID := binary.BigEndian.Uint32(data[0:])
+	fragID := binary.BigEndian.Uint32(data[4:])
+	index := int(binary.BigEndian.Uint16(data[8:]))
+	total := int(binary.BigEndian.Uint16(data[10:]))
+	chunk := data[fragmentHeadLen:]
+	// 每个分片至少携带一个字节，分片总数不会超过MaxFragmentedSize
+	if total == 0 || index >= total || total > maxSize {
+		xlog.ErrorF("connID = %d, invalid fragment %d/%d", connID, index, total)
+		return 0, nil, false
+	}
+
+	a.lock.Lock()
+	defer a.lock.Unlock()
+
+	now := time.Now()
+	a.expire(connID, now)
+
+	set, ok := a.sets[fragID]
+	if !ok {
+		if len(a.sets) >= maxPendingFragSet {
+			xlog.ErrorF("connID = %d, too many pending fragment sets, drop fragment of msgID = %s", connID, msgIDString(msgID))
+			return 0, nil, false
+		}
+		if a.sets == nil {
+			a.sets = make(map[uint32]*fragmentSet)
+		}
+		set = &fragmentSet{
+			msgID:    msgID,
+			total:    total,
+			chunks:   make(map[int][]byte),
+			deadline: now.Add(a.conf().FragmentTimeoutDuration()),
+		}
+		a.sets[fragID] = set
+	}
+
+	if set.msgID != msgID || set.total != total {
+		xlog.ErrorF("connID = %d, fragment set %d mismatch, drop it", connID, fragID)
+		delete(a.sets, fragID)
+		return 0, nil, false
+	}
+	if _, received := set.chunks[index]; received {
+		return 0, nil, false
+	}
+
+	set.size += len(chunk)
+	if set.size > maxSize {
+		xlog.ErrorF("connID = %d, fragmented msgID = %s exceeds MaxFragmentedSize %d, drop it", connID, msgIDString(msgID), maxSize)
+		delete(a.sets, fragID)
+		return 0, nil, false
+	}
+
+	// 读缓冲区会被复用，需要复制分片数据
+	set.chunks[index] = append([]byte{}, chunk...)
+	if len(set.chunks) < total {
+		return 0, nil, false
+	}
+
+	delete(a.sets, fragID)
+	payload := make([]byte, 0, set.size)
+	for i := 0; i < total; i++ {
+		payload = append(payload, set.chunks[i]...)
+	}
+
+	return msgID, payload, true
+}
+
+// 丢弃超时未收齐的分片组
+func (a *fragmentAssembler) expire(connID uint64, now time.Time) {
+	for fragID, set := range a.sets {
+		if now.After(set.deadline) {
+			xlog.ErrorF("connID = %d, fragmented msgID = %s timeout, received %d/%d, drop it",
+				connID, msgIDString(set.msgID), len(set.chunks), set.total)
+			delete(a.sets, fragID)
+		}
+	}
+}
+
+// reassembleFragment 收到分片时交给链接还原，分片组收齐时返回还原后的请求，否则返回nil
+func reassembleFragment(request IRequest) IRequest {
+	conn := request.GetConnection()
+	receiver, ok := conn.(fragmentReceiver)
+	if !ok {
+		return nil
+	}
+
+	msgID, payload, ok := receiver.receiveFragment(request.GetData())
+	if !ok {
+		return nil
+	}
+
+	reassembled := NewRequest(conn, NewMsgPackage(msgID, payload))
+	if origin, ok := request.(*Request); ok {
+		reassembled.(*Request).wsType = origin.wsType
+	}
+
+	return reassembled
+}
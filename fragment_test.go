@@ -0,0 +1,194 @@
+/**
+* @File: fragment_test.go
+* @Author: Jason Woo
+* @Date: 2026/10/16 12:02
+**/
+
+package fastnet
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"github.com/dyowoo/fastnet/xconf"
+	"io"
+	"net"
+	"testing"
+	"time"
+)
+
+// 分片相关配置与全局配置相同、只修改分片参数的配置
+func fragmentConfig(size, maxSize uint32, timeout int) *xconf.Config {
+	config := *xconf.GlobalObject
+	config.FragmentSize = size
+	config.MaxFragmentedSize = maxSize
+	config.FragmentTimeout = timeout
+
+	return &config
+}
+
+func testPayload(n int) []byte {
+	data := make([]byte, n)
+	for i := range data {
+		data[i] = byte(i)
+	}
+	return data
+}
+
+func TestFragmentedSendMsg(t *testing.T) {
+	s := NewUserConfServer(&xconf.Config{FragmentSize: 100, MaxFragmentedSize: 10000, FragmentTimeout: 1000, HideLogo: true}).(*Server)
+	s.AddInterceptor(s.GetDecoder())
+	s.GetMsgHandler().StartWorkerPool()
+	defer s.GetMsgHandler().StopWorkerPool()
+
+	received := make(chan []byte, 1)
+	s.AddRouterSlices(1, func(request IRequest) {
+		received <- request.GetData()
+	})
+
+	local, remote := net.Pipe()
+	conn := startTestConn(t, s, local, 1)
+	startTestConn(t, s, remote, 2)
+
+	payload := testPayload(1050)
+	if err := conn.SendMsg(1, payload); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case data := <-received:
+		if !bytes.Equal(data, payload) {
+			t.Fatalf("reassembled %d bytes, want %d", len(data), len(payload))
+		}
+	case <-time.After(time.Second):
+		t.Fatal("fragmented msg is not dispatched")
+	}
+}
+
+func TestSendStream(t *testing.T) {
+	s := NewUserConfServer(&xconf.Config{FragmentSize: 100, MaxFragmentedSize: 10000, FragmentTimeout: 1000, HideLogo: true}).(*Server)
+	s.AddInterceptor(s.GetDecoder())
+	s.GetMsgHandler().StartWorkerPool()
+	defer s.GetMsgHandler().StopWorkerPool()
+
+	received := make(chan []byte, 1)
+	s.AddRouterSlices(1, func(request IRequest) {
+		received <- request.GetData()
+	})
+
+	local, remote := net.Pipe()
+	conn := startTestConn(t, s, local, 1)
+	startTestConn(t, s, remote, 2)
+
+	expect := func(want []byte) {
+		t.Helper()
+		select {
+		case data := <-received:
+			if !bytes.Equal(data, want) {
+				t.Fatalf("received %d bytes, want %d", len(data), len(want))
+			}
+		case <-time.After(time.Second):
+			t.Fatal("stream msg is not dispatched")
+		}
+	}
+
+	// 超过一个分片时流式发送，不超过时与SendMsg相同
+	for _, size := range []int{1050, 60} {
+		payload := testPayload(size)
+		if err := conn.SendStream(1, bytes.NewReader(payload), int64(len(payload))); err != nil {
+			t.Fatal(err)
+		}
+		expect(payload)
+	}
+
+	// r中的数据不足时返回错误，已经写出的分片不影响之后的消息
+	short := testPayload(550)
+	if err := conn.SendStream(1, bytes.NewReader(short), 1050); !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Fatalf("short stream err = %v, want io.ErrUnexpectedEOF", err)
+	}
+	if err := conn.SendMsg(1, []byte("after")); err != nil {
+		t.Fatal(err)
+	}
+	expect([]byte("after"))
+
+	if err := conn.SendStream(1, bytes.NewReader(nil), -1); !errors.Is(err, ErrInvalidStreamSize) {
+		t.Fatalf("negative size err = %v, want ErrInvalidStreamSize", err)
+	}
+}
+
+func TestFragmentAssemblerOutOfOrder(t *testing.T) {
+	config := fragmentConfig(10, 1000, 1000)
+	sender, receiver := fragmentAssembler{config: config}, fragmentAssembler{config: config}
+	payload := testPayload(95)
+	fragments := sender.split(7, payload)
+	if len(fragments) != 10 {
+		t.Fatalf("fragment count = %d, want 10", len(fragments))
+	}
+
+	for i := len(fragments) - 1; i > 0; i-- {
+		if _, _, ok := receiver.receive(1, fragments[i].Data); ok {
+			t.Fatalf("completed before all fragments received")
+		}
+	}
+	msgID, data, ok := receiver.receive(1, fragments[0].Data)
+	if !ok || msgID != 7 || !bytes.Equal(data, payload) {
+		t.Fatalf("reassemble failed: ok = %v, msgID = %d, len = %d", ok, msgID, len(data))
+	}
+}
+
+func TestFragmentAssemblerRejectsOversizedTotal(t *testing.T) {
+	receiver := fragmentAssembler{config: &xconf.Config{MaxFragmentedSize: 100, FragmentTimeout: 1000}}
+
+	// 对端声明的分片总数超过MaxFragmentedSize时直接丢弃，不为其分配分片表
+	frag := make([]byte, fragmentHeadLen+1)
+	binary.BigEndian.PutUint32(frag[0:], 7)
+	binary.BigEndian.PutUint32(frag[4:], 1)
+	binary.BigEndian.PutUint16(frag[8:], 0)
+	binary.BigEndian.PutUint16(frag[10:], maxFragmentCount)
+	if _, _, ok := receiver.receive(1, frag); ok || len(receiver.sets) != 0 {
+		t.Fatalf("oversized fragment set accepted: ok = %v, sets = %d", ok, len(receiver.sets))
+	}
+
+	binary.BigEndian.PutUint16(frag[10:], 2)
+	receiver.receive(1, frag)
+	if set := receiver.sets[1]; set == nil || len(set.chunks) != 1 {
+		t.Fatal("valid fragment set is not kept")
+	}
+}
+
+func TestFragmentAssemblerDropsIncompleteSet(t *testing.T) {
+	config := fragmentConfig(10, 1000, 20)
+	sender, receiver := fragmentAssembler{config: config}, fragmentAssembler{config: config}
+	lost := sender.split(7, testPayload(30))
+	// 丢失最后一个分片
+	for _, fragment := range lost[:len(lost)-1] {
+		receiver.receive(1, fragment.Data)
+	}
+
+	time.Sleep(40 * time.Millisecond)
+
+	// 收到新的分片时清理超时的分片组，迟到的分片不会还原出消息
+	next := sender.split(8, testPayload(20))
+	receiver.receive(1, next[0].Data)
+	if _, ok := receiver.sets[1]; ok {
+		t.Fatal("expired fragment set is not dropped")
+	}
+	if _, _, ok := receiver.receive(1, lost[len(lost)-1].Data); ok {
+		t.Fatal("expired fragment set should not be reassembled")
+	}
+
+	msgID, data, ok := receiver.receive(1, next[1].Data)
+	if !ok || msgID != 8 || len(data) != 20 {
+		t.Fatalf("reassemble failed: ok = %v, msgID = %d, len = %d", ok, msgID, len(data))
+	}
+}
+
+func TestFragmentRejectedWithoutMaxFragmentedSize(t *testing.T) {
+	config := fragmentConfig(10, 0, 1000)
+	sender, receiver := fragmentAssembler{config: config}, fragmentAssembler{config: config}
+	for _, fragment := range sender.split(7, testPayload(20)) {
+		if _, _, ok := receiver.receive(1, fragment.Data); ok {
+			t.Fatal("fragments should be dropped when MaxFragmentedSize is 0")
+		}
+	}
+}
@@ -16,6 +16,7 @@ import (
 
 type FrameDecoder struct {
 	LengthField //从ILengthField集成的基础属性
+	boundConfig //所属链接的配置，决定缓冲区的初始容量
 
 	LengthFieldEndOffset   int   //长度字段结束位置的偏移量  LengthFieldOffset+LengthFieldLength
 	failFast               bool  //快速失败
@@ -24,6 +25,7 @@ type FrameDecoder struct {
 	bytesToDiscard         int64 //记录还剩余多少字节需要丢弃
 	in                     []byte
 	lock                   sync.Mutex
+	onDrop                 func(reason string) // 丢弃超长帧时的通知
 }
 
 func NewFrameDecoder(lf LengthField) IFrameDecoder {
@@ -42,7 +44,6 @@ func NewFrameDecoder(lf LengthField) IFrameDecoder {
 	frameDecoder.InitialBytesToStrip = lf.InitialBytesToStrip
 
 	frameDecoder.LengthFieldEndOffset = lf.LengthFieldOffset + lf.LengthFieldLength
-	frameDecoder.in = make([]byte, 0)
 
 	return frameDecoder
 }
@@ -58,7 +59,19 @@ func NewFrameDecoderByParams(maxFrameLength uint64, lengthFieldOffset, lengthFie
 	})
 }
 
+// SetDropHandler 设置丢弃超长帧时的通知
+func (d *FrameDecoder) SetDropHandler(handler func(reason string)) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	d.onDrop = handler
+}
+
 func (d *FrameDecoder) fail(frameLength int64) {
+	if d.onDrop != nil {
+		d.onDrop(fmt.Sprintf("frame length %d exceeds max frame length %d - discarded", frameLength, d.MaxFrameLength))
+	}
+
 	//丢弃完成或未完成都抛异常
 	//if frameLength > 0 {
 	//	msg := fmt.Sprintf("Adjusted frame length exceeds %d : %d - discarded", this.MaxFrameLength, frameLength)
@@ -84,28 +97,17 @@ func (d *FrameDecoder) discardingTooLongFrameFunc(buffer *bytes.Buffer) {
 }
 
 func (d *FrameDecoder) getUnadjustedFrameLength(buf *bytes.Buffer, offset int, length int, order binary.ByteOrder) int64 {
-	// 长度字段的值
+	// 长度字段的值，直接按字节序读取，避免每个包都分配临时的Buffer
 	var frameLength int64
 	arr := buf.Bytes()
 	arr = arr[offset : offset+length]
-	buffer := bytes.NewBuffer(arr)
 	switch length {
 	case 1:
 		// byte
-		var value uint8
-		err := binary.Read(buffer, order, &value)
-		if err != nil {
-			return 0
-		}
-		frameLength = int64(value)
+		frameLength = int64(arr[0])
 	case 2:
 		// short
-		var value uint16
-		err := binary.Read(buffer, order, &value)
-		if err != nil {
-			return 0
-		}
-		frameLength = int64(value)
+		frameLength = int64(order.Uint16(arr))
 	case 3:
 		// int占32位，这里取出后24位，返回int类型
 		if order == binary.LittleEndian {
@@ -117,18 +119,10 @@ func (d *FrameDecoder) getUnadjustedFrameLength(buf *bytes.Buffer, offset int, l
 		}
 	case 4:
 		// int
-		var value uint32
-		err := binary.Read(buffer, order, &value)
-		if err != nil {
-			return 0
-		}
-		frameLength = int64(value)
+		frameLength = int64(order.Uint32(arr))
 	case 8:
 		// long
-		err := binary.Read(buffer, order, &frameLength)
-		if err != nil {
-			return 0
-		}
+		frameLength = int64(order.Uint64(arr))
 	default:
 		panic(fmt.Sprintf("unsupported LengthFieldLength: %d (expected: 1, 2, 3, 4, or 8)", d.LengthFieldLength))
 	}
@@ -192,8 +186,8 @@ func (d *FrameDecoder) failOnFrameLengthLessThanInitialBytesToStrip(in *bytes.Bu
 	panic(fmt.Sprintf("adjusted frame length (%d) is less  than initialBytesToStrip: %d", frameLength, initialBytesToStrip))
 }
 
-func (d *FrameDecoder) decode(buf []byte) []byte {
-	in := bytes.NewBuffer(buf)
+// decode 从in中解码出一个完整的数据包，半包时返回nil且不消费in中的数据
+func (d *FrameDecoder) decode(in *bytes.Buffer) []byte {
 	// 丢弃模式
 	if d.discardingTooLongFrame {
 		d.discardingTooLongFrameFunc(in)
@@ -256,25 +250,40 @@ func (d *FrameDecoder) decode(buf []byte) []byte {
 	return buff
 }
 
+func (d *FrameDecoder) copiesFrames() bool { return true }
+
+// Buffered 当前累积的尚未组成完整包的字节数
+func (d *FrameDecoder) Buffered() int {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	return len(d.in)
+}
+
 func (d *FrameDecoder) Decode(buff []byte) [][]byte {
 	d.lock.Lock()
 	defer d.lock.Unlock()
 
+	// 累积本次读取到的数据，一次读取可能只包含半个包，也可能包含多个包
+	if d.in == nil {
+		d.in = d.newFrameBuff()
+	}
 	d.in = append(d.in, buff...)
-	resp := make([][]byte, 0)
 
+	// 一次读取中的所有完整包都在本次解码出来，没有完整包时返回nil
+	var resp [][]byte
+	in := bytes.NewBuffer(d.in)
 	for {
-		arr := d.decode(d.in)
-
-		if arr != nil {
-			// 证明已经解析出一个完整包
-			resp = append(resp, arr)
-			_size := len(arr) + d.InitialBytesToStrip
-			if _size > 0 {
-				d.in = d.in[_size:]
-			}
-		} else {
-			return resp
+		arr := d.decode(in)
+		if arr == nil {
+			break
 		}
+		// 证明已经解析出一个完整包
+		resp = append(resp, arr)
 	}
+
+	// 已解码和已丢弃的数据都从in中消费掉了，剩余的半包留到下一次读取时继续解码
+	d.in = append(d.in[:0], in.Bytes()...)
+
+	return resp
 }
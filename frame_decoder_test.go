@@ -0,0 +1,321 @@
+/**
+* @File: frame_decoder_test.go
+* @Author: Jason Woo
+* @Date: 2026/10/16 19:10
+**/
+
+package fastnet
+
+import (
+	"bytes"
+	"errors"
+	"github.com/dyowoo/fastnet/xconf"
+	"github.com/dyowoo/fastnet/xlog"
+	"net"
+	"sync/atomic"
+	"testing"
+)
+
+// 生成由多个TLV包组成的字节流，第i个包的MsgID为i，数据长度为sizes[i]
+func tlvStream(t *testing.T, sizes ...int) []byte {
+	dp := NewDataPack()
+	var stream []byte
+	for i, size := range sizes {
+		packed, err := dp.Pack(NewMsgPackage(uint32(i), bytes.Repeat([]byte{byte('a' + i)}, size)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		stream = append(stream, packed...)
+	}
+	return stream
+}
+
+func checkTLVFrames(t *testing.T, frames [][]byte, sizes ...int) {
+	if len(frames) != len(sizes) {
+		t.Fatalf("got %d frames, want %d", len(frames), len(sizes))
+	}
+	decoder := NewTLVDecoder().(*TLVDecoder)
+	for i, frame := range frames {
+		tlv := decoder.decode(frame)
+		if tlv.Tag != uint32(i) || !bytes.Equal(tlv.Value, bytes.Repeat([]byte{byte('a' + i)}, sizes[i])) {
+			t.Fatalf("frame %d: tag = %d, value len = %d", i, tlv.Tag, len(tlv.Value))
+		}
+	}
+}
+
+func TestFrameDecoderPartialReads(t *testing.T) {
+	sizes := []int{0, 1, 300, 7, 1024}
+	stream := tlvStream(t, sizes...)
+
+	// 逐字节输入
+	decoder := newFrameDecoderFor(NewTLVDecoder(), nil)
+	var frames [][]byte
+	for _, b := range stream {
+		frames = append(frames, decoder.Decode([]byte{b})...)
+	}
+	checkTLVFrames(t, frames, sizes...)
+
+	// 按与包边界无关的大小分块输入
+	for _, chunk := range []int{3, 13, 500} {
+		decoder = newFrameDecoderFor(NewTLVDecoder(), nil)
+		frames = frames[:0]
+		for i := 0; i < len(stream); i += chunk {
+			end := i + chunk
+			if end > len(stream) {
+				end = len(stream)
+			}
+			frames = append(frames, decoder.Decode(stream[i:end])...)
+		}
+		checkTLVFrames(t, frames, sizes...)
+	}
+
+	// 一次输入全部数据
+	checkTLVFrames(t, newFrameDecoderFor(NewTLVDecoder(), nil).Decode(stream), sizes...)
+
+	// 读循环复用读缓冲区，解码出的包不能引用输入的数据
+	buf := append([]byte(nil), stream...)
+	frames = newFrameDecoderFor(NewTLVDecoder(), nil).Decode(buf)
+	for i := range buf {
+		buf[i] = 0xff
+	}
+	checkTLVFrames(t, frames, sizes...)
+}
+
+func TestFrameDecoderDiscardTooLongFrame(t *testing.T) {
+	lf := *NewTLVDecoder().GetLengthField()
+	lf.MaxFrameLength = 8 + 16
+	decoder := NewFrameDecoder(lf)
+	var dropped []string
+	decoder.(IFrameDropNotifier).SetDropHandler(func(reason string) {
+		dropped = append(dropped, reason)
+	})
+
+	// 超长的包分两次到达，之后紧跟一个正常的包
+	tooLong := tlvStream(t, 100)
+	next, _ := NewDataPack().Pack(NewMsgPackage(0, []byte("abc")))
+	var frames [][]byte
+	frames = append(frames, decoder.Decode(tooLong[:50])...)
+	frames = append(frames, decoder.Decode(append(tooLong[50:], next...))...)
+
+	if len(frames) != 1 || !bytes.Equal(frames[0], next) {
+		t.Fatalf("unexpected frames after discarding: %q", frames)
+	}
+	if len(dropped) != 1 {
+		t.Fatalf("drop handler called %d times, want 1: %q", len(dropped), dropped)
+	}
+}
+
+func TestDecodeErrorCallback(t *testing.T) {
+	s := NewServer().(*Server)
+	s.SetDecoder(NewHTLVCRCDecoder())
+	s.AddInterceptor(s.GetDecoder())
+
+	var gotConnID uint64
+	var gotErr error
+	var gotRaw []byte
+	s.SetOnDecodeError(func(connID uint64, err error, raw []byte) {
+		gotConnID, gotErr, gotRaw = connID, err, raw
+	})
+
+	// CRC校验值错误的帧
+	frame := []byte{0xA2, 0x10, 0x02, 0x01, 0x02, 0x00, 0x00}
+	conn, _ := newPipeConn(t, s, 7)
+
+	s.GetMsgHandler().Execute(NewRequest(conn, NewRawMessage(uint32(len(frame)), frame)))
+
+	if gotConnID != 7 || gotErr != ErrCRCCheck || !bytes.Equal(gotRaw, frame) {
+		t.Fatalf("unexpected decode error callback: connID=%d err=%v raw=%x", gotConnID, gotErr, gotRaw)
+	}
+}
+
+func TestDecodeErrorCallbackIncompleteFrame(t *testing.T) {
+	cases := []struct {
+		name    string
+		decoder IDecoder
+		frame   []byte
+		want    error
+	}{
+		{"tlv", NewTLVDecoder(), []byte{0, 0, 0, 1, 0, 0, 0, 4, 'a'}, ErrIncompleteFrame},
+		{"tlv short head", NewTLVDecoder(), []byte{0, 0, 0, 1}, ErrIncompleteFrame},
+		{"ltv", NewLTVLittleDecoder(), []byte{4, 0, 0, 0, 1, 0, 0, 0, 'a'}, ErrIncompleteFrame},
+		{"varint", NewVarintDecoder(), []byte{0x01, 0x04, 'a'}, ErrIncompleteFrame},
+		{"varint overflow", NewVarintDecoder(), []byte{0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0x01}, ErrVarintOverflow},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			s := NewServer().(*Server)
+			s.SetDecoder(tc.decoder)
+			s.AddInterceptor(s.GetDecoder())
+
+			var gotErr error
+			var gotRaw []byte
+			s.SetOnDecodeError(func(connID uint64, err error, raw []byte) {
+				gotErr, gotRaw = err, raw
+			})
+
+			conn, _ := newPipeConn(t, s, 1)
+
+			s.GetMsgHandler().Execute(NewRequest(conn, NewRawMessage(uint32(len(tc.frame)), tc.frame)))
+
+			if !errors.Is(gotErr, tc.want) || !bytes.Equal(gotRaw, tc.frame) {
+				t.Fatalf("decode error callback: err=%v raw=%x, want %v", gotErr, gotRaw, tc.want)
+			}
+		})
+	}
+}
+
+func TestConnectionClosesOnStalledPartialFrame(t *testing.T) {
+	s := NewUserConfServer(&xconf.Config{MaxFrameAccum: 100, HideLogo: true}).(*Server)
+	local, remote := net.Pipe()
+	defer func() { _ = remote.Close() }()
+	conn := newServerConn(s, local, 1)
+	go conn.Start()
+
+	// 包头声明了1000字节的包体，但只发送一部分后停止发送
+	packed, _ := NewDataPack().Pack(NewMsgPackage(1, make([]byte, 1000)))
+	if _, err := remote.Write(packed[:50]); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := remote.Write(packed[50:200]); err != nil {
+		t.Fatal(err)
+	}
+
+	waitFor(t, func() bool {
+		return conn.Context() != nil && conn.Context().Err() != nil
+	})
+}
+
+// BenchmarkReadLoopFrames 对端每次写入多个小包时读循环每秒处理的包数
+func BenchmarkReadLoopFrames(b *testing.B) {
+	const framesPerWrite = 64
+
+	// 关闭调试日志，只统计读取、解码和分发的开销
+	xlog.SetLogLevel(xlog.LogError)
+	defer xlog.SetLogLevel(xlog.LogDebug)
+
+	s := NewServer().(*Server)
+	var received int64
+	done := make(chan struct{})
+	s.AddRouterSlices(1, func(request IRequest) {
+		if atomic.AddInt64(&received, 1) == int64(b.N) {
+			close(done)
+		}
+	})
+	s.AddInterceptor(s.GetDecoder())
+	s.GetMsgHandler().StartWorkerPool()
+	defer s.GetMsgHandler().StopWorkerPool()
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer func() { _ = ln.Close() }()
+	remote, err := net.Dial("tcp", ln.Addr().String())
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer func() { _ = remote.Close() }()
+	local, err := ln.Accept()
+	if err != nil {
+		b.Fatal(err)
+	}
+	conn := newServerConn(s, local, 1)
+	go conn.Start()
+	defer conn.Stop()
+
+	packed, _ := NewDataPack().Pack(NewMsgPackage(1, []byte("ping")))
+	chunk := bytes.Repeat(packed, framesPerWrite)
+
+	b.ResetTimer()
+	for sent := 0; sent < b.N; sent += framesPerWrite {
+		n := framesPerWrite
+		if b.N-sent < n {
+			n = b.N - sent
+		}
+		if _, err = remote.Write(chunk[:n*len(packed)]); err != nil {
+			b.Fatal(err)
+		}
+	}
+	<-done
+	b.ReportMetric(float64(b.N)/b.Elapsed().Seconds(), "frames/s")
+}
+
+// 记录经过的请求的拦截器
+type captureInterceptor struct {
+	request IRequest
+}
+
+func (ci *captureInterceptor) Intercept(chain IChain) IcResp {
+	ci.request, _ = chain.Request().(IRequest)
+	return chain.Proceed(chain.Request())
+}
+
+func TestDecodeResult(t *testing.T) {
+	tlvFrame := tlvStream(t, 0, 3)[TlvHeaderSize:]
+	htlvFrame := []byte{0xA2, 0x10, 0x02, 0x01, 0x02}
+	htlvFrame = append(htlvFrame, GetCrC(htlvFrame)...)
+
+	cases := []struct {
+		name    string
+		decoder IDecoder
+		frame   []byte
+		msgID   uint32
+		body    []byte
+		crc     []byte
+	}{
+		{name: "tlv", decoder: NewTLVDecoder(), frame: tlvFrame, msgID: 1, body: []byte("bbb")},
+		{name: "htlv", decoder: NewHTLVCRCDecoder(), frame: htlvFrame, msgID: 0x10, body: []byte{0x01, 0x02}, crc: htlvFrame[5:]},
+	}
+
+	for _, c := range cases {
+		capture := &captureInterceptor{}
+		request := NewRequest(nil, NewRawMessage(uint32(len(c.frame)), c.frame))
+		NewChain([]IInterceptor{c.decoder, capture}, 0, request).Proceed(request)
+
+		result, ok := GetDecodeResult(capture.request)
+		if !ok {
+			t.Fatalf("%s: no decode result", c.name)
+		}
+		if result.MsgID != c.msgID || !bytes.Equal(result.Body, c.body) ||
+			!bytes.Equal(result.Crc, c.crc) || !bytes.Equal(result.Raw, c.frame) {
+			t.Fatalf("%s: unexpected decode result %+v", c.name, result)
+		}
+
+		// 解码后数据仍是解码器原有的类型
+		switch resp := capture.request.GetResponse().(type) {
+		case TLVDecoder:
+			if c.name != "tlv" || resp.Tag != c.msgID {
+				t.Fatalf("%s: response = %+v", c.name, resp)
+			}
+		case HtlvCrcDecoder:
+			if c.name != "htlv" || uint32(resp.FunCode) != c.msgID {
+				t.Fatalf("%s: response = %+v", c.name, resp)
+			}
+		default:
+			t.Fatalf("%s: response type = %T", c.name, resp)
+		}
+	}
+
+	if _, ok := GetDecodeResult(NewRequest(nil, NewMsgPackage(1, nil))); ok {
+		t.Fatal("request without decoding should not have a decode result")
+	}
+}
+
+// 返回的包直接引用传入数据的自定义解码器
+type aliasFrameDecoder struct{}
+
+func (aliasFrameDecoder) Decode(buff []byte) [][]byte { return [][]byte{buff} }
+
+func TestReadBufferReuseOnlyForCopyingDecoders(t *testing.T) {
+	for _, decoder := range []IDecoder{
+		NewTLVDecoder(), NewVarintDecoder(), NewDelimiterDecoder([]byte("\n")), NewFixedLengthDecoder(4),
+	} {
+		if !copiesFrames(newFrameDecoderFor(decoder, nil)) {
+			t.Fatalf("%T should reuse the read buffer", decoder)
+		}
+	}
+	if copiesFrames(nil) || copiesFrames(aliasFrameDecoder{}) {
+		t.Fatal("custom or missing frame decoder should not reuse the read buffer")
+	}
+}
@@ -0,0 +1,92 @@
+/**
+* @File: handler_timeout.go
+* @Author: Jason Woo
+* @Date: 2026/10/16 23:30
+**/
+
+package fastnet
+
+import (
+	"context"
+	"github.com/dyowoo/fastnet/xlog"
+	"runtime/debug"
+	"time"
+)
+
+// 请求实现该接口，处理超时时为请求设置带截止时间的上下文，超时后终止尚未执行的处理函数
+type requestContextSetter interface {
+	setContext(ctx context.Context)
+	cancelHandlers()
+}
+
+// SetHandlerTimeout 设置指定MsgID的处理超时时间，d小于等于0时删除该设置，使用默认的超时时间
+func (mh *MsgHandle) SetHandlerTimeout(msgID uint32, d time.Duration) {
+	mh.timeoutLock.Lock()
+	defer mh.timeoutLock.Unlock()
+
+	if d <= 0 {
+		delete(mh.handlerTimeouts, msgID)
+		return
+	}
+	mh.handlerTimeouts[msgID] = d
+}
+
+// SetDefaultHandlerTimeout 设置默认的处理超时时间，d小于等于0时不限制
+func (mh *MsgHandle) SetDefaultHandlerTimeout(d time.Duration) {
+	mh.timeoutLock.Lock()
+	defer mh.timeoutLock.Unlock()
+
+	mh.defaultTimeout = d
+}
+
+func (mh *MsgHandle) handlerTimeout(msgID uint32) time.Duration {
+	mh.timeoutLock.RLock()
+	defer mh.timeoutLock.RUnlock()
+
+	if d, ok := mh.handlerTimeouts[msgID]; ok {
+		return d
+	}
+	return mh.defaultTimeout
+}
+
+// callWithTimeout 执行处理函数，处理函数全部执行完成时返回true
+// 设置了处理超时时处理函数在新的协程中执行，超时或链接断开后不再等待，worker可以继续处理后续的消息
+// 框架无法强制结束仍在运行的处理函数，处理函数需要监听request.Context().Done()才能真正取消
+func (mh *MsgHandle) callWithTimeout(request IRequest, call func()) bool {
+	timeout := mh.handlerTimeout(request.GetMsgID())
+	setter, ok := request.(requestContextSetter)
+	if timeout <= 0 || !ok {
+		call()
+		return true
+	}
+
+	ctx, cancel := context.WithTimeout(request.Context(), timeout)
+	defer cancel()
+	setter.setContext(ctx)
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		// 处理函数在新的协程中执行，需要单独捕获panic
+		defer func() {
+			if err := recover(); err != nil {
+				mh.HandlePanic(request, err, debug.Stack())
+			}
+		}()
+
+		call()
+	}()
+
+	select {
+	case <-done:
+		return true
+	case <-ctx.Done():
+		// 终止尚未执行的处理函数，已经开始执行的处理函数需要自行监听ctx
+		// 处理函数仍在另一个协程中使用请求，这里只设置原子标记，不能调用Abort修改处理链的状态
+		setter.cancelHandlers()
+		if ctx.Err() == context.DeadlineExceeded {
+			xlog.ErrorF("msgID = %s handler timeout after %v, worker released", msgIDString(request.GetMsgID()), timeout)
+		}
+		return false
+	}
+}
@@ -0,0 +1,84 @@
+/**
+* @File: handshake.go
+* @Author: Jason Woo
+* @Date: 2026/10/16 19:40
+**/
+
+package fastnet
+
+import (
+	"errors"
+	"io"
+)
+
+// HandshakeFunc 链接握手函数，在OnConnStart之前、读循环启动之前同步执行
+// 函数中可以使用conn.ReadMsg()读取对端的消息，使用conn.SendMsg()回复消息，完成版本协商等握手流程
+// 返回错误时拒绝该链接，链接会被直接关闭，不会触发OnConnStart和OnConnStop
+// 握手需要超时时可以通过conn.GetConnection().SetReadDeadline设置读超时
+type HandshakeFunc func(conn IConnection) error
+
+var ErrReadMsgNotInHandshake = errors.New("ReadMsg can only be called in handshake") // 在握手函数之外调用ReadMsg
+
+// 支持从流中逐字节读取包头的封包方式，例如DataPackVarint
+type streamUnpacker interface {
+	UnpackFrom(r io.ByteReader) (IMessage, error)
+}
+
+// 数据之后还有帧尾(例如校验和)的封包方式，例如DataPackChecksum
+type frameTrailer interface {
+	trailerLen() uint32
+}
+
+// 每次只从底层读取一个字节，保证不会多读取属于下一条消息的数据
+type singleByteReader struct {
+	r   io.Reader
+	buf [1]byte
+}
+
+func (br *singleByteReader) ReadByte() (byte, error) {
+	if _, err := io.ReadFull(br.r, br.buf[:]); err != nil {
+		return 0, err
+	}
+	return br.buf[0], nil
+}
+
+// readMsgFrom 按照packet的封包格式从r中读取一条完整的消息
+func readMsgFrom(r io.Reader, packet IDataPack) (IMessage, error) {
+	var msg IMessage
+	var err error
+
+	if unpacker, ok := packet.(streamUnpacker); ok {
+		msg, err = unpacker.UnpackFrom(&singleByteReader{r: r})
+	} else {
+		head := make([]byte, packet.GetHeadLen())
+		if _, err = io.ReadFull(r, head); err != nil {
+			return nil, err
+		}
+		msg, err = packet.Unpack(head)
+		if trailer, ok := packet.(frameTrailer); ok && err == nil {
+			return readFrameWithTrailer(r, packet, head, msg.GetDataLen()+trailer.trailerLen())
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	data := make([]byte, msg.GetDataLen())
+	if _, err = io.ReadFull(r, data); err != nil {
+		return nil, err
+	}
+	msg.SetData(data)
+
+	return msg, nil
+}
+
+// 读取包头之后的数据和帧尾，按完整的帧再次拆包，由封包方式校验帧尾
+func readFrameWithTrailer(r io.Reader, packet IDataPack, head []byte, rest uint32) (IMessage, error) {
+	frame := make([]byte, len(head)+int(rest))
+	copy(frame, head)
+	if _, err := io.ReadFull(r, frame[len(head):]); err != nil {
+		return nil, err
+	}
+
+	return packet.Unpack(frame)
+}
@@ -0,0 +1,83 @@
+/**
+* @File: handshake_test.go
+* @Author: Jason Woo
+* @Date: 2026/10/16 19:55
+**/
+
+package fastnet
+
+import (
+	"errors"
+	"net"
+	"sync/atomic"
+	"testing"
+)
+
+const (
+	testMsgVersion    uint32 = 1
+	testMsgVersionAck uint32 = 2
+)
+
+// 版本协商握手：读取对端的版本号，版本不一致时拒绝链接
+func versionHandshake(conn IConnection) error {
+	msg, err := conn.ReadMsg()
+	if err != nil {
+		return err
+	}
+	if msg.GetMsgID() != testMsgVersion || string(msg.GetData()) != "v1" {
+		return errors.New("unsupported version")
+	}
+	return conn.SendMsg(testMsgVersionAck, []byte("ok"))
+}
+
+func startHandshakeConn(t *testing.T, version string) (net.Conn, IConnection, *int32, *int32) {
+	var started, stopped int32
+	s := NewServer(WithHandshake(versionHandshake)).(*Server)
+	s.SetOnConnStart(func(IConnection) { atomic.AddInt32(&started, 1) })
+	s.SetOnConnStop(func(IConnection) { atomic.AddInt32(&stopped, 1) })
+
+	local, remote := net.Pipe()
+	t.Cleanup(func() { _ = remote.Close() })
+	conn := newServerConn(s, local, 1)
+	go conn.Start()
+
+	packed, _ := s.GetPacket().Pack(NewMsgPackage(testMsgVersion, []byte(version)))
+	if _, err := remote.Write(packed); err != nil {
+		t.Fatal(err)
+	}
+
+	return remote, conn, &started, &stopped
+}
+
+func TestHandshakeAccept(t *testing.T) {
+	remote, conn, started, _ := startHandshakeConn(t, "v1")
+	defer conn.Stop()
+
+	ack, err := readMsgFrom(remote, NewDataPack())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ack.GetMsgID() != testMsgVersionAck || string(ack.GetData()) != "ok" {
+		t.Fatalf("unexpected ack: %d %s", ack.GetMsgID(), ack.GetData())
+	}
+
+	waitFor(t, func() bool { return atomic.LoadInt32(started) == 1 })
+
+	// 读循环启动之后不能再调用ReadMsg
+	if _, err = conn.ReadMsg(); !errors.Is(err, ErrReadMsgNotInHandshake) {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+func TestHandshakeReject(t *testing.T) {
+	remote, _, started, stopped := startHandshakeConn(t, "v0")
+
+	// 握手失败后链接被关闭，对端读取到EOF
+	if _, err := remote.Read(make([]byte, 1)); err == nil {
+		t.Fatal("rejected conn should be closed")
+	}
+
+	if atomic.LoadInt32(started) != 0 || atomic.LoadInt32(stopped) != 0 {
+		t.Fatalf("rejected conn should not trigger hooks, started = %d, stopped = %d", *started, *stopped)
+	}
+}
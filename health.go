@@ -0,0 +1,166 @@
+/**
+* @File: health.go
+* @Author: Jason Woo
+* @Date: 2026/10/16 12:21
+**/
+
+package fastnet
+
+import (
+	"context"
+	"github.com/dyowoo/fastnet/xlog"
+	"net/http"
+	"runtime/debug"
+	"time"
+)
+
+// HealthStatus Server的健康状态，供负载均衡判断是否继续向该实例分配新链接
+type HealthStatus int32
+
+const (
+	HealthStarting HealthStatus = iota // 已创建但还没有调用Start
+	HealthReady                        // 正在接受新链接
+	HealthDegraded                     // 正在接受新链接，但Worker任务队列积压，见DegradedQueueLen
+	HealthDraining                     // 正在优雅停止，不再接受新链接，等待已有链接断开
+	HealthStopped                      // 已经停止
+)
+
+func (h HealthStatus) String() string {
+	switch h {
+	case HealthStarting:
+		return "starting"
+	case HealthReady:
+		return "ready"
+	case HealthDegraded:
+		return "degraded"
+	case HealthDraining:
+		return "draining"
+	case HealthStopped:
+		return "stopped"
+	default:
+		return "unknown"
+	}
+}
+
+// Serving 是否应该继续向该实例分配新链接，Ready和Degraded时为true
+func (h HealthStatus) Serving() bool {
+	return h == HealthReady || h == HealthDegraded
+}
+
+// Health 获取Server当前的健康状态
+// Start之后为Ready，任意Worker任务队列积压达到DegradedQueueLen时为Degraded，GracefulStop期间为Draining
+func (s *Server) Health() HealthStatus {
+	status := HealthStatus(s.health.Load())
+	if status == HealthReady && s.workerQueueSaturated() {
+		return HealthDegraded
+	}
+
+	return status
+}
+
+// 任意Worker任务队列积压的消息数达到阈值时返回true，没有开启Worker工作池时总是返回false
+func (s *Server) workerQueueSaturated() bool {
+	threshold := s.config.DegradedQueueLen
+	if threshold <= 0 {
+		threshold = int(s.config.MaxWorkerTaskLen) * 8 / 10
+	}
+	if threshold <= 0 {
+		return false
+	}
+
+	for workerID := uint32(0); workerID < s.msgHandler.WorkerPoolSize(); workerID++ {
+		if s.msgHandler.WorkerQueueDepth(workerID) >= threshold {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (s *Server) isDraining() bool {
+	return HealthStatus(s.health.Load()) == HealthDraining
+}
+
+// GracefulStop 优雅停止服务：健康状态变为Draining，关闭tcp监听并拒绝新的websocket升级请求，
+// 等待已有链接全部断开或ctx结束后调用Stop，ctx结束时仍有链接未断开则返回ctx.Err()，剩余链接由Stop关闭
+// 负载均衡通过HealthHandler发现实例进入Draining后停止分配新链接，配合ctx的超时时间实现不中断服务的发布
+// 等待超时后Stop会取消所有链接、请求以及Server.Context()的上下文，监听request.Context()的处理函数随之退出，停止过程才有确定的上限
+func (s *Server) GracefulStop(ctx context.Context) error {
+	s.health.Store(int32(HealthDraining))
+	// 关闭监听后新链接只会由Handoff启动的新进程Accept
+	s.closeTCPListener()
+	xlog.InfoF("[stop] server name %s is draining, %d conns remaining", s.name, s.connMgr.Len())
+	s.notifyDrainConns()
+
+	ticker := time.NewTicker(100 * time.Millisecond)
+	defer ticker.Stop()
+
+	var err error
+wait:
+	for s.connMgr.Len() > 0 {
+		select {
+		case <-ctx.Done():
+			err = ctx.Err()
+			xlog.WarnF("[stop] server name %s drain interrupted: %v, %d conns remaining", s.name, err, s.connMgr.Len())
+			break wait
+		case <-ticker.C:
+		}
+	}
+
+	s.Stop()
+	return err
+}
+
+// SetOnDrainConn 设置GracefulStop开始时对每个已有链接调用的回调，默认为nil，用于不中断服务的发布:
+//
+//	s.SetOnDrainConn(func(conn fastnet.IConnection) {
+//		_ = conn.Kick(MigrateMsgID, []byte(newAddr), fastnet.CloseReasonServerShutdown)
+//	})
+//
+// 回调在健康状态变为Draining、关闭监听之后调用，每个链接的回调在独立的协程中执行，可以发送迁移指令(例如新实例的地址)
+// 并等待客户端确认或主动断开；GracefulStop不等待回调返回，ctx结束后剩余链接由Stop关闭，回调可以监听conn.Context()得知链接已关闭
+func (s *Server) SetOnDrainConn(hookFunc func(IConnection)) {
+	s.onDrainConn = hookFunc
+}
+
+// 对每个已有链接调用onDrainConn
+func (s *Server) notifyDrainConns() {
+	if s.onDrainConn == nil {
+		return
+	}
+
+	s.connMgr.RangeConn(func(connID uint64, conn IConnection) bool {
+		go s.callOnDrainConn(conn)
+		return true
+	})
+}
+
+func (s *Server) callOnDrainConn(conn IConnection) {
+	defer func() {
+		if err := recover(); err != nil {
+			xlog.ErrorF("connID = %d OnDrainConn panic: %v\n%s", conn.GetConnID(), err, debug.Stack())
+		}
+	}()
+
+	s.onDrainConn(conn)
+}
+
+// HealthHandler 以HTTP方式提供Server的健康状态，供负载均衡定期探测，例如:
+//
+//	http.Handle("/healthz", fastnet.HealthHandler(s))
+//
+// 注册到http.DefaultServeMux时websocket端口同样可以访问
+// Ready和Degraded时返回200，其他状态返回503，响应内容为状态名称
+func HealthHandler(s IServer) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		status := s.Health()
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		w.Header().Set("Cache-Control", "no-store")
+		if status.Serving() {
+			w.WriteHeader(http.StatusOK)
+		} else {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+		_, _ = w.Write([]byte(status.String()))
+	})
+}
@@ -9,17 +9,27 @@ package fastnet
 import (
 	"fmt"
 	"github.com/dyowoo/fastnet/xlog"
+	"math/rand"
+	"sync"
+	"sync/atomic"
 	"time"
 )
 
 const (
-	HeartbeatDefaultMsgID uint32 = 99999
+	HeartbeatDefaultMsgID     uint32 = 99999
+	HeartbeatDefaultMaxMissed        = 1 // 默认连续丢失1次心跳即认为连接已死亡
+
+	heartbeatMaxJitter = 0.5 // 心跳间隔随机抖动比例的上限，保证抖动后的间隔大于0
 )
 
 type IHeartbeatChecker interface {
 	SetOnRemoteNotAlive(OnRemoteNotAlive)
 	SetHeartbeatMsgFunc(HeartbeatMsgFunc)
 	SetHeartbeatFunc(HeartbeatFunc)
+	SetMaxMissedBeats(int)
+	SetJitter(float64)
+	ResetMissedBeats()
+	MissedBeats() int
 	BindRouter(uint32, IRouter)
 	BindRouterSlices(uint32, ...RouterHandler)
 	Start()
@@ -38,8 +48,8 @@ type HeartbeatMsgFunc func(IConnection) []byte
 // HeartbeatFunc 用户自定义心跳函数
 type HeartbeatFunc func(IConnection) error
 
-// OnRemoteNotAlive 用户自定义的远程连接不存活时的处理方法
-type OnRemoteNotAlive func(IConnection)
+// OnRemoteNotAlive 用户自定义的远程连接不存活时的处理方法, missedBeats为连续丢失的心跳次数
+type OnRemoteNotAlive func(conn IConnection, missedBeats int)
 
 type HeartbeatOption struct {
 	MakeMsg          HeartbeatMsgFunc // 用户自定义的心跳检测消息处理方法
@@ -47,11 +57,16 @@ type HeartbeatOption struct {
 	HeartbeatMsgID   uint32           // 用户自定义的心跳检测消息ID
 	Router           IRouter          // 用户自定义的心跳检测消息业务处理路由
 	RouterSlices     []RouterHandler  // 新版本的路由处理函数的集合
+	MaxMissedBeats   int              // 连续丢失多少次心跳才认为连接已死亡，默认为1
+	Jitter           float64          // 每个链接的心跳间隔在[interval*(1-Jitter), interval]内随机，为0时使用配置HeartbeatJitter，小于0时不抖动
 }
 
 type HeartbeatChecker struct {
 	interval         time.Duration    // 心跳检测时间间隔
-	quitChan         chan bool        // 退出信号
+	jitter           float64          // 心跳间隔随机抖动的比例，为0时不抖动
+	tickInterval     time.Duration    // 实际使用的检测间隔，Clone时在interval的基础上随机抖动，为0时使用interval
+	quitChan         chan struct{}    // 退出信号，关闭时通知检测协程退出
+	quitOnce         sync.Once        // 保证退出信号只关闭一次
 	makeMsg          HeartbeatMsgFunc // 用户自定义的心跳检测消息处理方法
 	onRemoteNotAlive OnRemoteNotAlive // 用户自定义的远程连接不存活时的处理方法
 	msgID            uint32           // 心跳的消息ID
@@ -59,6 +74,9 @@ type HeartbeatChecker struct {
 	routerSlices     []RouterHandler  // 用户自定义的心跳检测消息业务处理新路由
 	conn             IConnection      // 绑定的链接
 	beatFunc         HeartbeatFunc    // 用户自定义心跳发送函数
+	maxMissedBeats   int              // 连续丢失多少次心跳才认为连接已死亡
+	missedBeats      int32            // 当前连续丢失的心跳次数，收到对端任意数据时清零
+	clock            clock            // 检测定时器的时间来源
 }
 
 // HeatBeatDefaultRouter 收到remote心跳消息的默认回调路由业务
@@ -81,15 +99,15 @@ func makeDefaultMsg(conn IConnection) []byte {
 	return []byte(msg)
 }
 
-func notAliveDefaultFunc(conn IConnection) {
-	xlog.InfoF("remote connection %s is not alive, stop it", conn.RemoteAddr())
-	conn.Stop()
+func notAliveDefaultFunc(conn IConnection, missedBeats int) {
+	xlog.InfoF("remote connection %s is not alive, missed %d heartbeats, stop it", conn.RemoteAddr(), missedBeats)
+	conn.StopWithReason(CloseReasonHeartbeatTimeout)
 }
 
 func NewHeartbeatChecker(interval time.Duration) IHeartbeatChecker {
 	heartbeat := &HeartbeatChecker{
 		interval: interval,
-		quitChan: make(chan bool),
+		quitChan: make(chan struct{}),
 
 		// 均使用默认的心跳消息生成函数和远程连接不存活时的处理方法
 		makeMsg:          makeDefaultMsg,
@@ -98,11 +116,39 @@ func NewHeartbeatChecker(interval time.Duration) IHeartbeatChecker {
 		router:           &HeatBeatDefaultRouter{},
 		routerSlices:     []RouterHandler{HeatBeatDefaultHandle},
 		beatFunc:         nil,
+		maxMissedBeats:   HeartbeatDefaultMaxMissed,
+		clock:            systemClock,
 	}
 
 	return heartbeat
 }
 
+// newHeartbeatCheckerWithOption 根据自定义配置创建心跳检测器，Server与Client共用
+// routerSlicesMode 为true时心跳消息使用切片路由，否则使用旧版路由
+// jitter 配置的心跳间隔抖动比例，option中设置了Jitter时以option为准
+func newHeartbeatCheckerWithOption(interval time.Duration, option *HeartbeatOption, routerSlicesMode bool, jitter float64) IHeartbeatChecker {
+	checker := NewHeartbeatChecker(interval)
+
+	if option != nil && option.Jitter != 0 {
+		jitter = option.Jitter
+	}
+	checker.SetJitter(jitter)
+
+	if option != nil {
+		checker.SetHeartbeatMsgFunc(option.MakeMsg)
+		checker.SetOnRemoteNotAlive(option.OnRemoteNotAlive)
+		checker.SetMaxMissedBeats(option.MaxMissedBeats)
+		// 检测当前路由模式
+		if routerSlicesMode {
+			checker.BindRouterSlices(option.HeartbeatMsgID, option.RouterSlices...)
+		} else {
+			checker.BindRouter(option.HeartbeatMsgID, option.Router)
+		}
+	}
+
+	return checker
+}
+
 func (h *HeartbeatChecker) SetOnRemoteNotAlive(f OnRemoteNotAlive) {
 	if f != nil {
 		h.onRemoteNotAlive = f
@@ -121,6 +167,46 @@ func (h *HeartbeatChecker) SetHeartbeatFunc(beatFunc HeartbeatFunc) {
 	}
 }
 
+// SetMaxMissedBeats 设置连续丢失多少次心跳才认为连接已死亡，用于容忍弱网下的偶发丢包
+func (h *HeartbeatChecker) SetMaxMissedBeats(n int) {
+	if n > 0 {
+		h.maxMissedBeats = n
+	}
+}
+
+// ResetMissedBeats 收到对端数据时清零连续丢失的心跳次数
+func (h *HeartbeatChecker) ResetMissedBeats() {
+	atomic.StoreInt32(&h.missedBeats, 0)
+}
+
+// MissedBeats 获取当前连续丢失的心跳次数
+func (h *HeartbeatChecker) MissedBeats() int {
+	return int(atomic.LoadInt32(&h.missedBeats))
+}
+
+// SetJitter 设置心跳间隔随机抖动的比例，Clone到每个链接时间隔在[interval*(1-jitter), interval]内随机，
+// 避免大量链接同时建立后心跳在同一时刻触发，抖动只会缩短间隔，不会因为间隔变长而误判链接已死亡，
+// 小于等于0时不抖动，超过0.5时按0.5处理
+func (h *HeartbeatChecker) SetJitter(jitter float64) {
+	if jitter < 0 {
+		jitter = 0
+	}
+	if jitter > heartbeatMaxJitter {
+		jitter = heartbeatMaxJitter
+	}
+	h.jitter = jitter
+}
+
+// 在interval的基础上按jitter随机缩短后的检测间隔
+func (h *HeartbeatChecker) jitteredInterval() time.Duration {
+	if h.jitter <= 0 {
+		return h.interval
+	}
+
+	delta := rand.Float64() * h.jitter
+	return h.interval - time.Duration(float64(h.interval)*delta)
+}
+
 func (h *HeartbeatChecker) BindRouter(msgID uint32, router IRouter) {
 	if router != nil && msgID != HeartbeatDefaultMsgID {
 		h.msgID = msgID
@@ -136,10 +222,15 @@ func (h *HeartbeatChecker) BindRouterSlices(msgID uint32, handlers ...RouterHand
 }
 
 func (h *HeartbeatChecker) start() {
-	ticker := time.NewTicker(h.interval)
+	interval := h.tickInterval
+	if interval <= 0 {
+		interval = h.interval
+	}
+
+	ticker := h.clock.NewTicker(interval)
 	for {
 		select {
-		case <-ticker.C:
+		case <-ticker.C():
 			_ = h.check()
 		case <-h.quitChan:
 			ticker.Stop()
@@ -152,9 +243,15 @@ func (h *HeartbeatChecker) Start() {
 	go h.start()
 }
 
+// Stop 停止心跳检测，可重复调用且不会阻塞
+// 绑定在链接上的检测器会在链接关闭时由链接自动调用
 func (h *HeartbeatChecker) Stop() {
-	xlog.InfoF("heartbeat checker stop, connID=%+v", h.conn.GetConnID())
-	h.quitChan <- true
+	h.quitOnce.Do(func() {
+		if h.conn != nil {
+			xlog.InfoF("heartbeat checker stop, connID=%+v", h.conn.GetConnID())
+		}
+		close(h.quitChan)
+	})
 }
 
 func (h *HeartbeatChecker) SendHeartbeatMsg() error {
@@ -163,7 +260,7 @@ func (h *HeartbeatChecker) SendHeartbeatMsg() error {
 
 	err := h.conn.SendMsg(h.msgID, msg)
 	if err != nil {
-		xlog.ErrorF("send heartbeat msg error: %v, msgId=%+v msg=%+v", err, h.msgID, msg)
+		xlog.ErrorF("send heartbeat msg error: %v, msgId=%s msg=%+v", err, msgIDString(h.msgID), msg)
 		return err
 	}
 
@@ -176,13 +273,18 @@ func (h *HeartbeatChecker) check() (err error) {
 	}
 
 	if !h.conn.IsAlive() {
-		h.onRemoteNotAlive(h.conn)
-	} else {
-		if h.beatFunc != nil {
-			err = h.beatFunc(h.conn)
-		} else {
-			err = h.SendHeartbeatMsg()
+		missed := int(atomic.AddInt32(&h.missedBeats, 1))
+		if missed >= h.maxMissedBeats {
+			h.onRemoteNotAlive(h.conn, missed)
+			return nil
 		}
+		xlog.InfoF("remote connection %s missed %d/%d heartbeats", h.conn.RemoteAddr(), missed, h.maxMissedBeats)
+	}
+
+	if h.beatFunc != nil {
+		err = h.beatFunc(h.conn)
+	} else {
+		err = h.SendHeartbeatMsg()
 	}
 
 	return err
@@ -193,18 +295,22 @@ func (h *HeartbeatChecker) BindConn(conn IConnection) {
 	conn.SetHeartbeat(h)
 }
 
-// Clone 克隆到一个指定的链接上
+// Clone 克隆到一个指定的链接上，每个克隆的检测间隔按jitter独立随机
 func (h *HeartbeatChecker) Clone() IHeartbeatChecker {
 	heartbeat := &HeartbeatChecker{
 		interval:         h.interval,
-		quitChan:         make(chan bool),
+		jitter:           h.jitter,
+		tickInterval:     h.jitteredInterval(),
+		quitChan:         make(chan struct{}),
 		beatFunc:         h.beatFunc,
 		makeMsg:          h.makeMsg,
 		onRemoteNotAlive: h.onRemoteNotAlive,
 		msgID:            h.msgID,
 		router:           h.router,
 		routerSlices:     h.routerSlices,
+		maxMissedBeats:   h.maxMissedBeats,
 		conn:             nil,
+		clock:            h.clock,
 	}
 
 	return heartbeat
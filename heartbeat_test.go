@@ -0,0 +1,271 @@
+/**
+* @File: heartbeat_test.go
+* @Author: Jason Woo
+* @Date: 2026/10/16 14:20
+**/
+
+package fastnet
+
+import (
+	"net"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestHeartbeatStopIdempotent(t *testing.T) {
+	checker := NewHeartbeatChecker(time.Second)
+	checker.Start()
+
+	done := make(chan struct{})
+	go func() {
+		checker.Stop()
+		checker.Stop()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("heartbeat checker Stop blocked")
+	}
+}
+
+func TestHeartbeatGoroutineReleasedOnConnClose(t *testing.T) {
+	var started int32
+	s := NewServer().(*Server)
+	s.StartHeartbeat(time.Hour)
+	s.SetOnConnStart(func(IConnection) {
+		atomic.AddInt32(&started, 1)
+	})
+
+	baseline := runtime.NumGoroutine()
+
+	const n = 100
+	peers := make([]net.Conn, 0, n)
+	for i := 0; i < n; i++ {
+		local, remote := net.Pipe()
+		peers = append(peers, remote)
+
+		conn := newServerConn(s, local, uint64(i+1))
+		go s.StartConn(conn)
+	}
+
+	// 等待所有链接启动完成
+	waitFor(t, func() bool { return atomic.LoadInt32(&started) == n })
+
+	// 对端关闭链接，触发链接的关闭流程
+	for _, peer := range peers {
+		_ = peer.Close()
+	}
+
+	waitFor(t, func() bool { return s.GetConnMgr().Len() == 0 && runtime.NumGoroutine() <= baseline })
+}
+
+func TestHeartbeatMissedBeatsWithFakeClock(t *testing.T) {
+	clk := newFakeClock()
+	s := NewServer().(*Server)
+	local, remote := net.Pipe()
+	conn := newServerConn(s, local, 1).(*Connection)
+	conn.clock = clk
+	defer func() {
+		s.GetConnMgr().Remove(conn)
+		_ = local.Close()
+		_ = remote.Close()
+	}()
+
+	beats := make(chan struct{}, 1)
+	notAlive := make(chan int, 1)
+	checker := NewHeartbeatChecker(time.Second).(*HeartbeatChecker)
+	checker.clock = clk
+	checker.SetMaxMissedBeats(2)
+	checker.SetHeartbeatFunc(func(IConnection) error {
+		beats <- struct{}{}
+		return nil
+	})
+	checker.SetOnRemoteNotAlive(func(_ IConnection, missed int) { notAlive <- missed })
+	checker.BindConn(conn)
+	conn.updateActivity()
+	checker.Start()
+	defer checker.Stop()
+	waitFor(t, func() bool { return clk.Waiters() == 1 })
+
+	tick := func(d time.Duration) {
+		clk.Advance(d)
+		select {
+		case <-beats:
+		case <-time.After(time.Second):
+			t.Fatal("heartbeat is not sent after the clock advances")
+		}
+	}
+
+	// 超时之前不计入丢失
+	maxDuration := conn.config.HeartbeatMaxDuration()
+	tick(maxDuration / 2)
+	if missed := checker.MissedBeats(); missed != 0 {
+		t.Fatalf("missed beats = %d, want 0", missed)
+	}
+
+	// 超过最长心跳间隔后连续丢失2次才认为链接已死亡
+	tick(maxDuration)
+	if missed := checker.MissedBeats(); missed != 1 {
+		t.Fatalf("missed beats = %d, want 1", missed)
+	}
+	clk.Advance(time.Second)
+	select {
+	case missed := <-notAlive:
+		if missed != 2 {
+			t.Fatalf("missed beats = %d, want 2", missed)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("remote is not reported as dead")
+	}
+}
+
+func waitFor(t *testing.T, cond func() bool) {
+	t.Helper()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("condition not met before deadline, goroutines = %d", runtime.NumGoroutine())
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// 由可替换的时钟判断存活，读协程更新活动时间、Resume重置活动时间与心跳协程的检查可以并发执行
+func TestConnIsAliveWithFakeClock(t *testing.T) {
+	clk := newFakeClock()
+	s := NewServer().(*Server)
+	c, _ := newPipeConn(t, s, 1)
+	conn := c.(*Connection)
+	conn.clock = clk
+	maxDuration := conn.config.HeartbeatMaxDuration()
+
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 100; i++ {
+			conn.updateActivity()
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 100; i++ {
+			conn.Pause()
+			conn.Resume()
+		}
+	}()
+	for i := 0; i < 100; i++ {
+		clk.Advance(time.Millisecond)
+		conn.IsAlive()
+	}
+	wg.Wait()
+
+	conn.updateActivity()
+	if !conn.IsAlive() {
+		t.Fatal("conn should be alive right after activity")
+	}
+	clk.Advance(maxDuration)
+	if conn.IsAlive() {
+		t.Fatal("conn should not be alive after the max heartbeat duration")
+	}
+	// 恢复读取后重新开始计算超时时间
+	conn.Pause()
+	conn.Resume()
+	if !conn.IsAlive() {
+		t.Fatal("conn should be alive after resume")
+	}
+}
+
+func TestHeartbeatJitter(t *testing.T) {
+	const interval = 10 * time.Second
+
+	s := NewServer().(*Server)
+	s.StartHeartbeatWithOption(interval, &HeartbeatOption{Jitter: 0.2})
+	template := s.GetHeartbeat().(*HeartbeatChecker)
+
+	intervals := make(map[time.Duration]struct{})
+	for i := 0; i < 100; i++ {
+		d := template.Clone().(*HeartbeatChecker).tickInterval
+		// 抖动只缩短间隔，不能超过配置的interval
+		if d < 8*time.Second || d > interval {
+			t.Fatalf("jittered interval %v out of range", d)
+		}
+		intervals[d] = struct{}{}
+	}
+	if len(intervals) < 2 {
+		t.Fatal("cloned checkers should not share the same interval")
+	}
+
+	// 小于0时关闭抖动，超过上限时按上限处理
+	template.SetJitter(-1)
+	if d := template.Clone().(*HeartbeatChecker).tickInterval; d != interval {
+		t.Fatalf("interval without jitter = %v, want %v", d, interval)
+	}
+	template.SetJitter(3)
+	if template.jitter != heartbeatMaxJitter {
+		t.Fatalf("jitter = %v, want %v", template.jitter, heartbeatMaxJitter)
+	}
+
+	// 没有设置时使用配置的默认值
+	s = NewServer().(*Server)
+	s.StartHeartbeat(interval)
+	if jitter := s.GetHeartbeat().(*HeartbeatChecker).jitter; jitter != s.config.HeartbeatJitter || jitter == 0 {
+		t.Fatalf("default jitter = %v, config = %v", jitter, s.config.HeartbeatJitter)
+	}
+}
+
+func TestClientReconnectRetries(t *testing.T) {
+	ln := newPipeListener()
+	defer func() { _ = ln.Close() }()
+
+	s := NewServer(WithListenFunc(func(_, _ string) (net.Listener, error) {
+		return ln, nil
+	})).(*Server)
+	var serverConns atomic.Int32
+	s.SetOnConnStart(func(IConnection) { serverConns.Add(1) })
+	s.Start()
+	defer s.Stop()
+
+	// 重连时第一次建立链接失败，之后按退避时间重试，没有协程接收错误也不会阻塞
+	var dials atomic.Int32
+	c := NewClient("127.0.0.1", 1, WithDialFunc(func(network, address string) (net.Conn, error) {
+		if dials.Add(1) == 2 {
+			return nil, net.ErrClosed
+		}
+		return ln.Dial(network, address)
+	})).(*Client)
+	connected := make(chan IConnection, 2)
+	c.SetOnConnStart(func(conn IConnection) { connected <- conn })
+	c.Start()
+
+	first := <-connected
+	c.reconnect()
+	select {
+	case conn := <-connected:
+		if conn == first || c.Conn() != conn {
+			t.Fatal("client conn is not replaced after reconnect")
+		}
+	case <-time.After(3 * reconnectMinDelay):
+		t.Fatal("client is not reconnected")
+	}
+	if dials.Load() != 3 {
+		t.Fatalf("dials = %d, want 3", dials.Load())
+	}
+	if err := <-c.GetErrChan(); err != net.ErrClosed {
+		t.Fatalf("err = %v, want net.ErrClosed", err)
+	}
+
+	// 等待服务端的链接都启动之后再停止服务
+	waitFor(t, func() bool { return serverConns.Load() == 2 })
+	c.Stop()
+	c.Stop()
+	if first.IsAlive() {
+		t.Fatal("old conn is not stopped")
+	}
+}
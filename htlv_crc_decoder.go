@@ -8,12 +8,15 @@ package fastnet
 
 import (
 	"encoding/hex"
+	"errors"
 	"github.com/dyowoo/fastnet/xlog"
 	"math"
 )
 
 const HeaderSize = 5
 
+var ErrCRCCheck = errors.New("crc check failed") // CRC校验失败
+
 type HtlvCrcDecoder struct {
 	Head    byte   // HeaderCode(头码)
 	FunCode byte   // FunctionCode(功能码)
@@ -86,10 +89,20 @@ func (hcd *HtlvCrcDecoder) Intercept(chain IChain) IcResp {
 	}
 
 	htlvData := hcd.decode(data)
+	// CRC校验失败，丢弃该消息
+	if htlvData == nil {
+		ReportDecodeError(chain.Request(), ErrCRCCheck, data)
+		return nil
+	}
 
 	// 将解码后的数据重新设置到IMessage中, Router需要MsgID来寻址
 	message.SetMsgID(uint32(htlvData.FunCode))
 
 	// 将解码后的数据进入下一层
-	return chain.ProceedWithIMessage(message, *htlvData)
+	return proceedDecoded(chain, message, *htlvData, &DecodeResult{
+		MsgID: uint32(htlvData.FunCode),
+		Body:  htlvData.Body,
+		Raw:   htlvData.Data,
+		Crc:   htlvData.Crc,
+	})
 }
@@ -0,0 +1,73 @@
+/**
+* @File: http_request_info.go
+* @Author: Jason Woo
+* @Date: 2026/10/16 12:10
+**/
+
+package fastnet
+
+import (
+	"net/http"
+	"net/url"
+)
+
+// HTTPRequestInfo websocket升级请求的信息副本，链接不持有*http.Request
+// 业务可以在OnConnStart或路由中根据其中的Cookie、Authorization头、查询参数等做鉴权
+type HTTPRequestInfo struct {
+	Method     string         // 请求方法
+	Host       string         // 请求的Host
+	Path       string         // 请求路径
+	RemoteAddr string         // http.Request.RemoteAddr，经过代理时为代理的地址
+	Header     http.Header    // 请求头
+	Query      url.Values     // URL查询参数
+	Cookies    []*http.Cookie // 请求携带的Cookie
+}
+
+// 从升级请求中复制需要的信息
+func newHTTPRequestInfo(r *http.Request) *HTTPRequestInfo {
+	return &HTTPRequestInfo{
+		Method:     r.Method,
+		Host:       r.Host,
+		Path:       r.URL.Path,
+		RemoteAddr: r.RemoteAddr,
+		Header:     r.Header.Clone(),
+		Query:      r.URL.Query(),
+		Cookies:    r.Cookies(),
+	}
+}
+
+// Cookie 根据名称获取Cookie，不存在时ok为false
+func (info *HTTPRequestInfo) Cookie(name string) (*http.Cookie, bool) {
+	for _, cookie := range info.Cookies {
+		if cookie.Name == name {
+			return cookie, true
+		}
+	}
+
+	return nil, false
+}
+
+// 深拷贝，修改返回值不会影响链接保存的信息
+func (info *HTTPRequestInfo) clone() *HTTPRequestInfo {
+	if info == nil {
+		return nil
+	}
+
+	c := *info
+	c.Header = info.Header.Clone()
+	if info.Query != nil {
+		c.Query = make(url.Values, len(info.Query))
+		for k, v := range info.Query {
+			c.Query[k] = append([]string(nil), v...)
+		}
+	}
+	if info.Cookies != nil {
+		c.Cookies = make([]*http.Cookie, 0, len(info.Cookies))
+		for _, cookie := range info.Cookies {
+			cp := *cookie
+			c.Cookies = append(c.Cookies, &cp)
+		}
+	}
+
+	return &c
+}
@@ -0,0 +1,72 @@
+/**
+* @File: integration_test.go
+* @Author: Jason Woo
+* @Date: 2026/10/16 14:15
+**/
+
+package fastnet_test
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/dyowoo/fastnet"
+	"github.com/dyowoo/fastnet/testutil"
+	"testing"
+	"time"
+)
+
+func echoHandlers() map[uint32]fastnet.RouterHandler {
+	return map[uint32]fastnet.RouterHandler{
+		1: func(request fastnet.IRequest) {
+			request.SetResponse(fastnet.NewMsgPackage(2, request.GetData()))
+		},
+	}
+}
+
+func TestIntegrationHalfPacket(t *testing.T) {
+	_, client := testutil.StartTestServer(t, echoHandlers())
+
+	packed, err := fastnet.NewDataPack().Pack(fastnet.NewMsgPackage(1, []byte("half packet")))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 分两次写出同一帧，服务器需要等待完整的消息后再处理
+	if _, err = client.Conn().Write(packed[:3]); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(20 * time.Millisecond)
+	if _, err = client.Conn().Write(packed[3:]); err != nil {
+		t.Fatal(err)
+	}
+
+	reply, err := client.Await(2, time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(reply.GetData()) != "half packet" {
+		t.Fatalf("reply = %q, want %q", reply.GetData(), "half packet")
+	}
+}
+
+func TestIntegrationMultipleClients(t *testing.T) {
+	_, addr := testutil.StartTestServerAddr(t, echoHandlers())
+
+	for i := 0; i < 3; i++ {
+		client, err := testutil.Dial(addr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer client.Close()
+
+		// 每个客户端只收到自己的回复
+		data := []byte(fmt.Sprintf("client-%d", i))
+		reply, err := client.Request(1, data, 2, time.Second)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(reply.GetData(), data) {
+			t.Fatalf("reply = %q, want %q", reply.GetData(), data)
+		}
+	}
+}
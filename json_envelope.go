@@ -0,0 +1,148 @@
+/**
+* @File: json_envelope.go
+* @Author: Jason Woo
+* @Date: 2026/10/16 21:05
+**/
+
+package fastnet
+
+import (
+	"encoding/json"
+	"errors"
+)
+
+// websocket直通模式下每个websocket帧就是一条完整的消息，不再使用长度前缀的封包格式
+// 消息使用JSON信封描述，浏览器可以直接收发，无需实现二进制编解码:
+//
+//	{"msgId": 1, "data": {"name": "fastnet"}}
+//
+// data可以是任意合法的JSON值，交给路由的数据是data对应的原始JSON文本
+
+var ErrInvalidEnvelope = errors.New("invalid json envelope") // 不是合法的JSON信封
+
+// JSONEnvelope JSON信封
+type JSONEnvelope struct {
+	MsgID uint32          `json:"msgId"`          // 消息ID
+	Data  json.RawMessage `json:"data,omitempty"` // 消息数据
+}
+
+// 解析一个websocket帧中的JSON信封
+func parseJSONEnvelope(frame []byte) (*JSONEnvelope, error) {
+	envelope := &JSONEnvelope{}
+	if err := json.Unmarshal(frame, envelope); err != nil {
+		return nil, ErrInvalidEnvelope
+	}
+
+	return envelope, nil
+}
+
+// JSONEnvelopePack JSON信封的封包方式，只用于websocket直通模式
+// 封包时数据是合法的JSON则原样放入data字段，否则作为JSON字符串放入data字段
+type JSONEnvelopePack struct {
+	boundConfig
+}
+
+// NewJSONEnvelopePack 封包拆包实例初始化方法
+func NewJSONEnvelopePack() IDataPack {
+	return &JSONEnvelopePack{}
+}
+
+// GetHeadLen JSON信封没有包头
+func (dp *JSONEnvelopePack) GetHeadLen() uint32 {
+	return 0
+}
+
+// Pack 封包方法
+func (dp *JSONEnvelopePack) Pack(msg IMessage) ([]byte, error) {
+	envelope := JSONEnvelope{MsgID: msg.GetMsgID()}
+
+	data := msg.GetData()
+	if len(data) > 0 {
+		if json.Valid(data) {
+			envelope.Data = data
+		} else {
+			str, err := json.Marshal(string(data))
+			if err != nil {
+				return nil, err
+			}
+			envelope.Data = str
+		}
+	}
+
+	return json.Marshal(envelope)
+}
+
+// Unpack 拆包方法，binaryData必须是一个完整的websocket帧，返回的消息包含数据
+func (dp *JSONEnvelopePack) Unpack(binaryData []byte) (IMessage, error) {
+	if maxSize := dp.conf().MaxPacketSize; maxSize > 0 && uint32(len(binaryData)) > maxSize {
+		return nil, ErrTooLargeMsg
+	}
+
+	envelope, err := parseJSONEnvelope(binaryData)
+	if err != nil {
+		return nil, err
+	}
+
+	return NewMsgPackage(envelope.MsgID, envelope.Data), nil
+}
+
+// JSONEnvelopeDecoder 与JSONEnvelopePack配套的解码器
+// 每个websocket帧就是一条消息，不需要断粘包处理
+type JSONEnvelopeDecoder struct{}
+
+func NewJSONEnvelopeDecoder() IDecoder {
+	return &JSONEnvelopeDecoder{}
+}
+
+// GetLengthField JSON信封没有长度字段，链接不会创建断粘包解码器
+func (jd *JSONEnvelopeDecoder) GetLengthField() *LengthField {
+	return nil
+}
+
+func (jd *JSONEnvelopeDecoder) Intercept(chain IChain) IcResp {
+	message := chain.GetIMessage()
+	if message == nil {
+		return chain.ProceedWithIMessage(message, nil)
+	}
+
+	frame := message.GetData()
+	envelope, err := parseJSONEnvelope(frame)
+	// 不是合法的JSON信封，直接进入下一层
+	if err != nil {
+		ReportDecodeError(chain.Request(), err, frame)
+		return chain.ProceedWithIMessage(message, nil)
+	}
+
+	// 将解码后的数据重新设置到IMessage中, Router需要MsgID来寻址
+	message.SetMsgID(envelope.MsgID)
+	message.SetData(envelope.Data)
+	message.SetDataLen(uint32(len(envelope.Data)))
+
+	// 将解码后的数据进入下一层
+	return proceedDecoded(chain, message, *envelope, &DecodeResult{
+		MsgID: envelope.MsgID,
+		Body:  envelope.Data,
+		Raw:   frame,
+	})
+}
+
+// 开启websocket直通模式后，按链接类型选择解码器，tcp链接仍然使用原有的解码器
+type wsPassthroughDecoder struct {
+	tcp IDecoder
+	ws  IDecoder
+}
+
+func (d *wsPassthroughDecoder) Intercept(chain IChain) IcResp {
+	decoder := d.tcp
+	if request, ok := chain.Request().(IRequest); ok && request.GetConnection() != nil {
+		if request.GetConnection().Network() == "websocket" {
+			decoder = d.ws
+		}
+	}
+
+	if decoder == nil {
+		return chain.Proceed(chain.Request())
+	}
+
+	return decoder.Intercept(chain)
+}
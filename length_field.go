@@ -8,10 +8,41 @@ package fastnet
 
 import "encoding/binary"
 
+// IFrameDecoder 断粘包解码器，Decode返回buff与之前累积的数据中所有完整的包，没有完整的包时返回nil
 type IFrameDecoder interface {
 	Decode(buff []byte) [][]byte
 }
 
+// 内置的断粘包解码器实现该接口，表示返回的包都是复制出来的，不引用传入的buff
+// 只有这些解码器的读循环会复用读缓冲区，自定义的解码器返回的包可能引用buff，每次读取仍使用新的缓冲区
+type frameCopier interface {
+	copiesFrames() bool
+}
+
+// 断粘包解码器返回的包是否不引用传入的buff，读循环据此决定能否复用读缓冲区
+func copiesFrames(d IFrameDecoder) bool {
+	copier, ok := d.(frameCopier)
+	return ok && copier.copiesFrames()
+}
+
+// IFrameBuffered 断粘包解码器可以实现该接口，返回当前累积的尚未组成完整包的字节数
+// 链接据此限制缓冲区大小，防止对端发送合法的包头后不发送包体导致缓冲区无限增长
+type IFrameBuffered interface {
+	Buffered() int
+}
+
+// IFrameRejecter 断粘包解码器可以实现该接口，在数据不符合协议(例如第一个包头的魔数不一致)时返回原因
+// 链接在每次解码之后检查，返回非nil时以CloseReasonProtocolError关闭链接
+type IFrameRejecter interface {
+	Rejected() error
+}
+
+// IFrameDropNotifier 断粘包解码器可以实现该接口，在丢弃超长或非法的数据时通知链接
+// 链接只在Server设置了OnFrameDropped回调时才会设置handler
+type IFrameDropNotifier interface {
+	SetDropHandler(handler func(reason string))
+}
+
 // LengthField 具备的基础属性
 type LengthField struct {
 	/*
@@ -0,0 +1,169 @@
+/**
+* @File: listener_handoff.go
+* @Author: Jason Woo
+* @Date: 2026/10/16 12:24
+**/
+
+package fastnet
+
+import (
+	"errors"
+	"fmt"
+	"github.com/dyowoo/fastnet/xlog"
+	"net"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// 不停机重启(graceful restart)：旧进程通过Handoff启动新版本的程序，并把tcp监听的文件描述符传给它，
+// 新进程创建Server时直接使用继承的监听开始Accept，旧进程随后调用GracefulStop等待已有链接断开:
+//
+//	// 旧进程，例如收到SIGHUP后
+//	if _, err := s.Handoff(os.Args[0], os.Args[1:]...); err == nil {
+//		_ = s.GracefulStop(ctx)
+//	}
+//
+// 新进程不需要修改代码，监听地址与旧进程相同时自动使用继承的监听
+// 目前只传递tcp监听，websocket监听不会被继承
+
+// InheritListenerEnv 记录继承的监听的环境变量，格式为 address=fd[,address=fd...]
+const InheritListenerEnv = "FASTNET_INHERIT_LISTENERS"
+
+var (
+	ErrNoListener       = errors.New("server is not listening")                // Server还没有开始监听
+	ErrListenerNotFile  = errors.New("listener does not support File()")       // 监听不支持获取文件描述符，例如ListenFunc创建的内存监听
+	ErrInvalidInherited = errors.New("invalid inherited listener environment") // 继承监听的环境变量格式错误
+)
+
+var inherited struct {
+	sync.Mutex
+	used map[string]bool // 已经被使用过的继承监听，同一个监听只能使用一次
+}
+
+// InheritedListener 获取从父进程继承的监听地址为address的监听，没有继承该地址时返回nil, nil
+// Server在创建tcp监听时会自动调用，使用ListenFunc时可以在ListenFunc中调用
+func InheritedListener(address string) (net.Listener, error) {
+	value := os.Getenv(InheritListenerEnv)
+	if value == "" {
+		return nil, nil
+	}
+
+	inherited.Lock()
+	defer inherited.Unlock()
+
+	if inherited.used[address] {
+		return nil, nil
+	}
+
+	for _, entry := range strings.Split(value, ",") {
+		addr, fdStr, ok := strings.Cut(entry, "=")
+		if !ok {
+			return nil, fmt.Errorf("%w: %q", ErrInvalidInherited, entry)
+		}
+		if addr != address {
+			continue
+		}
+
+		fd, err := strconv.Atoi(fdStr)
+		if err != nil || fd < 0 {
+			return nil, fmt.Errorf("%w: %q", ErrInvalidInherited, entry)
+		}
+
+		// FileListener复制了文件描述符，继承的描述符使用后关闭
+		f := os.NewFile(uintptr(fd), "fastnet-listener-"+address)
+		ln, err := net.FileListener(f)
+		_ = f.Close()
+		if err != nil {
+			return nil, fmt.Errorf("inherit listener %s fd %d: %w", address, fd, err)
+		}
+
+		if inherited.used == nil {
+			inherited.used = make(map[string]bool)
+		}
+		inherited.used[address] = true
+		xlog.InfoF("inherit listener %s from parent process, fd = %d", address, fd)
+
+		return ln, nil
+	}
+
+	return nil, nil
+}
+
+// Handoff 启动新的进程(通常是升级后的程序)，并将tcp监听传递给它，新进程使用相同的地址监听时直接继承该监听
+// 新进程的标准输入输出与当前进程相同，返回后两个进程同时Accept，当前进程应随后调用GracefulStop
+// 传递之前不会检查新进程是否能正常启动，需要时可以通过新进程的健康检查确认后再停止当前进程
+func (s *Server) Handoff(name string, args ...string) (*os.Process, error) {
+	s.listenerLock.Lock()
+	ln := s.tcpListener
+	s.listenerLock.Unlock()
+	if ln == nil {
+		return nil, ErrNoListener
+	}
+
+	fileListener, ok := ln.(interface{ File() (*os.File, error) })
+	if !ok {
+		return nil, ErrListenerNotFile
+	}
+	f, err := fileListener.File()
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = f.Close() }()
+
+	// ExtraFiles中的第i个文件在子进程中的描述符为3+i
+	env := make([]string, 0, len(os.Environ())+1)
+	for _, kv := range os.Environ() {
+		if !strings.HasPrefix(kv, InheritListenerEnv+"=") {
+			env = append(env, kv)
+		}
+	}
+	env = append(env, fmt.Sprintf("%s=%s=%d", InheritListenerEnv, s.tcpAddress(), 3))
+
+	cmd := exec.Command(name, args...)
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+	cmd.Env = env
+	cmd.ExtraFiles = []*os.File{f}
+	if err = cmd.Start(); err != nil {
+		return nil, err
+	}
+
+	xlog.InfoF("[handoff] listener %s is passed to process pid = %d", s.tcpAddress(), cmd.Process.Pid)
+	return cmd.Process, nil
+}
+
+// tcp监听的地址，同时作为继承监听的标识，IPv6地址带有方括号
+func (s *Server) tcpAddress() string {
+	return net.JoinHostPort(s.ip, strconv.Itoa(s.port))
+}
+
+// 记录tcp监听，用于Handoff和GracefulStop
+func (s *Server) setTCPListener(ln net.Listener) {
+	s.listenerLock.Lock()
+	s.tcpListener = ln
+	s.listenerLock.Unlock()
+}
+
+// 记录tcp监听或加载证书失败的错误
+func (s *Server) setListenErr(err error) {
+	s.listenerLock.Lock()
+	s.listenErr = err
+	s.listenerLock.Unlock()
+}
+
+// 关闭tcp监听，acceptLoop随之退出，重复关闭时忽略
+func (s *Server) closeTCPListener() {
+	s.listenerLock.Lock()
+	ln := s.tcpListener
+	s.tcpListener = nil
+	s.listenerLock.Unlock()
+
+	if ln == nil {
+		return
+	}
+	if err := ln.Close(); err != nil && !errors.Is(err, net.ErrClosed) {
+		xlog.ErrorF("listener close err: %v", err)
+	}
+}
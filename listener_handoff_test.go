@@ -0,0 +1,79 @@
+/**
+* @File: listener_handoff_test.go
+* @Author: Jason Woo
+* @Date: 2026/10/16 12:24
+**/
+
+package fastnet
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"os"
+	"runtime"
+	"testing"
+	"time"
+)
+
+// 作为Handoff启动的子进程运行，从继承的监听Accept一个链接后回复"child"
+func TestHandoffHelperProcess(t *testing.T) {
+	address := os.Getenv("FASTNET_TEST_HANDOFF_ADDR")
+	if address == "" {
+		t.Skip("helper process for TestServerHandoff")
+	}
+
+	ln, err := InheritedListener(address)
+	if err != nil || ln == nil {
+		fmt.Fprintf(os.Stderr, "inherit listener: %v\n", err)
+		os.Exit(1)
+	}
+	conn, err := ln.Accept()
+	if err != nil {
+		os.Exit(1)
+	}
+	_, _ = conn.Write([]byte("child\n"))
+	_ = conn.Close()
+	os.Exit(0)
+}
+
+func TestServerHandoff(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("passing listeners to child processes is not supported on windows")
+	}
+
+	s := NewServer().(*Server)
+	if _, err := s.Handoff(os.Args[0]); err != ErrNoListener {
+		t.Fatalf("Handoff before listening err = %v, want ErrNoListener", err)
+	}
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.setTCPListener(ln)
+
+	t.Setenv("FASTNET_TEST_HANDOFF_ADDR", s.tcpAddress())
+	proc, err := s.Handoff(os.Args[0], "-test.run=^TestHandoffHelperProcess$")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 父进程关闭监听后，子进程继承的监听仍然可以Accept
+	s.closeTCPListener()
+
+	conn, err := net.Dial("tcp", ln.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	_ = conn.SetReadDeadline(time.Now().Add(10 * time.Second))
+	line, err := bufio.NewReader(conn).ReadString('\n')
+	if err != nil || line != "child\n" {
+		t.Fatalf("read from child = %q, %v", line, err)
+	}
+
+	state, err := proc.Wait()
+	if err != nil || !state.Success() {
+		t.Fatalf("child process exit: %v, %v", state, err)
+	}
+}
@@ -0,0 +1,53 @@
+//go:build linux || darwin || dragonfly || freebsd || netbsd || openbsd
+
+/**
+* @File: listener_handoff_unix_test.go
+* @Author: Jason Woo
+* @Date: 2026/10/16 12:24
+**/
+
+package fastnet
+
+import (
+	"fmt"
+	"net"
+	"syscall"
+	"testing"
+)
+
+func TestInheritedListener(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	f, err := ln.(*net.TCPListener).File()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// InheritedListener会关闭继承的描述符，传入单独复制的描述符，避免f回收时重复关闭被复用的描述符
+	fd, err := syscall.Dup(int(f.Fd()))
+	_ = f.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Setenv(InheritListenerEnv, fmt.Sprintf("other:1=99,%s=%d", ln.Addr(), fd))
+	if got, err := InheritedListener("127.0.0.1:1"); got != nil || err != nil {
+		t.Fatalf("not inherited address: %v, %v", got, err)
+	}
+
+	got, err := InheritedListener(ln.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer got.Close()
+	if got.Addr().String() != ln.Addr().String() {
+		t.Fatalf("inherited addr = %s, want %s", got.Addr(), ln.Addr())
+	}
+
+	// 同一个监听只能继承一次
+	if again, err := InheritedListener(ln.Addr().String()); again != nil || err != nil {
+		t.Fatalf("inherit twice: %v, %v", again, err)
+	}
+}
@@ -9,6 +9,8 @@ package fastnet
 import (
 	"fmt"
 	"github.com/dyowoo/fastnet/xconf"
+	"github.com/dyowoo/fastnet/xlog"
+	"io"
 )
 
 var fastnetLog = `
@@ -21,10 +23,26 @@ var fastnetLog = `
   ░██  ░░████████ ██████   ░░██  ███  ░██░░██████  ░░██ 
   ░░    ░░░░░░░░ ░░░░░░     ░░  ░░░   ░░  ░░░░░░    ░░  `
 
+// PrintLogo 通过日志输出logo和版本信息，输出位置由xlog的配置决定，配置HideLogo为true时创建服务器不会调用
 func PrintLogo() {
-	fmt.Println(fastnetLog)
-	fmt.Printf("\n[FastNet] Version: %s, MaxConn: %d, MaxPacketSize: %d\n",
-		xconf.GlobalObject.Version,
-		xconf.GlobalObject.MaxConn,
-		xconf.GlobalObject.MaxPacketSize)
+	printLogo(xconf.GlobalObject)
+}
+
+// 输出logo和config中的版本信息，Server创建时传入自己的配置
+func printLogo(config *xconf.Config) {
+	xlog.Info(fastnetLog)
+	xlog.Info(versionBanner(config))
+}
+
+// FprintLogo 将logo和版本信息写入w，需要输出到日志以外的位置(例如命令行工具的标准输出)时使用
+func FprintLogo(w io.Writer) {
+	_, _ = fmt.Fprintln(w, fastnetLog)
+	_, _ = fmt.Fprintln(w, versionBanner(xconf.GlobalObject))
+}
+
+func versionBanner(config *xconf.Config) string {
+	return fmt.Sprintf("[FastNet] Version: %s, MaxConn: %d, MaxPacketSize: %d",
+		config.Version,
+		config.MaxConn,
+		config.MaxPacketSize)
 }
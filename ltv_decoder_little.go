@@ -71,8 +71,9 @@ func (ltv *LtvLittleDecoder) Intercept(chain IChain) IcResp {
 
 	data := message.GetData()
 
-	// 读取的数据不超过包头，直接进入下一层
-	if len(data) < LtvHeaderSize {
+	// 读取的数据不超过包头，或者不足一个完整的包(没有经过断粘包解码器)，上报后直接进入下一层
+	if len(data) < LtvHeaderSize || uint64(len(data)) < LtvHeaderSize+uint64(binary.LittleEndian.Uint32(data[0:4])) {
+		ReportDecodeError(chain.Request(), ErrIncompleteFrame, data)
 		return chain.ProceedWithIMessage(message, nil)
 	}
 
@@ -84,5 +85,9 @@ func (ltv *LtvLittleDecoder) Intercept(chain IChain) IcResp {
 	message.SetData(ltvData.Value)
 
 	// 将解码后的数据进入下一层
-	return chain.ProceedWithIMessage(message, *ltvData)
+	return proceedDecoded(chain, message, *ltvData, &DecodeResult{
+		MsgID: ltvData.Tag,
+		Body:  ltvData.Value,
+		Raw:   data,
+	})
 }
@@ -0,0 +1,84 @@
+/**
+* @File: max_conn_events.go
+* @Author: Jason Woo
+* @Date: 2026/10/16 13:29
+**/
+
+package fastnet
+
+import (
+	"github.com/dyowoo/fastnet/xlog"
+	"runtime/debug"
+	"sync/atomic"
+	"time"
+)
+
+// 链接数达到上限的事件：链接数达到MaxConn时调用OnMaxConnReached，之后有空闲时调用OnMaxConnRecovered，用于告警和自动扩容
+// 两个回调成对出现，链接数在MaxConn附近反复变化时，距离上一次OnMaxConnReached不足maxConnEventInterval的达到上限不再通知
+// 回调在accept协程(或websocket的升级请求)中同步调用，不能阻塞；没有设置回调时每次检查只多一次原子读取
+
+const maxConnEventInterval = time.Second // 两次OnMaxConnReached之间的最小间隔
+
+// MaxConnFunc 链接数达到上限或恢复时的回调，current为当时的链接数
+type MaxConnFunc func(current int)
+
+// maxConnEvents 链接数达到上限和恢复的事件通知，零值表示没有设置回调
+type maxConnEvents struct {
+	onReached   MaxConnFunc  // 链接数达到上限时的回调
+	onRecovered MaxConnFunc  // 链接数从上限恢复时的回调
+	saturated   atomic.Bool  // 是否已经通知了达到上限，尚未通知恢复
+	lastReached atomic.Int64 // 上一次通知达到上限的时间(UnixNano)
+}
+
+// 链接数达到上限
+func (e *maxConnEvents) reached(current int, now time.Time) {
+	if e.saturated.Load() || (e.onReached == nil && e.onRecovered == nil) {
+		return
+	}
+	if now.UnixNano()-e.lastReached.Load() < int64(maxConnEventInterval) {
+		return
+	}
+	// 多个accept协程同时达到上限时只通知一次
+	if !e.saturated.CompareAndSwap(false, true) {
+		return
+	}
+	e.lastReached.Store(now.UnixNano())
+
+	callMaxConnFunc("OnMaxConnReached", e.onReached, current)
+}
+
+// 链接数低于上限，之前通知过达到上限时通知恢复
+func (e *maxConnEvents) recovered(current int) {
+	if !e.saturated.Load() || !e.saturated.CompareAndSwap(true, false) {
+		return
+	}
+
+	callMaxConnFunc("OnMaxConnRecovered", e.onRecovered, current)
+}
+
+// 调用回调，回调发生的panic被记录后忽略，不影响accept
+func callMaxConnFunc(name string, hookFunc MaxConnFunc, current int) {
+	if hookFunc == nil {
+		return
+	}
+
+	defer func() {
+		if err := recover(); err != nil {
+			xlog.ErrorF("%s panic: %v\n%s", name, err, debug.Stack())
+		}
+	}()
+
+	hookFunc(current)
+}
+
+// SetOnMaxConnReached 设置链接数达到MaxConn时的回调，需要在Start之前调用，回调不能阻塞
+// 链接数在MaxConn附近反复变化时，最多每maxConnEventInterval通知一次
+func (s *Server) SetOnMaxConnReached(hookFunc MaxConnFunc) {
+	s.maxConnEvents.onReached = hookFunc
+}
+
+// SetOnMaxConnRecovered 设置链接数从MaxConn恢复到有空闲时的回调，需要在Start之前调用，回调不能阻塞
+// 每次恢复都对应之前的一次OnMaxConnReached
+func (s *Server) SetOnMaxConnRecovered(hookFunc MaxConnFunc) {
+	s.maxConnEvents.onRecovered = hookFunc
+}
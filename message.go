@@ -22,8 +22,13 @@ type Message struct {
 	ID      uint32 // ID of the message
 	Data    []byte // Content of the message
 	rawData []byte // Raw data of the message
+	version uint8  // 协议版本，只有带协议头的封包方式或解码器会设置
+
+	contentType ContentType // 消息数据的编码类型，只有带内容类型的协议头会设置
 }
 
+// NewMsgPackage 使用消息ID和消息内容创建一条消息，DataLen取data的长度
+// 自定义发送、测试DataPack的Pack/Unpack时使用该方法构造消息
 func NewMsgPackage(ID uint32, data []byte) *Message {
 	return &Message{
 		ID:      ID,
@@ -33,7 +38,16 @@ func NewMsgPackage(ID uint32, data []byte) *Message {
 	}
 }
 
-func NewMessage(len uint32, data []byte) *Message {
+// NewMessage 使用消息ID和消息内容创建一条消息，DataLen取data的长度，与NewMsgPackage相同
+// 自定义发送、测试DataPack的Pack/Unpack时使用
+// 注意旧版本的第一个参数是数据长度，原来用NewMessage(len, data)包装原始数据的代码请改用NewRawMessage
+func NewMessage(msgID uint32, data []byte) *Message {
+	return NewMsgPackage(msgID, data)
+}
+
+// NewRawMessage 使用原始数据创建一条尚未解码的消息，消息ID为0，即旧版本NewMessage(len, data)的行为
+// 链接读取到的数据通过该方法包装后交给解码器，解码器再通过SetMsgID/SetData/SetDataLen设置解码结果
+func NewRawMessage(len uint32, data []byte) *Message {
 	return &Message{
 		DataLen: len,
 		Data:    data,
@@ -41,6 +55,7 @@ func NewMessage(len uint32, data []byte) *Message {
 	}
 }
 
+// NewMessageByMsgId 使用消息ID、数据长度和消息内容创建一条消息
 func NewMessageByMsgId(id uint32, len uint32, data []byte) *Message {
 	return &Message{
 		ID:      id,
@@ -50,6 +65,7 @@ func NewMessageByMsgId(id uint32, len uint32, data []byte) *Message {
 	}
 }
 
+// Init 重新设置消息ID和消息内容，DataLen取data的长度
 func (msg *Message) Init(ID uint32, data []byte) {
 	msg.ID = ID
 	msg.Data = data
@@ -69,6 +85,7 @@ func (msg *Message) GetData() []byte {
 	return msg.Data
 }
 
+// GetRawData 获取创建消息时的原始数据，解码器通过SetData替换消息内容后仍可获取解码前的数据
 func (msg *Message) GetRawData() []byte {
 	return msg.rawData
 }
@@ -81,6 +98,26 @@ func (msg *Message) SetMsgID(msgID uint32) {
 	msg.ID = msgID
 }
 
+// GetVersion 获取消息的协议版本，没有协议头时为0
+func (msg *Message) GetVersion() uint8 {
+	return msg.version
+}
+
+func (msg *Message) SetVersion(version uint8) {
+	msg.version = version
+}
+
+// GetContentType 获取消息数据的编码类型，协议头没有携带编码类型时为ContentTypeDefault
+func (msg *Message) GetContentType() ContentType {
+	return msg.contentType
+}
+
+// SetContentType 设置消息数据的编码类型，使用带内容类型的协议头封包时写入包头
+func (msg *Message) SetContentType(contentType ContentType) {
+	msg.contentType = contentType
+}
+
+// SetData 设置消息内容，不会修改DataLen，需要时请同时调用SetDataLen
 func (msg *Message) SetData(data []byte) {
 	msg.Data = data
 }
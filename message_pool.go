@@ -0,0 +1,62 @@
+/**
+* @File: message_pool.go
+* @Author: Jason Woo
+* @Date: 2026/10/16 13:32
+**/
+
+package fastnet
+
+import "sync"
+
+// 消息对象池：链接读取到的每一帧和Unpack拆出的包头都从对象池获取Message，减少高消息速率下的GC压力
+// 消息的生命周期:
+//
+//	读协程 AcquireMessage -> 拦截器 -> Worker处理函数 -> 处理函数全部返回后 ReleaseMessage
+//
+// 只有配置了MessagePool时框架才会回收消息，回收后消息被其他请求复用，处理函数之外(例如新协程或缓存中)
+// 不能再通过request或request.GetMessage()读取消息，需要在处理函数返回之前取出MsgID、数据等所需的字段
+// 以下情况框架不回收消息，由GC回收: 设置了处理超时(超时后处理函数可能仍在运行)、消息被拦截器丢弃、使用自定义的IMsgHandle
+// 对象池只复用Message本身，消息数据仍由断粘包解码器分配
+
+var messagePool = sync.Pool{
+	New: func() interface{} {
+		return new(Message)
+	},
+}
+
+// AcquireMessage 从对象池获取一条消息，与NewMessage相同，len为数据长度，消息ID为0
+// 不再使用时可以通过ReleaseMessage放回对象池，不放回时由GC回收
+func AcquireMessage(len uint32, data []byte) *Message {
+	msg := messagePool.Get().(*Message)
+	msg.DataLen = len
+	msg.Data = data
+	msg.rawData = data
+
+	return msg
+}
+
+// ReleaseMessage 重置消息并放回对象池，放回之后不能再使用该消息及其数据
+// msg不是*Message时忽略
+func ReleaseMessage(msg IMessage) {
+	m, ok := msg.(*Message)
+	if !ok || m == nil {
+		return
+	}
+
+	m.Reset()
+	messagePool.Put(m)
+}
+
+// Reset 清空消息的所有字段，不再引用消息数据
+func (msg *Message) Reset() {
+	*msg = Message{}
+}
+
+// 处理函数全部返回后回收请求的消息，设置了处理超时时处理函数可能仍在运行，不回收
+func (mh *MsgHandle) releaseMessage(request IRequest, msgID uint32) {
+	if !mh.messagePool || mh.handlerTimeout(msgID) > 0 {
+		return
+	}
+
+	ReleaseMessage(request.GetMessage())
+}
@@ -0,0 +1,76 @@
+/**
+* @File: message_pool_test.go
+* @Author: Jason Woo
+* @Date: 2026/10/16 13:32
+**/
+
+package fastnet
+
+import (
+	"fmt"
+	"github.com/dyowoo/fastnet/xconf"
+	"github.com/dyowoo/fastnet/xlog"
+	"testing"
+	"time"
+)
+
+func TestMessagePoolRelease(t *testing.T) {
+	cases := []struct {
+		name     string
+		config   *xconf.Config
+		timeout  time.Duration
+		released bool
+	}{
+		{"disabled", &xconf.Config{}, 0, false},
+		{"enabled", &xconf.Config{MessagePool: true}, 0, true},
+		// 超时后处理函数可能仍在运行，不回收
+		{"handler-timeout", &xconf.Config{MessagePool: true}, time.Second, false},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			s := NewUserConfServer(c.config).(*Server)
+			mh := s.GetMsgHandler().(*MsgHandle)
+			mh.SetHandlerTimeout(1, c.timeout)
+
+			var got string
+			mh.AddRouterSlices(1, func(request IRequest) {
+				got = string(request.GetData())
+			})
+
+			msg := AcquireMessage(4, []byte("ping"))
+			msg.SetMsgID(1)
+			mh.dispatch(NewRequest(nil, msg), 0)
+
+			if got != "ping" {
+				t.Fatalf("handler got %q, want ping", got)
+			}
+			if released := msg.GetMsgID() == 0 && msg.GetData() == nil; released != c.released {
+				t.Fatalf("message released = %v, want %v", released, c.released)
+			}
+		})
+	}
+}
+
+// BenchmarkMessagePool 开启MessagePool前后每条消息的内存分配次数
+func BenchmarkMessagePool(b *testing.B) {
+	xlog.SetLogLevel(xlog.LogError)
+	defer xlog.SetLogLevel(xlog.LogDebug)
+
+	data := []byte("ping")
+	for _, pooled := range []bool{false, true} {
+		b.Run(fmt.Sprintf("pool=%v", pooled), func(b *testing.B) {
+			s := NewUserConfServer(&xconf.Config{MessagePool: pooled}).(*Server)
+			mh := s.GetMsgHandler().(*MsgHandle)
+			mh.AddRouterSlices(1, func(IRequest) {})
+
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				msg := AcquireMessage(uint32(len(data)), data)
+				msg.SetMsgID(1)
+				mh.dispatch(NewRequest(nil, msg), 0)
+			}
+		})
+	}
+}
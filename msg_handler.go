@@ -11,57 +11,173 @@ import (
 	"fmt"
 	"github.com/dyowoo/fastnet/xconf"
 	"github.com/dyowoo/fastnet/xlog"
+	"runtime/debug"
 	"sync"
+	"time"
 )
 
 type IMsgHandle interface {
 	AddRouter(msgID uint32, router IRouter)                                //
 	AddRouterSlices(msgId uint32, handler ...RouterHandler) IRouterSlices  //
+	TryAddRouterSlices(msgId uint32, handler ...RouterHandler) error       // 重复注册时返回错误而不是panic
+	RemoveRouterSlices(msgId uint32) bool                                  // 移除切片路由，可在服务运行期间调用
 	Group(start, end uint32, Handlers ...RouterHandler) IGroupRouterSlices //
 	Use(Handlers ...RouterHandler) IRouterSlices                           //
 	StartWorkerPool()                                                      // Start the worker pool
+	StopWorkerPool()                                                       // 停止Worker工作池，等待队列中已有的消息处理完成后返回
+	SetTaskQueueFactory(factory TaskQueueFactory)                          // 设置创建Worker任务队列的方法，需要在StartWorkerPool之前调用
+	MsgLatency() map[uint32]MsgLatencyStats                                // 获取每个MsgID的处理耗时统计
 	SendMsgToTaskQueue(request IRequest)                                   // 将消息交给TaskQueue,由worker进行处理
 	Execute(request IRequest)                                              // 执行责任链上的拦截器方法
 	AddInterceptor(interceptor IInterceptor)                               // 注册责任链任务入口，每个拦截器处理完后，数据都会传递至下一个拦截器，使得消息可以层层处理层层传递，顺序取决于注册顺序
+	WorkerPoolSize() uint32                                                // 获取Worker工作池的数量
+	WorkerQueueDepth(workerID uint32) int                                  // 获取指定Worker任务队列中等待处理的消息数量
+	WorkerUtilization() WorkerUtilization                                  // 获取Worker工作池的使用率和平均队列积压
+	SetPanicHandler(handler PanicHandler)                                  // 设置业务处理发生panic时的回调，默认只记录日志
+	HandlePanic(request IRequest, recovered interface{}, stack []byte)     // 将捕获的panic交给当前的panic回调处理
+	SetHandlerTimeout(msgID uint32, d time.Duration)                       // 设置指定MsgID的处理超时时间，超时后worker不再等待该处理函数
+	SetDefaultHandlerTimeout(d time.Duration)                              // 设置默认的处理超时时间，小于等于0时不限制
+	SetMsgPriority(msgID uint32, priority int)                             // 设置MsgID的优先级，数值越大越先处理，需要在StartWorkerPool之前调用
+	SetCodec(codec ICodec)                                                 // 设置类型化路由使用的编解码器，默认为JSONCodec
+	GetCodec() ICodec                                                      // 获取类型化路由使用的编解码器
+	SetBindErrorHandler(handler BindErrorFunc)                             // 设置类型化路由解析消息数据失败时的回调，默认记录日志后丢弃
+	HandleBindError(request IRequest, err error)                           // 将解析消息数据失败的请求交给回调处理
+	SetRouteKeyFunc(f RouteKeyFunc)                                        // 设置自定义路由键的提取方法，返回""时按MsgID路由
+	AddKeyRouter(key RouteKey, handlers ...RouterHandler)                  // 按自定义路由键注册处理器集合
+	RemoveKeyRouter(key RouteKey) bool                                     // 移除自定义路由键的处理器集合
+	SetOnMessage(hookFunc func(IRequest))                                  // 设置每条消息在路由之前都会调用的回调，回调中Abort可丢弃该消息
+	DumpRoutes() []RouteInfo                                               // 导出所有已注册的路由，按MsgID排序
+}
+
+// PanicHandler 业务处理发生panic时的回调
+// request 发生panic的请求，函数式请求(IFuncRequest)时为nil
+// recovered recover()得到的值
+// stack 发生panic时的完整堆栈
+type PanicHandler func(request IRequest, recovered interface{}, stack []byte)
+
+// DefaultPanicHandler 默认的panic回调，只记录日志
+func DefaultPanicHandler(request IRequest, recovered interface{}, stack []byte) {
+	if request == nil {
+		xlog.ErrorF("func request panic: %v\n%s", recovered, stack)
+		return
+	}
+	conn := request.GetConnection()
+	if conn == nil {
+		xlog.ErrorF("msgID = %s handler panic: %v\n%s", msgIDString(request.GetMsgID()), recovered, stack)
+		return
+	}
+	xlog.ErrorF("workerID: %d connID = %d, msgID = %s handler panic: %v\n%s",
+		conn.GetWorkerID(), conn.GetConnID(), msgIDString(request.GetMsgID()), recovered, stack)
 }
 
 const (
 	// WorkerIDWithoutWorkerPool (如果不启动Worker协程池，则会给MsgHandler分配一个虚拟的WorkerID，这个workerID为0, 便于指标统计
 	// 启动了Worker协程池后，每个worker的ID为0,1,2,3...)
 	WorkerIDWithoutWorkerPool int = 0
+
+	// Bind模式下工作池超过该数量时在启动时给出警告，每个worker都是一个常驻协程和一条任务队列
+	bindWorkerPoolWarnSize uint32 = 1024
 )
 
 // MsgHandle 对消息的处理回调模块
 type MsgHandle struct {
-	routers        map[uint32]IRouter  // 存放每个MsgID 所对应的处理方法的map属性
-	workerPoolSize uint32              // 业务工作Worker池的数量
-	freeWorkers    map[uint32]struct{} // 空闲worker集合
-	freeWorkerMu   sync.Mutex
-	TaskQueue      []chan IRequest // Worker负责取任务的消息队列
-	builder        *chainBuilder   // 责任链构造器
-	routerSlices   *RouterSlices
+	routers          map[uint32]IRouter  // 存放每个MsgID 所对应的处理方法的map属性
+	routersLock      sync.RWMutex        // 保护routers，允许在服务运行期间注册路由和导出路由表
+	workerPoolSize   uint32              // 业务工作Worker池的数量，创建时从配置中获取，之后不再读取全局配置
+	maxWorkerTaskLen uint32              // 每个Worker任务队列的长度，创建时从配置中获取
+	workerMode       string              // Worker的分配方式，创建时从配置中获取
+	routerSlicesMode bool                // 路由模式，创建时从配置中获取，之后不再读取全局配置
+	messagePool      bool                // 处理完成后是否回收消息对象，创建时从配置中获取
+	handlerSem       chan struct{}       // 不启动工作池时限制同时处理消息的协程数，为nil时不限制
+	freeWorkers      map[uint32]struct{} // 空闲worker集合
+	workerOwners     map[uint32]uint64   // Bind模式下独占worker的链接ID，空闲worker用完后共用的worker不在其中
+	affinityWorkers  map[string]uint32   // Bind模式下worker亲和key最近一次绑定的worker
+	workerAffinity   map[uint32]string   // Bind模式下每个worker最近一次绑定的亲和key
+	freeWorkerMu     sync.Mutex
+	TaskQueue        []ITaskQueue     // Worker负责取任务的消息队列
+	taskQueueFactory TaskQueueFactory // 创建Worker任务队列的方法，为nil时使用先进先出队列
+	builder          *chainBuilder    // 责任链构造器
+	routerSlices     *RouterSlices
+	panicHandler     PanicHandler // 业务处理发生panic时的回调
+
+	latency latencyRecorder // 每个MsgID的处理耗时统计
+
+	workerExit chan struct{}  // 关闭时通知所有worker退出，工作池未启动时为nil
+	workerWg   sync.WaitGroup // 等待所有worker退出
+	workerLock sync.Mutex     // 保护工作池的启动和停止
+
+	handlerTimeouts map[uint32]time.Duration // 每个MsgID的处理超时时间
+	defaultTimeout  time.Duration            // 默认的处理超时时间，为0时不限制
+	timeoutLock     sync.RWMutex             // 保护处理超时时间的设置
+
+	priorities   map[uint32]int // 每个MsgID的优先级，没有设置优先级时worker使用先进先出队列
+	priorityLock sync.RWMutex   // 保护优先级的设置
+
+	codec            ICodec        // 类型化路由使用的编解码器
+	bindErrorHandler BindErrorFunc // 类型化路由解析消息数据失败时的回调
+
+	routeKeyFunc RouteKeyFunc // 自定义路由键的提取方法，为nil时只按MsgID路由
+	keyRoutes    keyRouter    // 按自定义路由键注册的处理器集合
+
+	usage workerUsage // worker是否正在处理消息及累计处理时间，用于统计工作池使用率
+
+	onMessage func(IRequest) // 每条消息在路由之前调用的回调，为nil时不调用
 }
 
 func newMsgHandle() *MsgHandle {
+	return newMsgHandleWithConfig(xconf.GlobalObject)
+}
+
+// NewMsgHandle 创建默认的消息处理模块，与NewUserConfServer相同，config中非零值的参数覆盖全局配置，config为nil时使用全局配置
+// 自定义消息分发(例如转发到消息总线)时可以嵌入它，只重写需要的方法，再通过WithMsgHandler注入Server
+func NewMsgHandle(config *xconf.Config) *MsgHandle {
+	if config == nil {
+		config = &xconf.Config{}
+	}
+	return newMsgHandleWithConfig(mergeUserConf(config))
+}
+
+// newMsgHandleWithConfig 根据config创建消息处理模块，之后不再读取配置
+func newMsgHandleWithConfig(config *xconf.Config) *MsgHandle {
+	workerPoolSize := config.WorkerPoolSize
 	var freeWorkers map[uint32]struct{}
-	if xconf.GlobalObject.WorkerMode == xconf.WorkerModeBind {
+	var workerOwners map[uint32]uint64
+	if config.WorkerMode == xconf.WorkerModeBind {
 		// 为每个链接分配一个worker，避免同一worker处理多个链接时的互相影响
 		// 同时可以减小MaxWorkerTaskLen，比如50，因为每个worker的负担减轻了
-		xconf.GlobalObject.WorkerPoolSize = uint32(xconf.GlobalObject.MaxConn)
-		freeWorkers = make(map[uint32]struct{}, xconf.GlobalObject.WorkerPoolSize)
+		// workerID的范围与TaskQueue的长度一致，都是[0, MaxConn)
+		workerPoolSize = uint32(config.MaxConn)
+		freeWorkers = make(map[uint32]struct{}, workerPoolSize)
+		workerOwners = make(map[uint32]uint64, workerPoolSize)
 
-		for i := uint32(0); i < xconf.GlobalObject.WorkerPoolSize; i++ {
+		for i := uint32(0); i < workerPoolSize; i++ {
 			freeWorkers[i] = struct{}{}
 		}
 	}
 
 	handle := &MsgHandle{
-		routers:        make(map[uint32]IRouter),
-		routerSlices:   NewRouterSlices(),
-		workerPoolSize: xconf.GlobalObject.WorkerPoolSize,
-		TaskQueue:      make([]chan IRequest, xconf.GlobalObject.WorkerPoolSize),
-		freeWorkers:    freeWorkers,
-		builder:        newChainBuilder(),
+		routers:          make(map[uint32]IRouter),
+		routerSlices:     NewRouterSlices(),
+		workerPoolSize:   workerPoolSize,
+		maxWorkerTaskLen: config.MaxWorkerTaskLen,
+		workerMode:       config.WorkerMode,
+		routerSlicesMode: config.RouterSlicesMode,
+		messagePool:      config.MessagePool,
+		handlerSem:       newHandlerSem(config.MaxConcurrentHandlers),
+		TaskQueue:        make([]ITaskQueue, workerPoolSize),
+		freeWorkers:      freeWorkers,
+		workerOwners:     workerOwners,
+		usage:            newWorkerUsage(workerPoolSize),
+		builder:          newChainBuilder(),
+		panicHandler:     DefaultPanicHandler,
+
+		handlerTimeouts: make(map[uint32]time.Duration),
+		defaultTimeout:  config.HandlerTimeoutDuration(),
+
+		priorities: make(map[uint32]int),
+
+		codec:            JSONCodec{},
+		bindErrorHandler: BindErrorLog,
 	}
 
 	// 此处必须把 msgHandler 添加到责任链中，并且是责任链最后一环，在msgHandler中进行解码后由router做数据分发
@@ -70,29 +186,81 @@ func newMsgHandle() *MsgHandle {
 	return handle
 }
 
+func newHandlerSem(maxHandlers int) chan struct{} {
+	if maxHandlers <= 0 {
+		return nil
+	}
+	return make(chan struct{}, maxHandlers)
+}
+
+// newClientMsgHandle 客户端不启动Worker工作池，每条消息在新的协程中处理
+func newClientMsgHandle(config *xconf.Config) *MsgHandle {
+	handle := newMsgHandleWithConfig(config)
+	handle.workerPoolSize = 0
+	handle.TaskQueue = nil
+	handle.freeWorkers = nil
+	handle.workerOwners = nil
+	handle.usage = newWorkerUsage(0)
+
+	return handle
+}
+
+// 嵌入了*MsgHandle的自定义消息处理模块同样实现该接口
+type msgHandleEmbedder interface {
+	msgHandle() *MsgHandle
+}
+
+func (mh *MsgHandle) msgHandle() *MsgHandle {
+	return mh
+}
+
+// 获取消息处理模块中的*MsgHandle，完全自定义的IMsgHandle返回nil，由其自行分配worker和路由
+func asMsgHandle(handler IMsgHandle) *MsgHandle {
+	if embedder, ok := handler.(msgHandleEmbedder); ok {
+		return embedder.msgHandle()
+	}
+	return nil
+}
+
 // Use worker ID
 // 占用workerID
 func useWorker(conn IConnection) uint32 {
-	mh, _ := conn.GetMsgHandler().(*MsgHandle)
+	mh := asMsgHandle(conn.GetMsgHandler())
 	if mh == nil {
-		xlog.ErrorF("useWorker failed, mh is nil")
 		return 0
 	}
 
-	if xconf.GlobalObject.WorkerMode == xconf.WorkerModeBind {
+	key := workerAffinityKey(conn)
+
+	if mh.workerMode == xconf.WorkerModeBind {
 		mh.freeWorkerMu.Lock()
 		defer mh.freeWorkerMu.Unlock()
 
+		// 优先使用亲和key上次绑定的worker
+		if k, ok := mh.takeAffinityWorker(key); ok {
+			mh.workerOwners[k] = conn.GetConnID()
+			return k
+		}
 		for k := range mh.freeWorkers {
 			delete(mh.freeWorkers, k)
+			mh.workerOwners[k] = conn.GetConnID()
+			if key != "" {
+				mh.rememberAffinity(k, key)
+			}
 			return k
 		}
+		// 空闲worker已经用完(例如MaxConn之外的链接)，按下面的取余方式与其他链接共用worker
 	}
 
 	if mh.workerPoolSize <= 0 {
 		return 0
 	}
 
+	// 设置了亲和key时按key分配，重连后仍然分配到同一个worker
+	if key != "" {
+		return affinityHash(key) % mh.workerPoolSize
+	}
+
 	// 根据ConnID来分配当前的连接应该由哪个worker负责处理
 	// 轮询的平均分配法则
 	// 得到需要处理此条连接的workerID
@@ -101,17 +269,21 @@ func useWorker(conn IConnection) uint32 {
 
 // 释放workerID
 func freeWorker(conn IConnection) {
-	mh, _ := conn.GetMsgHandler().(*MsgHandle)
+	mh := asMsgHandle(conn.GetMsgHandler())
 	if mh == nil {
-		xlog.ErrorF("useWorker failed, mh is nil")
 		return
 	}
 
-	if xconf.GlobalObject.WorkerMode == xconf.WorkerModeBind {
+	if mh.workerMode == xconf.WorkerModeBind {
 		mh.freeWorkerMu.Lock()
 		defer mh.freeWorkerMu.Unlock()
 
-		mh.freeWorkers[conn.GetWorkerID()] = struct{}{}
+		// 只归还该链接独占的worker，共用的worker仍属于原来的链接
+		workerID := conn.GetWorkerID()
+		if owner, ok := mh.workerOwners[workerID]; ok && owner == conn.GetConnID() {
+			delete(mh.workerOwners, workerID)
+			mh.freeWorkers[workerID] = struct{}{}
+		}
 	}
 }
 
@@ -124,17 +296,28 @@ func (mh *MsgHandle) Intercept(chain IChain) IcResp {
 		case IRequest:
 			iRequest := request.(IRequest)
 
-			if xconf.GlobalObject.WorkerPoolSize > 0 {
+			// 协商了压缩算法的链接先解压，解压失败的消息被丢弃
+			if !decompressRequest(iRequest) {
+				break
+			}
+			// 框架保留的控制消息不交给路由处理
+			if handleControlMsg(iRequest) {
+				break
+			}
+			// 分片消息收齐之后还原为原始消息再交给路由处理
+			if iRequest.GetMsgID() == FragmentMsgID {
+				if iRequest = reassembleFragment(iRequest); iRequest == nil {
+					break
+				}
+			}
+
+			// 只使用创建时确定的工作池数量和路由模式，运行期间修改全局配置不会影响消息分发
+			if mh.workerPoolSize > 0 {
 				// 已经启动工作池机制，将消息交给Worker处理
 				mh.SendMsgToTaskQueue(iRequest)
 			} else {
 				// 从绑定好的消息和对应的处理方法中执行对应的Handle方法
-				if !xconf.GlobalObject.RouterSlicesMode {
-					go mh.doMsgHandler(iRequest, WorkerIDWithoutWorkerPool)
-				} else if xconf.GlobalObject.RouterSlicesMode {
-					go mh.doMsgHandlerSlices(iRequest, WorkerIDWithoutWorkerPool)
-				}
-
+				mh.goMsgHandler(iRequest)
 			}
 		}
 	}
@@ -142,6 +325,32 @@ func (mh *MsgHandle) Intercept(chain IChain) IcResp {
 	return chain.Proceed(chain.Request())
 }
 
+// goMsgHandler 不启动工作池时在新的协程中处理消息
+// 同时处理的协程数达到MaxConcurrentHandlers时阻塞当前链接的读协程，直到有协程处理完成或链接断开
+func (mh *MsgHandle) goMsgHandler(request IRequest) {
+	if mh.handlerSem != nil {
+		var done <-chan struct{}
+		if conn := request.GetConnection(); conn != nil && conn.Context() != nil {
+			done = conn.Context().Done()
+		}
+
+		select {
+		case mh.handlerSem <- struct{}{}:
+		case <-done:
+			xlog.ErrorF("connection closed, drop msgID = %s", msgIDString(request.GetMsgID()))
+			return
+		}
+	}
+
+	go func() {
+		if mh.handlerSem != nil {
+			defer func() { <-mh.handlerSem }()
+		}
+
+		mh.dispatch(request, WorkerIDWithoutWorkerPool)
+	}()
+}
+
 func (mh *MsgHandle) AddInterceptor(interceptor IInterceptor) {
 	if mh.builder != nil {
 		mh.builder.AddInterceptor(interceptor)
@@ -151,41 +360,123 @@ func (mh *MsgHandle) AddInterceptor(interceptor IInterceptor) {
 // SendMsgToTaskQueue 将消息交给TaskQueue,由worker进行处理
 func (mh *MsgHandle) SendMsgToTaskQueue(request IRequest) {
 	workerID := request.GetConnection().GetWorkerID()
-	mh.TaskQueue[workerID] <- request
-	xlog.DebugF("sendMsgToTaskQueue-->%s", hex.EncodeToString(request.GetData()))
+	if int(workerID) >= len(mh.TaskQueue) {
+		xlog.ErrorF("connID = %d workerID = %d out of range, worker pool size = %d, drop msgID = %s",
+			request.GetConnection().GetConnID(), workerID, len(mh.TaskQueue), msgIDString(request.GetMsgID()))
+		return
+	}
+	taskQueue := mh.TaskQueue[workerID]
+	if taskQueue == nil {
+		xlog.ErrorF("worker pool is not started, drop msgID = %s", msgIDString(request.GetMsgID()))
+		return
+	}
+	// 入队之后worker可能已经开始处理并修改该请求，需要在入队之前记录日志
+	xlog.DebugF("sendMsgToTaskQueue msgID = %s -->%s", msgIDString(request.GetMsgID()), hex.EncodeToString(request.GetData()))
+	taskQueue.Enqueue(request)
+}
+
+// WorkerPoolSize 获取Worker工作池的数量
+func (mh *MsgHandle) WorkerPoolSize() uint32 {
+	return mh.workerPoolSize
+}
+
+// WorkerQueueDepth 获取指定Worker任务队列中等待处理的消息数量，用于诊断Worker负载是否均衡
+// workerID不存在或工作池未启动时返回0
+func (mh *MsgHandle) WorkerQueueDepth(workerID uint32) int {
+	if int(workerID) >= len(mh.TaskQueue) || mh.TaskQueue[workerID] == nil {
+		return 0
+	}
+
+	return mh.TaskQueue[workerID].Len()
+}
+
+// SetPanicHandler 设置业务处理发生panic时的回调，传入nil时恢复为默认的只记录日志
+func (mh *MsgHandle) SetPanicHandler(handler PanicHandler) {
+	if handler == nil {
+		handler = DefaultPanicHandler
+	}
+	mh.panicHandler = handler
+}
+
+// HandlePanic 将捕获的panic交给panic回调处理，回调自身发生的panic会被记录并忽略
+// 请求所在的路由或分组设置了错误处理回调时，交给该回调处理，不再调用全局的panic回调
+func (mh *MsgHandle) HandlePanic(request IRequest, recovered interface{}, stack []byte) {
+	defer func() {
+		if err := recover(); err != nil {
+			xlog.ErrorF("panic handler panic: %v", err)
+		}
+	}()
+
+	handler := mh.panicHandler
+	if h := requestErrorHandler(request); h != nil {
+		handler = h
+	}
+	handler(request, recovered, stack)
 }
 
 // doFuncHandler 执行函数式请求
 func (mh *MsgHandle) doFuncHandler(request IFuncRequest, workerID int) {
 	defer func() {
 		if err := recover(); err != nil {
-			xlog.ErrorF("workerID: %d doFuncRequest panic: %v", workerID, err)
+			mh.HandlePanic(nil, err, debug.Stack())
 		}
 	}()
 
 	request.CallFunc()
 }
 
-// 立即以非阻塞方式处理消息
-func (mh *MsgHandle) doMsgHandler(request IRequest, workerID int) {
+// 立即以非阻塞方式处理消息，没有找到对应的路由时found为false
+func (mh *MsgHandle) doMsgHandler(request IRequest, workerID int) (found bool) {
 	defer func() {
 		if err := recover(); err != nil {
-			xlog.ErrorF("workerID: %d doMsgHandler panic: %v", workerID, err)
+			mh.HandlePanic(request, err, debug.Stack())
 		}
 	}()
 
 	msgId := request.GetMsgID()
-	handler, ok := mh.routers[msgId]
+	handler, ok := mh.getRouter(msgId)
 
 	if !ok {
-		xlog.ErrorF("api msgID = %d is not FOUND!", request.GetMsgID())
+		xlog.ErrorF("api msgID = %s is not FOUND!", msgIDString(request.GetMsgID()))
 		return
 	}
+	found = true
 
 	// Request请求绑定Router对应关系
 	request.BindRouter(handler)
 
-	request.Call()
+	if !mh.callWithTimeout(request, request.Call) {
+		return
+	}
+
+	mh.sendResponse(request)
+	return
+}
+
+// sendResponse 处理器通过SetResponse设置了回复数据时，在处理链执行完成后自动回复给对端
+// 回复数据为[]byte时使用请求的MsgID回复，为IMessage(如NewMsgPackage)时使用其中的MsgID回复
+// 解码器通过SetResponse传递的解码结果不属于以上两种类型，不会被发送
+func (mh *MsgHandle) sendResponse(request IRequest) {
+	var msgID uint32
+	var data []byte
+
+	switch resp := request.GetResponse().(type) {
+	case IMessage:
+		msgID, data = resp.GetMsgID(), resp.GetData()
+	case []byte:
+		msgID, data = request.GetMsgID(), resp
+	default:
+		return
+	}
+
+	conn := request.GetConnection()
+	if conn == nil {
+		return
+	}
+
+	if err := conn.SendMsg(msgID, data); err != nil {
+		xlog.ErrorF("send response error, msgID = %s, err = %v", msgIDString(msgID), err)
+	}
 }
 
 func (mh *MsgHandle) Execute(request IRequest) {
@@ -193,25 +484,68 @@ func (mh *MsgHandle) Execute(request IRequest) {
 	mh.builder.Execute(request)
 }
 
-// AddRouter 为消息添加具体的处理逻辑
+// AddRouter 为消息添加具体的处理逻辑，RouterSlices模式下通过AdaptRouter适配为切片路由
 func (mh *MsgHandle) AddRouter(msgID uint32, router IRouter) {
+	if mh.routerSlicesMode {
+		mh.routerSlices.AddHandler(msgID, routerHandlers(router)...)
+		xlog.InfoF("add router msgID = %s as router slices", msgIDString(msgID))
+		return
+	}
+
+	mh.routersLock.Lock()
 	// 判断当前msg绑定的API处理方法是否已经存在
 	if _, ok := mh.routers[msgID]; ok {
-		msgErr := fmt.Sprintf("repeated api , msgID = %+v\n", msgID)
+		mh.routersLock.Unlock()
+		msgErr := fmt.Sprintf("repeated api , msgID = %s\n", msgIDString(msgID))
 		panic(msgErr)
 	}
 
 	// 添加msg与api的绑定关系
 	mh.routers[msgID] = router
-	xlog.InfoF("add router msgID = %d", msgID)
+	mh.routersLock.Unlock()
+	xlog.InfoF("add router msgID = %s", msgIDString(msgID))
+}
+
+// 获取旧版路由
+func (mh *MsgHandle) getRouter(msgID uint32) (IRouter, bool) {
+	mh.routersLock.RLock()
+	defer mh.routersLock.RUnlock()
+
+	router, ok := mh.routers[msgID]
+	return router, ok
+}
+
+// 是否注册了旧版路由
+func (mh *MsgHandle) hasRouter(msgID uint32) bool {
+	_, ok := mh.getRouter(msgID)
+	return ok
 }
 
 // AddRouterSlices 切片路由添加
 func (mh *MsgHandle) AddRouterSlices(msgId uint32, handler ...RouterHandler) IRouterSlices {
 	mh.routerSlices.AddHandler(msgId, handler...)
+	xlog.InfoF("add router slices msgID = %s", msgIDString(msgId))
 	return mh.routerSlices
 }
 
+// TryAddRouterSlices 切片路由添加，重复注册时返回错误
+func (mh *MsgHandle) TryAddRouterSlices(msgId uint32, handler ...RouterHandler) error {
+	if err := mh.routerSlices.TryAddHandler(msgId, handler...); err != nil {
+		return err
+	}
+	xlog.InfoF("add router slices msgID = %s", msgIDString(msgId))
+	return nil
+}
+
+// RemoveRouterSlices 移除切片路由，可在服务运行期间与消息处理并发调用
+func (mh *MsgHandle) RemoveRouterSlices(msgId uint32) bool {
+	if !mh.routerSlices.RemoveHandler(msgId) {
+		return false
+	}
+	xlog.InfoF("remove router slices msgID = %s", msgIDString(msgId))
+	return true
+}
+
 // Group 路由分组
 func (mh *MsgHandle) Group(start, end uint32, Handlers ...RouterHandler) IGroupRouterSlices {
 	return NewGroup(start, end, mh.routerSlices, Handlers...)
@@ -222,56 +556,221 @@ func (mh *MsgHandle) Use(Handlers ...RouterHandler) IRouterSlices {
 	return mh.routerSlices
 }
 
-func (mh *MsgHandle) doMsgHandlerSlices(request IRequest, workerID int) {
+func (mh *MsgHandle) doMsgHandlerSlices(request IRequest, workerID int) (found bool) {
 	defer func() {
 		if err := recover(); err != nil {
-			xlog.ErrorF("workerID: %d doMsgHandler panic: %v", workerID, err)
+			mh.HandlePanic(request, err, debug.Stack())
 		}
 	}()
 
 	msgId := request.GetMsgID()
 	handlers, ok := mh.routerSlices.GetHandlers(msgId)
 	if !ok {
-		xlog.ErrorF("api msgID = %d is not FOUND!", request.GetMsgID())
+		xlog.ErrorF("api msgID = %s is not FOUND!", msgIDString(request.GetMsgID()))
 		return
 	}
+	found = true
 
 	request.BindRouterSlices(handlers)
-	request.RouterSlicesNext()
+	bindRouteErrorHandler(request, mh.routerSlices.errorHandler(msgId))
+	if !mh.callWithTimeout(request, request.RouterSlicesNext) {
+		return
+	}
+
+	mh.sendResponse(request)
+	return
 }
 
 // StartOneWorker 启动一个Worker工作流程
-func (mh *MsgHandle) StartOneWorker(workerID int, taskQueue chan IRequest) {
+func (mh *MsgHandle) StartOneWorker(workerID int, taskQueue ITaskQueue) {
+	mh.runWorker(workerID, taskQueue, nil)
+}
+
+// runWorker worker的处理循环，exit关闭后处理完队列中已有的消息再退出
+func (mh *MsgHandle) runWorker(workerID int, taskQueue ITaskQueue, exit chan struct{}) {
 	xlog.InfoF("Worker ID = %d is started.", workerID)
 
-	// 不断地等待队列中的消息
+	// 不断地等待队列中的消息，有消息则取出队列的Request，并执行绑定的业务方法
 	for {
-		select {
-		// 有消息则取出队列的Request，并执行绑定的业务方法
-		case request := <-taskQueue:
-			switch req := request.(type) {
-			case IFuncRequest:
-				// 内部函数调用request
-				mh.doFuncHandler(req, workerID)
-			case IRequest:
-				if !xconf.GlobalObject.RouterSlicesMode {
-					mh.doMsgHandler(req, workerID)
-				} else if xconf.GlobalObject.RouterSlicesMode {
-					mh.doMsgHandlerSlices(req, workerID)
-				}
-			}
+		request, ok := taskQueue.Dequeue(exit)
+		if !ok {
+			break
+		}
+		since := mh.usage.begin(workerID)
+		mh.doRequest(request, workerID)
+		mh.usage.end(workerID, since)
+	}
+
+	// 退出之前处理完队列中已有的消息
+	for {
+		request, ok := taskQueue.TryDequeue()
+		if !ok {
+			break
+		}
+		since := mh.usage.begin(workerID)
+		mh.doRequest(request, workerID)
+		mh.usage.end(workerID, since)
+	}
+	xlog.InfoF("Worker ID = %d is stopped.", workerID)
+}
+
+func (mh *MsgHandle) doRequest(request IRequest, workerID int) {
+	switch req := request.(type) {
+	case IFuncRequest:
+		// 内部函数调用request
+		mh.doFuncHandler(req, workerID)
+	case IRequest:
+		mh.dispatch(req, workerID)
+	}
+}
+
+// dispatch 按路由模式处理消息，并记录处理耗时
+func (mh *MsgHandle) dispatch(request IRequest, workerID int) {
+	// 处理过程中Redirect会修改MsgID，按收到时的MsgID统计
+	msgID := request.GetMsgID()
+	start := time.Now()
+	defer mh.releaseMessage(request, msgID)
+
+	if !mh.callOnMessage(request) {
+		return
+	}
+
+	key, ok := mh.routeKey(request)
+	if !ok {
+		return
+	}
+
+	var found bool
+	if key != "" {
+		found = mh.doKeyRouter(request, key)
+	} else if mh.routerSlicesMode || !mh.hasRouter(msgID) {
+		// 旧版路由模式下通过AddRouterSlices注册的切片路由同样按切片路由处理
+		found = mh.doMsgHandlerSlices(request, workerID)
+	} else {
+		found = mh.doMsgHandler(request, workerID)
+	}
+
+	// 只统计已注册的MsgID，避免对端发送任意MsgID导致统计无限增长
+	if found {
+		mh.latency.observe(msgID, time.Since(start))
+	}
+}
+
+// SetOnMessage 设置每条消息在路由之前都会调用的回调，两种路由模式都生效，需要在Start之前调用
+// 用于审计、按消息统计等与具体路由无关的逻辑，回调中调用request.Abort()可丢弃该消息
+func (mh *MsgHandle) SetOnMessage(hookFunc func(IRequest)) {
+	mh.onMessage = hookFunc
+}
+
+// 调用OnMessage回调，消息被Abort或回调发生panic时返回false，该消息不再交给路由处理
+func (mh *MsgHandle) callOnMessage(request IRequest) (proceed bool) {
+	if mh.onMessage == nil {
+		return true
+	}
+
+	defer func() {
+		if err := recover(); err != nil {
+			mh.HandlePanic(request, err, debug.Stack())
+			proceed = false
 		}
+	}()
+
+	mh.onMessage(request)
+	return !request.IsAborted()
+}
+
+// MsgLatency 获取每个MsgID的处理耗时统计
+func (mh *MsgHandle) MsgLatency() map[uint32]MsgLatencyStats {
+	return mh.latency.snapshot()
+}
+
+// SetTaskQueueFactory 设置创建Worker任务队列的方法，需要在StartWorkerPool之前调用
+// 例如使用按优先级出队的队列:
+//
+//	mh.SetTaskQueueFactory(func(workerID int, capacity int) ITaskQueue {
+//		return NewPriorityTaskQueue(capacity, priorityOf)
+//	})
+func (mh *MsgHandle) SetTaskQueueFactory(factory TaskQueueFactory) {
+	mh.workerLock.Lock()
+	defer mh.workerLock.Unlock()
+
+	mh.taskQueueFactory = factory
+}
+
+func (mh *MsgHandle) newTaskQueue(workerID int) ITaskQueue {
+	capacity := int(mh.maxWorkerTaskLen)
+	if mh.taskQueueFactory != nil {
+		return mh.taskQueueFactory(workerID, capacity)
+	}
+	if mh.hasMsgPriority() {
+		return NewPriorityTaskQueue(capacity, mh.msgPriority)
 	}
+	return NewFIFOTaskQueue(capacity)
 }
 
 // StartWorkerPool starts the worker pool
 func (mh *MsgHandle) StartWorkerPool() {
+	mh.workerLock.Lock()
+	defer mh.workerLock.Unlock()
+
+	// 工作池已经启动
+	if mh.workerExit != nil {
+		return
+	}
+	mh.workerExit = make(chan struct{})
+	mh.reportWorkerPool()
+
 	// 遍历需要启动worker的数量，依此启动
 	for i := 0; i < int(mh.workerPoolSize); i++ {
-		// 给当前worker对应的任务队列开辟空间
-		mh.TaskQueue[i] = make(chan IRequest, xconf.GlobalObject.MaxWorkerTaskLen)
+		// 给当前worker对应的任务队列开辟空间，重新启动时复用已有的队列
+		if mh.TaskQueue[i] == nil {
+			mh.TaskQueue[i] = mh.newTaskQueue(i)
+		}
 
 		// 启动当前Worker，阻塞的等待对应的任务队列是否有消息传递进来
-		go mh.StartOneWorker(i, mh.TaskQueue[i])
+		mh.workerWg.Add(1)
+		go func(workerID int, taskQueue ITaskQueue, exit chan struct{}) {
+			defer mh.workerWg.Done()
+			mh.runWorker(workerID, taskQueue, exit)
+		}(i, mh.TaskQueue[i], mh.workerExit)
+	}
+
+	// 定时采样队列积压和处理时间，用于按窗口统计工作池使用率
+	if mh.workerPoolSize > 0 {
+		mh.workerWg.Add(1)
+		go func(exit chan struct{}) {
+			defer mh.workerWg.Done()
+			mh.sampleUsage(exit)
+		}(mh.workerExit)
+	}
+}
+
+// 记录实际生效的worker分配方式和工作池大小，Bind模式按MaxConn创建worker，工作池过大时给出警告
+func (mh *MsgHandle) reportWorkerPool() {
+	mode := mh.workerMode
+	if mode == "" {
+		mode = xconf.WorkerModeHash
+	}
+	xlog.InfoF("worker pool: mode = %s, size = %d, max task len = %d", mode, mh.workerPoolSize, mh.maxWorkerTaskLen)
+
+	if mh.workerMode == xconf.WorkerModeBind && mh.workerPoolSize > bindWorkerPoolWarnSize {
+		xlog.WarnF("worker pool: Bind mode creates one worker per connection (MaxConn = %d), "+
+			"consider Hash mode or a smaller MaxConn", mh.workerPoolSize)
+	}
+}
+
+// StopWorkerPool 通知所有worker退出，并等待worker处理完队列中已有的消息
+// 任务队列不会被关闭，链接的读协程可能仍在向队列发送消息，关闭队列会导致发送方panic
+// 停止之后入队的消息会在工作池重新启动后处理
+func (mh *MsgHandle) StopWorkerPool() {
+	mh.workerLock.Lock()
+	defer mh.workerLock.Unlock()
+
+	if mh.workerExit == nil {
+		return
 	}
+
+	close(mh.workerExit)
+	mh.workerWg.Wait()
+	mh.workerExit = nil
 }
@@ -0,0 +1,592 @@
+/**
+* @File: msg_handler_test.go
+* @Author: Jason Woo
+* @Date: 2026/10/16 16:02
+**/
+
+package fastnet
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"github.com/dyowoo/fastnet/xconf"
+	"net"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestMsgHandlerSendResponse(t *testing.T) {
+	s := NewServer().(*Server)
+	mh := s.GetMsgHandler().(*MsgHandle)
+	mh.AddRouterSlices(1, func(request IRequest) {
+		request.SetResponse([]byte("pong"))
+	})
+	mh.AddRouterSlices(2, func(request IRequest) {
+		request.SetResponse(NewMsgPackage(3, []byte("pong")))
+	})
+
+	conn, remote := newPipeConn(t, s, 1)
+
+	cases := []struct {
+		reqID   uint32
+		replyID uint32
+	}{
+		{reqID: 1, replyID: 1},
+		{reqID: 2, replyID: 3},
+	}
+
+	for _, c := range cases {
+		go mh.doMsgHandlerSlices(NewRequest(conn, NewMsgPackage(c.reqID, []byte("ping"))), 0)
+
+		msg := readReply(t, s, remote)
+		if msg.GetMsgID() != c.replyID || !bytes.Equal(msg.GetData(), []byte("pong")) {
+			t.Fatalf("unexpected reply msgID = %d, data = %s", msg.GetMsgID(), msg.GetData())
+		}
+	}
+}
+
+func TestMsgHandlerPanicHandler(t *testing.T) {
+	s := NewServer().(*Server)
+	mh := s.GetMsgHandler().(*MsgHandle)
+	mh.AddRouterSlices(1, func(request IRequest) {
+		panic("boom")
+	})
+
+	var gotReq IRequest
+	var gotRecovered interface{}
+	var gotStack []byte
+	s.SetPanicHandler(func(request IRequest, recovered interface{}, stack []byte) {
+		gotReq, gotRecovered, gotStack = request, recovered, stack
+	})
+
+	conn, _ := newPipeConn(t, s, 1)
+
+	req := NewRequest(conn, NewMsgPackage(1, nil))
+	mh.doMsgHandlerSlices(req, 0)
+
+	if gotReq != req || gotRecovered != "boom" {
+		t.Fatalf("unexpected panic handler args: %v, %v", gotReq, gotRecovered)
+	}
+	if !bytes.Contains(gotStack, []byte("TestMsgHandlerPanicHandler")) {
+		t.Fatalf("stack does not contain the panicking caller:\n%s", gotStack)
+	}
+}
+
+func TestRouteErrorHandler(t *testing.T) {
+	s := NewServer().(*Server)
+	mh := s.GetMsgHandler().(*MsgHandle)
+
+	var handledBy []string
+	record := func(name string) PanicHandler {
+		return func(request IRequest, recovered interface{}, stack []byte) {
+			handledBy = append(handledBy, fmt.Sprintf("%s:%d:%v", name, request.GetMsgID(), recovered))
+		}
+	}
+	s.SetPanicHandler(record("global"))
+
+	boom := func(request IRequest) { panic("boom") }
+	group := mh.Group(100, 199)
+	group.AddHandler(101, boom)
+	group.AddHandler(102, boom)
+	mh.AddRouterSlices(1, boom)
+	// 分组的回调在注册路由之后设置同样生效
+	group.OnError(record("group"))
+	mh.routerSlices.SetErrorHandler(102, record("route"))
+
+	conn, _ := newPipeConn(t, s, 1)
+
+	for _, msgID := range []uint32{101, 102, 1} {
+		mh.doMsgHandlerSlices(NewRequest(conn, NewMsgPackage(msgID, nil)), 0)
+	}
+
+	want := []string{"group:101:boom", "route:102:boom", "global:1:boom"}
+	if fmt.Sprint(handledBy) != fmt.Sprint(want) {
+		t.Fatalf("handled by %v, want %v", handledBy, want)
+	}
+}
+
+func TestRouterRecoveryWithReply(t *testing.T) {
+	s := NewServer().(*Server)
+	mh := s.GetMsgHandler().(*MsgHandle)
+	mh.Use(RouterRecoveryWithReply(500, []byte("internal error")))
+	mh.AddRouterSlices(1, func(request IRequest) {
+		panic("boom")
+	})
+
+	var gotStack []byte
+	s.SetPanicHandler(func(request IRequest, recovered interface{}, stack []byte) {
+		gotStack = stack
+	})
+
+	conn, remote := newPipeConn(t, s, 1)
+
+	go mh.doMsgHandlerSlices(NewRequest(conn, NewMsgPackage(1, nil)), 0)
+
+	msg := readReply(t, s, remote)
+	if msg.GetMsgID() != 500 || string(msg.GetData()) != "internal error" {
+		t.Fatalf("unexpected reply msgID = %d, data = %s", msg.GetMsgID(), msg.GetData())
+	}
+	if !bytes.Contains(gotStack, []byte("TestRouterRecoveryWithReply")) {
+		t.Fatalf("stack does not contain the panicking handler:\n%s", gotStack)
+	}
+}
+
+func TestHandlerTimeoutReleasesWorker(t *testing.T) {
+	s := NewServer().(*Server)
+	mh := s.GetMsgHandler().(*MsgHandle)
+	mh.StartWorkerPool()
+	defer mh.StopWorkerPool()
+
+	ctxErr := make(chan error, 1)
+	release := make(chan struct{})
+	defer close(release)
+	handled := make(chan struct{})
+
+	// 监听ctx的处理函数
+	mh.AddRouterSlices(1, func(request IRequest) {
+		<-request.Context().Done()
+		ctxErr <- request.Context().Err()
+	})
+	// 不监听ctx的处理函数，超时后仍在运行
+	mh.AddRouterSlices(2, func(request IRequest) {
+		<-release
+	})
+	mh.AddRouterSlices(3, func(request IRequest) {
+		close(handled)
+	})
+	s.SetHandlerTimeout(1, 20*time.Millisecond)
+	s.SetHandlerTimeout(2, 20*time.Millisecond)
+
+	mh.SendMsgToTaskQueue(newTestRequest(t, s, 1))
+	select {
+	case err := <-ctxErr:
+		if err != context.DeadlineExceeded {
+			t.Fatalf("ctx err = %v, want DeadlineExceeded", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("handler context is not canceled")
+	}
+
+	// 同一个worker在处理函数超时后继续处理后续的消息
+	mh.SendMsgToTaskQueue(newTestRequest(t, s, 2))
+	mh.SendMsgToTaskQueue(newTestRequest(t, s, 3))
+	select {
+	case <-handled:
+	case <-time.After(time.Second):
+		t.Fatal("worker is not released after handler timeout")
+	}
+}
+
+func TestHandlerTimeoutStopsChain(t *testing.T) {
+	s := NewServer().(*Server)
+	mh := s.GetMsgHandler().(*MsgHandle)
+
+	// 超时之后中间件调用Next不会再执行后续的处理函数
+	returned := make(chan struct{})
+	var called atomic.Bool
+	mh.AddRouterSlices(1, func(request IRequest) {
+		waitFor(t, request.IsAborted)
+		request.Next()
+		close(returned)
+	}, func(request IRequest) {
+		called.Store(true)
+	})
+	s.SetHandlerTimeout(1, 20*time.Millisecond)
+
+	mh.doMsgHandlerSlices(newTestRequest(t, s, 1), 0)
+	select {
+	case <-returned:
+		if called.Load() {
+			t.Fatal("handler after the timed out middleware is called")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("middleware is not returned")
+	}
+}
+
+func TestMsgHandleUsesCapturedConfig(t *testing.T) {
+	s := NewServer().(*Server)
+	mh := s.GetMsgHandler().(*MsgHandle)
+	mh.StartWorkerPool()
+	defer mh.StopWorkerPool()
+
+	handled := make(chan struct{})
+	mh.AddRouterSlices(1, func(request IRequest) {
+		close(handled)
+	})
+
+	// 创建之后修改全局配置不影响消息分发
+	oldPoolSize, oldMode := xconf.GlobalObject.WorkerPoolSize, xconf.GlobalObject.RouterSlicesMode
+	xconf.GlobalObject.WorkerPoolSize, xconf.GlobalObject.RouterSlicesMode = 0, false
+	defer func() {
+		xconf.GlobalObject.WorkerPoolSize, xconf.GlobalObject.RouterSlicesMode = oldPoolSize, oldMode
+	}()
+
+	mh.Execute(newTestRequest(t, s, 1))
+
+	select {
+	case <-handled:
+	case <-time.After(time.Second):
+		t.Fatal("request is not dispatched to the router slices")
+	}
+}
+
+func TestMaxConcurrentHandlers(t *testing.T) {
+	s := NewServer().(*Server)
+	mh := newClientMsgHandle(xconf.GlobalObject)
+	mh.handlerSem = newHandlerSem(2)
+
+	var running, maxRunning int32
+	release := make(chan struct{})
+	mh.AddRouterSlices(1, func(request IRequest) {
+		n := atomic.AddInt32(&running, 1)
+		for {
+			old := atomic.LoadInt32(&maxRunning)
+			if n <= old || atomic.CompareAndSwapInt32(&maxRunning, old, n) {
+				break
+			}
+		}
+		<-release
+		atomic.AddInt32(&running, -1)
+	})
+
+	sent := make(chan struct{})
+	go func() {
+		defer close(sent)
+		for i := 0; i < 5; i++ {
+			mh.Execute(newTestRequest(t, s, 1))
+		}
+	}()
+
+	waitFor(t, func() bool { return atomic.LoadInt32(&running) == 2 })
+	select {
+	case <-sent:
+		t.Fatal("dispatch should block when MaxConcurrentHandlers is reached")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	close(release)
+	<-sent
+	waitFor(t, func() bool { return atomic.LoadInt32(&running) == 0 })
+	if n := atomic.LoadInt32(&maxRunning); n != 2 {
+		t.Fatalf("max concurrent handlers = %d, want 2", n)
+	}
+}
+
+func TestStopWorkerPoolDrainsQueue(t *testing.T) {
+	s := NewServer().(*Server)
+	mh := s.GetMsgHandler().(*MsgHandle)
+
+	var handled int32
+	mh.AddRouterSlices(1, func(request IRequest) {
+		atomic.AddInt32(&handled, 1)
+	})
+
+	// 工作池启动之前入队的消息在停止时也会被处理
+	mh.TaskQueue[0] = NewFIFOTaskQueue(10)
+	for i := 0; i < 10; i++ {
+		mh.SendMsgToTaskQueue(newTestRequest(t, s, 1))
+	}
+	mh.StartWorkerPool()
+	mh.StopWorkerPool()
+
+	if n := atomic.LoadInt32(&handled); n != 10 {
+		t.Fatalf("handled = %d, want 10", n)
+	}
+}
+
+func TestMsgPriorityUnderBacklog(t *testing.T) {
+	s := NewUserConfServer(&xconf.Config{WorkerPoolSize: 1, MaxWorkerTaskLen: 200, HideLogo: true}).(*Server)
+	mh := s.GetMsgHandler().(*MsgHandle)
+	s.SetMsgPriority(2, 10)
+	mh.StartWorkerPool()
+	defer mh.StopWorkerPool()
+
+	var lock sync.Mutex
+	var order []uint32
+	record := func(request IRequest) {
+		lock.Lock()
+		order = append(order, request.GetMsgID())
+		lock.Unlock()
+	}
+
+	started, release := make(chan struct{}), make(chan struct{})
+	var once sync.Once
+	mh.AddRouterSlices(1, func(request IRequest) {
+		once.Do(func() {
+			close(started)
+			<-release
+		})
+		record(request)
+	})
+	mh.AddRouterSlices(2, record)
+
+	// 第一条消息阻塞worker，之后的数据消息全部积压在队列中
+	mh.SendMsgToTaskQueue(newTestRequest(t, s, 1))
+	<-started
+	for i := 0; i < 100; i++ {
+		mh.SendMsgToTaskQueue(newTestRequest(t, s, 1))
+	}
+	mh.SendMsgToTaskQueue(newTestRequest(t, s, 2))
+	close(release)
+
+	waitFor(t, func() bool {
+		lock.Lock()
+		defer lock.Unlock()
+		return len(order) == 102
+	})
+	// 阻塞的消息处理完成后，优先处理高优先级的消息
+	if order[1] != 2 {
+		t.Fatalf("high priority msg handled at %d, want 1", indexOfMsgID(order, 2))
+	}
+}
+
+func TestMsgPriorityDefaultFIFO(t *testing.T) {
+	s := NewServer().(*Server)
+	mh := s.GetMsgHandler().(*MsgHandle)
+	mh.StartWorkerPool()
+	defer mh.StopWorkerPool()
+
+	if _, ok := mh.TaskQueue[0].(fifoTaskQueue); !ok {
+		t.Fatalf("task queue = %T, want fifoTaskQueue", mh.TaskQueue[0])
+	}
+}
+
+func indexOfMsgID(order []uint32, msgID uint32) int {
+	for i, id := range order {
+		if id == msgID {
+			return i
+		}
+	}
+	return -1
+}
+
+func TestRouteKeyFunc(t *testing.T) {
+	s := NewServer().(*Server)
+	mh := s.GetMsgHandler().(*MsgHandle)
+
+	var got []string
+	s.Use(func(request IRequest) {
+		got = append(got, "use")
+		request.RouterSlicesNext()
+	})
+	s.SetRouteKeyFunc(func(msg IMessage) RouteKey {
+		return RouteKey(msg.GetData())
+	})
+	s.AddKeyRouter("chat/room1", func(request IRequest) {
+		got = append(got, "room1")
+	})
+	s.AddRouterSlices(1, func(request IRequest) {
+		got = append(got, "msgID")
+	})
+
+	request := newTestRequest(t, s, 1)
+	request.GetMessage().SetData([]byte("chat/room1"))
+	mh.dispatch(request, 0)
+	// 没有路由键的消息按MsgID路由
+	mh.dispatch(newTestRequest(t, s, 1), 0)
+
+	want := []string{"use", "room1", "use", "msgID"}
+	if strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Fatalf("handled = %v, want %v", got, want)
+	}
+
+	func() {
+		defer func() {
+			if recover() == nil {
+				t.Fatal("AddKeyRouter should panic on repeated route key")
+			}
+		}()
+		s.AddKeyRouter("chat/room1", func(request IRequest) {})
+	}()
+
+	if !mh.RemoveKeyRouter("chat/room1") || mh.RemoveKeyRouter("chat/room1") {
+		t.Fatal("RemoveKeyRouter should report whether the route key was registered")
+	}
+	if mh.doKeyRouter(request, "chat/room1") {
+		t.Fatal("removed route key should not be found")
+	}
+
+	// 提取方法panic时交给panic回调，消息被丢弃，worker继续处理后续的消息
+	var recovered interface{}
+	s.SetPanicHandler(func(request IRequest, err interface{}, stack []byte) { recovered = err })
+	s.SetRouteKeyFunc(func(msg IMessage) RouteKey { panic("bad key") })
+	got = nil
+	mh.dispatch(newTestRequest(t, s, 1), 0)
+	if recovered != "bad key" || len(got) != 0 {
+		t.Fatalf("recovered = %v, handled = %v, want bad key and nothing", recovered, got)
+	}
+}
+
+// 旧版路由，处理时记录MsgID
+type recordRouter struct {
+	BaseRouter
+	handled *[]uint32
+}
+
+func (r *recordRouter) Handle(request IRequest) {
+	*r.handled = append(*r.handled, request.GetMsgID())
+}
+
+func TestOnMessage(t *testing.T) {
+	for _, slicesMode := range []bool{false, true} {
+		s := NewServer().(*Server)
+		mh := s.GetMsgHandler().(*MsgHandle)
+		mh.routerSlicesMode = slicesMode
+
+		var handled, observed []uint32
+		if slicesMode {
+			for _, msgID := range []uint32{1, 2} {
+				mh.AddRouterSlices(msgID, func(request IRequest) {
+					handled = append(handled, request.GetMsgID())
+				})
+			}
+		} else {
+			mh.AddRouter(1, &recordRouter{handled: &handled})
+			mh.AddRouter(2, &recordRouter{handled: &handled})
+		}
+		s.SetOnMessage(func(request IRequest) {
+			observed = append(observed, request.GetMsgID())
+			// 丢弃MsgID为2的消息
+			if request.GetMsgID() == 2 {
+				request.Abort()
+			}
+		})
+
+		// 没有注册路由的消息同样经过回调
+		for _, msgID := range []uint32{1, 2, 3} {
+			mh.dispatch(newTestRequest(t, s, msgID), 0)
+		}
+
+		if fmt.Sprint(observed) != "[1 2 3]" || fmt.Sprint(handled) != "[1]" {
+			t.Fatalf("slicesMode = %v: observed = %v, handled = %v", slicesMode, observed, handled)
+		}
+	}
+}
+
+func TestBindWorkerModeWorkerIDs(t *testing.T) {
+	s := NewUserConfServer(&xconf.Config{WorkerMode: xconf.WorkerModeBind, MaxConn: 2}).(*Server)
+	mh := s.GetMsgHandler().(*MsgHandle)
+	if len(mh.TaskQueue) != 2 {
+		t.Fatalf("task queue len = %d, want MaxConn", len(mh.TaskQueue))
+	}
+
+	conns := make([]*Connection, 3)
+	for i := range conns {
+		local, remote := net.Pipe()
+		conns[i] = newServerConn(s, local, uint64(i+1)).(*Connection)
+		conns[i].workerID = useWorker(conns[i])
+		conn := conns[i]
+		t.Cleanup(func() {
+			s.GetConnMgr().Remove(conn)
+			_ = local.Close()
+			_ = remote.Close()
+		})
+	}
+
+	if conns[0].workerID == conns[1].workerID || conns[2].workerID >= 2 {
+		t.Fatalf("worker IDs = %d, %d, %d", conns[0].workerID, conns[1].workerID, conns[2].workerID)
+	}
+
+	// 第三个链接与其他链接共用worker，断开时不能归还该worker
+	freeWorker(conns[2])
+	if len(mh.freeWorkers) != 0 {
+		t.Fatalf("shared worker is freed: %v", mh.freeWorkers)
+	}
+	freeWorker(conns[0])
+	if _, ok := mh.freeWorkers[conns[0].workerID]; !ok || len(mh.freeWorkers) != 1 {
+		t.Fatalf("exclusive worker is not freed: %v", mh.freeWorkers)
+	}
+
+	// workerID超出任务队列范围时丢弃消息，而不是panic
+	conns[1].workerID = 5
+	mh.SendMsgToTaskQueue(NewRequest(conns[1], NewMsgPackage(1, nil)))
+}
+
+func TestWorkerAffinity(t *testing.T) {
+	s := NewUserConfServer(&xconf.Config{WorkerMode: xconf.WorkerModeBind, MaxConn: 8}).(*Server)
+	connID := uint64(0)
+	newConn := func(srv *Server, key string) *Connection {
+		local, remote := net.Pipe()
+		connID++
+		conn := newServerConn(srv, local, connID).(*Connection)
+		t.Cleanup(func() {
+			srv.GetConnMgr().Remove(conn)
+			_ = local.Close()
+			_ = remote.Close()
+		})
+		if key != "" {
+			SetWorkerAffinityKey(conn, key)
+		}
+		conn.workerID = useWorker(conn)
+		return conn
+	}
+
+	first := newConn(s, "user-1")
+	freeWorker(first)
+
+	// 重连后分配到之前的worker
+	second := newConn(s, "user-1")
+	if second.workerID != first.workerID {
+		t.Fatalf("reconnect workerID = %d, want %d", second.workerID, first.workerID)
+	}
+	// 之前的worker被占用时分配其他空闲worker
+	third := newConn(s, "user-1")
+	if third.workerID == second.workerID {
+		t.Fatalf("busy worker %d is assigned again", third.workerID)
+	}
+
+	// Hash模式下相同的key分配到相同的worker
+	hs := NewUserConfServer(&xconf.Config{WorkerMode: xconf.WorkerModeHash, WorkerPoolSize: 16}).(*Server)
+	if a, b := newConn(hs, "user-2"), newConn(hs, "user-2"); a.workerID != b.workerID {
+		t.Fatalf("hash mode workerIDs = %d, %d", a.workerID, b.workerID)
+	}
+}
+
+func TestWorkerQueueDepth(t *testing.T) {
+	s := NewUserConfServer(&xconf.Config{WorkerPoolSize: 2, HideLogo: true}).(*Server)
+	mh := s.GetMsgHandler().(*MsgHandle)
+	if mh.WorkerPoolSize() != 2 {
+		t.Fatalf("WorkerPoolSize = %d, want 2", mh.WorkerPoolSize())
+	}
+	// 工作池未启动时没有任务队列
+	if depth := mh.WorkerQueueDepth(0); depth != 0 {
+		t.Fatalf("depth before start = %d, want 0", depth)
+	}
+
+	mh.StartWorkerPool()
+	defer mh.StopWorkerPool()
+
+	started, release := make(chan struct{}), make(chan struct{})
+	var once sync.Once
+	mh.AddRouterSlices(1, func(request IRequest) {
+		once.Do(func() {
+			close(started)
+			<-release
+		})
+	})
+
+	// 没有启动的链接都由worker 0处理，第一条消息阻塞worker 0，之后的消息积压在worker 0的队列中
+	mh.SendMsgToTaskQueue(newTestRequest(t, s, 1))
+	<-started
+	for i := 0; i < 3; i++ {
+		mh.SendMsgToTaskQueue(newTestRequest(t, s, 1))
+	}
+
+	if depth := mh.WorkerQueueDepth(0); depth != 3 {
+		t.Fatalf("worker 0 depth = %d, want 3", depth)
+	}
+	if depth := mh.WorkerQueueDepth(1); depth != 0 {
+		t.Fatalf("worker 1 depth = %d, want 0", depth)
+	}
+	if depth := mh.WorkerQueueDepth(5); depth != 0 {
+		t.Fatalf("depth of unknown worker = %d, want 0", depth)
+	}
+
+	close(release)
+	waitFor(t, func() bool { return mh.WorkerQueueDepth(0) == 0 })
+}
@@ -0,0 +1,67 @@
+/**
+* @File: msg_name.go
+* @Author: Jason Woo
+* @Date: 2026/10/16 14:55
+**/
+
+package fastnet
+
+import (
+	"strconv"
+	"sync"
+)
+
+// 消息ID与名称的注册表，用于日志和调试工具输出可读的消息名称
+var (
+	msgNames     = make(map[uint32]string)
+	msgNamesLock sync.RWMutex
+)
+
+// RegisterMsgName 为消息ID注册一个名称，框架日志中会同时输出消息ID和名称
+// 重复注册会覆盖之前的名称，name为空时删除该消息ID的名称
+func RegisterMsgName(msgID uint32, name string) {
+	msgNamesLock.Lock()
+	defer msgNamesLock.Unlock()
+
+	if name == "" {
+		delete(msgNames, msgID)
+		return
+	}
+
+	msgNames[msgID] = name
+}
+
+// MsgName 获取消息ID注册的名称，未注册时返回消息ID的数字形式
+func MsgName(msgID uint32) string {
+	msgNamesLock.RLock()
+	name, ok := msgNames[msgID]
+	msgNamesLock.RUnlock()
+
+	if !ok {
+		return strconv.FormatUint(uint64(msgID), 10)
+	}
+
+	return name
+}
+
+// 获取消息ID注册的名称，未注册时返回""
+func registeredMsgName(msgID uint32) string {
+	msgNamesLock.RLock()
+	defer msgNamesLock.RUnlock()
+
+	return msgNames[msgID]
+}
+
+// 格式化消息ID用于日志输出，已注册名称时输出 "1001(Login)"，否则输出 "1001"
+func msgIDString(msgID uint32) string {
+	msgNamesLock.RLock()
+	name, ok := msgNames[msgID]
+	msgNamesLock.RUnlock()
+
+	id := strconv.FormatUint(uint64(msgID), 10)
+	if !ok {
+		return id
+	}
+
+	return id + "(" + name + ")"
+}
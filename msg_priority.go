@@ -0,0 +1,48 @@
+/**
+* @File: msg_priority.go
+* @Author: Jason Woo
+* @Date: 2026/10/16 11:52
+**/
+
+package fastnet
+
+import (
+	"github.com/dyowoo/fastnet/xlog"
+)
+
+// SetMsgPriority 设置MsgID的优先级，数值越大越先处理，默认优先级为0，priority为0时删除该设置
+// 设置了优先级后worker使用按优先级出队的队列，没有设置任何优先级时仍然是先进先出
+// 队列类型在StartWorkerPool时确定，工作池启动后才设置优先级只有在已经使用优先级队列时生效
+// 注意：同一链接上不同优先级的消息，处理顺序与收到的顺序不一致
+func (mh *MsgHandle) SetMsgPriority(msgID uint32, priority int) {
+	mh.priorityLock.Lock()
+	if priority == 0 {
+		delete(mh.priorities, msgID)
+	} else {
+		mh.priorities[msgID] = priority
+	}
+	mh.priorityLock.Unlock()
+
+	mh.workerLock.Lock()
+	defer mh.workerLock.Unlock()
+
+	if mh.workerExit != nil && mh.taskQueueFactory == nil && len(mh.TaskQueue) > 0 {
+		if _, ok := mh.TaskQueue[0].(fifoTaskQueue); ok {
+			xlog.WarnF("SetMsgPriority msgID = %s after the worker pool started, the priority will not take effect", msgIDString(msgID))
+		}
+	}
+}
+
+func (mh *MsgHandle) msgPriority(msgID uint32) int {
+	mh.priorityLock.RLock()
+	defer mh.priorityLock.RUnlock()
+
+	return mh.priorities[msgID]
+}
+
+func (mh *MsgHandle) hasMsgPriority() bool {
+	mh.priorityLock.RLock()
+	defer mh.priorityLock.RUnlock()
+
+	return len(mh.priorities) > 0
+}
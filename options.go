@@ -9,6 +9,13 @@ package fastnet
 // Option Server的服务Option
 type Option func(s *Server)
 
+// WithNetwork 设置监听的网络类型 tcp/tcp4/tcp6，覆盖配置中的Network，Host需与之匹配，例如tcp6使用"::"或"::1"
+func WithNetwork(network string) Option {
+	return func(s *Server) {
+		s.network = network
+	}
+}
+
 // WithPacket 只要实现Packet 接口可自由实现数据包解析格式，如果没有则使用默认解析格式
 func WithPacket(pack IDataPack) Option {
 	return func(s *Server) {
@@ -16,6 +23,55 @@ func WithPacket(pack IDataPack) Option {
 	}
 }
 
+// WithHandshake 链接建立后、读循环启动之前执行的握手函数，返回错误时拒绝该链接
+func WithHandshake(handshake HandshakeFunc) Option {
+	return func(s *Server) {
+		s.SetHandshake(handshake)
+	}
+}
+
+// WithMsgHandler 使用自定义的消息处理模块，可以嵌入NewMsgHandle创建的默认实现，只重写需要的方法
+func WithMsgHandler(handler IMsgHandle) Option {
+	return func(s *Server) {
+		s.SetMsgHandler(handler)
+	}
+}
+
+// WithNoDecoder 不使用解码器，与SetDecoder(nil)相同，适用于由自定义拦截器完成分帧和解析的协议
+func WithNoDecoder() Option {
+	return func(s *Server) {
+		s.SetDecoder(nil)
+	}
+}
+
+// WithListenFunc 使用自定义的方法创建监听，例如在测试中使用内存网络
+func WithListenFunc(listenFunc ListenFunc) Option {
+	return func(s *Server) {
+		s.SetListenFunc(listenFunc)
+	}
+}
+
+// WithWsJSONPassthrough websocket直通模式，每个websocket文本帧是一条JSON信封格式的消息，tcp链接的封包方式不变
+func WithWsJSONPassthrough() Option {
+	return func(s *Server) {
+		s.SetWsPassthrough(NewJSONEnvelopePack(), NewJSONEnvelopeDecoder())
+	}
+}
+
+// WithTaskQueueFactory 使用自定义的Worker任务队列，例如按优先级出队的队列
+func WithTaskQueueFactory(factory TaskQueueFactory) Option {
+	return func(s *Server) {
+		s.msgHandler.SetTaskQueueFactory(factory)
+	}
+}
+
+// WithCodec 设置类型化路由使用的编解码器
+func WithCodec(codec ICodec) Option {
+	return func(s *Server) {
+		s.msgHandler.SetCodec(codec)
+	}
+}
+
 // ClientOption Options for Client
 type ClientOption func(c IClient)
 
@@ -30,3 +86,24 @@ func WithNameClient(name string) ClientOption {
 		c.SetName(name)
 	}
 }
+
+// WithAutoReconnectClient 心跳检测到服务端不存活时自动重连
+func WithAutoReconnectClient(autoReconnect bool) ClientOption {
+	return func(c IClient) {
+		c.SetAutoReconnect(autoReconnect)
+	}
+}
+
+// WithHandshakeClient 链接建立后、读循环启动之前执行的握手函数，返回错误时断开该链接
+func WithHandshakeClient(handshake HandshakeFunc) ClientOption {
+	return func(c IClient) {
+		c.SetHandshake(handshake)
+	}
+}
+
+// WithDialFunc 使用自定义的方法建立链接，例如通过SOCKS代理连接服务器
+func WithDialFunc(dialFunc DialFunc) ClientOption {
+	return func(c IClient) {
+		c.SetDialFunc(dialFunc)
+	}
+}
@@ -7,6 +7,7 @@
 package fastnet
 
 import (
+	"encoding/binary"
 	"sync"
 )
 
@@ -32,8 +33,18 @@ func (f *PackFactory) NewPack(kind string) IDataPack {
 	switch kind {
 	case FastDataPack:
 		dataPack = NewDataPack()
+	case FastDataPackLittleEndian:
+		dataPack = NewDataPack(binary.LittleEndian)
 	case FastDataPackOld:
 		dataPack = NewDataPackLtv()
+	case FastDataPackVarint:
+		dataPack = NewDataPackVarint()
+	case FastDataPackJSON:
+		dataPack = NewJSONEnvelopePack()
+	case FastDataPackCRC32:
+		dataPack = NewDataPackWithChecksum(ChecksumCRC32)
+	case FastDataPackAdler32:
+		dataPack = NewDataPackWithChecksum(ChecksumAdler32)
 	default:
 		dataPack = NewDataPack()
 	}
@@ -0,0 +1,121 @@
+/**
+* @File: ping.go
+* @Author: Jason Woo
+* @Date: 2026/10/16 12:00
+**/
+
+package fastnet
+
+import (
+	"encoding/binary"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// 保留的控制消息ID，由框架内部处理，不会交给路由，业务不应使用
+const (
+	PingMsgID uint32 = 99998 // Ping请求，收到后原样回复Pong
+	PongMsgID uint32 = 99997 // Pong回复，数据为Ping请求的序号
+)
+
+var (
+	ErrPingTimeout    = errors.New("ping timeout")                    // 超时没有收到Pong
+	ErrPingConnClosed = errors.New("connection closed while pinging") // 等待Pong期间链接关闭
+)
+
+// 链接实现该接口，收到Pong时唤醒等待中的Ping
+type pongReceiver interface {
+	receivePong(data []byte)
+}
+
+// pingState 应用层Ping的状态，与定时心跳相互独立
+type pingState struct {
+	rtt     atomic.Int64 // 最近一次测量的往返时间
+	lock    sync.Mutex
+	seq     uint64
+	waiters map[uint64]chan struct{} // 等待Pong的Ping序号
+}
+
+func (p *pingState) ping(conn IConnection, timeout time.Duration) (time.Duration, error) {
+	p.lock.Lock()
+	if p.waiters == nil {
+		p.waiters = make(map[uint64]chan struct{})
+	}
+	p.seq++
+	seq := p.seq
+	pong := make(chan struct{})
+	p.waiters[seq] = pong
+	p.lock.Unlock()
+
+	defer func() {
+		p.lock.Lock()
+		delete(p.waiters, seq)
+		p.lock.Unlock()
+	}()
+
+	data := make([]byte, 8)
+	binary.BigEndian.PutUint64(data, seq)
+
+	start := time.Now()
+	if err := conn.SendMsg(PingMsgID, data); err != nil {
+		return 0, err
+	}
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	select {
+	case <-pong:
+		rtt := time.Since(start)
+		p.rtt.Store(int64(rtt))
+		return rtt, nil
+	case <-timer.C:
+		return 0, ErrPingTimeout
+	case <-conn.Context().Done():
+		return 0, ErrPingConnClosed
+	}
+}
+
+func (p *pingState) pong(data []byte) {
+	if len(data) != 8 {
+		return
+	}
+	seq := binary.BigEndian.Uint64(data)
+
+	p.lock.Lock()
+	pong, ok := p.waiters[seq]
+	delete(p.waiters, seq)
+	p.lock.Unlock()
+
+	if ok {
+		close(pong)
+	}
+}
+
+func (p *pingState) lastRTT() time.Duration {
+	return time.Duration(p.rtt.Load())
+}
+
+// handleControlMsg 处理框架保留的控制消息，返回true时该消息不再交给路由
+// 在读协程中直接处理，不经过worker队列，测量的往返时间不受业务积压的影响
+func handleControlMsg(request IRequest) bool {
+	conn := request.GetConnection()
+	if conn == nil {
+		return false
+	}
+
+	switch request.GetMsgID() {
+	case PingMsgID:
+		_ = conn.SendMsg(PongMsgID, request.GetData())
+		return true
+	case PongMsgID:
+		if receiver, ok := conn.(pongReceiver); ok {
+			receiver.receivePong(request.GetData())
+		}
+		return true
+	}
+
+	return false
+}
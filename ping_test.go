@@ -0,0 +1,68 @@
+/**
+* @File: ping_test.go
+* @Author: Jason Woo
+* @Date: 2026/10/16 12:00
+**/
+
+package fastnet
+
+import (
+	"io"
+	"net"
+	"testing"
+	"time"
+)
+
+// 启动链接并等待OnConnStart执行完成
+func startTestConn(t *testing.T, s *Server, rawConn net.Conn, connID uint64) IConnection {
+	started := make(chan struct{})
+	s.SetOnConnStart(func(IConnection) { close(started) })
+	conn := newServerConn(s, rawConn, connID)
+	go conn.Start()
+	<-started
+	t.Cleanup(conn.Stop)
+
+	return conn
+}
+
+func TestConnPing(t *testing.T) {
+	s := NewServer().(*Server)
+	s.AddInterceptor(s.GetDecoder())
+
+	local, remote := net.Pipe()
+	conn := startTestConn(t, s, local, 1)
+	peer := startTestConn(t, s, remote, 2)
+
+	if conn.RTT() != 0 {
+		t.Fatalf("RTT before ping = %v, want 0", conn.RTT())
+	}
+
+	rtt, err := conn.Ping(time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rtt <= 0 || conn.RTT() != rtt {
+		t.Fatalf("rtt = %v, conn.RTT() = %v", rtt, conn.RTT())
+	}
+
+	// 对端同样可以发起Ping
+	if _, err := peer.Ping(time.Second); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestConnPingTimeout(t *testing.T) {
+	s := NewServer().(*Server)
+	s.AddInterceptor(s.GetDecoder())
+
+	local, remote := net.Pipe()
+	defer func() { _ = remote.Close() }()
+	conn := startTestConn(t, s, local, 1)
+
+	// 对端只读取数据不回复Pong
+	go func() { _, _ = io.Copy(io.Discard, remote) }()
+
+	if _, err := conn.Ping(50 * time.Millisecond); err != ErrPingTimeout {
+		t.Fatalf("err = %v, want %v", err, ErrPingTimeout)
+	}
+}
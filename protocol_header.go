@@ -0,0 +1,273 @@
+/**
+* @File: protocol_header.go
+* @Author: Jason Woo
+* @Date: 2026/10/16 12:28
+**/
+
+package fastnet
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"github.com/dyowoo/fastnet/xconf"
+)
+
+// 带协议头的TLV格式，在默认的TLV包头之前加上魔数和协议版本:
+//
+//	Magic(n byte)|Version(1byte)|MsgID(4byte)|DataLen(4byte)|Data
+//
+// ContentType为true时协议版本之后还有1字节的编码类型，接收方按编码类型选择编解码器:
+//
+//	Magic(n byte)|Version(1byte)|ContentType(1byte)|MsgID(4byte)|DataLen(4byte)|Data
+//
+// 对端使用了错误的协议时第一个包就会因为魔数不一致被拒绝，而不是解析出错乱的消息
+// 使用方式，服务端与客户端使用相同的ProtocolHeader:
+//
+//	header := ProtocolHeader{Magic: []byte("FN"), Version: 2, Accepted: []uint8{1, 2}}
+//	s.SetPacket(NewDataPackWithHeader(header))
+//	s.SetDecoder(NewTLVDecoderWithHeader(header))
+//
+// 路由中通过MsgVersion(request.GetMessage())获取对端使用的协议版本，MsgContentType获取消息的编码类型
+
+var (
+	ErrBadMagic           = errors.New("packet magic mismatch")        // 包头的魔数与约定的不一致，对端使用了错误的协议
+	ErrUnsupportedVersion = errors.New("unsupported protocol version") // 包头的协议版本不在接受的版本中
+)
+
+// ProtocolHeader 包头前缀，由魔数、协议版本和可选的编码类型组成
+type ProtocolHeader struct {
+	Magic       []byte  // 魔数，每个包都以魔数开头，为空时只校验协议版本
+	Version     uint8   // 封包时写入的协议版本
+	Accepted    []uint8 // 拆包时接受的协议版本，为空时只接受Version
+	ContentType bool    // 协议版本之后带有1字节的编码类型，封包时写入消息的编码类型
+}
+
+// Len 包头前缀的长度
+func (h *ProtocolHeader) Len() int {
+	if h.ContentType {
+		return len(h.Magic) + 2
+	}
+	return len(h.Magic) + 1
+}
+
+// 校验包头前缀，返回对端使用的协议版本，head的长度不能小于Len()
+func (h *ProtocolHeader) check(head []byte) (uint8, error) {
+	if !bytes.Equal(head[:len(h.Magic)], h.Magic) {
+		return 0, fmt.Errorf("%w: got %x, want %x", ErrBadMagic, head[:len(h.Magic)], h.Magic)
+	}
+
+	version := head[len(h.Magic)]
+	if !h.accepts(version) {
+		return version, fmt.Errorf("%w: %d", ErrUnsupportedVersion, version)
+	}
+
+	return version, nil
+}
+
+// 读取包头前缀中的编码类型，head的长度不能小于Len()
+func (h *ProtocolHeader) contentType(head []byte) ContentType {
+	if !h.ContentType {
+		return ContentTypeDefault
+	}
+	return ContentType(head[len(h.Magic)+1])
+}
+
+// 封包时写入包头前缀
+func (h *ProtocolHeader) write(buff *bytes.Buffer, msg IMessage) {
+	buff.Write(h.Magic)
+	buff.WriteByte(h.Version)
+	if h.ContentType {
+		buff.WriteByte(byte(MsgContentType(msg)))
+	}
+}
+
+func (h *ProtocolHeader) accepts(version uint8) bool {
+	if len(h.Accepted) == 0 {
+		return version == h.Version
+	}
+	for _, v := range h.Accepted {
+		if v == version {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (h *ProtocolHeader) clone() *ProtocolHeader {
+	return &ProtocolHeader{
+		Magic:       append([]byte(nil), h.Magic...),
+		Version:     h.Version,
+		Accepted:    append([]uint8(nil), h.Accepted...),
+		ContentType: h.ContentType,
+	}
+}
+
+// MsgVersion 获取消息的协议版本，只有使用带协议头的封包方式或解码器时才有值，否则返回0
+func MsgVersion(msg IMessage) uint8 {
+	if v, ok := msg.(interface{ GetVersion() uint8 }); ok {
+		return v.GetVersion()
+	}
+	return 0
+}
+
+// MsgContentType 获取消息数据的编码类型，只有使用带内容类型的协议头时才有值，否则返回ContentTypeDefault
+func MsgContentType(msg IMessage) ContentType {
+	if m, ok := msg.(interface{ GetContentType() ContentType }); ok {
+		return m.GetContentType()
+	}
+	return ContentTypeDefault
+}
+
+// NewDataPackWithHeader 带协议头的TLV封包方式，需配合NewTLVDecoderWithHeader使用
+// order 包头的字节序，不传时使用大端
+func NewDataPackWithHeader(header ProtocolHeader, order ...binary.ByteOrder) IDataPack {
+	dp := NewDataPack(order...).(*DataPack)
+	dp.header = header.clone()
+
+	return dp
+}
+
+// HeaderTLVDecoder 与NewDataPackWithHeader配套的解码器
+// 链接的第一个包头不符合时直接关闭链接，之后每个包的魔数或版本不符合时同样关闭链接
+type HeaderTLVDecoder struct {
+	TLVDecoder
+	header *ProtocolHeader
+}
+
+// NewTLVDecoderWithHeader 带协议头的TLV解码器
+// order 包头的字节序，不传时使用大端，需与对端使用的DataPack字节序一致
+func NewTLVDecoderWithHeader(header ProtocolHeader, order ...binary.ByteOrder) IDecoder {
+	decoder := &HeaderTLVDecoder{header: header.clone()}
+	decoder.order = NewTLVDecoder(order...).(*TLVDecoder).order
+
+	return decoder
+}
+
+func (hd *HeaderTLVDecoder) GetLengthField() *LengthField {
+	lengthField := hd.TLVDecoder.GetLengthField()
+	lengthField.MaxFrameLength += uint64(hd.header.Len())
+	lengthField.LengthFieldOffset += hd.header.Len()
+
+	return lengthField
+}
+
+// NewFrameDecoder 在按长度字段断包之前校验链接的第一个包头，不需要等到收齐一个完整的包
+func (hd *HeaderTLVDecoder) NewFrameDecoder() IFrameDecoder {
+	return &headerFrameDecoder{
+		IFrameDecoder: NewFrameDecoder(*hd.GetLengthField()),
+		header:        hd.header,
+	}
+}
+
+func (hd *HeaderTLVDecoder) Intercept(chain IChain) IcResp {
+	message := chain.GetIMessage()
+	if message == nil {
+		return chain.ProceedWithIMessage(message, nil)
+	}
+
+	data := message.GetData()
+	headLen := hd.header.Len()
+	// 读取的数据不超过包头，直接进入下一层
+	if len(data) < headLen+TlvHeaderSize {
+		return chain.ProceedWithIMessage(message, nil)
+	}
+
+	version, err := hd.header.check(data)
+	if err != nil {
+		ReportDecodeError(chain.Request(), err, data)
+		if request, ok := chain.Request().(IRequest); ok && request.GetConnection() != nil {
+			request.GetConnection().StopWithReason(CloseReasonProtocolError)
+		}
+		return nil
+	}
+
+	// 数据不足一个完整的包(没有经过断粘包解码器)，直接进入下一层
+	body := data[headLen:]
+	if uint64(len(body)) < TlvHeaderSize+uint64(hd.byteOrder().Uint32(body[4:8])) {
+		return chain.ProceedWithIMessage(message, nil)
+	}
+
+	tlvData := hd.decode(body)
+
+	// 将解码后的数据重新设置到IMessage中, Router需要MsgID来寻址
+	message.SetMsgID(tlvData.Tag)
+	message.SetData(tlvData.Value)
+	message.SetDataLen(tlvData.Length)
+	if m, ok := message.(interface{ SetVersion(uint8) }); ok {
+		m.SetVersion(version)
+	}
+	if m, ok := message.(interface{ SetContentType(ContentType) }); ok {
+		m.SetContentType(hd.header.contentType(data))
+	}
+
+	// 将解码后的数据进入下一层
+	return proceedDecoded(chain, message, *tlvData, &DecodeResult{
+		MsgID:   tlvData.Tag,
+		Body:    tlvData.Value,
+		Raw:     data,
+		Version: version,
+	})
+}
+
+// headerFrameDecoder 校验链接的第一个包头，不符合时丢弃之后的所有数据，链接通过Rejected得知后关闭
+type headerFrameDecoder struct {
+	IFrameDecoder
+	header  *ProtocolHeader
+	prefix  []byte // 尚未收齐的第一个包头
+	checked bool   // 第一个包头已经通过校验
+	err     error  // 第一个包头校验失败的原因
+}
+
+func (d *headerFrameDecoder) Decode(buff []byte) [][]byte {
+	if d.err != nil {
+		return nil
+	}
+
+	if !d.checked {
+		need := d.header.Len() - len(d.prefix)
+		if need > len(buff) {
+			need = len(buff)
+		}
+		d.prefix = append(d.prefix, buff[:need]...)
+		if len(d.prefix) == d.header.Len() {
+			if _, err := d.header.check(d.prefix); err != nil {
+				d.err = err
+				return nil
+			}
+			d.checked = true
+			d.prefix = nil
+		}
+	}
+
+	return d.IFrameDecoder.Decode(buff)
+}
+
+func (d *headerFrameDecoder) bindConfig(config *xconf.Config) {
+	bindConfig(d.IFrameDecoder, config)
+}
+
+// 第一个包头只复制到prefix中，是否复制包取决于内层的解码器
+func (d *headerFrameDecoder) copiesFrames() bool {
+	return copiesFrames(d.IFrameDecoder)
+}
+
+// Rejected 第一个包头校验失败时返回原因
+func (d *headerFrameDecoder) Rejected() error {
+	return d.err
+}
+
+func (d *headerFrameDecoder) Buffered() int {
+	if buffered, ok := d.IFrameDecoder.(IFrameBuffered); ok {
+		return buffered.Buffered()
+	}
+	return 0
+}
+
+func (d *headerFrameDecoder) SetDropHandler(handler func(reason string)) {
+	if notifier, ok := d.IFrameDecoder.(IFrameDropNotifier); ok {
+		notifier.SetDropHandler(handler)
+	}
+}
@@ -0,0 +1,178 @@
+/**
+* @File: recording.go
+* @Author: Jason Woo
+* @Date: 2026/10/16 13:21
+**/
+
+package fastnet
+
+import (
+	"encoding/binary"
+	"errors"
+	"github.com/dyowoo/fastnet/xlog"
+	"io"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// 流量录制与回放：录制链接收到的每一帧数据，之后回放到测试服务器中，用于离线复现特定设备的协议问题:
+//
+//	f, _ := os.Create("conn.rec")
+//	w := bufio.NewWriter(f)
+//	conn.StartRecording(w)
+//	...
+//	conn.StopRecording()
+//	_ = w.Flush()
+//
+//	_ = fastnet.ReplayInto(testServer, bufio.NewReader(recFile))
+//
+// 录制的是断粘包解码之后、拦截器处理之前的完整帧，没有断粘包解码器时为每次读取到的原始数据
+// 录制文件由连续的记录组成，每条记录为 8字节开始录制后经过的纳秒数 + 4字节帧长度 + 帧数据，均为大端序
+// 录制默认关闭，关闭时每帧只多一次原子读取；开启后写入在读协程中同步进行，建议使用带缓冲的Writer
+
+const (
+	recordHeaderLen  = 12       // 每条记录头部的长度
+	maxRecordedFrame = 64 << 20 // 回放时允许的最大帧长度，超过时认为录制文件已损坏
+)
+
+var (
+	ErrInvalidRecording = errors.New("invalid recording")                       // 录制文件格式错误或已损坏
+	ErrReplayServer     = errors.New("replay requires a server from NewServer") // 只能回放到NewServer创建的Server
+)
+
+// 一次录制
+type recording struct {
+	w     io.Writer // 录制的输出
+	start time.Time // 开始录制的时间
+}
+
+// frameRecorder 链接的入站帧录制器，零值表示没有录制
+type frameRecorder struct {
+	current atomic.Pointer[recording] // 当前的录制，没有录制时为nil，读协程据此快速跳过
+	lock    sync.Mutex                // 保证停止录制返回之后不会再写入
+}
+
+func (fr *frameRecorder) start(w io.Writer) {
+	fr.lock.Lock()
+	defer fr.lock.Unlock()
+
+	fr.current.Store(&recording{w: w, start: time.Now()})
+}
+
+func (fr *frameRecorder) stop() {
+	fr.lock.Lock()
+	defer fr.lock.Unlock()
+
+	fr.current.Store(nil)
+}
+
+// 录制一帧数据，写入失败时停止录制
+func (fr *frameRecorder) record(connID uint64, frame []byte) {
+	if fr.current.Load() == nil {
+		return
+	}
+
+	fr.lock.Lock()
+	defer fr.lock.Unlock()
+
+	rec := fr.current.Load()
+	if rec == nil {
+		return
+	}
+
+	if err := rec.write(frame); err != nil {
+		xlog.ErrorF("connID = %d record frame error: %v, recording stopped", connID, err)
+		fr.current.Store(nil)
+	}
+}
+
+func (rec *recording) write(frame []byte) error {
+	var header [recordHeaderLen]byte
+	binary.BigEndian.PutUint64(header[:8], uint64(time.Since(rec.start)))
+	binary.BigEndian.PutUint32(header[8:], uint32(len(frame)))
+
+	if _, err := rec.w.Write(header[:]); err != nil {
+		return err
+	}
+	_, err := rec.w.Write(frame)
+	return err
+}
+
+// 读取一条录制的帧，没有更多记录时返回io.EOF
+func readRecordedFrame(r io.Reader) ([]byte, error) {
+	var header [recordHeaderLen]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		if errors.Is(err, io.ErrUnexpectedEOF) {
+			return nil, ErrInvalidRecording
+		}
+		return nil, err
+	}
+
+	size := binary.BigEndian.Uint32(header[8:])
+	if size > maxRecordedFrame {
+		return nil, ErrInvalidRecording
+	}
+
+	frame := make([]byte, size)
+	if _, err := io.ReadFull(r, frame); err != nil {
+		return nil, ErrInvalidRecording
+	}
+
+	return frame, nil
+}
+
+// ReplayInto 将录制的帧回放到server中，server需要已经启动
+// 回放时创建一个新的链接，与真实接入的链接一样经过握手、断粘包解码、拦截器和路由，回复给该链接的数据被丢弃
+// 所有帧被链接读取之后关闭该链接并返回，此时worker中可能仍有消息正在处理
+func ReplayInto(server IServer, r io.Reader) error {
+	s, ok := server.(*Server)
+	if !ok {
+		return ErrReplayServer
+	}
+
+	local, remote := net.Pipe()
+	defer func() { _ = remote.Close() }()
+
+	// 丢弃服务端回复的数据，避免链接的写操作阻塞
+	go func() { _, _ = io.Copy(io.Discard, remote) }()
+
+	conn := newServerConn(s, local, atomic.AddUint64(&s.cID, 1))
+	xlog.InfoF("replay recording into connID = %d", conn.GetConnID())
+	go s.StartConn(conn)
+
+	for {
+		frame, err := readRecordedFrame(r)
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		if _, err = remote.Write(frame); err != nil {
+			return err
+		}
+	}
+}
+
+// StartRecording 开始将收到的每一帧录制到w，已经在录制时替换为新的w
+func (c *Connection) StartRecording(w io.Writer) {
+	c.recorder.start(w)
+}
+
+// StopRecording 停止录制，返回之后不会再写入w，w由调用方关闭
+func (c *Connection) StopRecording() {
+	c.recorder.stop()
+}
+
+// StartRecording 开始将收到的每一帧录制到w，已经在录制时替换为新的w
+func (c *WsConnection) StartRecording(w io.Writer) {
+	c.recorder.start(w)
+}
+
+// StopRecording 停止录制，返回之后不会再写入w，w由调用方关闭
+func (c *WsConnection) StopRecording() {
+	c.recorder.stop()
+}
@@ -0,0 +1,89 @@
+/**
+* @File: recording_test.go
+* @Author: Jason Woo
+* @Date: 2026/10/16 13:21
+**/
+
+package fastnet
+
+import (
+	"bytes"
+	"errors"
+	"github.com/dyowoo/fastnet/xconf"
+	"net"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestRecordAndReplay(t *testing.T) {
+	ln := newPipeListener()
+	s := NewUserConfServer(&xconf.Config{Mode: xconf.ServerModeTcp}, WithListenFunc(func(_, _ string) (net.Listener, error) {
+		return ln, nil
+	})).(*Server)
+
+	var recorded bytes.Buffer
+	started := make(chan IConnection, 1)
+	var once sync.Once
+	// 只录制第一个链接，回放的链接不录制
+	s.SetOnConnStart(func(conn IConnection) {
+		once.Do(func() {
+			conn.StartRecording(&recorded)
+			started <- conn
+		})
+	})
+
+	received := make(chan string, 10)
+	handler := func(request IRequest) {
+		received <- string(request.GetData())
+	}
+	s.AddRouterSlices(1, handler)
+	s.AddRouterSlices(2, handler)
+	s.Start()
+	defer s.Stop()
+
+	client, err := ln.Dial("", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = client.Close() }()
+
+	dp := s.GetPacket()
+	var stream []byte
+	for i, data := range []string{"a", "bb", "c"} {
+		packed, _ := dp.Pack(NewMsgPackage(uint32(i%2+1), []byte(data)))
+		stream = append(stream, packed...)
+	}
+	// 三条消息在一次写入中到达，录制的是断粘包之后的每一帧
+	if _, err = client.Write(stream); err != nil {
+		t.Fatal(err)
+	}
+
+	expectReceived := func(phase string) {
+		for _, want := range []string{"a", "bb", "c"} {
+			select {
+			case got := <-received:
+				if got != want {
+					t.Fatalf("%s: received %q, want %q", phase, got, want)
+				}
+			case <-time.After(5 * time.Second):
+				t.Fatalf("%s: message %q is not received", phase, want)
+			}
+		}
+	}
+	expectReceived("live")
+
+	conn := <-started
+	conn.StopRecording()
+
+	if err = ReplayInto(s, bytes.NewReader(recorded.Bytes())); err != nil {
+		t.Fatal(err)
+	}
+	expectReceived("replay")
+
+	// 录制文件被截断
+	truncated := recorded.Bytes()[:recorded.Len()-1]
+	if err = ReplayInto(s, bytes.NewReader(truncated)); !errors.Is(err, ErrInvalidRecording) {
+		t.Fatalf("replay truncated recording err = %v, want ErrInvalidRecording", err)
+	}
+}
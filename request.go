@@ -7,12 +7,23 @@
 package fastnet
 
 import (
-	"github.com/dyowoo/fastnet/xconf"
+	"context"
+	"errors"
 	"sync"
+	"sync/atomic"
+	"time"
 )
 
 type HandleStep int
 
+// MaxRequestRedirects 单个请求允许Redirect的最大次数，防止路由之间互相重定向导致死循环
+const MaxRequestRedirects = 8
+
+var (
+	ErrTooManyRedirects = errors.New("too many redirects")        // Redirect次数超过MaxRequestRedirects
+	ErrRedirectNotFound = errors.New("redirect api is not found") // Redirect的目标MsgID没有注册路由
+)
+
 // IFuncRequest 函数消息接口
 type IFuncRequest interface {
 	CallFunc()
@@ -25,13 +36,20 @@ type IRequest interface {
 	GetMsgID() uint32                 // 获取请求的消息ID
 	GetMessage() IMessage             // 获取请求消息的原始数据
 	GetResponse() IcResp              // 获取解析完后序列化数据
-	SetResponse(IcResp)               // 设置解析完后序列化数据
+	SetResponse(IcResp)               // 设置解析完后序列化数据, 处理器设置[]byte或IMessage时框架会在处理完成后自动回复
 	BindRouter(router IRouter)        // 绑定这次请求由哪个路由处理
 	Call()                            // 转进到下一个处理器开始执行 但是调用此方法的函数会根据先后顺序逆序执行
-	Abort()                           // 终止处理函数的运行 但调用此方法的函数会执行完毕
+	Abort()                           // 终止处理函数的运行 但调用此方法的函数以及已经调用Next的中间件的后续逻辑会执行完毕
+	IsAborted() bool                  // 是否已经调用过Abort
 	Goto(HandleStep)                  // 指定接下来的Handle去执行哪个Handler函数(慎用，会导致循环调用)
 	BindRouterSlices([]RouterHandler) // 新路由操作
-	RouterSlicesNext()                // 执行下一个函数
+	RouterSlicesNext()                // 执行下一个函数，与Next相同
+	Next()                            // 在中间件中执行后续的所有处理函数，返回后可继续执行中间件的后置逻辑
+	Redirect(newMsgID uint32) error   // 将请求转交给newMsgID对应的路由重新处理
+	GetWsMessageType() int            // 获取收到该消息的websocket帧类型(websocket.BinaryMessage/TextMessage)，tcp链接返回0
+	Context() context.Context         // 获取请求的上下文，设置了处理超时时带有截止时间，链接断开时被取消
+	ReceivedAt() time.Time            // 获取从socket读出该消息的时间，time.Since(ReceivedAt())即消息在队列中等待和处理的耗时
+	Bind(v interface{}) error         // 按消息的编码类型选择编解码器，将消息数据解析到v中
 }
 
 type BaseRequest struct{}
@@ -45,9 +63,16 @@ func (br *BaseRequest) SetResponse(IcResp)               {}
 func (br *BaseRequest) BindRouter(IRouter)               {}
 func (br *BaseRequest) Call()                            {}
 func (br *BaseRequest) Abort()                           {}
+func (br *BaseRequest) IsAborted() bool                  { return false }
 func (br *BaseRequest) Goto(HandleStep)                  {}
 func (br *BaseRequest) BindRouterSlices([]RouterHandler) {}
 func (br *BaseRequest) RouterSlicesNext()                {}
+func (br *BaseRequest) Next()                            {}
+func (br *BaseRequest) Redirect(uint32) error            { return nil }
+func (br *BaseRequest) GetWsMessageType() int            { return 0 }
+func (br *BaseRequest) Context() context.Context         { return context.Background() }
+func (br *BaseRequest) ReceivedAt() time.Time            { return time.Time{} }
+func (br *BaseRequest) Bind(interface{}) error           { return nil }
 
 const (
 	PreHandle  HandleStep = iota // PreHandle for pre-processing
@@ -66,8 +91,17 @@ type Request struct {
 	stepLock *sync.RWMutex   // 并发互斥
 	needNext bool            // 是否需要执行下一个路由函数
 	icResp   IcResp          // 拦截器返回数据
+	decoded  *DecodeResult   // 内置解码器设置的解码结果
 	handlers []RouterHandler // 路由函数切片
-	index    int8            // 路由函数切片索引
+	index    int             // 路由函数切片索引
+	aborted  bool            // 是否已经调用过Abort
+	redirect int             // 已经Redirect的次数
+	wsType   int             // 收到该消息的websocket帧类型
+	ctx      context.Context // 请求的上下文，为nil时使用链接的上下文
+	onError  PanicHandler    // 当前路由的错误处理回调，为nil时使用全局的panic回调
+	timedOut atomic.Bool     // 处理超时后由worker设置，处理函数仍在其他协程中运行，只能通过原子变量通知
+
+	receivedAt time.Time // 从socket读出该消息的时间
 }
 
 func (r *Request) GetResponse() IcResp {
@@ -78,6 +112,14 @@ func (r *Request) SetResponse(response IcResp) {
 	r.icResp = response
 }
 
+func (r *Request) setDecodeResult(result *DecodeResult) {
+	r.decoded = result
+}
+
+func (r *Request) getDecodeResult() *DecodeResult {
+	return r.decoded
+}
+
 func NewRequest(conn IConnection, msg IMessage) IRequest {
 	req := new(Request)
 	req.steps = PreHandle
@@ -86,10 +128,59 @@ func NewRequest(conn IConnection, msg IMessage) IRequest {
 	req.stepLock = new(sync.RWMutex)
 	req.needNext = true
 	req.index = -1
+	// 读协程读出数据后立即创建请求，此时即为消息的接收时间，之后才会进入worker队列
+	req.receivedAt = time.Now()
+
+	return req
+}
+
+// 创建websocket链接的请求，记录收到该消息的帧类型
+func newWsRequest(conn IConnection, msg IMessage, messageType int) IRequest {
+	req := NewRequest(conn, msg).(*Request)
+	req.wsType = messageType
 
 	return req
 }
 
+func (r *Request) GetWsMessageType() int {
+	return r.wsType
+}
+
+// Context 获取请求的上下文
+// 设置了处理超时时上下文带有截止时间，处理函数中耗时的操作应该监听ctx.Done()及时退出
+// 链接关闭或服务器停止(GracefulStop等待超时后)时上下文被取消，处理函数只有监听ctx.Done()才能被中断，
+// 不监听的处理函数会一直执行到结束，Stop需要等待worker处理完这些消息
+func (r *Request) Context() context.Context {
+	if r.ctx != nil {
+		return r.ctx
+	}
+	if r.conn != nil && r.conn.Context() != nil {
+		return r.conn.Context()
+	}
+	return context.Background()
+}
+
+// ReceivedAt 获取从socket读出该消息的时间
+// 处理函数中用time.Since(request.ReceivedAt())可以得到消息在worker队列中的等待时间加上已处理的时间，用于判断是否积压
+func (r *Request) ReceivedAt() time.Time {
+	return r.receivedAt
+}
+
+// Bind 将消息数据解析到v中，消息携带了编码类型(ContentType)时使用RegisterCodec注册的编解码器，
+// 否则使用链接所属MsgHandler的编解码器(SetCodec)，处理函数不需要关心消息的编码方式
+func (r *Request) Bind(v interface{}) error {
+	var mh IMsgHandle
+	if r.conn != nil {
+		mh = r.conn.GetMsgHandler()
+	}
+
+	return bindData(mh, r, v)
+}
+
+func (r *Request) setContext(ctx context.Context) {
+	r.ctx = ctx
+}
+
 func (r *Request) GetMessage() IMessage {
 	return r.msg
 }
@@ -134,7 +225,7 @@ func (r *Request) Call() {
 		return
 	}
 
-	for r.steps < HandleOver {
+	for r.steps < HandleOver && !r.timedOut.Load() {
 		switch r.steps {
 		case PreHandle:
 			r.router.PreHandle(r)
@@ -150,24 +241,96 @@ func (r *Request) Call() {
 	r.steps = PreHandle
 }
 
+// Abort 终止后续处理函数的执行，对旧版路由和RouterSlices都生效
+// RouterSlices模式下，所有层级的Next都不会再调用新的处理函数，已经调用Next的中间件在Next返回后仍会执行其后置逻辑
 func (r *Request) Abort() {
-	if xconf.GlobalObject.RouterSlicesMode {
-		r.index = int8(len(r.handlers))
-	} else {
-		r.stepLock.Lock()
-		r.steps = HandleOver
-		r.stepLock.Unlock()
+	r.stepLock.Lock()
+	r.aborted = true
+	r.steps = HandleOver
+	r.stepLock.Unlock()
+}
+
+func (r *Request) IsAborted() bool {
+	if r.timedOut.Load() {
+		return true
 	}
+
+	r.stepLock.RLock()
+	defer r.stepLock.RUnlock()
+
+	return r.aborted
+}
+
+// 处理超时后终止尚未执行的处理函数，处理链在执行下一个处理函数之前检查，不修改处理函数协程使用的其他字段
+func (r *Request) cancelHandlers() {
+	r.timedOut.Store(true)
 }
 
 func (r *Request) BindRouterSlices(handlers []RouterHandler) {
 	r.handlers = handlers
 }
 
+// RouterSlicesNext 执行后续的处理函数，与Next相同
 func (r *Request) RouterSlicesNext() {
+	r.Next()
+}
+
+// Next 执行后续的所有处理函数
+// 处理函数中可以嵌套调用Next，先执行后续的处理函数，返回后再执行自己的后置逻辑:
+//
+//	func(request IRequest) {
+//		start := time.Now()
+//		request.Next()
+//		xlog.InfoF("cost %s", time.Since(start))
+//	}
+//
+// 所有层级的Next共享同一个索引，每个处理函数只会被执行一次
+func (r *Request) Next() {
 	r.index++
-	for r.index < int8(len(r.handlers)) {
+	for r.index < len(r.handlers) && !r.IsAborted() {
 		r.handlers[r.index](r)
 		r.index++
 	}
 }
+
+// Redirect 将请求转交给newMsgID对应的路由重新处理，常用于中间件中做消息版本升级等MsgID映射
+// 调用后请求的MsgID变为newMsgID，当前处理函数返回后在同一个Worker中从newMsgID路由的第一个处理函数开始执行
+// 必须在处理链执行完成之前调用(例如在中间件调用RouterSlicesNext之前)，否则不会生效
+// 同一请求Redirect次数超过MaxRequestRedirects时返回ErrTooManyRedirects
+func (r *Request) Redirect(newMsgID uint32) error {
+	if r.redirect >= MaxRequestRedirects {
+		return ErrTooManyRedirects
+	}
+
+	if r.conn == nil {
+		return ErrRedirectNotFound
+	}
+	mh := asMsgHandle(r.conn.GetMsgHandler())
+	if mh == nil {
+		return ErrRedirectNotFound
+	}
+
+	if r.router != nil {
+		router, ok := mh.getRouter(newMsgID)
+		if !ok {
+			return ErrRedirectNotFound
+		}
+		r.router = router
+		// 当前步骤执行完成后，从新路由的PreHandle重新开始
+		r.Goto(PreHandle)
+	} else {
+		handlers, ok := mh.routerSlices.GetHandlers(newMsgID)
+		if !ok {
+			return ErrRedirectNotFound
+		}
+		r.handlers = handlers
+		r.onError = mh.routerSlices.errorHandler(newMsgID)
+		// 当前处理函数返回后，RouterSlicesNext的循环从新路由的第一个处理函数开始执行
+		r.index = -1
+	}
+
+	r.redirect++
+	r.msg.SetMsgID(newMsgID)
+
+	return nil
+}
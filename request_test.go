@@ -0,0 +1,192 @@
+/**
+* @File: request_test.go
+* @Author: Jason Woo
+* @Date: 2026/10/16 17:40
+**/
+
+package fastnet
+
+import (
+	"errors"
+	"github.com/dyowoo/fastnet/xconf"
+	"net"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// 创建一个绑定到server的请求，用于直接驱动路由处理
+func newTestRequest(t *testing.T, s *Server, msgID uint32) IRequest {
+	conn, _ := newPipeConn(t, s, 1)
+	return NewRequest(conn, NewMsgPackage(msgID, nil))
+}
+
+func TestRequestRedirect(t *testing.T) {
+	s := NewServer().(*Server)
+	mh := s.GetMsgHandler().(*MsgHandle)
+
+	var trace []string
+	mh.AddRouterSlices(1, func(request IRequest) {
+		trace = append(trace, "v1")
+		if err := request.Redirect(2); err != nil {
+			t.Error(err)
+		}
+	}, func(request IRequest) {
+		trace = append(trace, "v1 unreachable")
+	})
+	mh.AddRouterSlices(2, func(request IRequest) {
+		trace = append(trace, "v2")
+		if request.GetMsgID() != 2 {
+			t.Errorf("unexpected msgID after redirect: %d", request.GetMsgID())
+		}
+	})
+
+	mh.doMsgHandlerSlices(newTestRequest(t, s, 1), 0)
+
+	if want := []string{"v1", "v2"}; !reflect.DeepEqual(trace, want) {
+		t.Fatalf("trace = %v, want %v", trace, want)
+	}
+}
+
+func TestRequestRedirectLoop(t *testing.T) {
+	s := NewServer().(*Server)
+	mh := s.GetMsgHandler().(*MsgHandle)
+
+	var calls int
+	var lastErr error
+	mh.AddRouterSlices(1, func(request IRequest) {
+		calls++
+		lastErr = request.Redirect(1)
+	})
+
+	mh.doMsgHandlerSlices(newTestRequest(t, s, 1), 0)
+
+	if !errors.Is(lastErr, ErrTooManyRedirects) || calls != MaxRequestRedirects+1 {
+		t.Fatalf("calls = %d, lastErr = %v", calls, lastErr)
+	}
+
+	req := newTestRequest(t, s, 1)
+	req.BindRouterSlices(nil)
+	if err := req.Redirect(404); !errors.Is(err, ErrRedirectNotFound) {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+func TestRequestNestedNext(t *testing.T) {
+	var trace []string
+	req := NewRequest(nil, NewMsgPackage(1, nil))
+	req.BindRouterSlices([]RouterHandler{
+		func(request IRequest) {
+			trace = append(trace, "m1 before")
+			request.Next()
+			trace = append(trace, "m1 after")
+		},
+		func(request IRequest) {
+			trace = append(trace, "m2 before")
+			request.Next()
+			trace = append(trace, "m2 after")
+		},
+		func(request IRequest) {
+			trace = append(trace, "handler")
+		},
+	})
+
+	req.RouterSlicesNext()
+
+	want := []string{"m1 before", "m2 before", "handler", "m2 after", "m1 after"}
+	if !reflect.DeepEqual(trace, want) {
+		t.Fatalf("trace = %v, want %v", trace, want)
+	}
+}
+
+func TestRequestAbortInNestedNext(t *testing.T) {
+	var trace []string
+	req := NewRequest(nil, NewMsgPackage(1, nil))
+	req.BindRouterSlices([]RouterHandler{
+		func(request IRequest) {
+			trace = append(trace, "m1 before")
+			request.Next()
+			trace = append(trace, "m1 after")
+		},
+		func(request IRequest) {
+			trace = append(trace, "auth")
+			request.Abort()
+			// Abort之后再调用Next也不会执行后续的处理函数
+			request.Next()
+		},
+		func(request IRequest) {
+			trace = append(trace, "handler")
+		},
+	})
+
+	req.RouterSlicesNext()
+
+	want := []string{"m1 before", "auth", "m1 after"}
+	if !reflect.DeepEqual(trace, want) {
+		t.Fatalf("trace = %v, want %v", trace, want)
+	}
+	if !req.IsAborted() {
+		t.Fatal("request should be aborted")
+	}
+}
+
+func TestRequestAbortWithoutNext(t *testing.T) {
+	var trace []string
+	req := NewRequest(nil, NewMsgPackage(1, nil))
+	req.BindRouterSlices([]RouterHandler{
+		func(request IRequest) {
+			trace = append(trace, "auth")
+			request.Abort()
+		},
+		func(request IRequest) {
+			trace = append(trace, "handler")
+		},
+	})
+
+	req.RouterSlicesNext()
+
+	if want := []string{"auth"}; !reflect.DeepEqual(trace, want) {
+		t.Fatalf("trace = %v, want %v", trace, want)
+	}
+}
+
+func TestRequestReceivedAt(t *testing.T) {
+	s := NewUserConfServer(&xconf.Config{WorkerPoolSize: 1, HideLogo: true}).(*Server)
+	s.AddInterceptor(s.GetDecoder())
+	s.GetMsgHandler().StartWorkerPool()
+	defer s.GetMsgHandler().StopWorkerPool()
+
+	// 消息1阻塞唯一的worker，消息2在队列中等待
+	s.AddRouterSlices(1, func(request IRequest) {
+		time.Sleep(50 * time.Millisecond)
+	})
+	waits := make(chan time.Duration, 1)
+	s.AddRouterSlices(2, func(request IRequest) {
+		waits <- time.Since(request.ReceivedAt())
+	})
+
+	local, remote := net.Pipe()
+	defer remote.Close()
+	startTestConn(t, s, local, 1)
+
+	sent := time.Now()
+	for _, msgID := range []uint32{1, 2} {
+		packed, _ := s.GetPacket().Pack(NewMsgPackage(msgID, []byte("data")))
+		if _, err := remote.Write(packed); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	select {
+	case wait := <-waits:
+		if wait < 40*time.Millisecond || wait > time.Since(sent) {
+			t.Fatalf("queue wait = %v, want about 50ms", wait)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("message 2 is not handled")
+	}
+
+	if !NewFuncRequest(nil, func() {}).ReceivedAt().IsZero() {
+		t.Fatal("func request should not have a received time")
+	}
+}
@@ -0,0 +1,13 @@
+//go:build darwin || dragonfly || freebsd || netbsd || openbsd
+
+/**
+* @File: reuseport_bsd.go
+* @Author: Jason Woo
+* @Date: 2026/10/16 22:05
+**/
+
+package fastnet
+
+import "syscall"
+
+const soReusePort = syscall.SO_REUSEPORT
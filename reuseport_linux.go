@@ -0,0 +1,12 @@
+//go:build linux && !(mips || mipsle || mips64 || mips64le)
+
+/**
+* @File: reuseport_linux.go
+* @Author: Jason Woo
+* @Date: 2026/10/16 22:05
+**/
+
+package fastnet
+
+// syscall包在linux下没有定义SO_REUSEPORT，取值与golang.org/x/sys/unix.SO_REUSEPORT相同
+const soReusePort = 0xf
@@ -0,0 +1,12 @@
+//go:build linux && (mips || mipsle || mips64 || mips64le)
+
+/**
+* @File: reuseport_linux_mips.go
+* @Author: Jason Woo
+* @Date: 2026/10/16 22:05
+**/
+
+package fastnet
+
+// mips架构下SO_REUSEPORT的取值与其他linux架构不同
+const soReusePort = 0x200
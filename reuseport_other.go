@@ -0,0 +1,19 @@
+//go:build !(linux || darwin || dragonfly || freebsd || netbsd || openbsd)
+
+/**
+* @File: reuseport_other.go
+* @Author: Jason Woo
+* @Date: 2026/10/16 22:05
+**/
+
+package fastnet
+
+import "syscall"
+
+// 当前平台是否支持SO_REUSEPORT
+const reusePortSupported = false
+
+// reusePortControl 当前平台不支持SO_REUSEPORT，按普通方式监听
+func reusePortControl(network, address string, c syscall.RawConn) error {
+	return nil
+}
@@ -0,0 +1,32 @@
+/**
+* @File: reuseport_test.go
+* @Author: Jason Woo
+* @Date: 2026/10/16 22:20
+**/
+
+package fastnet
+
+import (
+	"github.com/dyowoo/fastnet/xconf"
+	"testing"
+)
+
+func TestListenReusePort(t *testing.T) {
+	if !reusePortSupported {
+		t.Skip("SO_REUSEPORT is not supported on this platform")
+	}
+
+	s := NewUserConfServer(&xconf.Config{ReusePort: true, HideLogo: true}).(*Server)
+	first, err := s.listenTCP("127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = first.Close() }()
+
+	// 第二个监听绑定同一个端口
+	second, err := s.listenTCP(first.Addr().String())
+	if err != nil {
+		t.Fatalf("listen the same port with SO_REUSEPORT: %v", err)
+	}
+	_ = second.Close()
+}
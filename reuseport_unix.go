@@ -0,0 +1,34 @@
+//go:build linux || darwin || dragonfly || freebsd || netbsd || openbsd
+
+/**
+* @File: reuseport_unix.go
+* @Author: Jason Woo
+* @Date: 2026/10/16 22:05
+**/
+
+package fastnet
+
+import (
+	"github.com/dyowoo/fastnet/xlog"
+	"syscall"
+)
+
+// 当前平台是否支持SO_REUSEPORT
+const reusePortSupported = true
+
+// reusePortControl 在bind之前为监听socket设置SO_REUSEPORT
+// 内核不支持该选项时只记录日志，按普通方式继续监听
+func reusePortControl(network, address string, c syscall.RawConn) error {
+	var sockErr error
+	err := c.Control(func(fd uintptr) {
+		sockErr = syscall.SetsockoptInt(int(fd), syscall.SOL_SOCKET, soReusePort, 1)
+	})
+	if err != nil {
+		return err
+	}
+	if sockErr != nil {
+		xlog.WarnF("set SO_REUSEPORT on %s %s err: %v, listen without it", network, address, sockErr)
+	}
+
+	return nil
+}
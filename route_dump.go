@@ -0,0 +1,101 @@
+/**
+* @File: route_dump.go
+* @Author: Jason Woo
+* @Date: 2026/10/16 13:14
+**/
+
+package fastnet
+
+import "sort"
+
+// 路由表导出：列出所有已注册的路由，用于启动时核对路由是否齐全，或者通过管理接口查看
+// 只读取已有的路由状态，可以在服务运行期间调用
+
+// RouteInfo 一条路由的注册信息
+type RouteInfo struct {
+	MsgID           uint32 `json:"msgId"`            // 消息ID，按自定义路由键注册的路由为0
+	Key             string `json:"key,omitempty"`    // AddKeyRouter注册的自定义路由键，按MsgID注册的路由为空
+	Name            string `json:"name,omitempty"`   // RegisterMsgName注册的名称，没有注册时为空
+	Legacy          bool   `json:"legacy"`           // 是否为旧版路由(IRouter)，旧版路由没有组件
+	Handlers        int    `json:"handlers"`         // 处理链上处理器的总数，包括合并进来的全局组件和分组组件
+	Middleware      int    `json:"middleware"`       // 注册时合并进来的全局组件(Use)数量
+	GroupMiddleware int    `json:"groupMiddleware"`  // 注册时合并进来的分组组件数量
+	Group           string `json:"group,omitempty"`  // 注册时所在的路由分组，不属于任何分组时为global
+	Source          string `json:"source,omitempty"` // 注册代码的位置
+}
+
+// DumpRoutes 导出所有已注册的路由，按MsgID排序，自定义路由键的路由排在最后并按路由键排序
+func (mh *MsgHandle) DumpRoutes() []RouteInfo {
+	routes := mh.routerSlices.routes()
+
+	mh.routersLock.RLock()
+	for msgID := range mh.routers {
+		routes = append(routes, RouteInfo{
+			MsgID:    msgID,
+			Name:     registeredMsgName(msgID),
+			Legacy:   true,
+			Handlers: 1,
+		})
+	}
+	mh.routersLock.RUnlock()
+
+	routes = append(routes, mh.keyRoutes.dump()...)
+
+	sort.Slice(routes, func(i, j int) bool {
+		if routes[i].Key != routes[j].Key {
+			if routes[i].Key == "" || routes[j].Key == "" {
+				return routes[i].Key == ""
+			}
+			return routes[i].Key < routes[j].Key
+		}
+		if routes[i].MsgID != routes[j].MsgID {
+			return routes[i].MsgID < routes[j].MsgID
+		}
+		// 同一个MsgID同时注册了两种路由时，旧版路由优先处理
+		return routes[i].Legacy
+	})
+
+	return routes
+}
+
+// 导出切片路由
+func (r *RouterSlices) routes() []RouteInfo {
+	r.RLock()
+	defer r.RUnlock()
+
+	routes := make([]RouteInfo, 0, len(r.Apis))
+	for msgID, handlers := range r.Apis {
+		src := r.sources[msgID]
+		routes = append(routes, RouteInfo{
+			MsgID:           msgID,
+			Name:            registeredMsgName(msgID),
+			Handlers:        len(handlers),
+			Middleware:      src.globals,
+			GroupMiddleware: src.groupHandlers,
+			Group:           src.group,
+			Source:          src.location(),
+		})
+	}
+
+	return routes
+}
+
+// 导出自定义路由键的路由
+func (kr *keyRouter) dump() []RouteInfo {
+	kr.lock.RLock()
+	defer kr.lock.RUnlock()
+
+	routes := make([]RouteInfo, 0, len(kr.routes))
+	for key, handlers := range kr.routes {
+		src := kr.sources[key]
+		routes = append(routes, RouteInfo{
+			Key:        string(key),
+			Handlers:   len(handlers),
+			Middleware: src.globals,
+			Group:      src.group,
+			Source:     src.location(),
+		})
+	}
+
+	return routes
+}
@@ -0,0 +1,90 @@
+/**
+* @File: route_error.go
+* @Author: Jason Woo
+* @Date: 2026/10/16 13:27
+**/
+
+package fastnet
+
+// 路由和分组的错误处理：处理函数发生panic时，按 路由 -> 分组 -> 全局 的顺序选择第一个设置了的回调，
+// 使不同的业务模块可以给客户端回复各自的错误消息:
+//
+//	g := s.Group(100, 199)
+//	g.OnError(func(request IRequest, recovered interface{}, stack []byte) {
+//		_ = request.GetConnection().SendMsg(199, []byte("user service error"))
+//	})
+//	g.AddHandler(101, login)
+//	s.AddRouterSlices(102, pay).SetErrorHandler(102, payErrorHandler)
+//
+// 回调在捕获panic的协程中调用，与全局的panic回调相同，只对切片路由生效
+
+// 请求实现该接口，记录处理该请求的路由的错误处理回调
+type routeErrorBinder interface {
+	setErrorHandler(handler PanicHandler)
+	errorHandler() PanicHandler
+}
+
+func (r *Request) setErrorHandler(handler PanicHandler) {
+	r.onError = handler
+}
+
+func (r *Request) errorHandler() PanicHandler {
+	return r.onError
+}
+
+// 为请求记录路由的错误处理回调，请求没有实现routeErrorBinder时忽略
+func bindRouteErrorHandler(request IRequest, handler PanicHandler) {
+	if binder, ok := request.(routeErrorBinder); ok {
+		binder.setErrorHandler(handler)
+	}
+}
+
+// 请求所在路由的错误处理回调，没有设置时返回nil
+func requestErrorHandler(request IRequest) PanicHandler {
+	if binder, ok := request.(routeErrorBinder); ok {
+		return binder.errorHandler()
+	}
+	return nil
+}
+
+// SetErrorHandler 设置MsgId的错误处理回调，处理函数发生panic时优先于分组和全局的panic回调
+// 可以在注册路由之前设置，传入nil时删除该设置；RemoveHandler移除路由时一并删除
+func (r *RouterSlices) SetErrorHandler(msgId uint32, handler PanicHandler) {
+	r.Lock()
+	defer r.Unlock()
+
+	if handler == nil {
+		delete(r.errorHandlers, msgId)
+		return
+	}
+	r.errorHandlers[msgId] = handler
+}
+
+// 按 路由 -> 分组 的顺序查找MsgId的错误处理回调，都没有设置时返回nil
+func (r *RouterSlices) errorHandler(msgId uint32) PanicHandler {
+	r.RLock()
+	defer r.RUnlock()
+
+	if handler, ok := r.errorHandlers[msgId]; ok {
+		return handler
+	}
+	if owner := r.sources[msgId].owner; owner != nil {
+		return owner.errorHandler()
+	}
+	return nil
+}
+
+// OnError 设置分组的错误处理回调，对分组中已经注册和之后注册的路由都生效，传入nil时恢复为全局的panic回调
+func (g *GroupRouter) OnError(handler PanicHandler) {
+	g.lock.Lock()
+	defer g.lock.Unlock()
+
+	g.onError = handler
+}
+
+func (g *GroupRouter) errorHandler() PanicHandler {
+	g.lock.RLock()
+	defer g.lock.RUnlock()
+
+	return g.onError
+}
@@ -0,0 +1,153 @@
+/**
+* @File: route_key.go
+* @Author: Jason Woo
+* @Date: 2026/10/16 12:19
+**/
+
+package fastnet
+
+import (
+	"fmt"
+	"github.com/dyowoo/fastnet/xlog"
+	"runtime/debug"
+	"sync"
+)
+
+// RouteKey 自定义路由键，例如字符串主题、路径或由多个字段拼接的组合键
+// 空字符串表示没有自定义路由键，按MsgID路由
+type RouteKey string
+
+// RouteKeyFunc 从解码后的消息中提取路由键，返回""时按MsgID路由
+// 在worker中调用，可以与其他消息的处理并发执行，不应修改消息
+// 例如按消息数据中的主题路由:
+//
+//	s.SetRouteKeyFunc(func(msg IMessage) RouteKey {
+//		if msg.GetMsgID() != PublishMsgID {
+//			return ""
+//		}
+//		topic, _, _ := bytes.Cut(msg.GetData(), []byte{'\n'})
+//		return RouteKey(topic)
+//	})
+//	s.AddKeyRouter("chat/room1", handleRoom1)
+type RouteKeyFunc func(msg IMessage) RouteKey
+
+// 按自定义路由键注册的处理器集合
+type keyRouter struct {
+	routes  map[RouteKey][]RouterHandler
+	sources map[RouteKey]routeSource // 每个路由键的注册来源
+	lock    sync.RWMutex
+}
+
+func (kr *keyRouter) add(src routeSource, key RouteKey, handlers []RouterHandler) error {
+	kr.lock.Lock()
+	defer kr.lock.Unlock()
+
+	if _, ok := kr.routes[key]; ok {
+		return fmt.Errorf("%w, routeKey = %q", ErrRepeatedRouter, key)
+	}
+	if kr.routes == nil {
+		kr.routes = make(map[RouteKey][]RouterHandler)
+		kr.sources = make(map[RouteKey]routeSource)
+	}
+	kr.routes[key] = handlers
+	kr.sources[key] = src
+
+	return nil
+}
+
+func (kr *keyRouter) remove(key RouteKey) bool {
+	kr.lock.Lock()
+	defer kr.lock.Unlock()
+
+	if _, ok := kr.routes[key]; !ok {
+		return false
+	}
+	delete(kr.routes, key)
+	delete(kr.sources, key)
+
+	return true
+}
+
+func (kr *keyRouter) get(key RouteKey) ([]RouterHandler, bool) {
+	kr.lock.RLock()
+	defer kr.lock.RUnlock()
+
+	handlers, ok := kr.routes[key]
+	return handlers, ok
+}
+
+// SetRouteKeyFunc 设置自定义路由键的提取方法，为nil时只按MsgID路由，需要在StartWorkerPool之前调用
+func (mh *MsgHandle) SetRouteKeyFunc(f RouteKeyFunc) {
+	mh.routeKeyFunc = f
+}
+
+// AddKeyRouter 按自定义路由键注册处理器集合，Use添加的全局组件同样生效，重复注册时panic
+// 可在服务运行期间与消息处理并发调用
+func (mh *MsgHandle) AddKeyRouter(key RouteKey, handlers ...RouterHandler) {
+	if key == "" {
+		panic("route key must not be empty")
+	}
+
+	src := callerSource(globalGroupName)
+	mh.routerSlices.RLock()
+	merged := make([]RouterHandler, 0, len(mh.routerSlices.Handlers)+len(handlers))
+	merged = append(merged, mh.routerSlices.Handlers...)
+	mh.routerSlices.RUnlock()
+	src.globals = len(merged)
+	merged = append(merged, handlers...)
+
+	if err := mh.keyRoutes.add(src, key, merged); err != nil {
+		panic(err.Error())
+	}
+	xlog.InfoF("add router routeKey = %q", key)
+}
+
+// RemoveKeyRouter 移除自定义路由键的处理器集合，已经开始处理的请求不受影响
+func (mh *MsgHandle) RemoveKeyRouter(key RouteKey) bool {
+	if !mh.keyRoutes.remove(key) {
+		return false
+	}
+	xlog.InfoF("remove router routeKey = %q", key)
+	return true
+}
+
+// 提取请求的路由键，没有设置提取方法时返回""
+// 提取方法发生panic时交给panic回调处理并返回false，该消息不再交给路由处理
+func (mh *MsgHandle) routeKey(request IRequest) (key RouteKey, ok bool) {
+	if mh.routeKeyFunc == nil || request.GetMessage() == nil {
+		return "", true
+	}
+
+	defer func() {
+		if err := recover(); err != nil {
+			mh.HandlePanic(request, err, debug.Stack())
+			key, ok = "", false
+		}
+	}()
+
+	return mh.routeKeyFunc(request.GetMessage()), true
+}
+
+// 按自定义路由键处理消息
+func (mh *MsgHandle) doKeyRouter(request IRequest, key RouteKey) (found bool) {
+	defer func() {
+		if err := recover(); err != nil {
+			mh.HandlePanic(request, err, debug.Stack())
+		}
+	}()
+
+	handlers, ok := mh.keyRoutes.get(key)
+	if !ok {
+		xlog.ErrorF("api routeKey = %q msgID = %s is not FOUND!", key, msgIDString(request.GetMsgID()))
+		return
+	}
+	found = true
+
+	request.BindRouterSlices(handlers)
+	if !mh.callWithTimeout(request, request.RouterSlicesNext) {
+		return
+	}
+
+	mh.sendResponse(request)
+	return
+}
@@ -7,7 +7,10 @@
 package fastnet
 
 import (
-	"strconv"
+	"errors"
+	"fmt"
+	"runtime"
+	"strings"
 	"sync"
 )
 
@@ -30,16 +33,65 @@ RouterHandler
 type RouterHandler func(request IRequest)
 type IRouterSlices interface {
 	Use(Handlers ...RouterHandler)                                         // 添加全局组件
-	AddHandler(msgId uint32, handlers ...RouterHandler)                    // 添加业务处理器集合
+	AddHandler(msgId uint32, handlers ...RouterHandler)                    // 添加业务处理器集合，重复注册时panic
+	TryAddHandler(msgId uint32, handlers ...RouterHandler) error           // 添加业务处理器集合，重复注册时返回错误
 	Group(start, end uint32, Handlers ...RouterHandler) IGroupRouterSlices // 路由分组管理，并且会返回一个组管理器
 	GetHandlers(MsgId uint32) ([]RouterHandler, bool)                      // 获得当前的所有注册在MsgId的处理器集合
+	RemoveHandler(msgId uint32) bool                                       // 移除MsgId的处理器集合，MsgId未注册时返回false
+	SetErrorHandler(msgId uint32, handler PanicHandler)                    // 设置MsgId的错误处理回调，优先于分组和全局的panic回调
 }
 
 type IGroupRouterSlices interface {
-	Use(Handlers ...RouterHandler)                      // 添加全局组件
-	AddHandler(MsgId uint32, Handlers ...RouterHandler) // 添加业务处理器集合
+	Use(Handlers ...RouterHandler)                               // 添加全局组件
+	AddHandler(MsgId uint32, Handlers ...RouterHandler)          // 添加业务处理器集合，重复注册或超出分组范围时panic
+	TryAddHandler(MsgId uint32, Handlers ...RouterHandler) error // 添加业务处理器集合，重复注册或超出分组范围时返回错误
+	OnError(handler PanicHandler)                                // 设置分组的错误处理回调，优先于全局的panic回调
 }
 
+var (
+	ErrRepeatedRouter   = errors.New("repeated api")             // 重复注册同一个MsgId的路由
+	ErrGroupRouterRange = errors.New("msgId out of group range") // 注册到分组的MsgId超出分组范围
+)
+
+// routeSource 路由的注册来源，用于重复注册时给出清晰的错误信息
+type routeSource struct {
+	group         string       // 注册时所在的路由分组
+	file          string       // 注册代码所在的文件
+	line          int          // 注册代码所在的行号
+	globals       int          // 注册时合并进来的全局组件数量
+	groupHandlers int          // 注册时合并进来的分组组件数量
+	owner         *GroupRouter // 注册时所在的分组，不通过分组注册时为nil
+}
+
+func (rs routeSource) String() string {
+	return rs.group + " at " + rs.location()
+}
+
+// 注册代码的位置 file:line
+func (rs routeSource) location() string {
+	return fmt.Sprintf("%s:%d", rs.file, rs.line)
+}
+
+// 获取调用路由注册方法的用户代码位置，跳过框架内部的调用
+func callerSource(group string) routeSource {
+	pcs := make([]uintptr, 16)
+	n := runtime.Callers(2, pcs)
+	frames := runtime.CallersFrames(pcs[:n])
+
+	src := routeSource{group: group, file: "unknown-file"}
+	for {
+		frame, more := frames.Next()
+		src.file, src.line = frame.File, frame.Line
+		if !strings.HasPrefix(frame.Function, "github.com/dyowoo/fastnet.") || !more {
+			break
+		}
+	}
+
+	return src
+}
+
+const globalGroupName = "global"
+
 // BaseRouter 实现router时，先嵌入这个基类，然后根据需要对这个基类的方法进行重写
 type BaseRouter struct{}
 
@@ -61,27 +113,57 @@ func (br *BaseRouter) PostHandle(req IRequest) {}
 // 路由本体会讲这些路由处理器函数全部保存,在请求来的时候找到，并交由IRequest去执行
 // 路由可以设置全局的共用组件通过Use方法
 // 路由可以分组,通过Group,分组也有自己对应Use方法设置组共有组件
+//
+// 并发说明:
+// AddHandler/TryAddHandler/RemoveHandler/Use可以在服务运行期间与消息处理并发调用，例如插件热加载时注册和移除路由
+// GetHandlers返回的处理器集合不会再被修改，已经开始处理的请求不受之后的注册和移除影响
+// 移除后新到达的该MsgId的请求将找不到路由；Use添加的全局组件只对之后注册的路由生效
 
 type RouterSlices struct {
-	Apis     map[uint32][]RouterHandler
-	Handlers []RouterHandler
+	Apis          map[uint32][]RouterHandler
+	Handlers      []RouterHandler
+	sources       map[uint32]routeSource  // 每个MsgId的注册来源
+	errorHandlers map[uint32]PanicHandler // 每个MsgId单独设置的错误处理回调
 	sync.RWMutex
 }
 
 func NewRouterSlices() *RouterSlices {
 	return &RouterSlices{
-		Apis:     make(map[uint32][]RouterHandler, 10),
-		Handlers: make([]RouterHandler, 0, 6),
+		Apis:          make(map[uint32][]RouterHandler, 10),
+		Handlers:      make([]RouterHandler, 0, 6),
+		sources:       make(map[uint32]routeSource, 10),
+		errorHandlers: make(map[uint32]PanicHandler),
 	}
 }
 
+// Use 添加全局组件，只对之后注册的路由生效
 func (r *RouterSlices) Use(handles ...RouterHandler) {
+	r.Lock()
+	defer r.Unlock()
+
 	r.Handlers = append(r.Handlers, handles...)
 }
 
+// AddHandler 添加业务处理器集合，重复注册时panic
 func (r *RouterSlices) AddHandler(msgId uint32, Handlers ...RouterHandler) {
+	if err := r.addHandler(callerSource(globalGroupName), msgId, Handlers...); err != nil {
+		panic(err.Error())
+	}
+}
+
+// TryAddHandler 添加业务处理器集合，重复注册时返回错误而不是panic
+// 用于在服务启动时收集所有的路由冲突
+func (r *RouterSlices) TryAddHandler(msgId uint32, Handlers ...RouterHandler) error {
+	return r.addHandler(callerSource(globalGroupName), msgId, Handlers...)
+}
+
+func (r *RouterSlices) addHandler(src routeSource, msgId uint32, Handlers ...RouterHandler) error {
+	r.Lock()
+	defer r.Unlock()
+
 	if _, ok := r.Apis[msgId]; ok {
-		panic("repeated api , msgId = " + strconv.Itoa(int(msgId)))
+		return fmt.Errorf("%w, msgId = %s, registered by %s, already registered by %s",
+			ErrRepeatedRouter, msgIDString(msgId), src, r.sources[msgId])
 	}
 
 	finalSize := len(r.Handlers) + len(Handlers)
@@ -89,6 +171,26 @@ func (r *RouterSlices) AddHandler(msgId uint32, Handlers ...RouterHandler) {
 	copy(mergedHandlers, r.Handlers)
 	copy(mergedHandlers[len(r.Handlers):], Handlers)
 	r.Apis[msgId] = append(r.Apis[msgId], mergedHandlers...)
+	src.globals = len(r.Handlers)
+	r.sources[msgId] = src
+
+	return nil
+}
+
+// RemoveHandler 移除MsgId的处理器集合，移除后可以重新注册
+func (r *RouterSlices) RemoveHandler(msgId uint32) bool {
+	r.Lock()
+	defer r.Unlock()
+
+	if _, ok := r.Apis[msgId]; !ok {
+		return false
+	}
+
+	delete(r.Apis, msgId)
+	delete(r.sources, msgId)
+	delete(r.errorHandlers, msgId)
+
+	return true
 }
 
 func (r *RouterSlices) GetHandlers(MsgId uint32) ([]RouterHandler, bool) {
@@ -108,7 +210,9 @@ type GroupRouter struct {
 	start    uint32
 	end      uint32
 	handlers []RouterHandler
-	router   IRouterSlices
+	router   *RouterSlices
+	onError  PanicHandler // 分组的错误处理回调，为nil时使用全局的panic回调
+	lock     sync.RWMutex // 保护handlers和onError
 }
 
 func NewGroup(start, end uint32, router *RouterSlices, Handlers ...RouterHandler) *GroupRouter {
@@ -125,18 +229,42 @@ func NewGroup(start, end uint32, router *RouterSlices, Handlers ...RouterHandler
 }
 
 func (g *GroupRouter) Use(Handlers ...RouterHandler) {
+	g.lock.Lock()
+	defer g.lock.Unlock()
+
 	g.handlers = append(g.handlers, Handlers...)
 }
 
+// AddHandler 添加业务处理器集合，重复注册或超出分组范围时panic
 func (g *GroupRouter) AddHandler(MsgId uint32, Handlers ...RouterHandler) {
+	if err := g.addHandler(callerSource(g.name()), MsgId, Handlers...); err != nil {
+		panic(err.Error())
+	}
+}
+
+// TryAddHandler 添加业务处理器集合，重复注册或超出分组范围时返回错误而不是panic
+func (g *GroupRouter) TryAddHandler(MsgId uint32, Handlers ...RouterHandler) error {
+	return g.addHandler(callerSource(g.name()), MsgId, Handlers...)
+}
+
+func (g *GroupRouter) addHandler(src routeSource, MsgId uint32, Handlers ...RouterHandler) error {
 	if MsgId < g.start || MsgId > g.end {
-		panic("add s_router to group err in msgId:" + strconv.Itoa(int(MsgId)))
+		return fmt.Errorf("%w, add s_router to %s err in msgId:%s", ErrGroupRouterRange, g.name(), msgIDString(MsgId))
 	}
 
+	g.lock.RLock()
 	finalSize := len(g.handlers) + len(Handlers)
 	mergedHandlers := make([]RouterHandler, finalSize)
 	copy(mergedHandlers, g.handlers)
 	copy(mergedHandlers[len(g.handlers):], Handlers)
+	src.groupHandlers = len(g.handlers)
+	src.owner = g
+	g.lock.RUnlock()
+
+	return g.router.addHandler(src, MsgId, mergedHandlers...)
+}
 
-	g.router.AddHandler(MsgId, mergedHandlers...)
+// 分组名称，用于错误信息
+func (g *GroupRouter) name() string {
+	return fmt.Sprintf("group[%d-%d]", g.start, g.end)
 }
@@ -0,0 +1,43 @@
+/**
+* @File: router_adapter.go
+* @Author: Jason Woo
+* @Date: 2026/10/16 13:06
+**/
+
+package fastnet
+
+// 旧版路由(IRouter)与切片路由(RouterHandler)之间的适配，两种路由可以在同一个Server中共存，便于按消息逐个迁移:
+//
+//	RouterSlices模式下AddRouter注册的IRouter被适配为切片路由，Use添加的全局组件同样对其生效
+//	旧版路由模式下AddRouterSlices/Group/Use注册的切片路由照常生效，没有旧版路由的MsgID按切片路由处理
+
+// AdaptRouter 将旧版路由适配为切片路由的处理函数，依次执行PreHandle/Handle/PostHandle，Goto和Abort的行为不变
+func AdaptRouter(router IRouter) RouterHandler {
+	return func(request IRequest) {
+		request.BindRouter(router)
+		request.Call()
+	}
+}
+
+// AdaptRouterSlices 将切片路由的处理函数适配为旧版路由，在Handle中按顺序执行所有处理函数
+func AdaptRouterSlices(handlers ...RouterHandler) IRouter {
+	return &slicesRouter{handlers: handlers}
+}
+
+// 将旧版路由转换为切片路由的处理函数集合，由AdaptRouterSlices适配而来的路由直接还原为原来的处理函数
+func routerHandlers(router IRouter) []RouterHandler {
+	if sr, ok := router.(*slicesRouter); ok {
+		return sr.handlers
+	}
+	return []RouterHandler{AdaptRouter(router)}
+}
+
+type slicesRouter struct {
+	BaseRouter
+	handlers []RouterHandler
+}
+
+func (sr *slicesRouter) Handle(request IRequest) {
+	request.BindRouterSlices(sr.handlers)
+	request.RouterSlicesNext()
+}
@@ -0,0 +1,206 @@
+/**
+* @File: router_test.go
+* @Author: Jason Woo
+* @Date: 2026/10/16 15:30
+**/
+
+package fastnet
+
+import (
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestRouterSlicesTryAddHandler(t *testing.T) {
+	router := NewRouterSlices()
+	handler := func(request IRequest) {}
+
+	if err := router.TryAddHandler(1, handler); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	group := router.Group(1, 10)
+	err := group.TryAddHandler(1, handler)
+	if !errors.Is(err, ErrRepeatedRouter) {
+		t.Fatalf("expected ErrRepeatedRouter, got %v", err)
+	}
+	if !strings.Contains(err.Error(), "group[1-10]") || !strings.Contains(err.Error(), "global at") {
+		t.Fatalf("error should describe both registrations: %v", err)
+	}
+
+	if err = group.TryAddHandler(11, handler); !errors.Is(err, ErrGroupRouterRange) {
+		t.Fatalf("expected ErrGroupRouterRange, got %v", err)
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Fatal("AddHandler should panic on repeated msgId")
+		}
+	}()
+	router.AddHandler(1, handler)
+}
+
+func TestRouterSlicesConcurrentAddHandler(t *testing.T) {
+	router := NewRouterSlices()
+	group := router.Group(100, 199)
+
+	var wg sync.WaitGroup
+	for i := uint32(0); i < 50; i++ {
+		wg.Add(3)
+		go func(id uint32) {
+			defer wg.Done()
+			router.AddHandler(id, func(request IRequest) {})
+		}(i)
+		go func(id uint32) {
+			defer wg.Done()
+			group.Use(func(request IRequest) {})
+			group.AddHandler(100+id, func(request IRequest) {})
+		}(i)
+		go func(id uint32) {
+			defer wg.Done()
+			router.GetHandlers(id)
+		}(i)
+	}
+	wg.Wait()
+
+	for i := uint32(0); i < 50; i++ {
+		if _, ok := router.GetHandlers(i); !ok {
+			t.Fatalf("msgId %d is not registered", i)
+		}
+		if _, ok := router.GetHandlers(100 + i); !ok {
+			t.Fatalf("msgId %d is not registered", 100+i)
+		}
+	}
+}
+
+func TestRouterSlicesRemoveHandler(t *testing.T) {
+	router := NewRouterSlices()
+	router.AddHandler(1, func(request IRequest) {})
+
+	if !router.RemoveHandler(1) {
+		t.Fatal("remove registered msgId should return true")
+	}
+	if router.RemoveHandler(1) {
+		t.Fatal("remove unregistered msgId should return false")
+	}
+	if _, ok := router.GetHandlers(1); ok {
+		t.Fatal("msgId 1 should be removed")
+	}
+	if err := router.TryAddHandler(1, func(request IRequest) {}); err != nil {
+		t.Fatalf("re-register after remove: %v", err)
+	}
+}
+
+func TestRouterSlicesDynamicRegistration(t *testing.T) {
+	router := NewRouterSlices()
+
+	stop := make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for {
+			select {
+			case <-stop:
+				return
+			default:
+				if handlers, ok := router.GetHandlers(1); ok {
+					for _, h := range handlers {
+						h(nil)
+					}
+				}
+			}
+		}
+	}()
+
+	for i := 0; i < 100; i++ {
+		_ = router.TryAddHandler(1, func(request IRequest) {})
+		router.RemoveHandler(1)
+	}
+	close(stop)
+	wg.Wait()
+}
+
+func TestMixedRouters(t *testing.T) {
+	for _, slicesMode := range []bool{false, true} {
+		s := NewServer().(*Server)
+		mh := s.GetMsgHandler().(*MsgHandle)
+		s.routerSlicesMode, mh.routerSlicesMode = slicesMode, slicesMode
+
+		var got []string
+		s.Use(func(request IRequest) {
+			got = append(got, "use")
+			request.RouterSlicesNext()
+		})
+
+		var legacy []uint32
+		s.AddRouter(1, &recordRouter{handled: &legacy})
+		s.AddRouterSlices(2, func(request IRequest) {
+			got = append(got, "slices")
+		})
+		s.AddRouter(3, AdaptRouterSlices(func(request IRequest) {
+			got = append(got, "adapted")
+		}))
+
+		for _, msgID := range []uint32{1, 2, 3} {
+			mh.dispatch(newTestRequest(t, s, msgID), 0)
+		}
+
+		// RouterSlices模式下旧版路由被适配为切片路由，全局组件同样对其生效
+		want := "use,slices"
+		if slicesMode {
+			want = "use,use,slices,use,adapted"
+		} else {
+			want += ",adapted"
+		}
+		if len(legacy) != 1 || strings.Join(got, ",") != want {
+			t.Fatalf("slicesMode = %v: legacy = %v, handled = %v, want %s", slicesMode, legacy, got, want)
+		}
+	}
+}
+
+func TestDumpRoutes(t *testing.T) {
+	s := NewServer().(*Server)
+	mh := s.GetMsgHandler().(*MsgHandle)
+	s.routerSlicesMode, mh.routerSlicesMode = false, false
+
+	RegisterMsgName(12, "DumpLogin")
+	defer RegisterMsgName(12, "")
+
+	handler := func(request IRequest) {}
+	s.Use(handler, handler)
+	s.AddRouter(1, &BaseRouter{})
+	s.Group(10, 20, handler).AddHandler(12, handler)
+	s.AddRouterSlices(2, handler)
+	s.AddKeyRouter("chat/room1", handler)
+
+	routes := s.DumpRoutes()
+	if len(routes) != 4 {
+		t.Fatalf("got %d routes, want 4: %+v", len(routes), routes)
+	}
+
+	if r := routes[0]; r.MsgID != 1 || !r.Legacy || r.Handlers != 1 {
+		t.Fatalf("legacy route = %+v", r)
+	}
+	if r := routes[1]; r.MsgID != 2 || r.Legacy || r.Handlers != 3 || r.Middleware != 2 || r.Group != globalGroupName {
+		t.Fatalf("slices route = %+v", r)
+	}
+	r := routes[2]
+	if r.MsgID != 12 || r.Name != "DumpLogin" || r.Group != "group[10-20]" {
+		t.Fatalf("group route = %+v", r)
+	}
+	if r.Handlers != 4 || r.Middleware != 2 || r.GroupMiddleware != 1 {
+		t.Fatalf("group route handlers = %+v", r)
+	}
+	if r.Source == "" {
+		t.Fatal("group route source is empty")
+	}
+
+	// 自定义路由键的路由排在最后
+	r = routes[3]
+	if r.Key != "chat/room1" || r.MsgID != 0 || r.Handlers != 3 || r.Middleware != 2 || r.Source == "" {
+		t.Fatalf("key route = %+v", r)
+	}
+}
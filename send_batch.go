@@ -0,0 +1,72 @@
+/**
+* @File: send_batch.go
+* @Author: Jason Woo
+* @Date: 2026/10/16 17:05
+**/
+
+package fastnet
+
+import (
+	"fmt"
+	"net"
+)
+
+// OutMsg 批量发送时的一条待发送消息
+type OutMsg struct {
+	MsgID uint32 // 消息ID
+	Data  []byte // 消息内容
+}
+
+// BatchSendError 批量发送部分失败时返回的错误
+// Sent 为已经完整发送给对端的消息条数，msgs[Sent:]均未发送或只发送了一部分
+type BatchSendError struct {
+	Sent  int   // 已完整发送的消息条数
+	Total int   // 本次批量发送的消息总条数
+	Err   error // 导致发送中断的原始错误
+}
+
+func (e *BatchSendError) Error() string {
+	return fmt.Sprintf("send msg batch failed after %d/%d msgs: %v", e.Sent, e.Total, e.Err)
+}
+
+func (e *BatchSendError) Unwrap() error {
+	return e.Err
+}
+
+// packBatch 按顺序将msgs逐条封包，任意一条封包失败则整批都不发送
+func packBatch(packet IDataPack, msgs []OutMsg) ([][]byte, error) {
+	packed := make([][]byte, 0, len(msgs))
+	for _, m := range msgs {
+		data, err := packet.Pack(NewMsgPackage(m.MsgID, m.Data))
+		if err != nil {
+			return nil, &BatchSendError{Sent: 0, Total: len(msgs), Err: fmt.Errorf("pack msg ID = %s error: %w", msgIDString(m.MsgID), err)}
+		}
+		packed = append(packed, data)
+	}
+
+	return packed, nil
+}
+
+// writeBatch 通过一次net.Buffers写出全部已封包的消息，TCP链接下使用writev系统调用
+// 写出失败时根据已写出的字节数计算出完整发送的消息条数
+func writeBatch(conn net.Conn, packed [][]byte) (int64, error) {
+	buffers := make(net.Buffers, len(packed))
+	copy(buffers, packed)
+
+	n, err := buffers.WriteTo(conn)
+	if err == nil {
+		return n, nil
+	}
+
+	sent := 0
+	remain := n
+	for _, data := range packed {
+		if remain < int64(len(data)) {
+			break
+		}
+		remain -= int64(len(data))
+		sent++
+	}
+
+	return n, &BatchSendError{Sent: sent, Total: len(packed), Err: err}
+}
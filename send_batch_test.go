@@ -0,0 +1,185 @@
+/**
+* @File: send_batch_test.go
+* @Author: Jason Woo
+* @Date: 2026/10/16 17:20
+**/
+
+package fastnet
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net"
+	"sync"
+	"testing"
+	"time"
+)
+
+// 建立一对本地回环TCP链接，返回服务端的Connection和客户端的原始socket
+func newLoopbackConn(tb testing.TB) (*Connection, net.Conn) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		tb.Fatal(err)
+	}
+	defer func() { _ = ln.Close() }()
+
+	remote, err := net.Dial("tcp", ln.Addr().String())
+	if err != nil {
+		tb.Fatal(err)
+	}
+	local, err := ln.Accept()
+	if err != nil {
+		tb.Fatal(err)
+	}
+
+	s := NewServer().(*Server)
+	conn := newServerConn(s, local, 1).(*Connection)
+	tb.Cleanup(func() {
+		s.GetConnMgr().Remove(conn)
+		_ = local.Close()
+		_ = remote.Close()
+	})
+
+	return conn, remote
+}
+
+func TestSendMsgBatch(t *testing.T) {
+	conn, remote := newLoopbackConn(t)
+
+	msgs := []OutMsg{
+		{MsgID: 1, Data: []byte("a")},
+		{MsgID: 2, Data: []byte("bb")},
+		{MsgID: 3, Data: []byte("ccc")},
+	}
+	if err := conn.SendMsgBatch(msgs); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, want := range msgs {
+		head := make([]byte, conn.packet.GetHeadLen())
+		if _, err := io.ReadFull(remote, head); err != nil {
+			t.Fatal(err)
+		}
+		msg, err := conn.packet.Unpack(head)
+		if err != nil {
+			t.Fatal(err)
+		}
+		data := make([]byte, msg.GetDataLen())
+		if _, err = io.ReadFull(remote, data); err != nil {
+			t.Fatal(err)
+		}
+		if msg.GetMsgID() != want.MsgID || string(data) != string(want.Data) {
+			t.Fatalf("unexpected msg ID = %d, data = %s, want ID = %d, data = %s", msg.GetMsgID(), data, want.MsgID, want.Data)
+		}
+	}
+}
+
+func TestSendMsgBatchPartialFailure(t *testing.T) {
+	conn, remote := newLoopbackConn(t)
+	_ = conn.conn.Close()
+	_ = remote.Close()
+
+	err := conn.SendMsgBatch([]OutMsg{{MsgID: 1, Data: []byte("a")}, {MsgID: 2, Data: []byte("b")}})
+
+	var batchErr *BatchSendError
+	if !errors.As(err, &batchErr) {
+		t.Fatalf("expected *BatchSendError, got %v", err)
+	}
+	if batchErr.Sent != 0 || batchErr.Total != 2 {
+		t.Fatalf("unexpected batch error: %v", batchErr)
+	}
+}
+
+const benchBatchSize = 16
+
+func benchmarkSend(b *testing.B, send func(conn *Connection, msgs []OutMsg)) {
+	conn, remote := newLoopbackConn(b)
+	go func() { _, _ = io.Copy(io.Discard, remote) }()
+
+	msgs := make([]OutMsg, benchBatchSize)
+	for i := range msgs {
+		msgs[i] = OutMsg{MsgID: uint32(i), Data: make([]byte, 64)}
+	}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		send(conn, msgs)
+	}
+}
+
+func BenchmarkSendMsgSequential(b *testing.B) {
+	benchmarkSend(b, func(conn *Connection, msgs []OutMsg) {
+		for _, m := range msgs {
+			if err := conn.SendMsg(m.MsgID, m.Data); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
+
+func BenchmarkSendMsgBatch(b *testing.B) {
+	benchmarkSend(b, func(conn *Connection, msgs []OutMsg) {
+		if err := conn.SendMsgBatch(msgs); err != nil {
+			b.Fatal(err)
+		}
+	})
+}
+
+func TestConcurrentSendNoInterleave(t *testing.T) {
+	conn, remote := newLoopbackConn(t)
+	// 有缓冲发送的写协程随链接的ctx退出，这里不启动读协程，只创建ctx
+	conn.ctx, conn.cancel = context.WithCancel(context.Background())
+	defer conn.cancel()
+	// 消息丢失时读取超时失败，而不是一直阻塞
+	_ = remote.SetReadDeadline(time.Now().Add(10 * time.Second))
+
+	const senders, perSender = 32, 200
+	payload := func(id uint32) []byte {
+		return bytes.Repeat([]byte{byte(id)}, 64+int(id)*10)
+	}
+
+	// 所有协程同时开始发送
+	start := make(chan struct{})
+	var wg sync.WaitGroup
+	for i := uint32(0); i < senders; i++ {
+		wg.Add(1)
+		go func(id uint32) {
+			defer wg.Done()
+			<-start
+			for j := 0; j < perSender; j++ {
+				var err error
+				switch j % 4 {
+				case 0:
+					// 每个协程的第一条消息都是有缓冲发送，并发的首次发送只能创建一个有缓冲管道和写协程
+					err = conn.SendBuffMsgWithTimeout(id, payload(id), time.Second)
+				case 1:
+					err = conn.SendMsg(id, payload(id))
+				case 2:
+					err = conn.SendMsgBatch([]OutMsg{{MsgID: id, Data: payload(id)}})
+				default:
+					packed, _ := conn.packet.Pack(NewMsgPackage(id, payload(id)))
+					err = conn.Send(packed)
+				}
+				if err != nil {
+					t.Error(err)
+					return
+				}
+			}
+		}(i)
+	}
+	close(start)
+
+	// 读取全部消息，每条消息的内容必须与其MsgID对应
+	for n := 0; n < senders*perSender; n++ {
+		msg, err := readMsgFrom(remote, conn.packet)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(msg.GetData(), payload(msg.GetMsgID())) {
+			t.Fatalf("msg %d corrupted: msgID = %d, len = %d", n, msg.GetMsgID(), len(msg.GetData()))
+		}
+	}
+	wg.Wait()
+}
@@ -0,0 +1,94 @@
+/**
+* @File: send_rate.go
+* @Author: Jason Woo
+* @Date: 2026/10/16 12:04
+**/
+
+package fastnet
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// sendShaper 有缓冲发送的令牌桶限速，只在链接的写协程中等待，不会阻塞业务处理函数
+// 令牌按速率匀速补充，最多累积1秒的量，单条消息超过剩余令牌时先发送再等待补足欠下的令牌
+type sendShaper struct {
+	lock   sync.Mutex
+	rate   float64 // 每秒允许发送的字节数，为0时不限制
+	tokens float64
+	last   time.Time
+	clock  clock // 时间来源，为nil时使用systemClock
+
+	sampleLock  sync.Mutex
+	sampleTime  time.Time // 上一次统计发送速率的时间
+	sampleBytes uint64    // 上一次统计时累计写出的字节数
+	sampleRate  float64   // 上一次统计得到的发送速率
+}
+
+func (s *sendShaper) setRate(bytesPerSec int) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if bytesPerSec <= 0 {
+		s.rate = 0
+		return
+	}
+	s.rate = float64(bytesPerSec)
+	s.tokens = s.rate
+	s.last = clockOrSystem(s.clock).Now()
+}
+
+// wait 发送n字节之前调用，需要等待时阻塞当前协程，ctx结束时返回false
+func (s *sendShaper) wait(ctx context.Context, n int) bool {
+	s.lock.Lock()
+	if s.rate == 0 {
+		s.lock.Unlock()
+		return true
+	}
+
+	now := clockOrSystem(s.clock).Now()
+	s.tokens += now.Sub(s.last).Seconds() * s.rate
+	if s.tokens > s.rate {
+		s.tokens = s.rate
+	}
+	s.last = now
+	s.tokens -= float64(n)
+
+	var delay time.Duration
+	if s.tokens < 0 {
+		delay = time.Duration(-s.tokens / s.rate * float64(time.Second))
+	}
+	s.lock.Unlock()
+
+	if delay <= 0 {
+		return true
+	}
+
+	select {
+	case <-clockOrSystem(s.clock).After(delay):
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// currentRate 根据累计写出的字节数计算发送速率，距离上一次统计不足1秒时返回上一次的结果
+func (s *sendShaper) currentRate(written uint64) float64 {
+	s.sampleLock.Lock()
+	defer s.sampleLock.Unlock()
+
+	now := clockOrSystem(s.clock).Now()
+	if s.sampleTime.IsZero() {
+		s.sampleTime, s.sampleBytes = now, written
+		return 0
+	}
+
+	if elapsed := now.Sub(s.sampleTime); elapsed >= time.Second {
+		s.sampleRate = float64(written-s.sampleBytes) / elapsed.Seconds()
+		s.sampleTime, s.sampleBytes = now, written
+	}
+
+	return s.sampleRate
+}
@@ -0,0 +1,127 @@
+/**
+* @File: send_rate_test.go
+* @Author: Jason Woo
+* @Date: 2026/10/16 12:04
+**/
+
+package fastnet
+
+import (
+	"context"
+	"io"
+	"testing"
+	"time"
+)
+
+func TestSendShaperPacing(t *testing.T) {
+	var shaper sendShaper
+	shaper.setRate(10000)
+	ctx := context.Background()
+
+	// 初始可以突发1秒的量
+	start := time.Now()
+	if !shaper.wait(ctx, 10000) {
+		t.Fatal("wait should succeed")
+	}
+	if elapsed := time.Since(start); elapsed > 50*time.Millisecond {
+		t.Fatalf("burst wait = %v, want no delay", elapsed)
+	}
+
+	// 令牌用完后按速率等待
+	start = time.Now()
+	shaper.wait(ctx, 1000)
+	if elapsed := time.Since(start); elapsed < 80*time.Millisecond {
+		t.Fatalf("paced wait = %v, want about 100ms", elapsed)
+	}
+
+	// 等待期间链接关闭时立即返回
+	cancelCtx, cancel := context.WithCancel(ctx)
+	cancel()
+	if shaper.wait(cancelCtx, 100000) {
+		t.Fatal("wait should return false when ctx is done")
+	}
+
+	// 取消限速后不再等待
+	shaper.setRate(0)
+	start = time.Now()
+	shaper.wait(ctx, 1<<20)
+	if elapsed := time.Since(start); elapsed > 50*time.Millisecond {
+		t.Fatalf("unlimited wait = %v, want no delay", elapsed)
+	}
+}
+
+func TestConnSendRateLimit(t *testing.T) {
+	conn, remote := newLoopbackConn(t)
+	conn.ctx, conn.cancel = context.WithCancel(context.Background())
+	defer conn.cancel()
+	go func() { _, _ = io.Copy(io.Discard, remote) }()
+
+	// 每条消息带包头1KB，限速100KB/s时前100条可以突发，之后50条至少需要约0.5秒
+	conn.SetSendRateLimit(100 * 1024)
+	data := make([]byte, 1024-int(conn.packet.GetHeadLen()))
+	start := time.Now()
+	for i := 0; i < 150; i++ {
+		for conn.SendBuffMsg(1, data) != nil {
+			time.Sleep(time.Millisecond)
+		}
+	}
+	waitFor(t, func() bool { return conn.BytesWritten() == 150*1024 })
+
+	if elapsed := time.Since(start); elapsed < 400*time.Millisecond {
+		t.Fatalf("sent 150KB in %v with 100KB/s limit", elapsed)
+	}
+}
+
+func TestConnFlush(t *testing.T) {
+	conn, remote := newLoopbackConn(t)
+	conn.ctx, conn.cancel = context.WithCancel(context.Background())
+	go func() { _, _ = io.Copy(io.Discard, remote) }()
+
+	// 限速使写协程明显慢于入队，Flush返回时之前入队的消息必须全部写出
+	conn.SetSendRateLimit(100 * 1024)
+	data := make([]byte, 1024-int(conn.packet.GetHeadLen()))
+	for i := 0; i < 120; i++ {
+		for conn.SendBuffMsg(1, data) != nil {
+			time.Sleep(time.Millisecond)
+		}
+	}
+	if err := conn.Flush(); err != nil {
+		t.Fatalf("Flush error = %v", err)
+	}
+	if n := conn.BytesWritten(); n != 120*1024 {
+		t.Fatalf("BytesWritten after Flush = %d, want %d", n, 120*1024)
+	}
+
+	// 队列为空时立即返回
+	if err := conn.Flush(); err != nil {
+		t.Fatalf("Flush on empty queue error = %v", err)
+	}
+
+	// 链接关闭后返回错误
+	conn.cancel()
+	if err := conn.Flush(); err != ErrFlushConnClosed {
+		t.Fatalf("Flush after close error = %v, want ErrFlushConnClosed", err)
+	}
+}
+
+func TestFlushStateCancelledEnqueue(t *testing.T) {
+	var progress flushState
+	progress.enqueued()
+	progress.enqueued()
+	progress.done()
+
+	// 等待期间撤销尚未放入队列的消息，Flush不会一直等待一条不会写出的消息
+	waited := make(chan error, 1)
+	go func() { waited <- progress.wait(context.Background()) }()
+	time.Sleep(10 * time.Millisecond)
+	progress.cancelled()
+
+	select {
+	case err := <-waited:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Flush is not returned after the enqueue is cancelled")
+	}
+}
@@ -0,0 +1,169 @@
+/**
+* @File: send_stream.go
+* @Author: Jason Woo
+* @Date: 2026/10/16 13:36
+**/
+
+package fastnet
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"io"
+)
+
+// 流式发送大数据：SendStream从io.Reader中逐个分片读取数据，封包后直接写出，不需要把整个文件或大对象一次性加载到内存
+// 分片格式与分片传输(fragment.go)相同，接收方配置了足够大的MaxFragmentedSize时还原为一条msgID的消息交给路由
+//
+// 背压：整个发送过程持有链接的写锁，分片之间不会插入其他消息；对端读取慢、socket写缓冲区满时写出阻塞，
+// SendStream随之阻塞并暂停从r读取，内存占用始终只有一个分片；期间该链接的SendMsg、SendMsgBatch以及写协程的
+// 有缓冲发送都在等待写锁，有缓冲队列满后SendBuffMsg按原有的规则处理。大数据传输时建议为其单独建立链接
+// 链接关闭或读取r失败时停止发送，已经写出的分片在接收方因分片组不完整而超时丢弃，链接上的数据流仍然完整
+
+const defaultStreamChunkSize = 32 * 1024 // 没有配置FragmentSize时每个分片的数据长度
+
+var (
+	ErrInvalidStreamSize = errors.New("invalid stream size")                // 数据长度小于0
+	ErrStreamTooLarge    = errors.New("stream exceeds max fragment count")  // 按分片长度拆分后超过65535个分片
+	ErrStreamClosed      = errors.New("connection closed when send stream") // 发送过程中链接被关闭
+)
+
+// 流式发送时每个分片的数据长度，配置了FragmentSize时与SendMsg拆分的长度相同
+func (a *fragmentAssembler) streamChunkSize() int {
+	if size := int(a.conf().FragmentSize); size > 0 {
+		return size
+	}
+
+	size := defaultStreamChunkSize
+	if limit := int(a.conf().MaxPacketSize) - fragmentHeadLen; limit > 0 && size > limit {
+		size = limit
+	}
+	return size
+}
+
+// stream 从r中读取size字节，按分片逐个封包后交给write写出，所有分片复用同一个缓冲区
+// ctx被取消时在写出下一个分片之前返回ErrStreamClosed
+func (a *fragmentAssembler) stream(ctx context.Context, packet IDataPack, msgID uint32, r io.Reader, size int64, write func([]byte) error) error {
+	chunkSize := int64(a.streamChunkSize())
+	total := (size + chunkSize - 1) / chunkSize
+	if total > maxFragmentCount {
+		return ErrStreamTooLarge
+	}
+
+	frag := make([]byte, fragmentHeadLen+chunkSize)
+	binary.BigEndian.PutUint32(frag[0:], msgID)
+	binary.BigEndian.PutUint32(frag[4:], a.nextFragID())
+	binary.BigEndian.PutUint16(frag[10:], uint16(total))
+
+	for i, remain := int64(0), size; i < total; i++ {
+		if ctx != nil && ctx.Err() != nil {
+			return ErrStreamClosed
+		}
+
+		n := chunkSize
+		if remain < n {
+			n = remain
+		}
+		remain -= n
+
+		binary.BigEndian.PutUint16(frag[8:], uint16(i))
+		if err := readStreamChunk(r, frag[fragmentHeadLen:fragmentHeadLen+n]); err != nil {
+			return err
+		}
+
+		packed, err := packet.Pack(NewMsgPackage(FragmentMsgID, frag[:fragmentHeadLen+n]))
+		if err != nil {
+			return err
+		}
+		if err = write(packed); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// 从r中读满buf，数据不足时返回io.ErrUnexpectedEOF
+func readStreamChunk(r io.Reader, buf []byte) error {
+	_, err := io.ReadFull(r, buf)
+	if errors.Is(err, io.EOF) {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
+
+// 不超过一个分片的数据直接读出后通过SendMsg发送
+func readStreamData(r io.Reader, size int64) ([]byte, error) {
+	data := make([]byte, size)
+	if err := readStreamChunk(r, data); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+// SendStream 从r中读取size字节，分片流式发送，接收方还原为一条msgID的消息，数据不超过一个分片时与SendMsg相同
+// 发送期间持有写锁，对端读取慢时阻塞并暂停读取r；r中的数据不足size字节时返回io.ErrUnexpectedEOF
+func (c *Connection) SendStream(msgID uint32, r io.Reader, size int64) error {
+	if size < 0 {
+		return ErrInvalidStreamSize
+	}
+	if size <= int64(c.fragments.streamChunkSize()) {
+		data, err := readStreamData(r, size)
+		if err != nil {
+			return err
+		}
+		return c.SendMsg(msgID, data)
+	}
+
+	c.msgLock.RLock()
+	defer c.msgLock.RUnlock()
+	if c.isClosed == true {
+		return ErrStreamClosed
+	}
+
+	c.writeLock.Lock()
+	defer c.writeLock.Unlock()
+
+	return c.fragments.stream(c.ctx, c.packet, msgID, r, size, func(frame []byte) error {
+		n, err := c.conn.Write(frame)
+		c.addBytesWritten(n)
+		if err != nil {
+			c.closeOnWriteError(err)
+		}
+		return err
+	})
+}
+
+// SendStream 从r中读取size字节，分片流式发送，与tcp链接相同，分片使用默认的帧类型
+// JSON信封直通模式不支持分片，读出全部数据后通过SendMsg发送
+func (c *WsConnection) SendStream(msgID uint32, r io.Reader, size int64) error {
+	if size < 0 {
+		return ErrInvalidStreamSize
+	}
+	if _, ok := c.packet.(*JSONEnvelopePack); ok || size <= int64(c.fragments.streamChunkSize()) {
+		data, err := readStreamData(r, size)
+		if err != nil {
+			return err
+		}
+		return c.SendMsg(msgID, data)
+	}
+
+	c.msgLock.RLock()
+	defer c.msgLock.RUnlock()
+	if c.isClosed == true {
+		return ErrStreamClosed
+	}
+
+	c.writeLock.Lock()
+	defer c.writeLock.Unlock()
+
+	return c.fragments.stream(c.ctx, c.packet, msgID, r, size, func(frame []byte) error {
+		if err := c.conn.WriteMessage(c.wsMessageType(), frame); err != nil {
+			c.closeOnWriteError(err)
+			return err
+		}
+		c.addBytesWritten(len(frame))
+		return nil
+	})
+}
@@ -7,6 +7,7 @@
 package fastnet
 
 import (
+	"context"
 	"crypto/rand"
 	"crypto/tls"
 	"errors"
@@ -18,75 +19,161 @@ import (
 	"net/http"
 	"os"
 	"os/signal"
+	"strconv"
+	"sync"
 	"sync/atomic"
 	"syscall"
 	"time"
 )
 
+var (
+	ErrInvalidNetwork = errors.New("invalid listen network") // 监听的网络类型不是tcp/tcp4/tcp6
+	ErrNilMsgHandler  = errors.New("msg handler is nil")     // 通过WithMsgHandler或SetMsgHandler设置了nil的消息处理模块
+)
+
 // IServer Defines the server interface
 type IServer interface {
 	Start()                                                                // 启动服务器方法
 	Stop()                                                                 // 停止服务器方法
+	GracefulStop(ctx context.Context) error                                // 不再接受新链接，等待已有链接断开或ctx结束后停止服务器
+	SetOnDrainConn(func(IConnection))                                      // 设置GracefulStop开始时对每个已有链接调用的回调，用于通知客户端迁移到新实例
+	Health() HealthStatus                                                  // 获取服务器当前的健康状态
+	ListenErr() error                                                      // 获取tcp监听或加载证书失败的错误，没有失败时为nil
+	Context() context.Context                                              // 获取服务器的上下文，开始停止服务时被取消
+	Handoff(name string, args ...string) (*os.Process, error)              // 启动新进程并将tcp监听传递给它，用于不停机重启
 	Serve()                                                                // 开启业务服务方法
 	AddRouter(msgID uint32, router IRouter)                                // 路由功能：给当前服务注册一个路由业务方法，供客户端链接处理使用
 	AddRouterSlices(msgID uint32, router ...RouterHandler) IRouterSlices   // 新版路由方式
+	TryAddRouterSlices(msgID uint32, router ...RouterHandler) error        // 新版路由方式，重复注册时返回错误而不是panic
+	RemoveRouterSlices(msgID uint32) bool                                  // 移除新版路由，可在服务运行期间调用，用于插件热加载
 	Group(start, end uint32, Handlers ...RouterHandler) IGroupRouterSlices // 路由组管理
 	Use(Handlers ...RouterHandler) IRouterSlices                           // 公共组件管理
+	Stats() ServerStats                                                    // 获取Server运行状态的快照
 	GetConnMgr() IConnManager                                              // 得到链接管理
+	BroadcastWithDeadline(uint32, []byte, time.Duration) BroadcastResult   // 向所有链接广播消息，整个广播最多等待超时时间，跳过截止时间前无法放入发送队列的链接
+	BroadcastByTag(string, string, uint32, []byte) BroadcastResult         // 向带有标签key=value的链接广播消息
+	GetConfig() *xconf.Config                                              // 获取该Server独立的配置，运行中不应修改
+	SetHandshake(HandshakeFunc)                                            // 设置该Server的连接握手函数，在OnConnStart之前执行
+	GetHandshake() HandshakeFunc                                           // 得到该Server的连接握手函数
+	SetListenFunc(ListenFunc)                                              // 设置创建监听的方法，默认使用标准库
+	SetOnAcceptError(AcceptErrorFunc)                                      // 设置Accept出错时的回调，决定是否继续Accept
+	SetOnMaxConnReached(MaxConnFunc)                                       // 设置链接数达到MaxConn时的回调，用于告警和自动扩容
+	SetOnMaxConnRecovered(MaxConnFunc)                                     // 设置链接数从MaxConn恢复到有空闲时的回调
 	SetOnConnStart(func(IConnection))                                      // 设置该Server的连接创建时Hook函数
 	SetOnConnStop(func(IConnection))                                       // 设置该Server的连接断开时的Hook函数
 	GetOnConnStart() func(IConnection)                                     // 得到该Server的连接创建时Hook函数
 	GetOnConnStop() func(IConnection)                                      // 得到该Server的连接断开时的Hook函数
+	SetOnConnStopE(ConnStopReasonFunc)                                     // 设置该Server的连接断开时带关闭原因的Hook函数
+	GetOnConnStopE() ConnStopReasonFunc                                    // 得到该Server的连接断开时带关闭原因的Hook函数
+	SetOnDecodeError(DecodeErrorFunc)                                      // 设置解码失败(例如CRC校验失败)时的回调
+	GetOnDecodeError() DecodeErrorFunc                                     // 得到解码失败时的回调
+	SetOnFrameDropped(FrameDroppedFunc)                                    // 设置断粘包丢弃数据(例如超长帧)时的回调
+	GetOnFrameDropped() FrameDroppedFunc                                   // 得到断粘包丢弃数据时的回调
+	SetOnMessage(func(IRequest))                                           // 设置每条消息在路由之前都会调用的回调，回调中Abort可丢弃该消息
 	GetPacket() IDataPack                                                  // 获取Server绑定的数据协议封包方式
 	GetMsgHandler() IMsgHandle                                             // 获取Server绑定的消息处理模块
+	SetMsgHandler(IMsgHandle)                                              // 设置自定义的消息处理模块，需要在Start和注册路由之前调用
 	SetPacket(IDataPack)                                                   // 设置Server绑定的数据协议封包方式
 	StartHeartbeat(time.Duration)                                          // 启动心跳检测
 	StartHeartbeatWithOption(time.Duration, *HeartbeatOption)              // 启动心跳检测(自定义回调)
 	GetHeartbeat() IHeartbeatChecker                                       // 获取心跳检测器
+	SetPanicHandler(PanicHandler)                                          // 设置业务处理发生panic时的回调，默认只记录日志
+	SetHandlerTimeout(msgID uint32, d time.Duration)                       // 设置指定MsgID的处理超时时间，处理函数需要监听request.Context()
+	SetMsgPriority(msgID uint32, priority int)                             // 设置MsgID的优先级，积压时优先处理，需要在Start之前调用
+	SetRouteKeyFunc(f RouteKeyFunc)                                        // 设置自定义路由键的提取方法，需要在Start之前调用
+	AddKeyRouter(key RouteKey, handlers ...RouterHandler)                  // 按自定义路由键注册处理器集合，没有路由键的消息仍按MsgID路由
+	DumpRoutes() []RouteInfo                                               // 导出所有已注册的路由，用于核对路由是否齐全
 	GetLengthField() *LengthField                                          //
 	SetDecoder(IDecoder)                                                   //
+	GetDecoder() IDecoder                                                  // 获取断粘包解码器
+	SetWsPassthrough(IDataPack, IDecoder)                                  // 设置websocket链接独立的封包方式和解码器，tcp链接不受影响
+	GetWsPacket() IDataPack                                                // 获取websocket链接使用的封包方式
+	GetWsDecoder() IDecoder                                                // 获取websocket链接使用的解码器
 	AddInterceptor(IInterceptor)                                           //
 	SetWebsocketAuth(func(r *http.Request) error)                          // 添加websocket认证方法
+	SetWebsocketSubprotocolSelector(SubprotocolSelector)                   // 设置websocket子协议协商回调，返回""时拒绝升级
 	ServerName() string                                                    // 获取服务器名称
 }
 
 // Server 接口实现，定义一个Server服务类
 type Server struct {
-	name             string // 服务器的名称
-	ipVersion        string
+	bytes            byteCounter            // 所有链接的收发字节数，原子操作访问，需放在结构体开头
+	name             string                 // 服务器的名称
+	network          string                 // 监听的网络类型 tcp/tcp4/tcp6
 	ip               string                 // 服务绑定的IP地址
 	port             int                    // 服务绑定的端口
 	wsPort           int                    // 服务绑定的websocket 端口 (Websocket port the server is bound to)
 	msgHandler       IMsgHandle             // 当前Server的消息管理模块，用来绑定MsgID和对应的处理方法
 	routerSlicesMode bool                   // 路由模式
 	connMgr          IConnManager           // 当前Server的链接管理器
+	handshake        HandshakeFunc          // 该Server的连接握手函数
+	listenFunc       ListenFunc             // 创建监听的方法，为nil时使用标准库
+	onAcceptError    AcceptErrorFunc        // Accept出错时的回调，为nil时记录日志后退避重试
 	onConnStart      func(conn IConnection) // 该Server的连接创建时Hook函数
 	onConnStop       func(conn IConnection) // 该Server的连接断开时的Hook函数
+	onConnStopE      ConnStopReasonFunc     // 该Server的连接断开时带关闭原因的Hook函数
+	onDecodeError    DecodeErrorFunc        // 解码失败时的回调
+	onFrameDropped   FrameDroppedFunc       // 断粘包丢弃数据时的回调
+	onDrainConn      func(conn IConnection) // GracefulStop开始时对每个已有链接调用的回调
+	wsSubprotocol    SubprotocolSelector    // websocket子协议协商回调，为nil时接受客户端的首选子协议
 	packet           IDataPack              // 数据报文封包方式
-	exitChan         chan struct{}          // 异步捕获链接关闭状态
+	exitChan         chan struct{}          // 异步捕获链接关闭状态，Stop时关闭
+	stopOnce         sync.Once              // 保证exitChan只关闭一次
 	decoder          IDecoder               // 断粘包解码器
+	wsPacket         IDataPack              // websocket直通模式的封包方式，为nil时与tcp相同
+	wsDecoder        IDecoder               // websocket直通模式的解码器，为nil时与tcp相同
 	heartbeatChecker IHeartbeatChecker      // 心跳检测器
+	config           *xconf.Config          // 该Server独立的配置，创建时从全局配置或用户配置复制
 	upgrader         *websocket.Upgrader
+	upgradeSem       chan struct{} // 限制同时进行中的websocket升级请求数，为nil时不限制
+	upgradeRejected  atomic.Uint64 // 因升级请求过多被拒绝的次数
+	health           atomic.Int32  // 服务的生命周期状态(HealthStatus)，Degraded在Health中按队列积压计算
 	websocketAuth    func(r *http.Request) error
 	cID              uint64
+	acceptLock       sync.Mutex    // 保护connReserved，保证检查最大链接数和预留槽位的原子性
+	connReserved     int           // 已经预留但尚未加入链接管理的链接槽位数量
+	maxConnEvents    maxConnEvents // 链接数达到上限和恢复的事件通知
+
+	tcpListener  net.Listener // 正在使用的tcp监听(TLS包装之前)，用于Handoff和GracefulStop
+	listenErr    error        // tcp监听或加载证书失败的错误
+	listenerLock sync.Mutex   // 保护tcpListener和listenErr
+
+	ctx    context.Context    // 服务器的上下文，服务端链接和请求的上下文都派生自它，Stop时被取消
+	cancel context.CancelFunc // 取消服务器的上下文
 }
 
 // 根据config创建一个服务器句柄
-func newServerWithConfig(config *xconf.Config, ipVersion string, opts ...Option) IServer {
-	PrintLogo()
+// Server持有config的副本，创建之后修改config或全局配置不会影响该Server
+func newServerWithConfig(config *xconf.Config, opts ...Option) IServer {
+	xconf.EnsureLoaded()
+
+	conf := *config
+	config = &conf
+
+	if !config.HideLogo {
+		printLogo(config)
+	}
+
+	// 按配置创建解码器，配置不合法时在启动阶段直接报错
+	decoder, err := NewDecoderFromConfig(config)
+	if err != nil {
+		panic(err)
+	}
 
 	s := &Server{
 		name:             config.Name,
-		ipVersion:        ipVersion,
+		network:          config.Network,
 		ip:               config.Host,
 		port:             config.TCPPort,
 		wsPort:           config.WsPort,
-		msgHandler:       newMsgHandle(),
+		config:           config,
+		msgHandler:       newMsgHandleWithConfig(config),
 		routerSlicesMode: config.RouterSlicesMode,
 		connMgr:          newConnManager(),
 		exitChan:         nil,
-		packet:           Factory().NewPack(FastDataPack),
-		decoder:          NewTLVDecoder(), // 默认使用TLV的解码方式
+		packet:           newPacketForDecoder(decoder), // 与配置的解码器线上格式一致的封包方式
+		decoder:          decoder,                      // 按配置创建的解码器，默认使用TLV的解码方式
+		upgradeSem:       newHandlerSem(config.MaxConcurrentUpgrades),
 		upgrader: &websocket.Upgrader{
 			ReadBufferSize: int(config.IOReadBuffSize),
 			CheckOrigin: func(r *http.Request) bool {
@@ -95,10 +182,26 @@ func newServerWithConfig(config *xconf.Config, ipVersion string, opts ...Option)
 		},
 	}
 
+	s.ctx, s.cancel = context.WithCancel(context.Background())
+
 	for _, opt := range opts {
 		opt(s)
 	}
 
+	// 封包方式的MaxPacketSize等参数按该Server的配置生效
+	bindConfig(s.packet, config)
+	bindConfig(s.wsPacket, config)
+
+	if err = checkNetwork(s.network); err != nil {
+		panic(err)
+	}
+	if err = checkTCPConfig(config); err != nil {
+		panic(err)
+	}
+	if s.network == "" {
+		s.network = xconf.NetworkTCP
+	}
+
 	// 提示当前配置信息
 	//config.Show()
 
@@ -107,22 +210,23 @@ func newServerWithConfig(config *xconf.Config, ipVersion string, opts ...Option)
 
 // NewServer 创建一个服务器句柄
 func NewServer(opts ...Option) IServer {
-	return newServerWithConfig(xconf.GlobalObject, "tcp", opts...)
+	return newServerWithConfig(xconf.GlobalObject, opts...)
 }
 
 // NewUserConfServer 创建一个服务器句柄
+// 用户配置中非零值的参数覆盖全局配置，得到该Server独立的配置，不修改全局配置，多个Server之间互不影响
+// 日志是进程级的，config中的日志参数不会修改xlog，需要时使用xconf.UserConfToGlobal
 func NewUserConfServer(config *xconf.Config, opts ...Option) IServer {
-	// 刷新用户配置到全局配置变量
-	xconf.UserConfToGlobal(config)
-
-	s := newServerWithConfig(config, "tcp4", opts...)
+	s := newServerWithConfig(mergeUserConf(config), opts...)
 	return s
 }
 
 // NewDefaultRouterSlicesServer 创建一个默认自带一个Recover处理器的服务器句柄
 func NewDefaultRouterSlicesServer(opts ...Option) IServer {
-	xconf.GlobalObject.RouterSlicesMode = true
-	s := newServerWithConfig(xconf.GlobalObject, "tcp", opts...)
+	xconf.EnsureLoaded()
+	conf := *xconf.GlobalObject
+	conf.RouterSlicesMode = true
+	s := newServerWithConfig(&conf, opts...)
 	s.Use(RouterRecovery)
 	return s
 }
@@ -133,15 +237,34 @@ func NewUserConfDefaultRouterSlicesServer(config *xconf.Config, opts ...Option)
 		panic("routerSlicesMode is false")
 	}
 
-	// 刷新用户配置到全局配置变量
-	xconf.UserConfToGlobal(config)
-
-	s := newServerWithConfig(xconf.GlobalObject, "tcp4", opts...)
+	s := newServerWithConfig(mergeUserConf(config), opts...)
 	s.Use(RouterRecovery)
 	return s
 }
 
+// 检查监听的网络类型，空字符串视为tcp
+func checkNetwork(network string) error {
+	switch network {
+	case "", xconf.NetworkTCP, xconf.NetworkTCP4, xconf.NetworkTCP6:
+		return nil
+	default:
+		return fmt.Errorf("%w: %q, must be tcp/tcp4/tcp6", ErrInvalidNetwork, network)
+	}
+}
+
+// 在全局配置的基础上合并用户配置，不修改全局配置
+func mergeUserConf(config *xconf.Config) *xconf.Config {
+	xconf.EnsureLoaded()
+
+	conf := *xconf.GlobalObject
+	conf.Merge(config)
+
+	return &conf
+}
+
 func (s *Server) StartConn(conn IConnection) {
+	applyConnTCPOptions(conn, s.config)
+
 	if s.heartbeatChecker != nil {
 		heartBeatChecker := s.heartbeatChecker.Clone()
 
@@ -151,138 +274,249 @@ func (s *Server) StartConn(conn IConnection) {
 	conn.Start()
 }
 
+// ListenTcpConn 监听tcp端口并接受链接，直到Server停止
+// 监听失败(例如端口被占用、不支持ReusePort时的权限问题)或加载证书失败时记录日志后返回，不会导致进程崩溃，错误可以通过ListenErr获取
 func (s *Server) ListenTcpConn() {
-	addr, err := net.ResolveTCPAddr(s.ipVersion, fmt.Sprintf("%s:%d", s.ip, s.port))
+	address := s.tcpAddress()
+	listener, err := s.listenTCP(address)
 	if err != nil {
-		xlog.ErrorF("[start] resolve tcp addr err: %v\n", err)
+		xlog.ErrorF("[start] listen tcp %s err: %v", address, err)
+		s.setListenErr(err)
 		return
 	}
+	s.setTCPListener(listener)
 
-	var listener net.Listener
-	if xconf.GlobalObject.CertFile != "" && xconf.GlobalObject.PrivateKeyFile != "" {
-		crt, err := tls.LoadX509KeyPair(xconf.GlobalObject.CertFile, xconf.GlobalObject.PrivateKeyFile)
+	if s.config.CertFile != "" && s.config.PrivateKeyFile != "" {
+		crt, err := tls.LoadX509KeyPair(s.config.CertFile, s.config.PrivateKeyFile)
 		if err != nil {
-			panic(err)
+			xlog.ErrorF("[start] load tls certificate err: %v", err)
+			s.setListenErr(err)
+			s.closeTCPListener()
+			return
 		}
 
 		tlsConfig := &tls.Config{}
 		tlsConfig.Certificates = []tls.Certificate{crt}
 		tlsConfig.Time = time.Now
 		tlsConfig.Rand = rand.Reader
-		listener, err = tls.Listen(s.ipVersion, fmt.Sprintf("%s:%d", s.ip, s.port), tlsConfig)
-		if err != nil {
-			panic(err)
-		}
-	} else {
-		listener, err = net.ListenTCP(s.ipVersion, addr)
-		if err != nil {
-			panic(err)
-		}
+		listener = tls.NewListener(listener, tlsConfig)
 	}
 
-	go func() {
-		for {
-			// 设置服务器最大连接控制,如果超过最大连接，则等待
-			if s.connMgr.Len() >= xconf.GlobalObject.MaxConn {
-				xlog.InfoF("exceeded the maxConnNum:%d, wait:%d", xconf.GlobalObject.MaxConn, AcceptDelay.duration)
-				AcceptDelay.Delay()
-				continue
-			}
-			// 阻塞等待客户端建立连接请求
-			conn, err := listener.Accept()
-			if err != nil {
-				if errors.Is(err, net.ErrClosed) {
-					xlog.ErrorF("listener closed")
-					return
-				}
-				xlog.ErrorF("accept err: %v", err)
-				AcceptDelay.Delay()
-				continue
-			}
+	// 多个协程同时在同一个listener上Accept，提高大量链接同时建立时的接入速度
+	concurrency := s.config.AcceptConcurrency
+	if concurrency <= 0 {
+		concurrency = 1
+	}
+	for i := 0; i < concurrency; i++ {
+		go s.acceptLoop(listener)
+	}
 
-			AcceptDelay.Reset()
+	select {
+	case <-s.exitChan:
+		s.closeTCPListener()
+	}
+}
 
-			// 处理该新连接请求的 业务 方法， 此时应该有 handler 和 conn是绑定的
-			newCid := atomic.AddUint64(&s.cID, 1)
-			dealConn := newServerConn(s, conn, newCid)
+// ListenErr 获取ListenTcpConn监听或加载证书失败的错误，没有失败或还没有开始监听时为nil
+func (s *Server) ListenErr() error {
+	s.listenerLock.Lock()
+	defer s.listenerLock.Unlock()
 
-			go s.StartConn(dealConn)
+	return s.listenErr
+}
 
-		}
-	}()
+// listenTCP 创建tcp监听，设置了ListenFunc时由ListenFunc创建
+// 开启ReusePort时设置SO_REUSEPORT，多个进程可以监听同一个端口，由内核把新链接分配给各个进程
+func (s *Server) listenTCP(address string) (net.Listener, error) {
+	if s.listenFunc != nil {
+		return s.listenFunc(s.network, address)
+	}
 
-	select {
-	case <-s.exitChan:
-		err := listener.Close()
-		if err != nil {
-			xlog.ErrorF("listener close err: %v", err)
-		}
+	// 父进程通过Handoff传递了该地址的监听时直接使用，实现不停机重启
+	if ln, err := InheritedListener(address); ln != nil || err != nil {
+		return ln, err
+	}
+
+	if !s.config.ReusePort {
+		return net.Listen(s.network, address)
+	}
+
+	if !reusePortSupported {
+		xlog.WarnF("SO_REUSEPORT is not supported on this platform, listen without it")
+		return net.Listen(s.network, address)
 	}
+
+	lc := net.ListenConfig{Control: reusePortControl}
+	return lc.Listen(context.Background(), s.network, address)
 }
 
-func (s *Server) ListenWebsocketConn() {
-	http.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
-		// 设置服务器最大连接控制,如果超过最大连接，则等待
-		if s.connMgr.Len() >= xconf.GlobalObject.MaxConn {
-			xlog.InfoF("exceeded the maxConnNum:%d, wait:%d", xconf.GlobalObject.MaxConn, AcceptDelay.duration)
+// acceptLoop 循环接受新的tcp链接，可以有多个acceptLoop同时运行
+func (s *Server) acceptLoop(listener net.Listener) {
+	for {
+		// 设置服务器最大连接控制,如果超过最大连接，则等待，预留槽位之后再Accept
+		if !s.reserveConnSlot() {
+			// 链接已满时不会调用Accept，需要单独检查服务器是否已经停止
+			select {
+			case <-s.exitChan:
+				return
+			default:
+			}
+			xlog.InfoF("exceeded the maxConnNum:%d, wait:%d", s.config.MaxConn, AcceptDelay.Duration())
 			AcceptDelay.Delay()
-			return
+			continue
 		}
-
-		// 如果需要 websocket 认证请设置认证信息
-		if s.websocketAuth != nil {
-			err := s.websocketAuth(r)
-			if err != nil {
-				xlog.ErrorF(" websocket auth err:%v", err)
-				w.WriteHeader(401)
-				AcceptDelay.Delay()
+		// 阻塞等待客户端建立连接请求
+		conn, err := listener.Accept()
+		if err != nil {
+			s.releaseConnSlot()
+			if errors.Is(err, net.ErrClosed) {
+				xlog.ErrorF("listener closed")
+				return
+			}
+			if IsTooManyOpenFiles(err) {
+				xlog.ErrorF("accept err: %v, file descriptors exhausted, check ulimit -n or MaxConn", err)
+			} else {
+				xlog.ErrorF("accept err: %v", err)
+			}
+			if s.onAcceptError != nil && !s.onAcceptError(err) {
+				xlog.ErrorF("stop accepting on %s", listener.Addr())
 				return
 			}
+			AcceptDelay.Delay()
+			continue
 		}
 
-		// 判断 header 里面是有子协议
-		if len(r.Header.Get("Sec-Websocket-Protocol")) > 0 {
-			s.upgrader.Subprotocols = websocket.Subprotocols(r)
-		}
+		AcceptDelay.Reset()
 
-		// 升级成 websocket 连接
-		conn, err := s.upgrader.Upgrade(w, r, nil)
-		if err != nil {
-			xlog.ErrorF("new websocket err:%v", err)
-			w.WriteHeader(500)
-			AcceptDelay.Delay()
-			return
+		// 优雅停止期间不再接受新链接
+		if s.isDraining() {
+			s.releaseConnSlot()
+			_ = conn.Close()
+			continue
 		}
-		AcceptDelay.Reset()
 
 		// 处理该新连接请求的 业务 方法， 此时应该有 handler 和 conn是绑定的
 		newCid := atomic.AddUint64(&s.cID, 1)
-		wsConn := newWebsocketConn(s, conn, newCid)
+		dealConn := newServerConn(s, conn, newCid)
+		// 链接已经加入链接管理，由链接管理计数
+		s.releaseConnSlot()
 
-		go s.StartConn(wsConn)
-	})
+		go s.StartConn(dealConn)
+	}
+}
+
+func (s *Server) ListenWebsocketConn() {
+	http.HandleFunc("/", s.serveWebsocket)
+
+	address := net.JoinHostPort(s.ip, strconv.Itoa(s.wsPort))
+	listen := net.Listen
+	if s.listenFunc != nil {
+		listen = s.listenFunc
+	}
 
-	err := http.ListenAndServe(fmt.Sprintf("%s:%d", s.ip, s.wsPort), nil)
+	listener, err := listen(s.network, address)
 	if err != nil {
 		panic(err)
 	}
+	if err = http.Serve(listener, nil); err != nil {
+		panic(err)
+	}
+}
+
+// 处理websocket升级请求
+func (s *Server) serveWebsocket(w http.ResponseWriter, r *http.Request) {
+	// 优雅停止期间拒绝新的升级请求，负载均衡会将客户端重试到其他实例
+	if s.isDraining() {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		return
+	}
+
+	// 设置服务器最大连接控制,如果超过最大连接，则等待，升级完成并加入链接管理或升级失败后释放预留的槽位
+	if !s.reserveConnSlot() {
+		xlog.InfoF("exceeded the maxConnNum:%d, wait:%d", s.config.MaxConn, AcceptDelay.Duration())
+		AcceptDelay.Delay()
+		return
+	}
+	defer s.releaseConnSlot()
+
+	// 限制同时进行中的升级请求数，认证和握手完成后释放，超过时直接返回503
+	if s.upgradeSem != nil {
+		select {
+		case s.upgradeSem <- struct{}{}:
+			defer func() { <-s.upgradeSem }()
+		default:
+			s.upgradeRejected.Add(1)
+			xlog.ErrorF("exceeded the maxConcurrentUpgrades:%d, reject websocket upgrade from %s", cap(s.upgradeSem), r.RemoteAddr)
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+	}
+
+	// 如果需要 websocket 认证请设置认证信息
+	if s.websocketAuth != nil {
+		err := s.websocketAuth(r)
+		if err != nil {
+			xlog.ErrorF(" websocket auth err:%v", err)
+			w.WriteHeader(401)
+			AcceptDelay.Delay()
+			return
+		}
+	}
+
+	// 协商子协议，不修改共享的upgrader，避免并发升级时相互影响
+	protocol, ok := s.negotiateSubprotocol(r)
+	if !ok {
+		xlog.ErrorF("websocket subprotocol rejected, offered:%v", websocket.Subprotocols(r))
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	var responseHeader http.Header
+	if protocol != "" {
+		responseHeader = http.Header{"Sec-Websocket-Protocol": []string{protocol}}
+	}
+
+	// 升级成 websocket 连接
+	conn, err := s.upgrader.Upgrade(w, r, responseHeader)
+	if err != nil {
+		xlog.ErrorF("new websocket err:%v", err)
+		w.WriteHeader(500)
+		AcceptDelay.Delay()
+		return
+	}
+	AcceptDelay.Reset()
+
+	// 处理该新连接请求的 业务 方法， 此时应该有 handler 和 conn是绑定的
+	newCid := atomic.AddUint64(&s.cID, 1)
+	wsConn := newWebsocketConn(s, conn, newCid, newHTTPRequestInfo(r))
+
+	go s.StartConn(wsConn)
 }
 
 // Start 开启网络服务
 func (s *Server) Start() {
+	if s.msgHandler == nil {
+		panic(ErrNilMsgHandler)
+	}
+
 	xlog.InfoF("[start] server name: %s,listener at ip: %s, port %d is starting", s.name, s.ip, s.port)
 	s.exitChan = make(chan struct{})
 
-	// 将解码器添加到拦截器
-	if s.decoder != nil {
+	// 将解码器添加到拦截器，开启websocket直通模式时按链接类型选择解码器
+	if s.wsDecoder != nil {
+		s.msgHandler.AddInterceptor(&wsPassthroughDecoder{tcp: s.decoder, ws: s.wsDecoder})
+	} else if s.decoder != nil {
 		s.msgHandler.AddInterceptor(s.decoder)
 	}
 
 	// 启动worker工作池机制
 	s.msgHandler.StartWorkerPool()
+	s.health.Store(int32(HealthReady))
+
+	// 配置了链接的最长存活时间时，定期关闭超时的链接
+	s.startLifetimeReaper()
 
 	// 开启一个go去做服务端Listener业务
-	switch xconf.GlobalObject.Mode {
+	switch s.config.Mode {
 	case xconf.ServerModeTcp:
 		go s.ListenTcpConn()
 	case xconf.ServerModeWebsocket:
@@ -299,8 +533,25 @@ func (s *Server) Stop() {
 
 	// 将其他需要清理的连接信息或者其他信息 也要一并停止或者清理
 	s.connMgr.ClearConn()
-	s.exitChan <- struct{}{}
-	close(s.exitChan)
+	// 链接已经以ServerShutdown的原因关闭，再取消服务器的上下文，仍在执行的处理函数通过ctx.Done()得知服务正在停止
+	s.cancel()
+	// 通过关闭通知tcp监听和acceptLoop退出，监听失败或websocket模式下没有协程等待exitChan时也不会阻塞
+	s.stopOnce.Do(func() {
+		close(s.exitChan)
+	})
+
+	// 等待worker处理完队列中已有的消息后退出
+	s.msgHandler.StopWorkerPool()
+	s.health.Store(int32(HealthStopped))
+
+	// 保证异步日志全部写出
+	xlog.Flush()
+}
+
+// Context 获取服务器的上下文，Stop(包括GracefulStop等待超时后)开始停止服务时被取消
+// 服务端链接和请求的上下文都派生自它，业务自行启动的协程也可以监听它随服务器一同退出
+func (s *Server) Context() context.Context {
+	return s.ctx
 }
 
 // Serve 运行服务
@@ -314,38 +565,97 @@ func (s *Server) Serve() {
 	xlog.InfoF("[serve] fastnet2 server, name %s, serve interrupt, signal = %v", s.name, sig)
 }
 
+// AddRouter 注册旧版路由，RouterSlices模式下通过AdaptRouter适配为切片路由
 func (s *Server) AddRouter(msgID uint32, router IRouter) {
-	if s.routerSlicesMode {
-		panic("server routerSlicesMode is true ")
-	}
 	s.msgHandler.AddRouter(msgID, router)
 }
 
+// AddRouterSlices 注册切片路由，旧版路由模式下同样生效，可以与旧版路由共存
 func (s *Server) AddRouterSlices(msgID uint32, router ...RouterHandler) IRouterSlices {
-	if !s.routerSlicesMode {
-		panic("server routerSlicesMode is false ")
-	}
 	return s.msgHandler.AddRouterSlices(msgID, router...)
 }
 
+func (s *Server) TryAddRouterSlices(msgID uint32, router ...RouterHandler) error {
+	return s.msgHandler.TryAddRouterSlices(msgID, router...)
+}
+
+// RemoveRouterSlices 移除新版路由，可在服务运行期间与消息处理并发调用
+// 已经开始处理的请求不受影响，移除后新到达的请求将找不到路由
+func (s *Server) RemoveRouterSlices(msgID uint32) bool {
+	return s.msgHandler.RemoveRouterSlices(msgID)
+}
+
 func (s *Server) Group(start, end uint32, Handlers ...RouterHandler) IGroupRouterSlices {
-	if !s.routerSlicesMode {
-		panic("server routerSlicesMode is false")
-	}
 	return s.msgHandler.Group(start, end, Handlers...)
 }
 
+// Use 添加切片路由的全局组件，只对之后注册的切片路由(包括RouterSlices模式下适配的旧版路由)生效
 func (s *Server) Use(Handlers ...RouterHandler) IRouterSlices {
-	if !s.routerSlicesMode {
-		panic("server routerSlicesMode is false")
-	}
 	return s.msgHandler.Use(Handlers...)
 }
 
+// SetRouteKeyFunc 设置自定义路由键的提取方法，提取到路由键的消息交给AddKeyRouter注册的处理器
+// 返回""的消息仍按MsgID路由，与原有的路由方式可以同时使用
+func (s *Server) SetRouteKeyFunc(f RouteKeyFunc) {
+	s.msgHandler.SetRouteKeyFunc(f)
+}
+
+// AddKeyRouter 按自定义路由键注册处理器集合，SetRouteKeyFunc提取到该路由键的消息交给这些处理器，
+// Use添加的全局组件同样生效，key为空或重复注册时panic
+func (s *Server) AddKeyRouter(key RouteKey, handlers ...RouterHandler) {
+	s.msgHandler.AddKeyRouter(key, handlers...)
+}
+
+// DumpRoutes 导出所有已注册的路由，包括旧版路由、切片路由和自定义路由键的路由，按MsgID排序
+func (s *Server) DumpRoutes() []RouteInfo {
+	return s.msgHandler.DumpRoutes()
+}
+
+// Stats 获取Server运行状态的快照
+func (s *Server) Stats() ServerStats {
+	return ServerStats{
+		ConnCount:    s.connMgr.Len(),
+		BytesRead:    s.bytes.loadRead(),
+		BytesWritten: s.bytes.loadWritten(),
+		MsgLatency:   s.msgHandler.MsgLatency(),
+
+		UpgradesRejected: s.upgradeRejected.Load(),
+
+		Workers: s.msgHandler.WorkerUtilization(),
+	}
+}
+
+func (s *Server) totalBytes() *byteCounter {
+	return &s.bytes
+}
+
+func (s *Server) GetConfig() *xconf.Config {
+	return s.config
+}
+
 func (s *Server) GetConnMgr() IConnManager {
 	return s.connMgr
 }
 
+func (s *Server) SetHandshake(handshake HandshakeFunc) {
+	s.handshake = handshake
+}
+
+func (s *Server) GetHandshake() HandshakeFunc {
+	return s.handshake
+}
+
+// SetListenFunc 设置创建监听的方法，需要在Start之前调用，设置后ReusePort不再生效
+func (s *Server) SetListenFunc(listenFunc ListenFunc) {
+	s.listenFunc = listenFunc
+}
+
+// SetOnAcceptError 设置Accept出错时的回调，需要在Start之前调用，默认记录日志后退避重试
+// 开启了多个acceptLoop时每个acceptLoop出错都会调用，返回false只停止出错的acceptLoop
+func (s *Server) SetOnAcceptError(hookFunc AcceptErrorFunc) {
+	s.onAcceptError = hookFunc
+}
+
 func (s *Server) SetOnConnStart(hookFunc func(IConnection)) {
 	s.onConnStart = hookFunc
 }
@@ -362,11 +672,45 @@ func (s *Server) GetOnConnStop() func(IConnection) {
 	return s.onConnStop
 }
 
+// SetOnConnStopE 设置连接断开时带关闭原因的Hook函数，与SetOnConnStop设置的Hook函数同时生效
+func (s *Server) SetOnConnStopE(hookFunc ConnStopReasonFunc) {
+	s.onConnStopE = hookFunc
+}
+
+func (s *Server) GetOnConnStopE() ConnStopReasonFunc {
+	return s.onConnStopE
+}
+
+// SetOnDecodeError 设置解码失败时的回调，默认为nil，可用于回复NACK或告警
+func (s *Server) SetOnDecodeError(hookFunc DecodeErrorFunc) {
+	s.onDecodeError = hookFunc
+}
+
+func (s *Server) GetOnDecodeError() DecodeErrorFunc {
+	return s.onDecodeError
+}
+
+// SetOnFrameDropped 设置断粘包丢弃数据时的回调，默认为nil
+func (s *Server) SetOnFrameDropped(hookFunc FrameDroppedFunc) {
+	s.onFrameDropped = hookFunc
+}
+
+func (s *Server) GetOnFrameDropped() FrameDroppedFunc {
+	return s.onFrameDropped
+}
+
+// SetOnMessage 设置每条消息在路由之前都会调用的回调，默认为nil，需要在Start之前调用
+// 与Use不同，不要求RouterSlices模式，回调中调用request.Abort()可丢弃该消息
+func (s *Server) SetOnMessage(hookFunc func(IRequest)) {
+	s.msgHandler.SetOnMessage(hookFunc)
+}
+
 func (s *Server) GetPacket() IDataPack {
 	return s.packet
 }
 
 func (s *Server) SetPacket(packet IDataPack) {
+	bindConfig(packet, s.config)
 	s.packet = packet
 }
 
@@ -374,38 +718,38 @@ func (s *Server) GetMsgHandler() IMsgHandle {
 	return s.msgHandler
 }
 
+// SetMsgHandler 设置自定义的消息处理模块，例如将消息转发到消息总线或跨进程分片处理，链接的接入和读写仍由Server负责
+// 需要在Start和注册路由之前调用，之前注册的路由和设置不会转移到新的消息处理模块
+func (s *Server) SetMsgHandler(handler IMsgHandle) {
+	s.msgHandler = handler
+}
+
+// SetPanicHandler 设置业务处理发生panic时的回调，可用于给客户端回复错误、统计指标或上报错误追踪系统
+func (s *Server) SetPanicHandler(handler PanicHandler) {
+	s.msgHandler.SetPanicHandler(handler)
+}
+
+// SetHandlerTimeout 设置指定MsgID的处理超时时间，默认的超时时间通过配置HandlerTimeout设置
+func (s *Server) SetHandlerTimeout(msgID uint32, d time.Duration) {
+	s.msgHandler.SetHandlerTimeout(msgID, d)
+}
+
+// SetMsgPriority 设置MsgID的优先级，数值越大越先处理，默认优先级为0
+// 适用于暂停、断开、认证等控制消息，避免排在大量数据消息之后
+func (s *Server) SetMsgPriority(msgID uint32, priority int) {
+	s.msgHandler.SetMsgPriority(msgID, priority)
+}
+
 // StartHeartbeat 启动心跳检测
 // interval 每次发送心跳的时间间隔
 func (s *Server) StartHeartbeat(interval time.Duration) {
-	checker := NewHeartbeatChecker(interval)
-
-	// 添加心跳检测的路由
-	// 检测当前路由模式
-	if s.routerSlicesMode {
-		s.AddRouterSlices(checker.MsgID(), checker.RouterSlices()...)
-	} else {
-		s.AddRouter(checker.MsgID(), checker.Router())
-	}
-
-	// server绑定心跳检测器
-	s.heartbeatChecker = checker
+	s.StartHeartbeatWithOption(interval, nil)
 }
 
 // StartHeartbeatWithOption 启动心跳检测
 // option 心跳检测的配置
 func (s *Server) StartHeartbeatWithOption(interval time.Duration, option *HeartbeatOption) {
-	checker := NewHeartbeatChecker(interval)
-
-	if option != nil {
-		checker.SetHeartbeatMsgFunc(option.MakeMsg)
-		checker.SetOnRemoteNotAlive(option.OnRemoteNotAlive)
-		// 检测当前路由模式
-		if s.routerSlicesMode {
-			checker.BindRouterSlices(option.HeartbeatMsgID, option.RouterSlices...)
-		} else {
-			checker.BindRouter(option.HeartbeatMsgID, option.Router)
-		}
-	}
+	checker := newHeartbeatCheckerWithOption(interval, option, s.routerSlicesMode, s.config.HeartbeatJitter)
 
 	// 添加心跳检测的路由
 	// 检测当前路由模式
@@ -423,10 +767,39 @@ func (s *Server) GetHeartbeat() IHeartbeatChecker {
 	return s.heartbeatChecker
 }
 
+// SetDecoder 设置断粘包解码器，需要在Start之前调用
+// 设置为nil时不使用解码器：Start不添加解码拦截器，链接不做断粘包，GetLengthField返回nil，
+// 每次从链接读取到的数据原样作为MsgID为0的消息交给之后的拦截器，由自定义的拦截器或路由处理分帧
 func (s *Server) SetDecoder(decoder IDecoder) {
 	s.decoder = decoder
 }
 
+func (s *Server) GetDecoder() IDecoder {
+	return s.decoder
+}
+
+// SetWsPassthrough 为websocket链接设置独立的封包方式和解码器，需要在Start之前调用
+// 例如 s.SetWsPassthrough(NewJSONEnvelopePack(), NewJSONEnvelopeDecoder())
+func (s *Server) SetWsPassthrough(packet IDataPack, decoder IDecoder) {
+	bindConfig(packet, s.config)
+	s.wsPacket = packet
+	s.wsDecoder = decoder
+}
+
+func (s *Server) GetWsPacket() IDataPack {
+	if s.wsPacket != nil {
+		return s.wsPacket
+	}
+	return s.packet
+}
+
+func (s *Server) GetWsDecoder() IDecoder {
+	if s.wsDecoder != nil {
+		return s.wsDecoder
+	}
+	return s.decoder
+}
+
 func (s *Server) GetLengthField() *LengthField {
 	if s.decoder != nil {
 		return s.decoder.GetLengthField()
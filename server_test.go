@@ -0,0 +1,584 @@
+/**
+* @File: server_test.go
+* @Author: Jason Woo
+* @Date: 2026/10/16 11:48
+**/
+
+package fastnet
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"github.com/dyowoo/fastnet/xconf"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"runtime"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestServerStartStopNoGoroutineLeak(t *testing.T) {
+	startStop := func() {
+		ln := newPipeListener()
+		s := NewServer(WithListenFunc(func(_, _ string) (net.Listener, error) {
+			return ln, nil
+		}))
+		s.Start()
+		s.Stop()
+	}
+
+	// 先完成一次启动和停止，排除只初始化一次的全局协程
+	startStop()
+	before := runtime.NumGoroutine()
+
+	for i := 0; i < 5; i++ {
+		startStop()
+	}
+
+	waitFor(t, func() bool {
+		return runtime.NumGoroutine() <= before
+	})
+}
+
+// 创建服务器时logo和版本信息通过日志输出，不会写入标准输出
+func TestNewServerDoesNotWriteStdout(t *testing.T) {
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stdout := os.Stdout
+	os.Stdout = w
+	defer func() { os.Stdout = stdout }()
+
+	NewServer()
+	xconf.GlobalObject.Show()
+	_ = w.Close()
+
+	out, _ := io.ReadAll(r)
+	if len(out) != 0 {
+		t.Fatalf("unexpected stdout output: %q", out)
+	}
+}
+
+func TestStartupDiagnosticsToWriter(t *testing.T) {
+	var b bytes.Buffer
+	FprintLogo(&b)
+	xconf.GlobalObject.ShowTo(&b)
+
+	out := b.String()
+	if !strings.Contains(out, "[FastNet] Version: "+xconf.GlobalObject.Version) {
+		t.Fatalf("version banner is missing: %q", out)
+	}
+	if !strings.Contains(out, "MaxConn: ") || !strings.Contains(out, "HideLogo: ") {
+		t.Fatalf("config fields are missing: %q", out)
+	}
+}
+
+func TestUserConfServersDoNotShareConfig(t *testing.T) {
+	oldMaxConn := xconf.GlobalObject.MaxConn
+
+	s1 := NewUserConfServer(&xconf.Config{MaxConn: 1, WorkerPoolSize: 2, HideLogo: true}).(*Server)
+	s2 := NewUserConfServer(&xconf.Config{MaxConn: 3, WorkerPoolSize: 4, HideLogo: true}).(*Server)
+
+	if xconf.GlobalObject.MaxConn != oldMaxConn {
+		t.Fatalf("global MaxConn changed to %d", xconf.GlobalObject.MaxConn)
+	}
+	if s1.GetConfig().MaxConn != 1 || s2.GetConfig().MaxConn != 3 {
+		t.Fatalf("MaxConn = %d, %d, want 1, 3", s1.GetConfig().MaxConn, s2.GetConfig().MaxConn)
+	}
+	if n := s1.msgHandler.(*MsgHandle).workerPoolSize; n != 2 {
+		t.Fatalf("s1 workerPoolSize = %d, want 2", n)
+	}
+	if n := s2.msgHandler.(*MsgHandle).workerPoolSize; n != 4 {
+		t.Fatalf("s2 workerPoolSize = %d, want 4", n)
+	}
+
+	// 每个Server按自己的MaxConn拒绝多余的链接
+	addr := startAcceptLoops(t, s1, 1)
+	for i := 0; i < 3; i++ {
+		conn, err := net.Dial("tcp", addr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer func() { _ = conn.Close() }()
+	}
+	waitFor(t, func() bool { return s1.connMgr.Len() == 1 })
+	time.Sleep(50 * time.Millisecond)
+	if n := s1.connMgr.Len(); n != 1 {
+		t.Fatalf("s1 conn count = %d, want 1", n)
+	}
+}
+
+func TestUserConfServerPacketUsesOwnConfig(t *testing.T) {
+	s1 := NewUserConfServer(&xconf.Config{MaxPacketSize: 16, HideLogo: true})
+	s2 := NewUserConfServer(&xconf.Config{MaxPacketSize: 1024, HideLogo: true})
+
+	data, err := s2.GetPacket().Pack(NewMsgPackage(1, make([]byte, 100)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = s2.GetPacket().Unpack(data); err != nil {
+		t.Fatalf("s2 unpack: %v", err)
+	}
+	if _, err = s1.GetPacket().Unpack(data); err == nil {
+		t.Fatal("s1 accepted a packet over its own MaxPacketSize")
+	}
+}
+
+func TestListenTcpConnErrorDoesNotPanic(t *testing.T) {
+	s := NewServer(WithListenFunc(func(_, _ string) (net.Listener, error) {
+		return nil, errors.New("address already in use")
+	})).(*Server)
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		s.ListenTcpConn()
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("ListenTcpConn should return when listen fails")
+	}
+	if err := s.ListenErr(); err == nil || err.Error() != "address already in use" {
+		t.Fatalf("ListenErr() = %v", err)
+	}
+}
+
+func TestStopAfterListenError(t *testing.T) {
+	s := NewUserConfServer(&xconf.Config{Mode: xconf.ServerModeTcp, HideLogo: true}, WithListenFunc(func(_, _ string) (net.Listener, error) {
+		return nil, errors.New("address already in use")
+	}))
+	s.Start()
+	waitFor(t, func() bool { return s.ListenErr() != nil })
+
+	// 监听失败后没有协程等待exitChan，Stop不能因此阻塞
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		s.Stop()
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Stop should return after listen fails")
+	}
+}
+
+func TestServerHealthLifecycle(t *testing.T) {
+	ln := newPipeListener()
+	s := NewServer(WithListenFunc(func(_, _ string) (net.Listener, error) {
+		return ln, nil
+	})).(*Server)
+	handler := HealthHandler(s)
+	probe := func() (int, string) {
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+		return w.Code, w.Body.String()
+	}
+
+	if code, body := probe(); code != http.StatusServiceUnavailable || body != "starting" {
+		t.Fatalf("before Start: %d %s", code, body)
+	}
+
+	s.Start()
+	if code, body := probe(); code != http.StatusOK || body != "ready" {
+		t.Fatalf("after Start: %d %s", code, body)
+	}
+
+	local, remote := net.Pipe()
+	defer func() { _ = remote.Close() }()
+	conn := startTestConn(t, s, local, 1)
+	done := make(chan error, 1)
+	go func() { done <- s.GracefulStop(context.Background()) }()
+
+	waitFor(t, func() bool { return s.Health() == HealthDraining })
+	if code, body := probe(); code != http.StatusServiceUnavailable || body != "draining" {
+		t.Fatalf("while draining: %d %s", code, body)
+	}
+
+	// 已有链接断开后完成停止
+	conn.Stop()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("GracefulStop err = %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("GracefulStop does not return after all conns are closed")
+	}
+	if s.Health() != HealthStopped {
+		t.Fatalf("health = %s, want stopped", s.Health())
+	}
+}
+
+func TestServerOnDrainConn(t *testing.T) {
+	ln := newPipeListener()
+	s := NewServer(WithListenFunc(func(_, _ string) (net.Listener, error) {
+		return ln, nil
+	})).(*Server)
+	s.Start()
+
+	const migrateMsgID = 3001
+	s.SetOnDrainConn(func(conn IConnection) {
+		if s.Health() != HealthDraining {
+			t.Errorf("health = %s in OnDrainConn, want draining", s.Health())
+		}
+		_ = conn.Kick(migrateMsgID, []byte("127.0.0.1:9000"), CloseReasonServerShutdown)
+	})
+
+	local, remote := net.Pipe()
+	defer func() { _ = remote.Close() }()
+	startTestConn(t, s, local, 1)
+
+	done := make(chan error, 1)
+	go func() { done <- s.GracefulStop(context.Background()) }()
+
+	// 客户端收到迁移指令，链接被关闭后GracefulStop完成
+	msg := readReply(t, s, remote)
+	if msg.GetMsgID() != migrateMsgID || string(msg.GetData()) != "127.0.0.1:9000" {
+		t.Fatalf("migrate msg = %d %q", msg.GetMsgID(), msg.GetData())
+	}
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("GracefulStop err = %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("GracefulStop does not return after the drained conn is closed")
+	}
+}
+
+func TestServerMaxConnEvents(t *testing.T) {
+	s := NewUserConfServer(&xconf.Config{MaxConn: 1}).(*Server)
+
+	var events []string
+	s.SetOnMaxConnReached(func(current int) { events = append(events, fmt.Sprintf("reached:%d", current)) })
+	s.SetOnMaxConnRecovered(func(current int) { events = append(events, fmt.Sprintf("recovered:%d", current)) })
+
+	local, remote := net.Pipe()
+	defer func() { _ = remote.Close() }()
+
+	atMaxConn := func() bool {
+		if !s.reserveConnSlot() {
+			return true
+		}
+		s.releaseConnSlot()
+		return false
+	}
+	if atMaxConn() {
+		t.Fatal("empty server should not be at max conn")
+	}
+	conn := newServerConn(s, local, 1)
+	// 达到上限后多次检查只通知一次
+	for i := 0; i < 3; i++ {
+		if !atMaxConn() {
+			t.Fatal("server should be at max conn")
+		}
+	}
+	s.GetConnMgr().Remove(conn)
+	atMaxConn()
+
+	// 距离上一次通知不足maxConnEventInterval时再次达到上限不通知，也不会通知恢复
+	conn = newServerConn(s, local, 2)
+	atMaxConn()
+	s.GetConnMgr().Remove(conn)
+	atMaxConn()
+
+	want := []string{"reached:1", "recovered:0"}
+	if fmt.Sprint(events) != fmt.Sprint(want) {
+		t.Fatalf("events = %v, want %v", events, want)
+	}
+
+	// 超过间隔之后再次达到上限时重新通知
+	s.maxConnEvents.reached(1, time.Now().Add(maxConnEventInterval))
+	if events[len(events)-1] != "reached:1" || len(events) != 3 {
+		t.Fatalf("events = %v, want reached again after the interval", events)
+	}
+}
+
+// 并发预留槽位时成功的数量不超过MaxConn，链接加入链接管理后释放槽位仍占用名额
+func TestServerReserveConnSlot(t *testing.T) {
+	const maxConn = 5
+	s := NewUserConfServer(&xconf.Config{MaxConn: maxConn}).(*Server)
+
+	var reserved int32
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if s.reserveConnSlot() {
+				atomic.AddInt32(&reserved, 1)
+			}
+		}()
+	}
+	wg.Wait()
+	if reserved != maxConn {
+		t.Fatalf("reserved %d slots, want %d", reserved, maxConn)
+	}
+
+	local, remote := net.Pipe()
+	defer func() { _ = remote.Close() }()
+	conn := newServerConn(s, local, 1)
+	s.releaseConnSlot()
+	if s.reserveConnSlot() {
+		t.Fatal("slot of a managed conn should not be reserved again")
+	}
+
+	s.GetConnMgr().Remove(conn)
+	if !s.reserveConnSlot() {
+		t.Fatal("slot should be reserved after the conn is removed")
+	}
+}
+
+func TestServerGracefulStopTimeout(t *testing.T) {
+	ln := newPipeListener()
+	s := NewServer(WithListenFunc(func(_, _ string) (net.Listener, error) {
+		return ln, nil
+	})).(*Server)
+	s.Start()
+	local, remote := net.Pipe()
+	defer func() { _ = remote.Close() }()
+	startTestConn(t, s, local, 1)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := s.GracefulStop(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("GracefulStop err = %v, want DeadlineExceeded", err)
+	}
+	if s.Health() != HealthStopped || s.connMgr.Len() != 0 {
+		t.Fatalf("health = %s, conns = %d after timeout", s.Health(), s.connMgr.Len())
+	}
+}
+
+// websocket模式下不启动tcp监听，GracefulStop同样要在ctx结束之前返回
+func TestServerGracefulStopWebsocketMode(t *testing.T) {
+	ln := newPipeListener()
+	s := NewUserConfServer(&xconf.Config{Mode: xconf.ServerModeWebsocket, HideLogo: true}, WithListenFunc(func(_, _ string) (net.Listener, error) {
+		return ln, nil
+	}))
+	s.Start()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	done := make(chan error, 1)
+	go func() { done <- s.GracefulStop(ctx) }()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("GracefulStop err = %v", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("GracefulStop does not return in websocket mode")
+	}
+	if s.Health() != HealthStopped {
+		t.Fatalf("health = %s after GracefulStop, want stopped", s.Health())
+	}
+}
+
+func TestServerStopCancelsRequestContext(t *testing.T) {
+	ln := newPipeListener()
+	s := NewServer(WithListenFunc(func(_, _ string) (net.Listener, error) {
+		return ln, nil
+	})).(*Server)
+
+	started := make(chan struct{})
+	cancelled := make(chan error, 1)
+	s.AddRouterSlices(1, func(request IRequest) {
+		close(started)
+		select {
+		case <-request.Context().Done():
+			cancelled <- request.Context().Err()
+		case <-time.After(5 * time.Second):
+			cancelled <- nil
+		}
+	})
+	s.Start()
+	local, remote := net.Pipe()
+	defer func() { _ = remote.Close() }()
+	startTestConn(t, s, local, 1)
+
+	packed, _ := s.GetPacket().Pack(NewMsgPackage(1, []byte("long task")))
+	go func() { _, _ = remote.Write(packed) }()
+	<-started
+
+	// 等待超时后处理函数的上下文被取消，Stop不需要等待处理函数执行完5秒
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	_ = s.GracefulStop(ctx)
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Fatalf("GracefulStop took %v with a handler waiting on ctx", elapsed)
+	}
+	if err := <-cancelled; err == nil {
+		t.Fatal("request context is not cancelled when the server stops")
+	}
+	if s.Context().Err() == nil {
+		t.Fatal("server context is not cancelled after Stop")
+	}
+}
+
+func TestServerHealthDegraded(t *testing.T) {
+	s := NewUserConfServer(&xconf.Config{WorkerPoolSize: 1, DegradedQueueLen: 3}).(*Server)
+	mh := s.GetMsgHandler().(*MsgHandle)
+	mh.StartWorkerPool()
+	defer mh.StopWorkerPool()
+	s.health.Store(int32(HealthReady))
+
+	started, release := make(chan struct{}), make(chan struct{})
+	var once sync.Once
+	mh.AddRouterSlices(1, func(request IRequest) {
+		once.Do(func() {
+			close(started)
+			<-release
+		})
+	})
+
+	// 第一条消息阻塞worker，之后的消息积压在队列中
+	mh.SendMsgToTaskQueue(newTestRequest(t, s, 1))
+	<-started
+	for i := 0; i < 3; i++ {
+		if s.Health() != HealthReady {
+			t.Fatalf("health = %s with %d queued msgs, want ready", s.Health(), i)
+		}
+		mh.SendMsgToTaskQueue(newTestRequest(t, s, 1))
+	}
+	if s.Health() != HealthDegraded || !s.Health().Serving() {
+		t.Fatalf("health = %s, want degraded", s.Health())
+	}
+
+	close(release)
+	waitFor(t, func() bool { return s.Health() == HealthReady })
+}
+
+func TestServerListenIPv6Loopback(t *testing.T) {
+	probe, err := net.Listen("tcp6", "[::1]:0")
+	if err != nil {
+		t.Skipf("IPv6 loopback is not available: %v", err)
+	}
+	_ = probe.Close()
+
+	s := NewUserConfServer(&xconf.Config{Host: "::1", Network: xconf.NetworkTCP6}).(*Server)
+	ln, err := s.listenTCP(net.JoinHostPort(s.ip, "0"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = ln.Close() }()
+
+	if addr := ln.Addr().(*net.TCPAddr); addr.IP.To4() != nil || !addr.IP.IsLoopback() {
+		t.Fatalf("listen addr = %v, want IPv6 loopback", addr)
+	}
+
+	conn, err := net.Dial("tcp6", ln.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = conn.Close()
+}
+
+func TestServerNetworkOption(t *testing.T) {
+	if s := NewServer().(*Server); s.network != xconf.NetworkTCP {
+		t.Fatalf("NewServer network = %q, want %q", s.network, xconf.NetworkTCP)
+	}
+	if s := NewUserConfServer(&xconf.Config{}).(*Server); s.network != xconf.NetworkTCP {
+		t.Fatalf("NewUserConfServer network = %q, want %q", s.network, xconf.NetworkTCP)
+	}
+	if s := NewServer(WithNetwork(xconf.NetworkTCP4)).(*Server); s.network != xconf.NetworkTCP4 {
+		t.Fatalf("WithNetwork network = %q, want %q", s.network, xconf.NetworkTCP4)
+	}
+
+	defer func() {
+		err, _ := recover().(error)
+		if !errors.Is(err, ErrInvalidNetwork) {
+			t.Fatalf("recover = %v, want ErrInvalidNetwork", err)
+		}
+	}()
+	NewServer(WithNetwork("udp"))
+}
+
+// 嵌入默认实现，记录经过的消息
+type countingMsgHandle struct {
+	*MsgHandle
+	executed int32
+}
+
+func (h *countingMsgHandle) Execute(request IRequest) {
+	atomic.AddInt32(&h.executed, 1)
+	h.MsgHandle.Execute(request)
+}
+
+func TestWithMsgHandler(t *testing.T) {
+	handler := &countingMsgHandle{MsgHandle: NewMsgHandle(&xconf.Config{WorkerMode: xconf.WorkerModeBind, MaxConn: 4})}
+	s := NewServer(WithMsgHandler(handler)).(*Server)
+	if s.GetMsgHandler() != handler {
+		t.Fatal("GetMsgHandler does not return the injected handler")
+	}
+
+	conn, _ := newPipeConn(t, s, 1)
+
+	conn.GetMsgHandler().Execute(NewRequest(conn, NewMsgPackage(1, nil)))
+	if atomic.LoadInt32(&handler.executed) != 1 {
+		t.Fatal("connection does not use the injected handler")
+	}
+	// 嵌入的默认实现仍然按Bind模式分配worker
+	useWorker(conn)
+	if len(handler.freeWorkers) != 3 {
+		t.Fatalf("free workers = %d, want 3", len(handler.freeWorkers))
+	}
+
+	defer func() {
+		if err, _ := recover().(error); !errors.Is(err, ErrNilMsgHandler) {
+			t.Fatalf("recover = %v, want ErrNilMsgHandler", err)
+		}
+	}()
+	NewServer(WithMsgHandler(nil)).Start()
+}
+
+func TestServerWithNoDecoder(t *testing.T) {
+	ln := newPipeListener()
+	s := NewUserConfServer(&xconf.Config{Mode: xconf.ServerModeTcp}, WithNoDecoder(), WithListenFunc(func(_, _ string) (net.Listener, error) {
+		return ln, nil
+	})).(*Server)
+	if s.GetDecoder() != nil || s.GetLengthField() != nil {
+		t.Fatal("decoder should be disabled")
+	}
+
+	received := make(chan string, 1)
+	s.AddRouterSlices(0, func(request IRequest) {
+		received <- string(request.GetData())
+	})
+	s.Start()
+	defer s.Stop()
+
+	conn, err := ln.Dial("", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = conn.Close() }()
+
+	// 没有解码器时读取到的数据原样交给MsgID为0的路由
+	if _, err = conn.Write([]byte("raw bytes")); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case data := <-received:
+		if data != "raw bytes" {
+			t.Fatalf("received = %q, want %q", data, "raw bytes")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("raw data is not routed")
+	}
+
+	if decoder, err := NewDecoderFromConfig(&xconf.Config{Decoder: xconf.DecoderNone}); decoder != nil || err != nil {
+		t.Fatalf("NewDecoderFromConfig(none) = %v, %v", decoder, err)
+	}
+}
@@ -0,0 +1,147 @@
+/**
+* @File: stats.go
+* @Author: Jason Woo
+* @Date: 2026/10/16 22:40
+**/
+
+package fastnet
+
+import (
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// ServerStats Server运行状态的快照
+type ServerStats struct {
+	ConnCount    int    // 当前链接数
+	BytesRead    uint64 // 所有链接累计读取的字节数(包括已断开的链接)
+	BytesWritten uint64 // 所有链接累计写出的字节数(包括已断开的链接)
+
+	MsgLatency map[uint32]MsgLatencyStats // 每个MsgID的处理耗时统计
+
+	UpgradesRejected uint64 // 同时进行中的websocket升级请求超过MaxConcurrentUpgrades被拒绝的次数
+
+	Workers WorkerUtilization // Worker工作池的使用率和平均队列积压
+}
+
+// byteCounter 收发字节数统计，字段只通过原子操作访问
+// 作为结构体字段时需要放在结构体的开头，保证32位平台上的64位对齐
+type byteCounter struct {
+	read    uint64
+	written uint64
+}
+
+func (b *byteCounter) addRead(n int) {
+	if n > 0 {
+		atomic.AddUint64(&b.read, uint64(n))
+	}
+}
+
+func (b *byteCounter) addWritten(n int) {
+	if n > 0 {
+		atomic.AddUint64(&b.written, uint64(n))
+	}
+}
+
+func (b *byteCounter) loadRead() uint64 {
+	return atomic.LoadUint64(&b.read)
+}
+
+func (b *byteCounter) loadWritten() uint64 {
+	return atomic.LoadUint64(&b.written)
+}
+
+// Server实现该接口，链接创建时获取Server的字节数统计，收发数据时同时累加
+type totalBytesOwner interface {
+	totalBytes() *byteCounter
+}
+
+// LatencyBuckets 消息处理耗时直方图的桶边界
+var LatencyBuckets = []time.Duration{
+	100 * time.Microsecond,
+	500 * time.Microsecond,
+	time.Millisecond,
+	5 * time.Millisecond,
+	10 * time.Millisecond,
+	50 * time.Millisecond,
+	100 * time.Millisecond,
+	500 * time.Millisecond,
+	time.Second,
+}
+
+// MsgLatencyStats 单个MsgID的处理耗时统计，耗时从worker取出消息开始到处理函数执行完成为止
+type MsgLatencyStats struct {
+	Count   uint64        // 处理次数
+	Sum     time.Duration // 累计耗时
+	Max     time.Duration // 最大耗时
+	Buckets []uint64      // Buckets[i]为耗时不超过LatencyBuckets[i]且超过前一个边界的次数，最后一个为超过所有边界的次数
+}
+
+// Avg 平均耗时
+func (ls MsgLatencyStats) Avg() time.Duration {
+	if ls.Count == 0 {
+		return 0
+	}
+	return ls.Sum / time.Duration(ls.Count)
+}
+
+// msgLatency 单个MsgID的处理耗时，字段只通过原子操作访问
+type msgLatency struct {
+	count   uint64
+	sum     int64
+	max     int64
+	buckets []uint64
+}
+
+func (l *msgLatency) observe(d time.Duration) {
+	atomic.AddUint64(&l.count, 1)
+	atomic.AddInt64(&l.sum, int64(d))
+	for {
+		old := atomic.LoadInt64(&l.max)
+		if int64(d) <= old || atomic.CompareAndSwapInt64(&l.max, old, int64(d)) {
+			break
+		}
+	}
+
+	i := sort.Search(len(LatencyBuckets), func(i int) bool { return d <= LatencyBuckets[i] })
+	atomic.AddUint64(&l.buckets[i], 1)
+}
+
+func (l *msgLatency) snapshot() MsgLatencyStats {
+	stats := MsgLatencyStats{
+		Count:   atomic.LoadUint64(&l.count),
+		Sum:     time.Duration(atomic.LoadInt64(&l.sum)),
+		Max:     time.Duration(atomic.LoadInt64(&l.max)),
+		Buckets: make([]uint64, len(l.buckets)),
+	}
+	for i := range l.buckets {
+		stats.Buckets[i] = atomic.LoadUint64(&l.buckets[i])
+	}
+
+	return stats
+}
+
+// latencyRecorder 按MsgID记录处理耗时
+type latencyRecorder struct {
+	msgs sync.Map // msgID -> *msgLatency
+}
+
+func (r *latencyRecorder) observe(msgID uint32, d time.Duration) {
+	l, ok := r.msgs.Load(msgID)
+	if !ok {
+		l, _ = r.msgs.LoadOrStore(msgID, &msgLatency{buckets: make([]uint64, len(LatencyBuckets)+1)})
+	}
+	l.(*msgLatency).observe(d)
+}
+
+func (r *latencyRecorder) snapshot() map[uint32]MsgLatencyStats {
+	result := make(map[uint32]MsgLatencyStats)
+	r.msgs.Range(func(key, value interface{}) bool {
+		result[key.(uint32)] = value.(*msgLatency).snapshot()
+		return true
+	})
+
+	return result
+}
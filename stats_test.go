@@ -0,0 +1,135 @@
+/**
+* @File: stats_test.go
+* @Author: Jason Woo
+* @Date: 2026/10/16 22:50
+**/
+
+package fastnet
+
+import (
+	"github.com/dyowoo/fastnet/xconf"
+	"net"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestConnectionByteCounters(t *testing.T) {
+	s := NewServer().(*Server)
+	s.AddInterceptor(s.GetDecoder())
+	s.GetMsgHandler().StartWorkerPool()
+	defer s.GetMsgHandler().StopWorkerPool()
+
+	s.AddRouterSlices(1, func(request IRequest) {
+		_ = request.GetConnection().SendMsg(2, []byte("pong!"))
+	})
+
+	local, remote := net.Pipe()
+	defer func() { _ = remote.Close() }()
+	conn := newServerConn(s, local, 1)
+	go conn.Start()
+	defer conn.Stop()
+
+	request, _ := s.GetPacket().Pack(NewMsgPackage(1, []byte("ping")))
+	if _, err := remote.Write(request); err != nil {
+		t.Fatal(err)
+	}
+
+	reply, err := readMsgFrom(remote, s.GetPacket())
+	if err != nil || reply.GetMsgID() != 2 {
+		t.Fatalf("unexpected reply: %v, %v", reply, err)
+	}
+	replyLen := uint64(s.GetPacket().GetHeadLen()) + uint64(reply.GetDataLen())
+
+	waitFor(t, func() bool {
+		return conn.BytesRead() == uint64(len(request)) && conn.BytesWritten() == replyLen
+	})
+
+	stats := s.Stats()
+	if stats.BytesRead != uint64(len(request)) || stats.BytesWritten != replyLen {
+		t.Fatalf("server stats = %+v, want read %d written %d", stats, len(request), replyLen)
+	}
+}
+
+func TestMsgLatencyStats(t *testing.T) {
+	s := NewServer().(*Server)
+	mh := s.GetMsgHandler().(*MsgHandle)
+	mh.AddRouterSlices(1, func(request IRequest) {
+		time.Sleep(2 * time.Millisecond)
+	})
+
+	mh.StartWorkerPool()
+	for i := 0; i < 3; i++ {
+		mh.SendMsgToTaskQueue(newTestRequest(t, s, 1))
+	}
+	// 没有注册路由的MsgID不统计
+	mh.SendMsgToTaskQueue(newTestRequest(t, s, 99))
+	mh.StopWorkerPool()
+
+	latency := s.Stats().MsgLatency
+	if _, ok := latency[99]; ok {
+		t.Fatal("unknown msgID should not be recorded")
+	}
+
+	stats := latency[1]
+	if stats.Count != 3 || stats.Max < 2*time.Millisecond || stats.Sum < 6*time.Millisecond {
+		t.Fatalf("unexpected latency stats: %+v", stats)
+	}
+	var total uint64
+	for _, n := range stats.Buckets {
+		total += n
+	}
+	if total != 3 || len(stats.Buckets) != len(LatencyBuckets)+1 {
+		t.Fatalf("unexpected latency buckets: %v", stats.Buckets)
+	}
+}
+
+func TestWorkerUtilization(t *testing.T) {
+	s := NewUserConfServer(&xconf.Config{WorkerPoolSize: 2}).(*Server)
+	mh := s.GetMsgHandler().(*MsgHandle)
+	if u := s.Stats().Workers; u.Total != 2 || u.Busy != 0 || u.BusyRatio != 0 {
+		t.Fatalf("utilization before start = %+v", u)
+	}
+	mh.StartWorkerPool()
+	defer mh.StopWorkerPool()
+
+	started, release := make(chan struct{}), make(chan struct{})
+	var once sync.Once
+	mh.AddRouterSlices(1, func(request IRequest) {
+		once.Do(func() {
+			close(started)
+			<-release
+		})
+	})
+
+	// 没有启动的链接都由worker 0处理，第一条消息阻塞worker 0，之后的消息积压在队列中
+	mh.SendMsgToTaskQueue(newTestRequest(t, s, 1))
+	<-started
+	for i := 0; i < 4; i++ {
+		mh.SendMsgToTaskQueue(newTestRequest(t, s, 1))
+	}
+	time.Sleep(200 * time.Millisecond)
+
+	u := s.Stats().Workers
+	if u.Total != 2 || u.Busy != 1 || u.QueueDepth != 4 {
+		t.Fatalf("utilization = %+v, want 1/2 busy with 4 queued", u)
+	}
+	// 两个worker中的一个一直在处理消息
+	if u.Window <= 0 || u.BusyRatio < 0.3 || u.BusyRatio > 0.7 {
+		t.Fatalf("busy ratio = %.2f over %s, want about 0.5", u.BusyRatio, u.Window)
+	}
+	if u.AvgQueueDepth <= 0 || u.AvgQueueDepth > 2 {
+		t.Fatalf("avg queue depth = %.2f, want (0, 2]", u.AvgQueueDepth)
+	}
+
+	close(release)
+	waitFor(t, func() bool {
+		u := mh.WorkerUtilization()
+		return u.Busy == 0 && u.QueueDepth == 0
+	})
+
+	// 客户端没有worker工作池
+	if u := newClientMsgHandle(s.config).WorkerUtilization(); u != (WorkerUtilization{}) {
+		t.Fatalf("client utilization = %+v, want zero value", u)
+	}
+}
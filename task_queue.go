@@ -0,0 +1,175 @@
+/**
+* @File: task_queue.go
+* @Author: Jason Woo
+* @Date: 2026/10/16 11:51
+**/
+
+package fastnet
+
+import (
+	"container/heap"
+	"sync"
+)
+
+// ITaskQueue Worker的任务队列
+type ITaskQueue interface {
+	Enqueue(request IRequest)                      // 入队，队列已满时阻塞
+	Dequeue(exit <-chan struct{}) (IRequest, bool) // 出队，队列为空时阻塞，exit关闭时返回false
+	TryDequeue() (IRequest, bool)                  // 非阻塞出队，队列为空时返回false
+	Len() int                                      // 队列中等待处理的消息数量
+}
+
+// TaskQueueFactory 为每个Worker创建任务队列，capacity为配置的MaxWorkerTaskLen
+type TaskQueueFactory func(workerID int, capacity int) ITaskQueue
+
+// PriorityFunc 获取MsgID的优先级，数值越大越先处理
+type PriorityFunc func(msgID uint32) int
+
+// PriorityMap 使用MsgID到优先级的映射作为PriorityFunc，未配置的MsgID优先级为0
+// 映射在创建后不应再修改
+func PriorityMap(priorities map[uint32]int) PriorityFunc {
+	return func(msgID uint32) int {
+		return priorities[msgID]
+	}
+}
+
+// fifoTaskQueue 默认的先进先出任务队列
+type fifoTaskQueue chan IRequest
+
+// NewFIFOTaskQueue 创建先进先出的任务队列
+func NewFIFOTaskQueue(capacity int) ITaskQueue {
+	return fifoTaskQueue(make(chan IRequest, capacity))
+}
+
+func (q fifoTaskQueue) Enqueue(request IRequest) {
+	q <- request
+}
+
+func (q fifoTaskQueue) Dequeue(exit <-chan struct{}) (IRequest, bool) {
+	select {
+	case request := <-q:
+		return request, true
+	case <-exit:
+		return nil, false
+	}
+}
+
+func (q fifoTaskQueue) TryDequeue() (IRequest, bool) {
+	select {
+	case request := <-q:
+		return request, true
+	default:
+		return nil, false
+	}
+}
+
+func (q fifoTaskQueue) Len() int {
+	return len(q)
+}
+
+// priorityTaskQueue 按MsgID优先级出队的任务队列
+type priorityTaskQueue struct {
+	lock     sync.Mutex
+	items    priorityItems
+	seq      uint64
+	priority PriorityFunc
+	slots    chan struct{} // 剩余容量，队列已满时Enqueue阻塞
+	ready    chan struct{} // 队列中的消息数量，队列为空时Dequeue阻塞
+}
+
+// NewPriorityTaskQueue 创建按优先级出队的任务队列
+// 优先级高的消息先出队，优先级相同的消息按入队顺序出队
+// 注意：同一链接的消息优先级不同时，处理顺序与收到的顺序不一致，依赖消息顺序的业务不应使用不同的优先级
+func NewPriorityTaskQueue(capacity int, priority PriorityFunc) ITaskQueue {
+	if capacity <= 0 {
+		capacity = 1
+	}
+
+	return &priorityTaskQueue{
+		priority: priority,
+		slots:    make(chan struct{}, capacity),
+		ready:    make(chan struct{}, capacity),
+	}
+}
+
+func (q *priorityTaskQueue) Enqueue(request IRequest) {
+	q.slots <- struct{}{}
+
+	item := priorityItem{request: request}
+	if q.priority != nil {
+		item.priority = q.priority(request.GetMsgID())
+	}
+
+	q.lock.Lock()
+	item.seq = q.seq
+	q.seq++
+	heap.Push(&q.items, item)
+	q.lock.Unlock()
+
+	q.ready <- struct{}{}
+}
+
+func (q *priorityTaskQueue) Dequeue(exit <-chan struct{}) (IRequest, bool) {
+	select {
+	case <-q.ready:
+		return q.pop(), true
+	case <-exit:
+		return nil, false
+	}
+}
+
+func (q *priorityTaskQueue) TryDequeue() (IRequest, bool) {
+	select {
+	case <-q.ready:
+		return q.pop(), true
+	default:
+		return nil, false
+	}
+}
+
+func (q *priorityTaskQueue) Len() int {
+	return len(q.ready)
+}
+
+func (q *priorityTaskQueue) pop() IRequest {
+	q.lock.Lock()
+	item := heap.Pop(&q.items).(priorityItem)
+	q.lock.Unlock()
+
+	<-q.slots
+
+	return item.request
+}
+
+type priorityItem struct {
+	request  IRequest
+	priority int
+	seq      uint64 // 入队顺序，优先级相同时先入队的先出队
+}
+
+// priorityItems 实现heap.Interface
+type priorityItems []priorityItem
+
+func (p priorityItems) Len() int { return len(p) }
+
+func (p priorityItems) Less(i, j int) bool {
+	if p[i].priority != p[j].priority {
+		return p[i].priority > p[j].priority
+	}
+	return p[i].seq < p[j].seq
+}
+
+func (p priorityItems) Swap(i, j int) { p[i], p[j] = p[j], p[i] }
+
+func (p *priorityItems) Push(x interface{}) {
+	*p = append(*p, x.(priorityItem))
+}
+
+func (p *priorityItems) Pop() interface{} {
+	old := *p
+	n := len(old)
+	item := old[n-1]
+	old[n-1] = priorityItem{}
+	*p = old[:n-1]
+	return item
+}
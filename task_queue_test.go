@@ -0,0 +1,52 @@
+/**
+* @File: task_queue_test.go
+* @Author: Jason Woo
+* @Date: 2026/10/16 11:51
+**/
+
+package fastnet
+
+import (
+	"testing"
+)
+
+func TestPriorityTaskQueueOrder(t *testing.T) {
+	s := NewServer().(*Server)
+	q := NewPriorityTaskQueue(10, PriorityMap(map[uint32]int{9: 10}))
+
+	for _, msgID := range []uint32{1, 2, 9, 3} {
+		q.Enqueue(newTestRequest(t, s, msgID))
+	}
+	if n := q.Len(); n != 4 {
+		t.Fatalf("Len = %d, want 4", n)
+	}
+
+	var got []uint32
+	for {
+		request, ok := q.TryDequeue()
+		if !ok {
+			break
+		}
+		got = append(got, request.GetMsgID())
+	}
+
+	want := []uint32{9, 1, 2, 3}
+	if len(got) != len(want) {
+		t.Fatalf("dequeue = %v, want %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("dequeue = %v, want %v", got, want)
+		}
+	}
+}
+
+func TestPriorityTaskQueueDequeueExit(t *testing.T) {
+	q := NewPriorityTaskQueue(1, nil)
+	exit := make(chan struct{})
+	close(exit)
+
+	if _, ok := q.Dequeue(exit); ok {
+		t.Fatal("Dequeue on empty queue should return false after exit")
+	}
+}
@@ -0,0 +1,74 @@
+/**
+* @File: tcp_options.go
+* @Author: Jason Woo
+* @Date: 2026/10/16 11:58
+**/
+
+package fastnet
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"github.com/dyowoo/fastnet/xconf"
+	"github.com/dyowoo/fastnet/xlog"
+	"net"
+)
+
+// tcp keepalive探测间隔的上限(单位：秒)，与Linux的TCP_KEEPIDLE上限一致
+const maxTCPKeepAlivePeriod = 32767
+
+var ErrInvalidTCPConfig = errors.New("invalid tcp config") // 配置中的tcp链接参数不合法
+
+// 检查tcp链接相关的配置，创建Server和Client时调用，不合法的配置在启动阶段直接报错而不是在每个链接上失败
+func checkTCPConfig(config *xconf.Config) error {
+	if config.IOReadBuffSize == 0 {
+		return fmt.Errorf("%w: IOReadBuffSize must be positive", ErrInvalidTCPConfig)
+	}
+	if config.TCPKeepAlivePeriod > maxTCPKeepAlivePeriod {
+		return fmt.Errorf("%w: TCPKeepAlivePeriod = %d exceeds %d seconds",
+			ErrInvalidTCPConfig, config.TCPKeepAlivePeriod, maxTCPKeepAlivePeriod)
+	}
+
+	return nil
+}
+
+// applyTCPOptions 按配置设置tcp链接的TCP_NODELAY和SO_KEEPALIVE，tls链接设置底层的tcp链接，其他类型的链接忽略
+func applyTCPOptions(conn net.Conn, config *xconf.Config) {
+	if tlsConn, ok := conn.(*tls.Conn); ok {
+		conn = tlsConn.NetConn()
+	}
+	tcpConn, ok := conn.(*net.TCPConn)
+	if !ok {
+		return
+	}
+
+	if err := tcpConn.SetNoDelay(config.TCPNoDelayEnabled()); err != nil {
+		xlog.WarnF("set TCP_NODELAY on %s failed: %v", tcpConn.RemoteAddr(), err)
+	}
+
+	period := config.TCPKeepAlivePeriodDuration()
+	switch {
+	case period < 0:
+		if err := tcpConn.SetKeepAlive(false); err != nil {
+			xlog.WarnF("disable SO_KEEPALIVE on %s failed: %v", tcpConn.RemoteAddr(), err)
+		}
+	case period > 0:
+		if err := tcpConn.SetKeepAlive(true); err != nil {
+			xlog.WarnF("set SO_KEEPALIVE on %s failed: %v", tcpConn.RemoteAddr(), err)
+			return
+		}
+		if err := tcpConn.SetKeepAlivePeriod(period); err != nil {
+			xlog.WarnF("set keepalive period %v on %s failed: %v", period, tcpConn.RemoteAddr(), err)
+		}
+	}
+}
+
+// 设置链接底层的tcp链接，websocket链接设置其底层的tcp链接
+func applyConnTCPOptions(conn IConnection, config *xconf.Config) {
+	if rawConn := conn.GetConnection(); rawConn != nil {
+		applyTCPOptions(rawConn, config)
+	} else if wsConn := conn.GetWsConn(); wsConn != nil {
+		applyTCPOptions(wsConn.UnderlyingConn(), config)
+	}
+}
@@ -0,0 +1,62 @@
+/**
+* @File: tcp_options_linux_test.go
+* @Author: Jason Woo
+* @Date: 2026/10/16 11:58
+**/
+
+package fastnet
+
+import (
+	"github.com/dyowoo/fastnet/xconf"
+	"net"
+	"syscall"
+	"testing"
+)
+
+func getsockoptInt(t *testing.T, conn net.Conn, level, opt int) int {
+	rawConn, err := conn.(*net.TCPConn).SyscallConn()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var value int
+	var sockErr error
+	if err := rawConn.Control(func(fd uintptr) {
+		value, sockErr = syscall.GetsockoptInt(int(fd), level, opt)
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if sockErr != nil {
+		t.Fatal(sockErr)
+	}
+
+	return value
+}
+
+func TestApplyTCPOptions(t *testing.T) {
+	conn, _ := newLoopbackConn(t)
+	rawConn := conn.GetConnection()
+
+	// 通过Merge显式关闭TCP_NODELAY
+	noDelay := false
+	config := *xconf.GlobalObject
+	config.Merge(&xconf.Config{TCPNoDelay: &noDelay, TCPKeepAlivePeriod: 37})
+	applyConnTCPOptions(conn, &config)
+	if v := getsockoptInt(t, rawConn, syscall.IPPROTO_TCP, syscall.TCP_NODELAY); v != 0 {
+		t.Fatalf("TCP_NODELAY = %d, want 0", v)
+	}
+	if v := getsockoptInt(t, rawConn, syscall.SOL_SOCKET, syscall.SO_KEEPALIVE); v == 0 {
+		t.Fatal("SO_KEEPALIVE is not set")
+	}
+	if v := getsockoptInt(t, rawConn, syscall.IPPROTO_TCP, syscall.TCP_KEEPIDLE); v != 37 {
+		t.Fatalf("TCP_KEEPIDLE = %d, want 37", v)
+	}
+
+	applyConnTCPOptions(conn, &xconf.Config{TCPKeepAlivePeriod: -1})
+	if v := getsockoptInt(t, rawConn, syscall.IPPROTO_TCP, syscall.TCP_NODELAY); v == 0 {
+		t.Fatal("TCP_NODELAY is not set")
+	}
+	if v := getsockoptInt(t, rawConn, syscall.SOL_SOCKET, syscall.SO_KEEPALIVE); v != 0 {
+		t.Fatalf("SO_KEEPALIVE = %d, want 0", v)
+	}
+}
@@ -0,0 +1,29 @@
+/**
+* @File: tcp_options_test.go
+* @Author: Jason Woo
+* @Date: 2026/10/16 14:10
+**/
+
+package fastnet
+
+import (
+	"errors"
+	"github.com/dyowoo/fastnet/xconf"
+	"testing"
+)
+
+func TestCheckTCPConfig(t *testing.T) {
+	cases := map[string]xconf.Config{
+		"zero read buffer":    {TCPKeepAlivePeriod: 10},
+		"keepalive too large": {IOReadBuffSize: 1024, TCPKeepAlivePeriod: maxTCPKeepAlivePeriod + 1},
+	}
+	for name, config := range cases {
+		config := config
+		if err := checkTCPConfig(&config); !errors.Is(err, ErrInvalidTCPConfig) {
+			t.Errorf("%s: err = %v, want ErrInvalidTCPConfig", name, err)
+		}
+	}
+	if err := checkTCPConfig(&xconf.Config{IOReadBuffSize: 1024, TCPKeepAlivePeriod: -1}); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,117 @@
+/**
+* @File: client.go
+* @Author: Jason Woo
+* @Date: 2026/10/16 13:09
+**/
+
+package testutil
+
+import (
+	"errors"
+	"fmt"
+	"github.com/dyowoo/fastnet"
+	"io"
+	"net"
+	"time"
+)
+
+var ErrAwaitTimeout = errors.New("await msg timeout") // 在超时时间内没有收到指定MsgID的消息
+
+// Client 使用默认封包方式的测试客户端，同步地发送和读取消息，不能在多个协程中同时使用
+type Client struct {
+	conn    net.Conn
+	pack    fastnet.IDataPack
+	pending []fastnet.IMessage // 等待指定MsgID时先收到的其他消息
+}
+
+// Dial 连接addr上的服务器
+func Dial(addr string) (*Client, error) {
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Client{conn: conn, pack: fastnet.NewDataPack()}, nil
+}
+
+// Conn 获取底层的tcp链接，可用于模拟半包、异常断开等情况
+func (c *Client) Conn() net.Conn {
+	return c.conn
+}
+
+// Send 发送一条消息
+func (c *Client) Send(msgID uint32, data []byte) error {
+	packed, err := c.pack.Pack(fastnet.NewMsgPackage(msgID, data))
+	if err != nil {
+		return err
+	}
+
+	_, err = c.conn.Write(packed)
+	return err
+}
+
+// Await 等待一条MsgID为msgID的消息，期间收到的其他消息保留给之后的Await
+// 超时时返回ErrAwaitTimeout
+func (c *Client) Await(msgID uint32, timeout time.Duration) (fastnet.IMessage, error) {
+	for i, msg := range c.pending {
+		if msg.GetMsgID() == msgID {
+			c.pending = append(c.pending[:i], c.pending[i+1:]...)
+			return msg, nil
+		}
+	}
+
+	if err := c.conn.SetReadDeadline(time.Now().Add(timeout)); err != nil {
+		return nil, err
+	}
+	defer func() { _ = c.conn.SetReadDeadline(time.Time{}) }()
+
+	for {
+		msg, err := c.read()
+		if err != nil {
+			var netErr net.Error
+			if errors.As(err, &netErr) && netErr.Timeout() {
+				return nil, fmt.Errorf("%w: msgID = %d", ErrAwaitTimeout, msgID)
+			}
+			return nil, err
+		}
+		if msg.GetMsgID() == msgID {
+			return msg, nil
+		}
+		c.pending = append(c.pending, msg)
+	}
+}
+
+// Request 发送一条消息，并等待MsgID为replyID的回复
+func (c *Client) Request(msgID uint32, data []byte, replyID uint32, timeout time.Duration) (fastnet.IMessage, error) {
+	if err := c.Send(msgID, data); err != nil {
+		return nil, err
+	}
+
+	return c.Await(replyID, timeout)
+}
+
+// Close 关闭链接
+func (c *Client) Close() error {
+	return c.conn.Close()
+}
+
+// 读取一条完整的消息
+func (c *Client) read() (fastnet.IMessage, error) {
+	head := make([]byte, c.pack.GetHeadLen())
+	if _, err := io.ReadFull(c.conn, head); err != nil {
+		return nil, err
+	}
+
+	msg, err := c.pack.Unpack(head)
+	if err != nil {
+		return nil, err
+	}
+
+	data := make([]byte, msg.GetDataLen())
+	if _, err = io.ReadFull(c.conn, data); err != nil {
+		return nil, err
+	}
+	msg.SetData(data)
+
+	return msg, nil
+}
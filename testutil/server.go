@@ -0,0 +1,91 @@
+/**
+* @File: server.go
+* @Author: Jason Woo
+* @Date: 2026/10/16 13:09
+**/
+
+// Package testutil 针对真实tcp链路编写集成测试的辅助工具
+// StartTestServer在随机端口上启动服务器并返回已经连接的测试客户端，测试结束时自动停止:
+//
+//	s, client := testutil.StartTestServer(t, map[uint32]fastnet.RouterHandler{
+//		1: func(request fastnet.IRequest) { request.SetResponse(request.GetData()) },
+//	})
+//	reply, err := client.Request(1, []byte("ping"), 1, time.Second)
+package testutil
+
+import (
+	"github.com/dyowoo/fastnet"
+	"github.com/dyowoo/fastnet/xconf"
+	"net"
+	"testing"
+	"time"
+)
+
+// 等待服务器开始监听的最长时间
+const listenTimeout = 5 * time.Second
+
+// StartTestServer 在127.0.0.1的随机端口上启动tcp服务器，按MsgID注册handlers，返回服务器和已经连接的测试客户端
+// 服务器使用默认的封包方式，opts可以修改服务器的其他设置，测试结束时关闭客户端并停止服务器
+func StartTestServer(tb testing.TB, handlers map[uint32]fastnet.RouterHandler, opts ...fastnet.Option) (fastnet.IServer, *Client) {
+	tb.Helper()
+
+	s, addr := startServer(tb, handlers, opts...)
+
+	client, err := Dial(addr)
+	if err != nil {
+		tb.Fatalf("dial test server: %v", err)
+	}
+	tb.Cleanup(func() { _ = client.Close() })
+
+	return s, client
+}
+
+// StartTestServerAddr 与StartTestServer相同，但不创建客户端，返回服务器的监听地址，用于测试多个客户端
+func StartTestServerAddr(tb testing.TB, handlers map[uint32]fastnet.RouterHandler, opts ...fastnet.Option) (fastnet.IServer, string) {
+	tb.Helper()
+
+	return startServer(tb, handlers, opts...)
+}
+
+func startServer(tb testing.TB, handlers map[uint32]fastnet.RouterHandler, opts ...fastnet.Option) (fastnet.IServer, string) {
+	tb.Helper()
+
+	// 忽略配置中的端口，在随机端口上监听，并得到实际的监听地址
+	listening := make(chan net.Addr, 1)
+	listenErr := make(chan error, 1)
+	listen := func(network, _ string) (net.Listener, error) {
+		ln, err := net.Listen(network, "127.0.0.1:0")
+		if err != nil {
+			listenErr <- err
+			return nil, err
+		}
+		listening <- ln.Addr()
+		return ln, nil
+	}
+
+	opts = append([]fastnet.Option{fastnet.WithListenFunc(listen)}, opts...)
+	s := fastnet.NewUserConfServer(&xconf.Config{
+		Name:     "fastnet-test",
+		Host:     "127.0.0.1",
+		Mode:     xconf.ServerModeTcp,
+		HideLogo: true,
+	}, opts...)
+
+	for msgID, handler := range handlers {
+		s.AddRouterSlices(msgID, handler)
+	}
+
+	s.Start()
+	tb.Cleanup(s.Stop)
+
+	select {
+	case addr := <-listening:
+		return s, addr.String()
+	case err := <-listenErr:
+		tb.Fatalf("test server listen: %v", err)
+		return nil, ""
+	case <-time.After(listenTimeout):
+		tb.Fatal("test server does not start listening")
+		return nil, ""
+	}
+}
@@ -0,0 +1,54 @@
+/**
+* @File: server_test.go
+* @Author: Jason Woo
+* @Date: 2026/10/16 13:09
+**/
+
+package testutil
+
+import (
+	"errors"
+	"github.com/dyowoo/fastnet"
+	"testing"
+	"time"
+)
+
+func TestStartTestServer(t *testing.T) {
+	// 中间件在注册路由之前通过Option添加
+	withPrefix := func(s *fastnet.Server) {
+		s.Use(func(request fastnet.IRequest) {
+			request.GetMessage().SetData(append([]byte("mw:"), request.GetData()...))
+			request.Next()
+		})
+	}
+
+	_, client := StartTestServer(t, map[uint32]fastnet.RouterHandler{
+		1: func(request fastnet.IRequest) {
+			request.SetResponse(fastnet.NewMsgPackage(2, request.GetData()))
+		},
+		3: func(request fastnet.IRequest) {
+			_ = request.GetConnection().SendMsg(4, []byte("other"))
+			request.SetResponse(fastnet.NewMsgPackage(5, nil))
+		},
+	}, withPrefix)
+
+	reply, err := client.Request(1, []byte("ping"), 2, time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(reply.GetData()) != "mw:ping" {
+		t.Fatalf("reply = %q, want %q", reply.GetData(), "mw:ping")
+	}
+
+	// 等待回复时先收到的其他消息保留给之后的Await
+	if _, err = client.Request(3, nil, 5, time.Second); err != nil {
+		t.Fatal(err)
+	}
+	if msg, err := client.Await(4, time.Second); err != nil || string(msg.GetData()) != "other" {
+		t.Fatalf("Await(4) = %v, %v", msg, err)
+	}
+
+	if _, err = client.Await(6, 50*time.Millisecond); !errors.Is(err, ErrAwaitTimeout) {
+		t.Fatalf("Await without reply err = %v, want ErrAwaitTimeout", err)
+	}
+}
@@ -7,7 +7,6 @@
 package fastnet
 
 import (
-	"bytes"
 	"encoding/binary"
 	"math"
 )
@@ -18,10 +17,25 @@ type TLVDecoder struct {
 	Tag    uint32 //T
 	Length uint32 //L
 	Value  []byte //V
+	order  binary.ByteOrder
 }
 
-func NewTLVDecoder() IDecoder {
-	return &TLVDecoder{}
+// NewTLVDecoder TLV解码器
+// order 包头的字节序，不传时使用大端，需与对端使用的DataPack字节序一致
+func NewTLVDecoder(order ...binary.ByteOrder) IDecoder {
+	tlv := &TLVDecoder{order: binary.BigEndian}
+	if len(order) > 0 && order[0] != nil {
+		tlv.order = order[0]
+	}
+
+	return tlv
+}
+
+func (tlv *TLVDecoder) byteOrder() binary.ByteOrder {
+	if tlv.order == nil {
+		return binary.BigEndian
+	}
+	return tlv.order
 }
 
 func (tlv *TLVDecoder) GetLengthField() *LengthField {
@@ -46,16 +60,17 @@ func (tlv *TLVDecoder) GetLengthField() *LengthField {
 		LengthFieldLength:   4,
 		LengthAdjustment:    0,
 		InitialBytesToStrip: 0,
+		Order:               tlv.byteOrder(),
 	}
 }
 
 func (tlv *TLVDecoder) decode(data []byte) *TLVDecoder {
-	tlvData := TLVDecoder{}
-	tlvData.Tag = binary.BigEndian.Uint32(data[0:4])
-	tlvData.Length = binary.BigEndian.Uint32(data[4:8])
+	order := tlv.byteOrder()
+	tlvData := TLVDecoder{order: order}
+	tlvData.Tag = order.Uint32(data[0:4])
+	tlvData.Length = order.Uint32(data[4:8])
 	tlvData.Value = make([]byte, tlvData.Length)
-
-	_ = binary.Read(bytes.NewBuffer(data[8:8+tlvData.Length]), binary.BigEndian, tlvData.Value)
+	copy(tlvData.Value, data[8:8+tlvData.Length])
 
 	return &tlvData
 }
@@ -68,8 +83,9 @@ func (tlv *TLVDecoder) Intercept(chain IChain) IcResp {
 
 	data := message.GetData()
 
-	// 读取的数据不超过包头，直接进入下一层
-	if len(data) < TlvHeaderSize {
+	// 读取的数据不超过包头，或者不足一个完整的包(没有经过断粘包解码器)，上报后直接进入下一层
+	if len(data) < TlvHeaderSize || uint64(len(data)) < TlvHeaderSize+uint64(tlv.byteOrder().Uint32(data[4:8])) {
+		ReportDecodeError(chain.Request(), ErrIncompleteFrame, data)
 		return chain.ProceedWithIMessage(message, nil)
 	}
 
@@ -81,5 +97,9 @@ func (tlv *TLVDecoder) Intercept(chain IChain) IcResp {
 	message.SetDataLen(tlvData.Length)
 
 	// 将解码后的数据进入下一层
-	return chain.ProceedWithIMessage(message, *tlvData)
+	return proceedDecoded(chain, message, *tlvData, &DecodeResult{
+		MsgID: tlvData.Tag,
+		Body:  tlvData.Value,
+		Raw:   data,
+	})
 }
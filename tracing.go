@@ -0,0 +1,78 @@
+/**
+* @File: tracing.go
+* @Author: Jason Woo
+* @Date: 2026/10/16 11:57
+**/
+
+package fastnet
+
+import (
+	"context"
+	"fmt"
+)
+
+// ISpan 链路追踪的span
+type ISpan interface {
+	RecordError(err error) // 记录错误，span的状态标记为失败
+	End()                  // 结束span
+}
+
+// ITracer 链路追踪的适配接口，框架本身不依赖任何追踪库，可以使用OpenTelemetry等实现该接口
+type ITracer interface {
+	Extract(ctx context.Context, request IRequest) context.Context   // 从消息(例如消息头中的追踪字段)中提取上游的span信息放入ctx，没有时原样返回ctx
+	Start(ctx context.Context, name string) (context.Context, ISpan) // 以ctx中的span为父span开始一个新的span
+}
+
+type spanKey struct{}
+
+// ContextWithSpan 将span放入ctx，ITracer的实现可以使用该方法，处理函数通过SpanFromContext获取
+func ContextWithSpan(ctx context.Context, span ISpan) context.Context {
+	return context.WithValue(ctx, spanKey{}, span)
+}
+
+// SpanFromContext 获取ctx中当前的span，没有时返回一个不做任何事情的span
+func SpanFromContext(ctx context.Context) ISpan {
+	if span, ok := ctx.Value(spanKey{}).(ISpan); ok {
+		return span
+	}
+	return noopSpan{}
+}
+
+type noopSpan struct{}
+
+func (noopSpan) RecordError(error) {}
+func (noopSpan) End()              {}
+
+// TracingMiddleware 为每条消息开始一个span，span名称为消息ID注册的名称，处理函数全部执行完成后结束
+// span放在request.Context()中，处理函数可以以它为父span创建子span，或通过SpanFromContext记录错误
+// 处理函数发生panic或处理超时时记录到span中，panic会继续向上抛出交给panic回调处理
+//
+//	s.Use(fastnet.TracingMiddleware(tracer))
+func TracingMiddleware(tracer ITracer) RouterHandler {
+	return func(request IRequest) {
+		setter, ok := request.(requestContextSetter)
+		if !ok {
+			request.Next()
+			return
+		}
+
+		ctx := tracer.Extract(request.Context(), request)
+		ctx, span := tracer.Start(ctx, MsgName(request.GetMsgID()))
+		setter.setContext(ContextWithSpan(ctx, span))
+
+		defer func() {
+			if err := recover(); err != nil {
+				span.RecordError(fmt.Errorf("panic: %v", err))
+				span.End()
+				panic(err)
+			}
+
+			if err := request.Context().Err(); err != nil {
+				span.RecordError(err)
+			}
+			span.End()
+		}()
+
+		request.Next()
+	}
+}
@@ -0,0 +1,84 @@
+/**
+* @File: tracing_test.go
+* @Author: Jason Woo
+* @Date: 2026/10/16 11:57
+**/
+
+package fastnet
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+)
+
+type traceParentKey struct{}
+
+type testSpan struct {
+	name   string
+	parent string
+	errs   []error
+	ended  bool
+}
+
+func (s *testSpan) RecordError(err error) { s.errs = append(s.errs, err) }
+func (s *testSpan) End()                  { s.ended = true }
+
+type testTracer struct {
+	lock  sync.Mutex
+	spans []*testSpan
+}
+
+// 测试中使用消息数据作为上游的span信息
+func (t *testTracer) Extract(ctx context.Context, request IRequest) context.Context {
+	return context.WithValue(ctx, traceParentKey{}, string(request.GetData()))
+}
+
+func (t *testTracer) Start(ctx context.Context, name string) (context.Context, ISpan) {
+	parent, _ := ctx.Value(traceParentKey{}).(string)
+	span := &testSpan{name: name, parent: parent}
+
+	t.lock.Lock()
+	t.spans = append(t.spans, span)
+	t.lock.Unlock()
+
+	return ctx, span
+}
+
+func TestTracingMiddleware(t *testing.T) {
+	s := NewServer().(*Server)
+	mh := s.GetMsgHandler().(*MsgHandle)
+	tracer := &testTracer{}
+	mh.Use(TracingMiddleware(tracer))
+
+	errFailed := errors.New("failed")
+	RegisterMsgName(101, "TraceLogin")
+	mh.AddRouterSlices(101, func(request IRequest) {
+		SpanFromContext(request.Context()).RecordError(errFailed)
+	})
+	mh.AddRouterSlices(102, func(request IRequest) {
+		panic("boom")
+	})
+
+	local := newTestRequest(t, s, 0).GetConnection()
+	mh.doMsgHandlerSlices(NewRequest(local, NewMsgPackage(101, []byte("parent-1"))), 0)
+	mh.doMsgHandlerSlices(NewRequest(local, NewMsgPackage(102, nil)), 0)
+
+	if len(tracer.spans) != 2 {
+		t.Fatalf("span count = %d, want 2", len(tracer.spans))
+	}
+
+	login := tracer.spans[0]
+	if login.name != "TraceLogin" || login.parent != "parent-1" || !login.ended {
+		t.Fatalf("unexpected span: %+v", login)
+	}
+	if len(login.errs) != 1 || login.errs[0] != errFailed {
+		t.Fatalf("span errors = %v, want [%v]", login.errs, errFailed)
+	}
+
+	panicked := tracer.spans[1]
+	if !panicked.ended || len(panicked.errs) != 1 {
+		t.Fatalf("panic should be recorded on the span: %+v", panicked)
+	}
+}
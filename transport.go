@@ -0,0 +1,17 @@
+/**
+* @File: transport.go
+* @Author: Jason Woo
+* @Date: 2026/10/16 23:05
+**/
+
+package fastnet
+
+import "net"
+
+// ListenFunc 自定义创建监听的方法，签名与net.Listen相同
+// 可以用于代理、内存网络等特殊环境，或在测试中替换真实的网络
+type ListenFunc func(network, address string) (net.Listener, error)
+
+// DialFunc 自定义建立链接的方法，签名与net.Dial相同
+// 可以用于通过SOCKS代理等方式连接服务器，或在测试中返回net.Pipe的一端
+type DialFunc func(network, address string) (net.Conn, error)
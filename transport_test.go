@@ -0,0 +1,98 @@
+/**
+* @File: transport_test.go
+* @Author: Jason Woo
+* @Date: 2026/10/16 23:15
+**/
+
+package fastnet
+
+import (
+	"net"
+	"sync"
+	"testing"
+	"time"
+)
+
+// pipeListener 使用net.Pipe的内存监听，不占用真实的端口
+type pipeListener struct {
+	conns chan net.Conn
+	done  chan struct{}
+	once  sync.Once
+}
+
+func newPipeListener() *pipeListener {
+	return &pipeListener{conns: make(chan net.Conn), done: make(chan struct{})}
+}
+
+func (l *pipeListener) Accept() (net.Conn, error) {
+	select {
+	case conn := <-l.conns:
+		return conn, nil
+	case <-l.done:
+		return nil, net.ErrClosed
+	}
+}
+
+func (l *pipeListener) Close() error {
+	l.once.Do(func() { close(l.done) })
+	return nil
+}
+
+func (l *pipeListener) Addr() net.Addr {
+	return &net.TCPAddr{IP: net.IPv4(127, 0, 0, 1)}
+}
+
+func (l *pipeListener) Dial(_, _ string) (net.Conn, error) {
+	local, remote := net.Pipe()
+	select {
+	case l.conns <- remote:
+		return local, nil
+	case <-l.done:
+		return nil, net.ErrClosed
+	}
+}
+
+func TestListenAndDialFunc(t *testing.T) {
+	ln := newPipeListener()
+	defer func() { _ = ln.Close() }()
+
+	s := NewServer(WithListenFunc(func(_, _ string) (net.Listener, error) {
+		return ln, nil
+	})).(*Server)
+	s.AddRouterSlices(1, func(request IRequest) {
+		_ = request.GetConnection().SendMsg(2, request.GetData())
+	})
+	s.Start()
+	defer s.Stop()
+
+	replies := make(chan string, 1)
+	c := NewClient("127.0.0.1", 1, WithDialFunc(ln.Dial))
+	c.AddRouterSlices(2, func(request IRequest) {
+		replies <- string(request.GetData())
+	})
+	connected := make(chan IConnection, 1)
+	c.SetOnConnStart(func(conn IConnection) {
+		connected <- conn
+	})
+	c.Start()
+
+	select {
+	case conn := <-connected:
+		if err := conn.SendMsg(1, []byte("hello")); err != nil {
+			t.Fatal(err)
+		}
+	case err := <-c.GetErrChan():
+		t.Fatal(err)
+	case <-time.After(time.Second):
+		t.Fatal("client not connected")
+	}
+
+	select {
+	case reply := <-replies:
+		if reply != "hello" {
+			t.Fatalf("reply = %q, want hello", reply)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("no reply from server")
+	}
+}
@@ -0,0 +1,29 @@
+/**
+* @File: typed_router.go
+* @Author: Jason Woo
+* @Date: 2026/10/16 11:56
+**/
+
+package fastnet
+
+// TypedRouterHandler 类型化的业务处理函数，data是使用编解码器解析后的消息数据
+type TypedRouterHandler[T any] func(request IRequest, data T)
+
+// AddTypedRouter 添加类型化的切片路由，消息数据按编码类型选择编解码器(没有编码类型时使用mh的编解码器)解析为T后再调用handler
+// 解析失败时交给SetBindErrorHandler设置的回调处理，并终止后续的处理函数，handler不会被调用
+//
+//	fastnet.AddTypedRouter(s.GetMsgHandler(), 1, func(request fastnet.IRequest, req LoginReq) {
+//		...
+//	})
+func AddTypedRouter[T any](mh IMsgHandle, msgID uint32, handler TypedRouterHandler[T]) IRouterSlices {
+	return mh.AddRouterSlices(msgID, func(request IRequest) {
+		var data T
+		if err := bindData(mh, request, &data); err != nil {
+			mh.HandleBindError(request, err)
+			request.Abort()
+			return
+		}
+
+		handler(request, data)
+	})
+}
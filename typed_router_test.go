@@ -0,0 +1,184 @@
+/**
+* @File: typed_router_test.go
+* @Author: Jason Woo
+* @Date: 2026/10/16 11:56
+**/
+
+package fastnet
+
+import (
+	"errors"
+	"net"
+	"testing"
+	"time"
+)
+
+type loginReq struct {
+	Name string `json:"name"`
+}
+
+func TestAddTypedRouter(t *testing.T) {
+	s := NewServer().(*Server)
+	mh := s.GetMsgHandler().(*MsgHandle)
+	mh.StartWorkerPool()
+	defer mh.StopWorkerPool()
+
+	names := make(chan string, 1)
+	AddTypedRouter(mh, 1, func(request IRequest, req loginReq) {
+		names <- req.Name
+	})
+	mh.SetBindErrorHandler(BindErrorReply(99))
+
+	conn, remote := newPipeConn(t, s, 1)
+
+	mh.Execute(NewRequest(conn, NewMsgPackage(1, []byte(`{"name":"fastnet"}`))))
+	select {
+	case name := <-names:
+		if name != "fastnet" {
+			t.Fatalf("name = %q, want fastnet", name)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("typed handler is not called")
+	}
+
+	// 解析失败时回复错误信息，处理函数不会被调用
+	mh.Execute(NewRequest(conn, NewMsgPackage(1, []byte("not json"))))
+	reply := readReply(t, s, remote)
+	if reply.GetMsgID() != 99 || len(reply.GetData()) == 0 {
+		t.Fatalf("unexpected bind error reply: msgID = %d, data = %q", reply.GetMsgID(), reply.GetData())
+	}
+	select {
+	case name := <-names:
+		t.Fatalf("typed handler should not be called, got %q", name)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+// 将消息数据原样作为名称的编解码器，用于区分是否使用了SetCodec设置的编解码器
+type rawNameCodec struct{}
+
+func (rawNameCodec) Marshal(v interface{}) ([]byte, error) {
+	return []byte(v.(*loginReq).Name), nil
+}
+
+func (rawNameCodec) Unmarshal(data []byte, v interface{}) error {
+	v.(*loginReq).Name = "raw:" + string(data)
+	return nil
+}
+
+func TestBindByContentType(t *testing.T) {
+	header := ProtocolHeader{Magic: []byte("FN"), Version: 1, ContentType: true}
+	s := NewServer().(*Server)
+	s.SetPacket(NewDataPackWithHeader(header))
+	s.SetDecoder(NewTLVDecoderWithHeader(header))
+	s.AddInterceptor(s.GetDecoder())
+	mh := s.GetMsgHandler().(*MsgHandle)
+	mh.SetCodec(rawNameCodec{})
+	mh.StartWorkerPool()
+	defer mh.StopWorkerPool()
+
+	type result struct {
+		name string
+		err  error
+	}
+	results := make(chan result, 1)
+	mh.AddRouterSlices(1, func(request IRequest) {
+		var req loginReq
+		err := request.Bind(&req)
+		results <- result{req.Name, err}
+	})
+
+	local, remote := net.Pipe()
+	defer remote.Close()
+	startTestConn(t, s, local, 1)
+
+	cases := []struct {
+		contentType ContentType
+		data        string
+		want        string
+		err         error
+	}{
+		{ContentTypeDefault, "fastnet", "raw:fastnet", nil},
+		{ContentTypeJSON, `{"name":"fastnet"}`, "fastnet", nil},
+		{ContentType(250), "fastnet", "", ErrUnknownContentType},
+	}
+	for _, c := range cases {
+		msg := NewMsgPackage(1, []byte(c.data))
+		msg.SetContentType(c.contentType)
+		packed, err := s.GetPacket().Pack(msg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if packed[3] != byte(c.contentType) {
+			t.Fatalf("packed content type = %d, want %d", packed[3], c.contentType)
+		}
+		if _, err = remote.Write(packed); err != nil {
+			t.Fatal(err)
+		}
+
+		select {
+		case r := <-results:
+			if r.name != c.want || !errors.Is(r.err, c.err) {
+				t.Fatalf("content type %d: name = %q, err = %v, want %q, %v", c.contentType, r.name, r.err, c.want, c.err)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("content type %d: message is not routed", c.contentType)
+		}
+	}
+
+	unpacked, err := s.GetPacket().Unpack([]byte{'F', 'N', 1, byte(ContentTypeJSON), 0, 0, 0, 1, 0, 0, 0, 0})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if MsgContentType(unpacked) != ContentTypeJSON {
+		t.Fatalf("unpacked content type = %d, want %d", MsgContentType(unpacked), ContentTypeJSON)
+	}
+}
+
+func TestReplyTypedUsesRequestContentType(t *testing.T) {
+	header := ProtocolHeader{Magic: []byte("FN"), Version: 1, ContentType: true}
+	s := NewServer().(*Server)
+	s.SetPacket(NewDataPackWithHeader(header))
+	s.SetDecoder(NewTLVDecoderWithHeader(header))
+	s.AddInterceptor(s.GetDecoder())
+	mh := s.GetMsgHandler().(*MsgHandle)
+	mh.SetCodec(rawNameCodec{})
+	mh.StartWorkerPool()
+	defer mh.StopWorkerPool()
+
+	mh.AddRouterSlices(1, func(request IRequest) {
+		if err := ReplyTyped(request, 2, &loginReq{Name: "ok"}); err != nil {
+			t.Error(err)
+		}
+	})
+
+	local, remote := net.Pipe()
+	defer remote.Close()
+	startTestConn(t, s, local, 1)
+
+	cases := []struct {
+		contentType ContentType
+		data        string
+		want        string
+	}{
+		{ContentTypeJSON, `{"name":"fastnet"}`, `{"name":"ok"}`},
+		{ContentTypeDefault, "fastnet", "ok"},
+	}
+	for _, c := range cases {
+		msg := NewMsgPackage(1, []byte(c.data))
+		msg.SetContentType(c.contentType)
+		packed, err := s.GetPacket().Pack(msg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err = remote.Write(packed); err != nil {
+			t.Fatal(err)
+		}
+
+		_ = remote.SetReadDeadline(time.Now().Add(time.Second))
+		reply := readReply(t, s, remote)
+		if MsgContentType(reply) != c.contentType || string(reply.GetData()) != c.want {
+			t.Fatalf("reply = %d %q, want %d %q", MsgContentType(reply), reply.GetData(), c.contentType, c.want)
+		}
+	}
+}
@@ -0,0 +1,143 @@
+/**
+* @File: varint_decoder.go
+* @Author: Jason Woo
+* @Date: 2026/10/16 18:25
+**/
+
+package fastnet
+
+import (
+	"fmt"
+	"github.com/dyowoo/fastnet/xlog"
+	"sync"
+)
+
+// VarintDecoder 与FastDataPackVarint封包方式配套的解码器
+// 使用方式:
+//
+//	s.SetPacket(Factory().NewPack(FastDataPackVarint))
+//	s.SetDecoder(NewVarintDecoder())
+type VarintDecoder struct {
+	MsgID  uint32 // 消息ID
+	Length uint32 // 数据长度
+	Value  []byte // 数据
+}
+
+func NewVarintDecoder() IDecoder {
+	return &VarintDecoder{}
+}
+
+// GetLengthField varint包头长度不固定，无法用LengthField描述，断粘包由NewFrameDecoder创建的解码器处理
+func (vd *VarintDecoder) GetLengthField() *LengthField {
+	return nil
+}
+
+// NewFrameDecoder 为每个链接创建varint格式的断粘包解码器
+func (vd *VarintDecoder) NewFrameDecoder() IFrameDecoder {
+	return &VarintFrameDecoder{}
+}
+
+func (vd *VarintDecoder) Intercept(chain IChain) IcResp {
+	message := chain.GetIMessage()
+	if message == nil {
+		return chain.ProceedWithIMessage(message, nil)
+	}
+
+	data := message.GetData()
+
+	// 帧的长度已经由断粘包解码器按MaxPacketSize检查过
+	msgID, dataLen, headLen, err := decodeVarintHead(data, 0)
+	// 数据不是一个完整的包，上报后直接进入下一层
+	if err == errVarintNeedMore || (err == nil && len(data) < headLen+int(dataLen)) {
+		err = ErrIncompleteFrame
+	}
+	if err != nil {
+		ReportDecodeError(chain.Request(), err, data)
+		return chain.ProceedWithIMessage(message, nil)
+	}
+
+	varintData := VarintDecoder{
+		MsgID:  msgID,
+		Length: dataLen,
+		Value:  data[headLen : headLen+int(dataLen)],
+	}
+
+	// 将解码后的数据重新设置到IMessage中, Router需要MsgID来寻址
+	message.SetMsgID(varintData.MsgID)
+	message.SetData(varintData.Value)
+	message.SetDataLen(varintData.Length)
+
+	// 将解码后的数据进入下一层
+	return proceedDecoded(chain, message, varintData, &DecodeResult{
+		MsgID: varintData.MsgID,
+		Body:  varintData.Value,
+		Raw:   data,
+	})
+}
+
+// VarintFrameDecoder varint包头的断粘包解码器
+// 跨多次读取累积数据，逐步解析包头，每凑齐一个完整的包就输出一帧(包含包头)
+type VarintFrameDecoder struct {
+	boundConfig
+	in     []byte
+	lock   sync.Mutex
+	onDrop func(reason string) // 丢弃非法数据时的通知
+}
+
+// SetDropHandler 设置丢弃非法数据时的通知
+func (d *VarintFrameDecoder) SetDropHandler(handler func(reason string)) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	d.onDrop = handler
+}
+
+// Buffered 当前累积的尚未组成完整包的字节数
+func (d *VarintFrameDecoder) Buffered() int {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	return len(d.in)
+}
+
+func (d *VarintFrameDecoder) copiesFrames() bool { return true }
+
+func (d *VarintFrameDecoder) Decode(buff []byte) [][]byte {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	if d.in == nil {
+		d.in = d.newFrameBuff()
+	}
+	d.in = append(d.in, buff...)
+	resp := make([][]byte, 0)
+
+	for len(d.in) > 0 {
+		_, dataLen, headLen, err := decodeVarintHead(d.in, d.conf().MaxPacketSize)
+		if err == errVarintNeedMore {
+			break
+		}
+		if err != nil {
+			// 包头非法时无法再找到下一个包的边界，丢弃已缓存的全部数据
+			xlog.ErrorF("varint frame decode error: %v, discard %d bytes", err, len(d.in))
+			if d.onDrop != nil {
+				d.onDrop(fmt.Sprintf("invalid varint head: %v, discard %d bytes", err, len(d.in)))
+			}
+			d.in = nil
+			break
+		}
+
+		frameLen := headLen + int(dataLen)
+		if len(d.in) < frameLen {
+			// 半包，等待后续数据
+			break
+		}
+
+		frame := make([]byte, frameLen)
+		copy(frame, d.in[:frameLen])
+		resp = append(resp, frame)
+		d.in = d.in[frameLen:]
+	}
+
+	return resp
+}
@@ -0,0 +1,78 @@
+/**
+* @File: worker_affinity.go
+* @Author: Jason Woo
+* @Date: 2026/10/16 13:03
+**/
+
+package fastnet
+
+import "hash/fnv"
+
+// worker亲和：同一个客户端身份(例如握手时得到的用户ID)重连后尽量分配到之前的worker，
+// 保留worker中为该客户端缓存的状态，需要在握手函数或OnConnStart中设置:
+//
+//	s.SetOnConnStart(func(conn IConnection) {
+//		SetWorkerAffinityKey(conn, userID)
+//	})
+//
+// Bind模式下优先使用该key上次绑定的worker，该worker正被其他链接占用时分配任意空闲worker
+// Hash模式下按key取余分配worker，相同的key总是分配到同一个worker
+
+// 保存worker亲和key的链接属性
+const workerAffinityProperty = "fastnet.workerAffinityKey"
+
+// SetWorkerAffinityKey 设置链接的worker亲和key，需要在链接分配worker之前(握手函数或OnConnStart中)调用
+func SetWorkerAffinityKey(conn IConnection, key string) {
+	conn.SetProperty(workerAffinityProperty, key)
+}
+
+// 获取链接的worker亲和key，没有设置时返回""
+func workerAffinityKey(conn IConnection) string {
+	value, err := conn.GetProperty(workerAffinityProperty)
+	if err != nil {
+		return ""
+	}
+
+	key, _ := value.(string)
+	return key
+}
+
+// 取出key上次绑定且当前空闲的worker，调用方需持有freeWorkerMu
+func (mh *MsgHandle) takeAffinityWorker(key string) (uint32, bool) {
+	workerID, ok := mh.affinityWorkers[key]
+	if !ok {
+		return 0, false
+	}
+	if _, free := mh.freeWorkers[workerID]; !free {
+		return 0, false
+	}
+
+	delete(mh.freeWorkers, workerID)
+	return workerID, true
+}
+
+// 记录key绑定的worker，该worker之前绑定的key失效，调用方需持有freeWorkerMu
+// 每个worker只记录最近一次绑定的key，记录的数量不超过worker的数量
+func (mh *MsgHandle) rememberAffinity(workerID uint32, key string) {
+	if mh.affinityWorkers == nil {
+		mh.affinityWorkers = make(map[string]uint32)
+		mh.workerAffinity = make(map[uint32]string)
+	}
+
+	if old, ok := mh.workerAffinity[workerID]; ok && mh.affinityWorkers[old] == workerID {
+		delete(mh.affinityWorkers, old)
+	}
+	if old, ok := mh.affinityWorkers[key]; ok && old != workerID {
+		delete(mh.workerAffinity, old)
+	}
+
+	mh.affinityWorkers[key] = workerID
+	mh.workerAffinity[workerID] = key
+}
+
+// 按key计算worker，相同的key总是得到相同的结果
+func affinityHash(key string) uint32 {
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(key))
+	return h.Sum32()
+}
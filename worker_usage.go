@@ -0,0 +1,171 @@
+/**
+* @File: worker_usage.go
+* @Author: Jason Woo
+* @Date: 2026/10/16 12:26
+**/
+
+package fastnet
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	UtilizationWindow         = 10 * time.Second // 统计worker使用率和平均队列积压的时间窗口
+	utilizationSampleInterval = time.Second      // 采样队列积压和累计处理时间的间隔
+)
+
+// WorkerUtilization worker工作池的使用情况，用于判断是否需要调整WorkerPoolSize
+type WorkerUtilization struct {
+	Total         int           // worker数量，没有启动工作池时为0
+	Busy          int           // 当前正在处理消息的worker数量，其余worker在等待队列中的消息
+	QueueDepth    int           // 当前所有worker任务队列中等待处理的消息总数
+	BusyRatio     float64       // 窗口内worker处理消息的时间占总时间的比例 0~1，持续接近1说明worker不足
+	AvgQueueDepth float64       // 窗口内平均每个worker任务队列中等待处理的消息数量
+	Window        time.Duration // 实际统计的窗口长度，工作池刚启动时小于UtilizationWindow
+}
+
+// 一次采样的结果
+type usageSample struct {
+	at         time.Time
+	busyNanos  int64 // 所有worker累计处理消息的时间
+	queueDepth int   // 所有worker任务队列中等待处理的消息总数
+}
+
+// workerUsage 记录每个worker是否正在处理消息，以及累计处理消息的时间，字段只通过原子操作访问
+type workerUsage struct {
+	busySince []int64 // 每个worker开始处理当前消息的时间(UnixNano)，为0时在等待队列中的消息
+	busyNanos []int64 // 每个worker已经处理完成的消息的累计耗时
+
+	lock    sync.Mutex
+	samples []usageSample // 窗口内的采样，按时间顺序排列
+}
+
+func newWorkerUsage(workerPoolSize uint32) workerUsage {
+	return workerUsage{
+		busySince: make([]int64, workerPoolSize),
+		busyNanos: make([]int64, workerPoolSize),
+	}
+}
+
+// begin worker从队列中取出消息开始处理
+func (u *workerUsage) begin(workerID int) int64 {
+	if workerID < 0 || workerID >= len(u.busySince) {
+		return 0
+	}
+	now := time.Now().UnixNano()
+	atomic.StoreInt64(&u.busySince[workerID], now)
+	return now
+}
+
+// end worker处理完消息，重新开始等待队列中的消息
+func (u *workerUsage) end(workerID int, since int64) {
+	if since == 0 {
+		return
+	}
+	atomic.AddInt64(&u.busyNanos[workerID], time.Now().UnixNano()-since)
+	atomic.StoreInt64(&u.busySince[workerID], 0)
+}
+
+// 统计当前正在处理消息的worker数量，以及包括正在处理的消息在内的累计处理时间
+func (u *workerUsage) current(now time.Time) (busy int, busyNanos int64) {
+	for i := range u.busySince {
+		busyNanos += atomic.LoadInt64(&u.busyNanos[i])
+		if since := atomic.LoadInt64(&u.busySince[i]); since != 0 {
+			busy++
+			if d := now.UnixNano() - since; d > 0 {
+				busyNanos += d
+			}
+		}
+	}
+
+	return busy, busyNanos
+}
+
+// 记录一次采样，丢弃超出窗口的采样
+func (u *workerUsage) sample(s usageSample) {
+	u.lock.Lock()
+	defer u.lock.Unlock()
+
+	u.samples = append(u.samples, s)
+	drop := 0
+	for drop < len(u.samples)-1 && s.at.Sub(u.samples[drop].at) > UtilizationWindow {
+		drop++
+	}
+	u.samples = u.samples[drop:]
+}
+
+// WorkerUtilization 获取worker工作池的使用情况，BusyRatio和AvgQueueDepth按UtilizationWindow窗口统计
+// 只统计工作池中的worker，WorkerPoolSize为0时返回零值
+func (mh *MsgHandle) WorkerUtilization() WorkerUtilization {
+	total := len(mh.usage.busySince)
+	if total == 0 {
+		return WorkerUtilization{}
+	}
+
+	now := time.Now()
+	busy, busyNanos := mh.usage.current(now)
+	queueDepth := mh.totalQueueDepth()
+	result := WorkerUtilization{Total: total, Busy: busy, QueueDepth: queueDepth}
+
+	mh.usage.lock.Lock()
+	samples := append([]usageSample(nil), mh.usage.samples...)
+	mh.usage.lock.Unlock()
+	if len(samples) == 0 {
+		result.AvgQueueDepth = float64(queueDepth) / float64(total)
+		return result
+	}
+
+	first := samples[0]
+	result.Window = now.Sub(first.at)
+	if result.Window > 0 {
+		ratio := float64(busyNanos-first.busyNanos) / float64(int64(result.Window)*int64(total))
+		if ratio > 1 {
+			ratio = 1
+		}
+		if ratio > 0 {
+			result.BusyRatio = ratio
+		}
+	}
+
+	depthSum := queueDepth
+	for _, s := range samples {
+		depthSum += s.queueDepth
+	}
+	result.AvgQueueDepth = float64(depthSum) / float64(len(samples)+1) / float64(total)
+
+	return result
+}
+
+// 所有worker任务队列中等待处理的消息总数
+func (mh *MsgHandle) totalQueueDepth() int {
+	depth := 0
+	for workerID := uint32(0); workerID < mh.workerPoolSize; workerID++ {
+		depth += mh.WorkerQueueDepth(workerID)
+	}
+
+	return depth
+}
+
+// 工作池运行期间定时采样，exit关闭后退出
+func (mh *MsgHandle) sampleUsage(exit chan struct{}) {
+	ticker := time.NewTicker(utilizationSampleInterval)
+	defer ticker.Stop()
+
+	for {
+		mh.takeUsageSample()
+		select {
+		case <-ticker.C:
+		case <-exit:
+			return
+		}
+	}
+}
+
+func (mh *MsgHandle) takeUsageSample() {
+	now := time.Now()
+	_, busyNanos := mh.usage.current(now)
+	mh.usage.sample(usageSample{at: now, busyNanos: busyNanos, queueDepth: mh.totalQueueDepth()})
+}
@@ -7,45 +7,79 @@
 package fastnet
 
 import (
+	"bytes"
 	"context"
 	"encoding/hex"
 	"errors"
+	"fmt"
 	"github.com/dyowoo/fastnet/xconf"
 	"github.com/dyowoo/fastnet/xlog"
 	"github.com/gorilla/websocket"
 	"net"
+	"net/http"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
 // WsConnection Websocket连接模块, 用于处理 Websocket 连接的读写业务 一个连接对应一个Connection
 type WsConnection struct {
+	bytes            byteCounter            // 当前链接的收发字节数，原子操作访问，需放在结构体开头
+	totalBytes       *byteCounter           // 所属Server的收发字节数，Client的链接为nil
 	conn             *websocket.Conn        // 当前连接的socket TCP套接字
 	connID           uint64                 // 当前连接的ID
 	workerID         uint32                 // 负责处理该链接的workerID
 	msgHandler       IMsgHandle             // 消息管理MsgID和对应处理方法的消息管理模块
+	config           *xconf.Config          // 链接使用的配置，服务端链接为所属Server的配置，客户端链接为全局配置
 	ctx              context.Context        // 告知该链接已经退出
 	cancel           context.CancelFunc     // 停止的channel
 	msgBuffChan      chan []byte            // 有缓冲管道，用于读、写两个goroutine之间的消息通信
 	msgLock          sync.RWMutex           // 用户收发消息的Lock
+	writerOnce       sync.Once              // 保证有缓冲管道和写协程只创建一次
 	property         map[string]interface{} // 链接属性
 	propertyLock     sync.Mutex             // 保护当前property的锁
 	isClosed         bool                   // 当前连接的关闭状态
 	connManager      IConnManager           // 当前链接是属于哪个Connection Manager的
 	onConnStart      func(conn IConnection) // 当前连接创建时Hook函数
 	onConnStop       func(conn IConnection) // 当前连接断开时的Hook函数
+	onConnStopE      ConnStopReasonFunc     // 当前连接断开时带关闭原因的Hook函数
+	closeReason      closeReason            // 链接关闭的原因
+	ping             pingState              // 应用层Ping的状态
+	fragments        fragmentAssembler      // 分片消息的还原器
+	shaper           sendShaper             // 有缓冲发送的限速
 	packet           IDataPack              // 数据报文封包方式
-	lastActivityTime time.Time              // 最后一次活动时间
+	lastActivityTime atomic.Int64           // 最后一次活动时间(UnixNano)，读协程、心跳协程和Resume会并发访问
 	frameDecoder     IFrameDecoder          // 断粘包解码器
 	heartbeatChecker IHeartbeatChecker      // 心跳检测器
 	name             string                 // 链接名称，默认与创建链接的Server/Client的Name一致
 	localAddr        string                 // 当前链接的本地地址
 	remoteAddr       string                 // 当前链接的远程地址
+	connectedAt      time.Time              // 链接建立的时间
+	header           http.Header            // 建立链接时的HTTP头
+	httpInfo         *HTTPRequestInfo       // 服务端链接升级请求的信息副本
+	resumeChan       chan struct{}          // 暂停读取时不为nil，恢复读取时关闭
+	pauseLock        sync.Mutex             // 保护resumeChan
+	writeLock        sync.Mutex             // websocket连接不支持并发写，保证同一时刻只有一个协程在写
+	messageType      int32                  // 发送消息默认使用的帧类型，默认为websocket.BinaryMessage
+	handshake        HandshakeFunc          // 读循环启动之前执行的握手函数
+	handshaking      bool                   // 是否正在执行握手函数
+	rejected         bool                   // 握手失败被拒绝的链接不会触发OnConnStop
+	firstMsgPending  bool                   // 是否仍在等待对端第一条完整的消息，设置了FirstMessageTimeout时有效
+	onDecodeError    DecodeErrorFunc        // 解码失败时的回调
+	onFrameDropped   FrameDroppedFunc       // 断粘包丢弃数据时的回调
+	compressor       ICompressor            // 握手时协商的压缩算法，为nil时不压缩
+	sendProgress     flushState             // 有缓冲发送的进度，用于Flush
+	clock            clock                  // 判断链接是否存活使用的时间来源
+	tags             tagSet                 // 不属于ConnManager时链接自己保存的标签
+	recorder         frameRecorder          // 入站帧的录制，默认关闭
+	baseCtx          context.Context        // 链接上下文的父上下文，服务端链接为所属Server的上下文，为nil时使用context.Background()
+	isClient         bool                   // 是否为客户端链接，客户端发送的帧带有掩码，用于统计链路上的字节数
 }
 
 // newServerConn :for Server, 创建一个Server服务端特性的连接的方法
 // Note: 名字由 NewConnection 更变
-func newWebsocketConn(server IServer, conn *websocket.Conn, connID uint64) IConnection {
+// httpInfo 升级为websocket时的HTTP请求信息
+func newWebsocketConn(server IServer, conn *websocket.Conn, connID uint64, httpInfo *HTTPRequestInfo) IConnection {
 	c := &WsConnection{
 		conn:        conn,
 		connID:      connID,
@@ -55,21 +89,39 @@ func newWebsocketConn(server IServer, conn *websocket.Conn, connID uint64) IConn
 		name:        server.ServerName(),
 		localAddr:   conn.LocalAddr().String(),
 		remoteAddr:  conn.RemoteAddr().String(),
+		connectedAt: time.Now(),
+		clock:       systemClock,
+		header:      httpInfo.Header,
+		httpInfo:    httpInfo,
+		messageType: websocket.BinaryMessage,
 	}
 
-	lengthField := server.GetLengthField()
-	if lengthField != nil {
-		c.frameDecoder = NewFrameDecoder(*lengthField)
-	}
+	c.frameDecoder = newFrameDecoderFor(server.GetWsDecoder(), server.GetConfig())
 
 	// 从server继承过来的属性
-	c.packet = server.GetPacket()
+	c.packet = server.GetWsPacket()
+	// JSON信封默认使用文本帧发送，方便浏览器直接处理
+	if _, ok := c.packet.(*JSONEnvelopePack); ok {
+		c.messageType = websocket.TextMessage
+	}
+	c.handshake = server.GetHandshake()
 	c.onConnStart = server.GetOnConnStart()
 	c.onConnStop = server.GetOnConnStop()
+	c.onConnStopE = server.GetOnConnStopE()
+	c.onDecodeError = server.GetOnDecodeError()
+	c.onFrameDropped = server.GetOnFrameDropped()
+	if owner, ok := server.(totalBytesOwner); ok {
+		c.totalBytes = owner.totalBytes()
+	}
 	c.msgHandler = server.GetMsgHandler()
+	c.config = server.GetConfig()
+	c.fragments.config = c.config
+	c.bindFrameDropHandler()
 
 	// 将当前的Connection与Server的ConnManager绑定
 	c.connManager = server.GetConnMgr()
+	// 服务器停止时链接和请求的上下文随之取消
+	c.baseCtx = server.Context()
 
 	// 将新创建的Conn添加到链接管理中
 	server.GetConnMgr().Add(c)
@@ -78,7 +130,8 @@ func newWebsocketConn(server IServer, conn *websocket.Conn, connID uint64) IConn
 }
 
 // newClientConn :for Client, 创建一个Client服务端特性的连接的方法
-func newWsClientConn(client IClient, conn *websocket.Conn) IConnection {
+// header 握手成功时服务端返回的HTTP响应头
+func newWsClientConn(client IClient, conn *websocket.Conn, header http.Header) IConnection {
 	c := &WsConnection{
 		conn:        conn,
 		connID:      0,
@@ -88,18 +141,23 @@ func newWsClientConn(client IClient, conn *websocket.Conn) IConnection {
 		name:        client.GetName(),
 		localAddr:   conn.LocalAddr().String(),
 		remoteAddr:  conn.RemoteAddr().String(),
+		connectedAt: time.Now(),
+		clock:       systemClock,
+		header:      header,
+		messageType: websocket.BinaryMessage,
+		isClient:    true,
 	}
 
-	lengthField := client.GetLengthField()
-	if lengthField != nil {
-		c.frameDecoder = NewFrameDecoder(*lengthField)
-	}
+	c.frameDecoder = newFrameDecoderFor(client.GetDecoder(), client.GetConfig())
 
 	// 从client继承过来的属性
 	c.packet = client.GetPacket()
+	c.handshake = client.GetHandshake()
 	c.onConnStart = client.GetOnConnStart()
 	c.onConnStop = client.GetOnConnStop()
+	c.onConnStopE = client.GetOnConnStopE()
 	c.msgHandler = client.GetMsgHandler()
+	c.config = client.GetConfig()
 
 	return c
 }
@@ -113,14 +171,18 @@ func (c *WsConnection) StartWriter() {
 		select {
 		case data, ok := <-c.msgBuffChan:
 			if ok {
-				if err := c.conn.WriteMessage(websocket.BinaryMessage, data); err != nil {
+				if !c.shaper.wait(c.ctx, len(data)) {
+					return
+				}
+				if err := c.write(c.wsMessageType(), data); err != nil {
 					xlog.ErrorF("send buff data error:, %s conn writer exit", err)
-					break
+					return
 				}
+				c.sendProgress.done()
 
 			} else {
 				xlog.ErrorF("msgBuffChan is closed")
-				break
+				return
 			}
 		case <-c.ctx.Done():
 			return
@@ -128,6 +190,15 @@ func (c *WsConnection) StartWriter() {
 	}
 }
 
+// startWriterOnce 第一次有缓冲发送时创建有缓冲管道并启动写协程，并发的首次发送也只会创建一个
+// 没有调用有缓冲发送的链接不分配管道也不启动写协程，调用方需要持有msgLock的读锁
+func (c *WsConnection) startWriterOnce() {
+	c.writerOnce.Do(func() {
+		c.msgBuffChan = make(chan []byte, c.config.MaxMsgChanLen)
+		go c.StartWriter()
+	})
+}
+
 // StartReader 读消息Goroutine，用于从客户端中读取数据
 func (c *WsConnection) StartReader() {
 	xlog.InfoF("[reader goroutine is running]")
@@ -140,10 +211,16 @@ func (c *WsConnection) StartReader() {
 		case <-c.ctx.Done():
 			return
 		default:
+			// 暂停读取时阻塞等待恢复，未读取的数据保留在系统的接收缓冲区中
+			if !c.waitResume() {
+				return
+			}
+
 			// 从conn的IO中读取数据到内存缓冲buffer中
 			messageType, buffer, err := c.conn.ReadMessage()
 			if err != nil {
-				c.cancel()
+				c.checkFirstMessageTimeout(err)
+				c.StopWithReason(readCloseReason(err))
 				return
 			}
 
@@ -160,6 +237,8 @@ func (c *WsConnection) StartReader() {
 
 			xlog.DebugF("read buffer %s \n", hex.EncodeToString(buffer[0:n]))
 
+			c.addBytesRead(n)
+
 			// 正常读取到对端数据，更新心跳检测Active状态
 			if n > 0 && c.heartbeatChecker != nil {
 				c.updateActivity()
@@ -169,21 +248,28 @@ func (c *WsConnection) StartReader() {
 			if c.frameDecoder != nil {
 				// 为读取到的0-n个字节的数据进行解码
 				bufArrays := c.frameDecoder.Decode(buffer)
+				if c.frameAccumExceeded() || c.frameRejected() {
+					return
+				}
 				if bufArrays == nil {
 					continue
 				}
+				c.firstMessageReceived()
 
 				for _, bytes := range bufArrays {
 					xlog.DebugF("read buffer %s \n", hex.EncodeToString(bytes))
-					msg := NewMessage(uint32(len(bytes)), bytes)
+					c.recorder.record(c.connID, bytes)
+					msg := AcquireMessage(uint32(len(bytes)), bytes)
 					// 得到当前客户端请求的Request数据
-					req := NewRequest(c, msg)
+					req := newWsRequest(c, msg, messageType)
 					c.msgHandler.Execute(req)
 				}
 			} else {
-				msg := NewMessage(uint32(n), buffer[0:n])
+				c.firstMessageReceived()
+				c.recorder.record(c.connID, buffer[0:n])
+				msg := AcquireMessage(uint32(n), buffer[0:n])
 				// 得到当前客户端请求的Request数据
-				req := NewRequest(c, msg)
+				req := newWsRequest(c, msg, messageType)
 				c.msgHandler.Execute(req)
 			}
 		}
@@ -192,7 +278,23 @@ func (c *WsConnection) StartReader() {
 
 // Start 启动连接，让当前连接开始工作
 func (c *WsConnection) Start() {
-	c.ctx, c.cancel = context.WithCancel(context.Background())
+	baseCtx := c.baseCtx
+	if baseCtx == nil {
+		baseCtx = context.Background()
+	}
+	c.ctx, c.cancel = context.WithCancel(baseCtx)
+
+	// 首条消息的读超时同样限制握手函数中的读取
+	c.armFirstMessageDeadline()
+
+	// 在读循环启动之前完成握手，握手失败则拒绝该链接
+	if !c.doHandshake() {
+		c.closeReason.set(CloseReasonHandshakeFailed)
+		c.cancel()
+		c.finalizer()
+		return
+	}
+
 	// 按照用户传递进来的创建连接时需要处理的业务，执行钩子方法
 	c.callOnConnStart()
 
@@ -218,9 +320,100 @@ func (c *WsConnection) Start() {
 
 // Stop 停止连接，结束当前连接状态
 func (c *WsConnection) Stop() {
+	c.StopWithReason(CloseReasonLocal)
+}
+
+// StopWithReason 停止连接并记录关闭原因，链接已经关闭时不会覆盖之前的原因
+func (c *WsConnection) StopWithReason(reason CloseReason) {
+	c.closeReason.set(reason)
 	c.cancel()
 }
 
+// CloseReason 获取链接关闭的原因，链接未关闭时返回CloseReasonNone
+func (c *WsConnection) CloseReason() CloseReason {
+	return c.closeReason.load()
+}
+
+// SetSendRateLimit 限制有缓冲发送写出的速率，用于在带宽受限时保证多个链接之间的公平
+// 只有写协程按速率等待，队列积压时SendBuffMsg按原有逻辑超时返回错误，不会阻塞业务处理函数
+// 直接发送(SendMsg等)不受限制
+func (c *WsConnection) SetSendRateLimit(bytesPerSec int) {
+	c.shaper.setRate(bytesPerSec)
+}
+
+// SendRate 最近一段时间写出到对端的平均速率(字节/秒)，包括所有发送方式，两次调用间隔不足1秒时返回上一次的结果
+func (c *WsConnection) SendRate() float64 {
+	return c.shaper.currentRate(c.BytesWritten())
+}
+
+// Ping 发送保留的Ping控制消息并等待对端回复Pong，返回往返时间
+// 对端同样需要使用fastnet(或按相同的约定回复PongMsgID)，超时返回ErrPingTimeout
+func (c *WsConnection) Ping(timeout time.Duration) (time.Duration, error) {
+	return c.ping.ping(c, timeout)
+}
+
+// RTT 最近一次Ping测量的往返时间，没有测量过时返回0
+func (c *WsConnection) RTT() time.Duration {
+	return c.ping.lastRTT()
+}
+
+func (c *WsConnection) receivePong(data []byte) {
+	c.ping.pong(data)
+}
+
+func (c *WsConnection) receiveFragment(data []byte) (uint32, []byte, bool) {
+	return c.fragments.receive(c.connID, data)
+}
+
+// Kick 发送最后一条消息，等待写出后发送close帧并以指定的原因关闭链接，用于封禁、强制下线等操作
+// 有缓冲队列中尚未写出的消息会先于该消息写出，写出最多等待kickFlushTimeout，写出失败时仍然会关闭链接
+func (c *WsConnection) Kick(msgID uint32, data []byte, reason CloseReason) error {
+	// 持有写锁期间其他协程无法发送消息，保证最后一条消息之后不会再写出数据
+	c.msgLock.Lock()
+	if c.isClosed == true {
+		c.msgLock.Unlock()
+		return errors.New("wsConnection closed when kick")
+	}
+	err := c.flushAndWrite(msgID, data)
+	if err == nil {
+		closeMsg := websocket.FormatCloseMessage(websocket.CloseNormalClosure, reason.String())
+		err = c.conn.WriteControl(websocket.CloseMessage, closeMsg, time.Now().Add(kickFlushTimeout))
+	}
+	c.msgLock.Unlock()
+
+	if err != nil {
+		xlog.ErrorF("kick connID = %d, msg ID = %s, err = %+v", c.connID, msgIDString(msgID), err)
+	}
+	c.StopWithReason(reason)
+
+	return err
+}
+
+// 写出有缓冲队列中尚未发送的消息，然后写出指定的消息，需要持有msgLock
+func (c *WsConnection) flushAndWrite(msgID uint32, data []byte) error {
+	msg, err := c.packet.Pack(NewMsgPackage(msgID, data))
+	if err != nil {
+		return err
+	}
+
+	_ = c.conn.SetWriteDeadline(time.Now().Add(kickFlushTimeout))
+
+	// 有写协程时交给写协程写出，保证排在所有已入队的消息之后
+	if c.msgBuffChan != nil {
+		return flushFinalMsg(c.ctx, c.msgBuffChan, &c.sendProgress, msg)
+	}
+
+	c.writeLock.Lock()
+	defer c.writeLock.Unlock()
+
+	if err := c.conn.WriteMessage(c.wsMessageType(), msg); err != nil {
+		return err
+	}
+	c.addBytesWritten(len(msg))
+
+	return nil
+}
+
 func (c *WsConnection) GetConnection() net.Conn {
 	return nil
 }
@@ -252,7 +445,7 @@ func (c *WsConnection) Send(data []byte) error {
 		return errors.New("wsConnection closed when send msg")
 	}
 
-	err := c.conn.WriteMessage(websocket.BinaryMessage, data)
+	err := c.write(c.wsMessageType(), data)
 	if err != nil {
 		xlog.ErrorF("sendMsg err data = %+v, err = %+v", data, err)
 		return err
@@ -265,12 +458,7 @@ func (c *WsConnection) SendToQueue(data []byte) error {
 	c.msgLock.RLock()
 	defer c.msgLock.RUnlock()
 
-	if c.msgBuffChan == nil {
-		c.msgBuffChan = make(chan []byte, xconf.GlobalObject.MaxMsgChanLen)
-		// 开启用于写回客户端数据流程的Goroutine
-		// 此方法只读取MsgBuffChan中的数据没调用SendBuffMsg可以分配内存和启用协程
-		go c.StartWriter()
-	}
+	c.startWriterOnce()
 
 	idleTimeout := time.NewTimer(5 * time.Millisecond)
 	defer idleTimeout.Stop()
@@ -284,16 +472,40 @@ func (c *WsConnection) SendToQueue(data []byte) error {
 		return errors.New("pack data is nil ")
 	}
 
+	// 先记录入队再放入队列，写协程写出后的计数不会先于入队计数，放入失败时撤销
+	c.sendProgress.enqueued()
 	select {
 	case <-idleTimeout.C:
+		c.sendProgress.cancelled()
 		return errors.New("send buff msg timeout")
 	case c.msgBuffChan <- data:
 		return nil
 	}
 }
 
-// SendMsg 直接将Message数据发送数据给远程的TCP客户端
+// SendMsg 直接将Message数据发送数据给远程的客户端，使用链接默认的帧类型
 func (c *WsConnection) SendMsg(msgID uint32, data []byte) error {
+	return c.SendMsgWithType(c.wsMessageType(), msgID, data)
+}
+
+// SendMsgWithContentType 使用链接默认的帧类型发送带编码类型的消息，带编码类型的消息不拆分分片
+func (c *WsConnection) SendMsgWithContentType(msgID uint32, contentType ContentType, data []byte) error {
+	return c.sendMsg(c.wsMessageType(), msgID, contentType, data)
+}
+
+// SendMsgWithType 使用指定的websocket帧类型发送消息，例如浏览器端需要文本帧时使用websocket.TextMessage
+// 配置了FragmentSize时，超过该长度的数据会拆分为多个分片连续写出，分片使用默认的帧类型，JSON信封直通模式不拆分
+func (c *WsConnection) SendMsgWithType(messageType int, msgID uint32, data []byte) error {
+	return c.sendMsg(messageType, msgID, ContentTypeDefault, data)
+}
+
+func (c *WsConnection) sendMsg(messageType int, msgID uint32, contentType ContentType, data []byte) error {
+	if _, ok := c.packet.(*JSONEnvelopePack); !ok && contentType == ContentTypeDefault {
+		if fragments := c.fragments.split(msgID, data); fragments != nil {
+			return c.SendMsgBatch(fragments)
+		}
+	}
+
 	c.msgLock.RLock()
 	defer c.msgLock.RUnlock()
 	if c.isClosed == true {
@@ -301,35 +513,173 @@ func (c *WsConnection) SendMsg(msgID uint32, data []byte) error {
 	}
 
 	// 将data封包，并且发送
-	msg, err := c.packet.Pack(NewMsgPackage(msgID, data))
+	m := NewMsgPackage(msgID, data)
+	m.SetContentType(contentType)
+	msg, err := c.packet.Pack(m)
 	if err != nil {
-		xlog.ErrorF("pack error msg ID = %d", msgID)
+		xlog.ErrorF("pack error msg ID = %s", msgIDString(msgID))
 		return errors.New("pack error msg ")
 	}
 
-	err = c.conn.WriteMessage(websocket.BinaryMessage, msg)
+	err = c.write(messageType, msg)
 	if err != nil {
-		xlog.ErrorF("sendMsg err msg ID = %d, data = %+v, err = %+v", msgID, string(msg), err)
+		xlog.ErrorF("sendMsg err msg ID = %s, data = %+v, err = %+v", msgIDString(msgID), string(msg), err)
 		return err
 	}
 
 	return nil
 }
 
-// SendBuffMsg sends BuffMsg
-func (c *WsConnection) SendBuffMsg(msgID uint32, data []byte) error {
+// ReadMsg 读取一个websocket帧，并按照链接的封包方式解析出一条完整的消息
+// 只能在握手函数中调用，读循环启动之后所有消息都交由路由处理
+func (c *WsConnection) ReadMsg() (IMessage, error) {
+	if !c.handshaking {
+		return nil, ErrReadMsgNotInHandshake
+	}
+
+	_, data, err := c.conn.ReadMessage()
+	if err != nil {
+		return nil, err
+	}
+	// 读到了完整的websocket帧即收到了对端的第一条消息
+	c.firstMessageReceived()
+
+	// JSON信封没有包头，一个websocket帧就是一条完整的消息
+	if packet, ok := c.packet.(*JSONEnvelopePack); ok {
+		return packet.Unpack(data)
+	}
+
+	msg, err := readMsgFrom(bytes.NewReader(data), c.packet)
+	if err != nil || c.compressor == nil {
+		return msg, err
+	}
+
+	if data, err = c.decompressMsg(msg.GetData()); err != nil {
+		return nil, err
+	}
+	msg.SetData(data)
+	msg.SetDataLen(uint32(len(data)))
+
+	return msg, nil
+}
+
+// SendMsgBatch 按顺序将多条消息封包后逐条写出，每条消息对应一个websocket二进制帧
+// 任意一条封包失败时整批都不发送，写出失败时返回的*BatchSendError记录了已完整发送的条数
+func (c *WsConnection) SendMsgBatch(msgs []OutMsg) error {
+	if len(msgs) == 0 {
+		return nil
+	}
+
 	c.msgLock.RLock()
 	defer c.msgLock.RUnlock()
+	if c.isClosed == true {
+		return errors.New("wsConnection closed when send msg batch")
+	}
 
-	if c.msgBuffChan == nil {
-		c.msgBuffChan = make(chan []byte, xconf.GlobalObject.MaxMsgChanLen)
-		// 开启用于写回客户端数据流程的Goroutine
-		// 此方法只读取MsgBuffChan中的数据没调用SendBuffMsg可以分配内存和启用协程
-		go c.StartWriter()
+	packed, err := packBatch(c.packet, msgs)
+	if err != nil {
+		xlog.ErrorF("sendMsgBatch err = %+v", err)
+		return err
 	}
 
-	idleTimeout := time.NewTimer(5 * time.Millisecond)
-	defer idleTimeout.Stop()
+	// 整批消息写出期间持有写锁，保证批内的消息连续发送
+	c.writeLock.Lock()
+	defer c.writeLock.Unlock()
+
+	for i, data := range packed {
+		if err = c.conn.WriteMessage(c.wsMessageType(), data); err != nil {
+			c.closeOnWriteError(err)
+			err = &BatchSendError{Sent: i, Total: len(packed), Err: err}
+			xlog.ErrorF("sendMsgBatch err = %+v", err)
+			return err
+		}
+		c.addBytesWritten(len(data))
+	}
+
+	return nil
+}
+
+// wsFrameSize 载荷为payload字节的未分片websocket帧在链路上占用的字节数，包括帧头和掩码
+func wsFrameSize(payload int, masked bool) int {
+	size := 2 + payload
+	switch {
+	case payload > 65535:
+		size += 8
+	case payload > 125:
+		size += 2
+	}
+	if masked {
+		size += 4
+	}
+
+	return size
+}
+
+// write 所有向websocket写数据的操作都经过该方法，gorilla/websocket不支持并发写，这里保证同一时刻只有一个协程在写
+func (c *WsConnection) write(messageType int, data []byte) error {
+	c.writeLock.Lock()
+	defer c.writeLock.Unlock()
+
+	if err := c.conn.WriteMessage(messageType, data); err != nil {
+		c.closeOnWriteError(err)
+		return err
+	}
+	c.addBytesWritten(len(data))
+
+	return nil
+}
+
+// 写出失败后gorilla/websocket的链接不能再继续使用，关闭链接，避免半死的链接继续占用链接数
+// 只取消ctx，由Start所在的协程完成关闭，调用方可以持有msgLock
+func (c *WsConnection) closeOnWriteError(err error) {
+	if c.cancel == nil {
+		return
+	}
+	xlog.ErrorF("connID = %d write err: %v, close conn", c.connID, err)
+	c.StopWithReason(CloseReasonWriteError)
+}
+
+// SetWsMessageType 设置发送消息默认使用的帧类型，只支持websocket.BinaryMessage和websocket.TextMessage
+func (c *WsConnection) SetWsMessageType(messageType int) {
+	if messageType != websocket.BinaryMessage && messageType != websocket.TextMessage {
+		xlog.ErrorF("unsupported websocket message type %d", messageType)
+		return
+	}
+	atomic.StoreInt32(&c.messageType, int32(messageType))
+}
+
+func (c *WsConnection) wsMessageType() int {
+	return int(atomic.LoadInt32(&c.messageType))
+}
+
+// Flush 阻塞等待调用之前通过SendBuffMsg/SendToQueue进入有缓冲队列的消息全部写出到socket
+// 消息仍由写协程按入队顺序写出，Flush只等待不插队，设置了SetSendRateLimit时同样受限速影响
+// 适合按帧(tick)批量发送：一帧内多次SendBuffMsg只入队不阻塞业务，帧结束时Flush保证这一帧的消息都已发出
+// 没有使用过有缓冲发送时直接返回nil，链接关闭或写出失败(写出失败会关闭链接)时返回ErrFlushConnClosed
+func (c *WsConnection) Flush() error {
+	c.msgLock.RLock()
+	closed, ctx := c.isClosed, c.ctx
+	c.msgLock.RUnlock()
+
+	if closed || ctx == nil || ctx.Err() != nil {
+		return ErrFlushConnClosed
+	}
+
+	return c.sendProgress.wait(ctx)
+}
+
+// SendBuffMsg sends BuffMsg
+func (c *WsConnection) SendBuffMsg(msgID uint32, data []byte) error {
+	return c.SendBuffMsgWithTimeout(msgID, data, sendBuffTimeout)
+}
+
+// SendBuffMsgWithTimeout 将消息放入有缓冲队列，队列已满时最多等待timeout，超时返回ErrSendBuffTimeout
+// timeout小于等于0时不等待，队列已满时立即返回，适合广播等不能被个别慢链接拖慢的场景
+func (c *WsConnection) SendBuffMsgWithTimeout(msgID uint32, data []byte, timeout time.Duration) error {
+	c.msgLock.RLock()
+	defer c.msgLock.RUnlock()
+
+	c.startWriterOnce()
 
 	if c.isClosed == true {
 		return errors.New("wsConnection closed when send buff msg")
@@ -338,13 +688,31 @@ func (c *WsConnection) SendBuffMsg(msgID uint32, data []byte) error {
 	// 将data封包，并且发送
 	msg, err := c.packet.Pack(NewMsgPackage(msgID, data))
 	if err != nil {
-		xlog.ErrorF("pack error msg ID = %d", msgID)
+		xlog.ErrorF("pack error msg ID = %s", msgIDString(msgID))
 		return errors.New("pack error msg ")
 	}
 
+	// 先记录入队再放入队列，写协程写出后的计数不会先于入队计数，放入失败时撤销
+	c.sendProgress.enqueued()
+
+	// 队列有空位时直接放入，不创建定时器
+	select {
+	case c.msgBuffChan <- msg:
+		return nil
+	default:
+	}
+	if timeout <= 0 {
+		c.sendProgress.cancelled()
+		return ErrSendBuffTimeout
+	}
+
+	idleTimeout := time.NewTimer(timeout)
+	defer idleTimeout.Stop()
+
 	select {
 	case <-idleTimeout.C:
-		return errors.New("send buff msg timeout")
+		c.sendProgress.cancelled()
+		return ErrSendBuffTimeout
 	case c.msgBuffChan <- msg:
 		return nil
 	}
@@ -378,6 +746,39 @@ func (c *WsConnection) RemoveProperty(key string) {
 	delete(c.property, key)
 }
 
+func (c *WsConnection) clearProperties() {
+	c.propertyLock.Lock()
+	defer c.propertyLock.Unlock()
+
+	c.property = nil
+}
+
+// SetTag 设置链接的标签，服务端链接由所属的ConnManager建立索引，可通过GetByTag按标签查找
+func (c *WsConnection) SetTag(key, value string) {
+	if c.connManager != nil {
+		c.connManager.SetTag(c, key, value)
+		return
+	}
+	c.tags.set(key, value)
+}
+
+// GetTag 获取链接的标签
+func (c *WsConnection) GetTag(key string) (string, bool) {
+	if c.connManager != nil {
+		return c.connManager.GetTag(c.connID, key)
+	}
+	return c.tags.get(key)
+}
+
+// RemoveTag 移除链接的标签
+func (c *WsConnection) RemoveTag(key string) {
+	if c.connManager != nil {
+		c.connManager.RemoveTag(c, key)
+		return
+	}
+	c.tags.remove(key)
+}
+
 // Context 返回ctx，用于用户自定义的go程获取连接退出状态
 func (c *WsConnection) Context() context.Context {
 	return c.ctx
@@ -413,12 +814,36 @@ func (c *WsConnection) finalizer() {
 		close(c.msgBuffChan)
 	}
 
+	// OnConnStop已经执行完，释放链接上保存的属性
+	c.clearProperties()
+
 	// 设置标志位
 	c.isClosed = true
 
 	xlog.InfoF("conn stop()...connID = %d", c.connID)
 }
 
+// 执行握手函数，握手失败时返回false
+func (c *WsConnection) doHandshake() bool {
+	if c.handshake == nil {
+		return true
+	}
+
+	c.handshaking = true
+	err := c.handshake(c)
+	c.handshaking = false
+
+	if err != nil {
+		xlog.ErrorF("connID = %d, remote = %s handshake failed: %v", c.connID, c.remoteAddr, err)
+		c.checkFirstMessageTimeout(err)
+		c.rejected = true
+		return false
+	}
+
+	// 握手函数没有通过ReadMsg读到完整的消息时，首条消息的读超时继续限制读循环
+	return true
+}
+
 func (c *WsConnection) callOnConnStart() {
 	if c.onConnStart != nil {
 		xlog.InfoF("callOnConnStart....")
@@ -427,22 +852,122 @@ func (c *WsConnection) callOnConnStart() {
 }
 
 func (c *WsConnection) callOnConnStop() {
+	if c.rejected {
+		return
+	}
 	if c.onConnStop != nil {
 		xlog.InfoF("callOnConnStop....")
 		c.onConnStop(c)
 	}
+	if c.onConnStopE != nil {
+		c.onConnStopE(c, c.CloseReason())
+	}
 }
 
 func (c *WsConnection) IsAlive() bool {
 	if c.isClosed {
 		return false
 	}
+	// 暂停读取期间无法收到对端的心跳，不应被认为已经死亡
+	if c.IsPaused() {
+		return true
+	}
 	// 检查连接最后一次活动时间，如果超过心跳间隔，则认为连接已经死亡
-	return time.Now().Sub(c.lastActivityTime) < xconf.GlobalObject.HeartbeatMaxDuration()
+	return c.clock.Now().Sub(time.Unix(0, c.lastActivityTime.Load())) < c.config.HeartbeatMaxDuration()
+}
+
+// BytesRead 累计从对端读取的字节数，包括websocket的帧头
+func (c *WsConnection) BytesRead() uint64 {
+	return c.bytes.loadRead()
+}
+
+// BytesWritten 累计写出到对端的字节数，包括websocket的帧头
+func (c *WsConnection) BytesWritten() uint64 {
+	return c.bytes.loadWritten()
+}
+
+// 记录读取到的一个载荷为n字节的websocket帧，对端为客户端时帧带有掩码
+func (c *WsConnection) addBytesRead(n int) {
+	n = wsFrameSize(n, !c.isClient)
+	c.bytes.addRead(n)
+	if c.totalBytes != nil {
+		c.totalBytes.addRead(n)
+	}
+}
+
+// 记录写出的一个载荷为n字节的websocket帧，客户端链接写出的帧带有掩码
+func (c *WsConnection) addBytesWritten(n int) {
+	n = wsFrameSize(n, c.isClient)
+	c.bytes.addWritten(n)
+	if c.totalBytes != nil {
+		c.totalBytes.addWritten(n)
+	}
+}
+
+// 未设置OnFrameDropped回调时不给断粘包解码器设置handler，丢弃数据时没有额外开销
+func (c *WsConnection) bindFrameDropHandler() {
+	if c.onFrameDropped == nil {
+		return
+	}
+
+	if notifier, ok := c.frameDecoder.(IFrameDropNotifier); ok {
+		notifier.SetDropHandler(c.reportFrameDropped)
+	}
+}
+
+func (c *WsConnection) reportDecodeError(err error, raw []byte) {
+	if c.onDecodeError != nil {
+		c.onDecodeError(c.connID, err, raw)
+	}
+}
+
+func (c *WsConnection) reportFrameDropped(reason string) {
+	if c.onFrameDropped != nil {
+		c.onFrameDropped(c.connID, reason)
+	}
+}
+
+// 断粘包缓冲区累积的半包超过上限时返回true，通常是对端发送了包头却迟迟不发送包体
+func (c *WsConnection) frameAccumExceeded() bool {
+	limit := c.config.MaxFrameAccumSize()
+	buffered, ok := c.frameDecoder.(IFrameBuffered)
+	if limit <= 0 || !ok {
+		return false
+	}
+
+	if n := buffered.Buffered(); n > limit {
+		xlog.ErrorF("connID = %d, remote = %s, partial frame buffered %d bytes exceeds limit %d, close connection",
+			c.connID, c.remoteAddr, n, limit)
+		c.reportFrameDropped(fmt.Sprintf("partial frame buffered %d bytes exceeds limit %d", n, limit))
+		c.closeReason.set(CloseReasonProtocolError)
+		return true
+	}
+
+	return false
+}
+
+// 断粘包解码器判断数据不符合协议时返回true，通常是对端使用了错误的协议
+func (c *WsConnection) frameRejected() bool {
+	rejecter, ok := c.frameDecoder.(IFrameRejecter)
+	if !ok {
+		return false
+	}
+
+	if err := rejecter.Rejected(); err != nil {
+		xlog.ErrorF("connID = %d, remote = %s, frame rejected: %v, close connection", c.connID, c.remoteAddr, err)
+		c.reportDecodeError(err, nil)
+		c.closeReason.set(CloseReasonProtocolError)
+		return true
+	}
+
+	return false
 }
 
 func (c *WsConnection) updateActivity() {
-	c.lastActivityTime = time.Now()
+	c.lastActivityTime.Store(c.clock.Now().UnixNano())
+	if c.heartbeatChecker != nil {
+		c.heartbeatChecker.ResetMissedBeats()
+	}
 }
 
 func (c *WsConnection) SetHeartbeat(checker IHeartbeatChecker) {
@@ -457,6 +982,58 @@ func (c *WsConnection) RemoteAddrString() string {
 	return c.remoteAddr
 }
 
+func (c *WsConnection) Network() string {
+	return "websocket"
+}
+
+func (c *WsConnection) ConnectedAt() time.Time {
+	return c.connectedAt
+}
+
+// Subprotocol 获取websocket握手时协商的子协议
+func (c *WsConnection) Subprotocol() string {
+	return c.conn.Subprotocol()
+}
+
+// RequestHeader 获取建立链接时的HTTP头副本，修改返回值不会影响链接
+func (c *WsConnection) RequestHeader() http.Header {
+	return c.header.Clone()
+}
+
+// GetHTTPRequestInfo 获取升级请求的信息副本，客户端链接返回nil
+func (c *WsConnection) GetHTTPRequestInfo() *HTTPRequestInfo {
+	return c.httpInfo.clone()
+}
+
+func (c *WsConnection) Compression() string {
+	c.msgLock.RLock()
+	defer c.msgLock.RUnlock()
+
+	if c.compressor == nil {
+		return ""
+	}
+	return c.compressor.Name()
+}
+
+// 设置协商的压缩算法，之后发送的消息都经过压缩，只在握手期间调用
+// JSON信封需要保持文本格式，不支持压缩
+func (c *WsConnection) setCompressor(compressor ICompressor) error {
+	c.msgLock.Lock()
+	defer c.msgLock.Unlock()
+
+	if _, ok := c.packet.(*JSONEnvelopePack); ok {
+		return fmt.Errorf("%w: json envelope does not support compression", ErrCompressionNegotiation)
+	}
+	c.compressor = compressor
+	c.packet = &compressedPack{IDataPack: c.packet, compressor: compressor}
+	return nil
+}
+
+// 解压收到的消息数据，解压后的数据不超过MaxPacketSize
+func (c *WsConnection) decompressMsg(data []byte) ([]byte, error) {
+	return decompressMsgData(c.compressor, data, int(c.config.MaxPacketSize))
+}
+
 func (c *WsConnection) GetName() string {
 	return c.name
 }
@@ -464,3 +1041,53 @@ func (c *WsConnection) GetName() string {
 func (c *WsConnection) GetMsgHandler() IMsgHandle {
 	return c.msgHandler
 }
+
+// Pause 暂停读取对端数据，正在进行中的读取会完成并继续分发
+// 暂停期间对端发送的数据保留在系统的接收缓冲区中，缓冲区满后TCP流控会使对端减速
+// 暂停期间SendMsg等发送方法不受影响，心跳检测也不会将该链接判定为死亡
+func (c *WsConnection) Pause() {
+	c.pauseLock.Lock()
+	defer c.pauseLock.Unlock()
+
+	if c.resumeChan == nil {
+		c.resumeChan = make(chan struct{})
+	}
+}
+
+// Resume 恢复读取对端数据
+func (c *WsConnection) Resume() {
+	c.pauseLock.Lock()
+	defer c.pauseLock.Unlock()
+
+	if c.resumeChan != nil {
+		close(c.resumeChan)
+		c.resumeChan = nil
+		// 重新开始计算心跳超时时间
+		c.lastActivityTime.Store(c.clock.Now().UnixNano())
+	}
+}
+
+func (c *WsConnection) IsPaused() bool {
+	c.pauseLock.Lock()
+	defer c.pauseLock.Unlock()
+
+	return c.resumeChan != nil
+}
+
+// 暂停读取时阻塞等待恢复，链接关闭时返回false
+func (c *WsConnection) waitResume() bool {
+	c.pauseLock.Lock()
+	resumeChan := c.resumeChan
+	c.pauseLock.Unlock()
+
+	if resumeChan == nil {
+		return true
+	}
+
+	select {
+	case <-resumeChan:
+		return true
+	case <-c.ctx.Done():
+		return false
+	}
+}
@@ -0,0 +1,276 @@
+/**
+* @File: ws_connection_test.go
+* @Author: Jason Woo
+* @Date: 2026/10/16 20:20
+**/
+
+package fastnet
+
+import (
+	"github.com/gorilla/websocket"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestWsConnectionMessageType(t *testing.T) {
+	s := NewServer().(*Server)
+	s.AddInterceptor(s.GetDecoder())
+	s.GetMsgHandler().StartWorkerPool()
+	defer s.GetMsgHandler().StopWorkerPool()
+
+	// 使用收到消息的帧类型回复
+	s.AddRouterSlices(1, func(request IRequest) {
+		_ = request.GetConnection().SendMsgWithType(request.GetWsMessageType(), 2, request.GetData())
+	})
+
+	upgrader := websocket.Upgrader{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		go newWebsocketConn(s, conn, 1, newHTTPRequestInfo(r)).Start()
+	}))
+	defer srv.Close()
+
+	client, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(srv.URL, "http"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = client.Close() }()
+
+	for _, messageType := range []int{websocket.TextMessage, websocket.BinaryMessage} {
+		packed, _ := s.GetPacket().Pack(NewMsgPackage(1, []byte(`{"hello":"fastnet"}`)))
+		if err = client.WriteMessage(messageType, packed); err != nil {
+			t.Fatal(err)
+		}
+
+		gotType, data, err := client.ReadMessage()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if gotType != messageType {
+			t.Fatalf("reply message type = %d, want %d", gotType, messageType)
+		}
+		msg, err := s.GetPacket().Unpack(data)
+		if err != nil || msg.GetMsgID() != 2 {
+			t.Fatalf("unexpected reply: %v, %v", msg, err)
+		}
+	}
+}
+
+func TestWsJSONPassthrough(t *testing.T) {
+	s := NewServer(WithWsJSONPassthrough()).(*Server)
+	s.AddInterceptor(&wsPassthroughDecoder{tcp: s.GetDecoder(), ws: s.GetWsDecoder()})
+	s.GetMsgHandler().StartWorkerPool()
+	defer s.GetMsgHandler().StopWorkerPool()
+
+	s.AddRouterSlices(1, func(request IRequest) {
+		_ = request.GetConnection().SendMsg(2, request.GetData())
+	})
+
+	// tcp链接的封包方式不受影响
+	if _, ok := s.GetPacket().(*JSONEnvelopePack); ok {
+		t.Fatal("tcp packet should not be replaced by json envelope")
+	}
+
+	upgrader := websocket.Upgrader{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		go newWebsocketConn(s, conn, 1, newHTTPRequestInfo(r)).Start()
+	}))
+	defer srv.Close()
+
+	client, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(srv.URL, "http"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = client.Close() }()
+
+	if err = client.WriteMessage(websocket.TextMessage, []byte(`{"msgId":1,"data":{"hello":"fastnet"}}`)); err != nil {
+		t.Fatal(err)
+	}
+
+	gotType, data, err := client.ReadMessage()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if gotType != websocket.TextMessage {
+		t.Fatalf("reply message type = %d, want text", gotType)
+	}
+	if want := `{"msgId":2,"data":{"hello":"fastnet"}}`; string(data) != want {
+		t.Fatalf("reply = %s, want %s", data, want)
+	}
+}
+
+func TestJSONEnvelopePack(t *testing.T) {
+	dp := NewJSONEnvelopePack()
+
+	packed, err := dp.Pack(NewMsgPackage(3, []byte("plain text")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := `{"msgId":3,"data":"plain text"}`; string(packed) != want {
+		t.Fatalf("packed = %s, want %s", packed, want)
+	}
+
+	msg, err := dp.Unpack(packed)
+	if err != nil || msg.GetMsgID() != 3 || string(msg.GetData()) != `"plain text"` {
+		t.Fatalf("unexpected unpack result: %v, %v", msg, err)
+	}
+
+	if _, err = dp.Unpack([]byte("not json")); err != ErrInvalidEnvelope {
+		t.Fatalf("err = %v, want ErrInvalidEnvelope", err)
+	}
+}
+
+func TestWsSubprotocolSelector(t *testing.T) {
+	s := NewServer().(*Server)
+	s.SetWebsocketSubprotocolSelector(func(offered []string) string {
+		for _, p := range offered {
+			if p == "fastnet.v2" {
+				return p
+			}
+		}
+		return ""
+	})
+	negotiated := make(chan string, 1)
+	s.SetOnConnStart(func(conn IConnection) {
+		negotiated <- conn.Subprotocol()
+	})
+
+	srv := httptest.NewServer(http.HandlerFunc(s.serveWebsocket))
+	defer srv.Close()
+	url := "ws" + strings.TrimPrefix(srv.URL, "http")
+
+	dialer := websocket.Dialer{Subprotocols: []string{"fastnet.v1", "fastnet.v2"}}
+	client, _, err := dialer.Dial(url, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = client.Close() }()
+
+	if client.Subprotocol() != "fastnet.v2" {
+		t.Fatalf("client subprotocol = %q, want fastnet.v2", client.Subprotocol())
+	}
+	if p := <-negotiated; p != "fastnet.v2" {
+		t.Fatalf("conn subprotocol = %q, want fastnet.v2", p)
+	}
+
+	// 不支持的子协议被拒绝
+	dialer.Subprotocols = []string{"fastnet.v1"}
+	_, resp, err := dialer.Dial(url, nil)
+	if err == nil || resp == nil || resp.StatusCode != http.StatusBadRequest {
+		t.Fatalf("unsupported subprotocol: err = %v, resp = %v, want 400", err, resp)
+	}
+}
+
+func TestWsHTTPRequestInfo(t *testing.T) {
+	s := NewServer().(*Server)
+	infos := make(chan *HTTPRequestInfo, 1)
+	s.SetOnConnStart(func(conn IConnection) {
+		info := conn.GetHTTPRequestInfo()
+		// 返回的是副本，修改不影响链接
+		info.Header.Del("Authorization")
+		infos <- conn.GetHTTPRequestInfo()
+	})
+
+	srv := httptest.NewServer(http.HandlerFunc(s.serveWebsocket))
+	defer srv.Close()
+
+	header := http.Header{}
+	header.Set("Authorization", "Bearer token")
+	header.Set("Cookie", "session=abc")
+	client, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(srv.URL, "http")+"/game?room=7", header)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = client.Close() }()
+
+	info := <-infos
+	if info.Path != "/game" || info.Query.Get("room") != "7" {
+		t.Fatalf("path = %q, query = %v", info.Path, info.Query)
+	}
+	if info.Header.Get("Authorization") != "Bearer token" {
+		t.Fatalf("Authorization = %q, want Bearer token", info.Header.Get("Authorization"))
+	}
+	if cookie, ok := info.Cookie("session"); !ok || cookie.Value != "abc" {
+		t.Fatalf("session cookie = %v, %v", cookie, ok)
+	}
+}
+
+func TestWsMaxConcurrentUpgrades(t *testing.T) {
+	s := NewServer().(*Server)
+	// 模拟已有一个升级请求正在进行中
+	s.upgradeSem = newHandlerSem(1)
+	s.upgradeSem <- struct{}{}
+
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	w := httptest.NewRecorder()
+	s.serveWebsocket(w, r)
+
+	if w.Code != http.StatusServiceUnavailable {
+		t.Fatalf("status = %d, want 503", w.Code)
+	}
+	if n := s.Stats().UpgradesRejected; n != 1 {
+		t.Fatalf("UpgradesRejected = %d, want 1", n)
+	}
+}
+
+func TestWsConnectionBytesCountFrames(t *testing.T) {
+	s := NewServer().(*Server)
+	conns := make(chan IConnection, 1)
+	upgrader := websocket.Upgrader{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		wsConn := newWebsocketConn(s, conn, 1, newHTTPRequestInfo(r))
+		conns <- wsConn
+		wsConn.Start()
+	}))
+	defer srv.Close()
+
+	client, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(srv.URL, "http"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = client.Close() }()
+	conn := <-conns
+
+	// 客户端发送的帧带有4字节掩码
+	packed, _ := s.GetPacket().Pack(NewMsgPackage(1, []byte("ping")))
+	if err = client.WriteMessage(websocket.BinaryMessage, packed); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, func() bool { return conn.BytesRead() == uint64(2+4+len(packed)) })
+
+	// 批量发送时按每条消息实际写出的帧统计，包括超过125字节时的扩展长度
+	msgs := []OutMsg{{MsgID: 2, Data: []byte("a")}, {MsgID: 3, Data: make([]byte, 200)}}
+	if err = conn.SendMsgBatch(msgs); err != nil {
+		t.Fatal(err)
+	}
+	want := uint64(0)
+	for _, m := range msgs {
+		_, data, err := client.ReadMessage()
+		if err != nil {
+			t.Fatal(err)
+		}
+		want += uint64(wsFrameSize(len(data), false))
+		if len(m.Data) > 125 && wsFrameSize(len(data), false) != 4+len(data) {
+			t.Fatalf("frame size for %d bytes = %d", len(data), wsFrameSize(len(data), false))
+		}
+	}
+	if n := conn.BytesWritten(); n != want {
+		t.Fatalf("BytesWritten = %d, want %d", n, want)
+	}
+}
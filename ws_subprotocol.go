@@ -0,0 +1,46 @@
+/**
+* @File: ws_subprotocol.go
+* @Author: Jason Woo
+* @Date: 2026/10/16 12:09
+**/
+
+package fastnet
+
+import (
+	"github.com/gorilla/websocket"
+	"net/http"
+)
+
+// SubprotocolSelector websocket子协议协商回调，offered为客户端在Sec-Websocket-Protocol中按优先级提供的子协议
+// 返回选中的子协议，返回""或不在offered中的值表示拒绝该客户端，升级请求以400响应
+// 设置该回调后，没有提供子协议的客户端offered为空，同样由回调决定，返回""即拒绝
+type SubprotocolSelector func(offered []string) string
+
+// 协商websocket子协议，ok为false时拒绝升级
+// 未设置回调时沿用之前的行为，接受客户端的首选子协议
+func (s *Server) negotiateSubprotocol(r *http.Request) (protocol string, ok bool) {
+	offered := websocket.Subprotocols(r)
+	if s.wsSubprotocol == nil {
+		if len(offered) > 0 {
+			return offered[0], true
+		}
+		return "", true
+	}
+
+	selected := s.wsSubprotocol(offered)
+	if selected == "" {
+		return "", false
+	}
+	for _, p := range offered {
+		if p == selected {
+			return selected, true
+		}
+	}
+
+	return "", false
+}
+
+// SetWebsocketSubprotocolSelector 设置websocket子协议协商回调，协商结果通过IConnection.Subprotocol获取
+func (s *Server) SetWebsocketSubprotocolSelector(selector SubprotocolSelector) {
+	s.wsSubprotocol = selector
+}
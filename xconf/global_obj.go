@@ -8,13 +8,16 @@ package xconf
 
 import (
 	"encoding/json"
+	"flag"
 	"fmt"
 	"github.com/dyowoo/fastnet/xlog"
 	"github.com/dyowoo/fastnet/xutils/commandline/args"
 	"github.com/dyowoo/fastnet/xutils/commandline/uflag"
+	"io"
 	"os"
 	"reflect"
-	"testing"
+	"strings"
+	"sync"
 	"time"
 )
 
@@ -23,11 +26,30 @@ const (
 	ServerModeWebsocket = "websocket"
 )
 
+const (
+	NetworkTCP  = "tcp"  // 同时监听IPv4和IPv6(双栈，取决于系统设置)
+	NetworkTCP4 = "tcp4" // 只监听IPv4
+	NetworkTCP6 = "tcp6" // 只监听IPv6
+)
+
 const (
 	WorkerModeHash = "Hash" // 默认使用取余的方式
 	WorkerModeBind = "Bind" // 为每个连接分配一个worker
 )
 
+const (
+	DecoderTLV         = "tlv"          // 默认 Tag(4)+Length(4)+Value
+	DecoderLTV         = "ltv"          // 小端 Length(4)+Tag(4)+Value
+	DecoderHTLVCRC     = "htlv-crc"     // Head+Tag+Length+Value+CRC
+	DecoderVarint      = "varint"       // varint包头
+	DecoderTLVCRC32    = "tlv-crc32"    // Tag(4)+Length(4)+Value+CRC32(4)，校验和覆盖整帧
+	DecoderTLVAdler32  = "tlv-adler32"  // Tag(4)+Length(4)+Value+Adler32(4)，校验和覆盖整帧
+	DecoderLengthField = "length-field" // 由LengthField系列参数描述的长度字段
+	DecoderDelimiter   = "delimiter"    // 按分隔符断包
+	DecoderFixed       = "fixed"        // 按固定长度断包
+	DecoderNone        = "none"         // 不使用解码器，每次读取到的数据原样交给拦截器和路由
+)
+
 // Config
 /*
 存储一切有关框架的全局参数，供其他模块使用
@@ -41,27 +63,66 @@ type Config struct {
 	Version           string // 当前版本号
 	MaxPacketSize     uint32 // 读写数据包的最大值
 	MaxConn           int    // 当前服务器主机允许的最大链接个数
+	AcceptConcurrency int    // tcp监听同时执行Accept的协程数量 默认 1 --大量客户端同时重连时可适当调大
+	ReusePort         bool   // tcp监听是否设置SO_REUSEPORT 默认 false --开启后可以每个核心运行一个进程监听同一端口，不支持的平台自动忽略
+	Network           string // 监听的网络类型 tcp/tcp4/tcp6 默认 "tcp" --tcp为双栈，tcp4/tcp6只接受对应协议的链接，Host需与之匹配
 	WorkerPoolSize    uint32 // 业务工作Worker池的数量
 	MaxWorkerTaskLen  uint32 // 业务工作Worker对应负责的任务队列最大任务存储数量
 	WorkerMode        string // 为链接分配worker的方式
 	MaxMsgChanLen     uint32 // SendBuffMsg发送消息的缓冲最大长度
 	IOReadBuffSize    uint32 // 每次IO最大的读取长度
+	MaxFrameAccum     uint32 // 断粘包缓冲区最多累积的半包字节数 默认 0 --为0时使用MaxPacketSize加包头预留，超过时关闭链接
+	FrameBuffInitCap  uint32 // 断粘包缓冲区的初始容量 默认 0 --可按常见消息大小设置以减少扩容
 	Mode              string // "tcp":tcp监听, "websocket":websocket 监听 为空时同时开启
-	RouterSlicesMode  bool   // 路由模式 false为旧版本路由，true为启用新版本的路由 默认使用旧版本
+	RouterSlicesMode  bool   // 路由模式 false为旧版本路由，true为启用新版本的路由 默认使用旧版本 --两种路由可以共存，true时旧版路由被适配为切片路由
 	LogDir            string // 日志所在文件夹 默认"./log"
 	LogFile           string // 日志文件名称   默认""  --如果没有设置日志文件，打印信息将打印至stderr
 	LogSaveDays       int    // 日志最大保留天数
 	LogFileSize       int64  // 日志单个日志最大容量 默认 64MB,单位：字节，记得一定要换算成MB（1024 * 1024）
 	LogCons           bool   // 日志标准输出  默认 false
 	LogIsolationLevel int    // 日志隔离级别  -- 0：全开 1：关debug 2：关debug/info 3：关debug/info/warn ...
+	LogAsyncBuffSize  int    // 异步日志队列长度 默认 0 --为0时同步输出日志
+	LogAsyncDrop      bool   // 异步日志队列已满时是否丢弃日志 默认 false --阻塞等待
+	LogNoCaller       bool   // 日志是否不输出调用位置(文件名和行号) 默认 false --开启后不再对每条日志调用runtime.Caller，提高大量日志时的吞吐
 	HeartbeatMax      int    // 最长心跳检测间隔时间(单位：秒),超过改时间间隔，则认为超时，从配置文件读取
+	HandlerTimeout    int    // 业务处理函数默认的超时时间(单位：毫秒) 默认 0 --不限制，超时后worker不再等待该处理函数
 	CertFile          string //  证书文件名称 默认""
 	PrivateKeyFile    string //  私钥文件名称 默认"" --如果没有设置证书和私钥文件，则不启用TLS加密
+
+	HeartbeatJitter     float64 // 每个链接的心跳间隔在该比例内随机缩短 默认 0.1 --避免大量链接同时发送心跳，只缩短不延长，小于0时不抖动，最大0.5
+	MaxConnLifetime     int     // 服务端链接的最长存活时间(单位：秒) 默认 0 --不限制，超过时写出有缓冲队列中的消息后关闭，客户端需要重连
+	FirstMessageTimeout int     // 服务端链接建立后必须在该时间内收到第一条完整的消息(单位：秒) 默认 0 --不限制，超时以HandshakeTimeout关闭，用于防御慢速攻击
+	MessagePool         bool    // 处理函数全部返回后是否回收消息对象复用 默认 false --开启后处理函数返回之后不能再通过请求读取消息
+
+	MaxConcurrentHandlers int // 不启动Worker工作池(WorkerPoolSize为0)时同时处理消息的最大协程数 默认 10000 --小于等于0时不限制
+	MaxConcurrentUpgrades int // 同时进行中的websocket升级请求的最大数量 默认 0 --小于等于0时不限制，超过时返回503
+	DegradedQueueLen      int // 任意Worker任务队列积压达到该数量时健康状态为Degraded 默认 0 --为MaxWorkerTaskLen的80%
+
+	TCPNoDelay         *bool // tcp链接是否设置TCP_NODELAY 默认 nil即true --关闭Nagle算法，降低小包延迟，需要保留Nagle算法时设置为false
+	TCPKeepAlivePeriod int   // tcp链接SO_KEEPALIVE探测间隔(单位：秒) 默认 0 --为0时使用系统默认，小于0时关闭keepalive，最大32767
+
+	HideLogo bool // 创建服务器时是否不输出logo和版本信息 默认 false --使用结构化日志时可以开启
+
+	FragmentSize      uint32 // SendMsg数据超过该长度时拆分为多个分片发送 默认 0 --不拆分，需小于MaxPacketSize减去分片头12字节
+	MaxFragmentedSize uint32 // 接收方还原分片后的消息最大长度 默认 0 --不接收分片消息
+	FragmentTimeout   int    // 接收方等待分片收齐的最长时间(单位：毫秒) 默认 10000 --超时未收齐的分片被丢弃
+
+	Decoder             string // 默认使用的解码器 tlv/ltv/htlv-crc/tlv-crc32/tlv-adler32/varint/length-field/delimiter/fixed/none 默认 "tlv" --代码中调用SetDecoder时以代码为准
+	DecoderByteOrder    string // 长度字段的字节序 big/little 默认 "" 即大端 --只有tlv、tlv-crc32、tlv-adler32和length-field解码器使用，其他解码器设置时创建Server报错
+	LengthFieldOffset   int    // length-field解码器 长度字段偏移量
+	LengthFieldLength   int    // length-field解码器 长度字段的字节数 1/2/3/4/8
+	LengthAdjustment    int    // length-field解码器 长度调整
+	InitialBytesToStrip int    // length-field解码器 需要跳过的字节数
+	FrameDelimiter      string // delimiter解码器 帧分隔符 默认 "\n"
+	FixedFrameSize      int    // fixed解码器 每帧的字节数
 }
 
 // GlobalObject 定义一个全局的对象
 var GlobalObject *Config
 
+// 保证命令行参数和默认配置文件只加载一次
+var loadOnce sync.Once
+
 // PathExists  判断一个文件是否存在
 func PathExists(path string) (bool, error) {
 	_, err := os.Stat(path)
@@ -74,7 +135,7 @@ func PathExists(path string) (bool, error) {
 	return false, err
 }
 
-// Reload 读取用户的配置文件
+// Reload 读取命令行参数-c指定的配置文件，文件不存在或格式错误时记录日志并保持当前配置
 func (g *Config) Reload() {
 	confFilePath := args.Args.ConfigFile
 	if confFileExists, _ := PathExists(confFilePath); confFileExists != true {
@@ -85,38 +146,105 @@ func (g *Config) Reload() {
 		return
 	}
 
-	data, err := os.ReadFile(confFilePath)
-	if err != nil {
-		panic(err)
+	if err := g.Load(confFilePath); err != nil {
+		xlog.ErrorF("load config file %s error: %v", confFilePath, err)
 	}
+}
+
+// Load 读取path指定的配置文件覆盖当前配置，并初始化日志模块配置
+// 文件不存在或格式错误时返回错误，当前配置保持不变
+func (g *Config) Load(path string) error {
+	defer g.InitLogConfig()
 
-	err = json.Unmarshal(data, g)
+	data, err := os.ReadFile(path)
 	if err != nil {
-		panic(err)
+		return err
+	}
+
+	// 先解析到副本中，避免格式错误时只覆盖了部分字段
+	conf := *g
+	if err = json.Unmarshal(data, &conf); err != nil {
+		return fmt.Errorf("parse config file %s: %w", path, err)
 	}
+	*g = conf
 
-	g.InitLogConfig()
+	return nil
 }
 
-// Show 打印配置信息
+// Show 通过日志输出配置信息，输出位置由xlog的配置决定
 func (g *Config) Show() {
+	var b strings.Builder
+	g.ShowTo(&b)
+
+	xlog.Info(strings.TrimSuffix(b.String(), "\n"))
+}
+
+// ShowTo 将配置信息写入w，需要输出到日志以外的位置时使用
+func (g *Config) ShowTo(w io.Writer) {
 	objVal := reflect.ValueOf(g).Elem()
 	objType := reflect.TypeOf(*g)
 
-	fmt.Println("===== Fastnet Global Config =====")
+	_, _ = fmt.Fprintln(w, "===== Fastnet Global Config =====")
 	for i := 0; i < objVal.NumField(); i++ {
 		field := objVal.Field(i)
 		typeField := objType.Field(i)
 
-		fmt.Printf("%s: %v\n", typeField.Name, field.Interface())
+		_, _ = fmt.Fprintf(w, "%s: %v\n", typeField.Name, field.Interface())
 	}
-	fmt.Println("==============================")
+	_, _ = fmt.Fprintln(w, "==============================")
 }
 
 func (g *Config) HeartbeatMaxDuration() time.Duration {
 	return time.Duration(g.HeartbeatMax) * time.Second
 }
 
+// HandlerTimeoutDuration 业务处理函数默认的超时时间，为0时不限制
+func (g *Config) HandlerTimeoutDuration() time.Duration {
+	return time.Duration(g.HandlerTimeout) * time.Millisecond
+}
+
+// MaxConnLifetimeDuration 服务端链接的最长存活时间，为0时不限制
+func (g *Config) MaxConnLifetimeDuration() time.Duration {
+	return time.Duration(g.MaxConnLifetime) * time.Second
+}
+
+// FirstMessageTimeoutDuration 等待服务端链接第一条完整消息的最长时间，为0时不限制
+func (g *Config) FirstMessageTimeoutDuration() time.Duration {
+	return time.Duration(g.FirstMessageTimeout) * time.Second
+}
+
+// TCPNoDelayEnabled tcp链接是否设置TCP_NODELAY，没有配置时为true
+func (g *Config) TCPNoDelayEnabled() bool {
+	return g.TCPNoDelay == nil || *g.TCPNoDelay
+}
+
+// TCPKeepAlivePeriodDuration tcp链接keepalive的探测间隔，为0时使用系统默认，小于0时关闭keepalive
+func (g *Config) TCPKeepAlivePeriodDuration() time.Duration {
+	if g.TCPKeepAlivePeriod < 0 {
+		return -1
+	}
+	return time.Duration(g.TCPKeepAlivePeriod) * time.Second
+}
+
+// FragmentTimeoutDuration 接收方等待分片收齐的最长时间
+func (g *Config) FragmentTimeoutDuration() time.Duration {
+	return time.Duration(g.FragmentTimeout) * time.Millisecond
+}
+
+// FrameHeadReserve 计算断粘包缓冲区上限时为包头预留的字节数
+const FrameHeadReserve = 64
+
+// MaxFrameAccumSize 断粘包缓冲区最多累积的半包字节数，返回0表示不限制
+func (g *Config) MaxFrameAccumSize() int {
+	if g.MaxFrameAccum > 0 {
+		return int(g.MaxFrameAccum)
+	}
+	if g.MaxPacketSize > 0 {
+		return int(g.MaxPacketSize) + FrameHeadReserve
+	}
+	return 0
+}
+
 func (g *Config) InitLogConfig() {
 	if g.LogFile != "" {
 		xlog.SetLogFile(g.LogDir, g.LogFile)
@@ -131,30 +259,38 @@ func (g *Config) InitLogConfig() {
 	if g.LogIsolationLevel > xlog.LogDebug {
 		xlog.SetLogLevel(g.LogIsolationLevel)
 	}
+	if g.LogAsyncBuffSize > 0 {
+		xlog.SetAsync(g.LogAsyncBuffSize, g.logAsyncPolicy())
+	}
+	if g.LogNoCaller {
+		xlog.SetCallerEnabled(false)
+	}
 }
 
-func init() {
+// 异步日志队列已满时的处理策略
+func (g *Config) logAsyncPolicy() int {
+	if g.LogAsyncDrop {
+		return xlog.AsyncDrop
+	}
+	return xlog.AsyncBlock
+}
+
+// DefaultConfig 返回一份默认配置，不解析命令行参数也不读取配置文件
+func DefaultConfig() *Config {
 	pwd, err := os.Getwd()
 	if err != nil {
 		pwd = "."
 	}
 
-	args.InitConfigFlag(pwd+"/conf/fastnet.json", "The configuration file defaults to <exeDir>/conf/fastnet.json if it is not set.")
-
-	// 防止 go test 出现"flag provided but not defined: -test.panic on exit0"等错误
-	testing.Init()
-	uflag.Parse()
-
-	args.FlagHandle()
-
-	// 初始化GlobalObject变量，设置一些默认值
-	GlobalObject = &Config{
+	return &Config{
 		Name:              "FastnetServerApp",
 		Version:           "V1.0",
 		TCPPort:           29000,
 		WsPort:            28000,
 		Host:              "0.0.0.0",
 		MaxConn:           12000,
+		AcceptConcurrency: 1,
+		Network:           NetworkTCP,
 		MaxPacketSize:     4096,
 		WorkerPoolSize:    10,
 		MaxWorkerTaskLen:  1024,
@@ -164,13 +300,59 @@ func init() {
 		LogFile:           "", // 默认日志文件为空，打印到stderr
 		LogIsolationLevel: 0,
 		HeartbeatMax:      10, // 默认心跳检测最长间隔为10秒
+		HeartbeatJitter:   0.1,
 		IOReadBuffSize:    1024,
 		CertFile:          "",
 		PrivateKeyFile:    "",
 		Mode:              ServerModeTcp,
 		RouterSlicesMode:  true,
+
+		MaxConcurrentHandlers: 10000,
+
+		FragmentTimeout: 10000,
+
+		Decoder:        DecoderTLV,
+		FrameDelimiter: "\n",
 	}
+}
+
+// InitConfig 显式初始化全局配置：先恢复默认值，再加载path指定的配置文件，path为空时只使用默认值
+// 调用后创建Server/Client时不再解析命令行参数和加载默认路径的配置文件，适合测试和嵌入到其他程序中使用
+// 配置文件不存在或格式错误时返回错误，此时全局配置保持为默认值
+func InitConfig(path string) error {
+	loadOnce.Do(func() {})
+
+	*GlobalObject = *DefaultConfig()
+	if path == "" {
+		GlobalObject.InitLogConfig()
+		return nil
+	}
+
+	return GlobalObject.Load(path)
+}
+
+// EnsureLoaded 没有调用过InitConfig时，解析命令行参数-c并加载对应的配置文件(默认<pwd>/conf/fastnet.json)，只执行一次
+// 创建Server/Client时会自动调用，需要在创建之前读取配置文件中的参数时可以手动调用
+func EnsureLoaded() {
+	loadOnce.Do(func() {
+		if !flag.Parsed() {
+			uflag.Parse()
+		}
+		args.FlagHandle()
+
+		// 从配置文件中加载一些用户配置的参数
+		GlobalObject.Reload()
+	})
+}
+
+func init() {
+	pwd, err := os.Getwd()
+	if err != nil {
+		pwd = "."
+	}
+
+	args.InitConfigFlag(pwd+"/conf/fastnet.json", "The configuration file defaults to <exeDir>/conf/fastnet.json if it is not set.")
 
-	// 从配置文件中加载一些用户配置的参数
-	GlobalObject.Reload()
+	// 初始化时只设置默认值，命令行参数和配置文件在首次创建Server/Client时加载，避免导入包时产生副作用
+	GlobalObject = DefaultConfig()
 }
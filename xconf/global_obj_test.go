@@ -0,0 +1,57 @@
+/**
+* @File: global_obj_test.go
+* @Author: Jason Woo
+* @Date: 2026/10/16 12:12
+**/
+
+package xconf
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func writeConfigFile(t *testing.T, content string) string {
+	path := filepath.Join(t.TempDir(), "fastnet.json")
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestInitConfig(t *testing.T) {
+	t.Cleanup(func() { _ = InitConfig("") })
+
+	if err := InitConfig(writeConfigFile(t, `{"Name": "demo", "TCPPort": 30000}`)); err != nil {
+		t.Fatal(err)
+	}
+	if GlobalObject.Name != "demo" || GlobalObject.TCPPort != 30000 {
+		t.Fatalf("config not loaded: Name = %q, TCPPort = %d", GlobalObject.Name, GlobalObject.TCPPort)
+	}
+	// 未配置的字段保持默认值
+	if GlobalObject.MaxConn != DefaultConfig().MaxConn {
+		t.Fatalf("MaxConn = %d, want default", GlobalObject.MaxConn)
+	}
+
+	// 显式初始化后不再自动加载默认路径的配置文件
+	EnsureLoaded()
+	if GlobalObject.Name != "demo" {
+		t.Fatalf("EnsureLoaded overwrote explicit config: Name = %q", GlobalObject.Name)
+	}
+}
+
+func TestInitConfigMalformed(t *testing.T) {
+	t.Cleanup(func() { _ = InitConfig("") })
+
+	if err := InitConfig(writeConfigFile(t, `{"Name": "demo",`)); err == nil {
+		t.Fatal("malformed config should return an error")
+	}
+	if GlobalObject.Name != DefaultConfig().Name {
+		t.Fatalf("malformed config should keep defaults, Name = %q", GlobalObject.Name)
+	}
+
+	if err := InitConfig(filepath.Join(t.TempDir(), "missing.json")); err == nil {
+		t.Fatal("missing config file should return an error")
+	}
+}
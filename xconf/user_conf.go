@@ -8,84 +8,198 @@ package xconf
 
 import "github.com/dyowoo/fastnet/xlog"
 
-// UserConfToGlobal 注意如果使用UserConf应该调用方法同步至 GlobalConfObject 因为其他参数是调用的此结构体参数
+// UserConfToGlobal 将用户配置同步至GlobalObject，会影响之后所有读取全局配置的Server/Client
+// NewUserConfServer不再调用该方法，每个Server使用合并后的独立配置
 func UserConfToGlobal(config *Config) {
+	EnsureLoaded()
+	GlobalObject.Merge(config)
+	applyUserLogConfig(config, GlobalObject)
+}
+
+// 日志是进程级的，只有同步到全局配置时才按用户配置中设置了的日志参数修改xlog
+func applyUserLogConfig(config, merged *Config) {
+	if merged.LogIsolationLevel > xlog.LogDebug {
+		xlog.SetLogLevel(merged.LogIsolationLevel)
+	}
+	if config.LogFile != "" {
+		xlog.SetLogFile(merged.LogDir, merged.LogFile)
+	}
+	if config.LogAsyncBuffSize > 0 {
+		xlog.SetAsync(merged.LogAsyncBuffSize, merged.logAsyncPolicy())
+	}
+	if config.LogNoCaller {
+		xlog.SetCallerEnabled(false)
+	}
+}
+
+// Merge 将config中非零值的参数覆盖到g中，只合并参数，不修改xlog等进程级的设置
+func (g *Config) Merge(config *Config) {
 
 	// Server
 	if config.Name != "" {
-		GlobalObject.Name = config.Name
+		g.Name = config.Name
 	}
 	if config.Host != "" {
-		GlobalObject.Host = config.Host
+		g.Host = config.Host
 	}
 	if config.TCPPort != 0 {
-		GlobalObject.TCPPort = config.TCPPort
+		g.TCPPort = config.TCPPort
 	}
 
 	// fastnet2
 	if config.Version != "" {
-		GlobalObject.Version = config.Version
+		g.Version = config.Version
 	}
 	if config.MaxPacketSize != 0 {
-		GlobalObject.MaxPacketSize = config.MaxPacketSize
+		g.MaxPacketSize = config.MaxPacketSize
 	}
 	if config.MaxConn != 0 {
-		GlobalObject.MaxConn = config.MaxConn
+		g.MaxConn = config.MaxConn
+	}
+	if config.AcceptConcurrency != 0 {
+		g.AcceptConcurrency = config.AcceptConcurrency
+	}
+	if config.ReusePort {
+		g.ReusePort = config.ReusePort
+	}
+	if config.Network != "" {
+		g.Network = config.Network
 	}
 	if config.WorkerPoolSize != 0 {
-		GlobalObject.WorkerPoolSize = config.WorkerPoolSize
+		g.WorkerPoolSize = config.WorkerPoolSize
 	}
 	if config.MaxWorkerTaskLen != 0 {
-		GlobalObject.MaxWorkerTaskLen = config.MaxWorkerTaskLen
+		g.MaxWorkerTaskLen = config.MaxWorkerTaskLen
 	}
 	if config.WorkerMode != "" {
-		GlobalObject.WorkerMode = config.WorkerMode
+		g.WorkerMode = config.WorkerMode
+	}
+	if config.MaxConcurrentHandlers != 0 {
+		g.MaxConcurrentHandlers = config.MaxConcurrentHandlers
+	}
+	if config.MaxConcurrentUpgrades != 0 {
+		g.MaxConcurrentUpgrades = config.MaxConcurrentUpgrades
+	}
+	if config.DegradedQueueLen != 0 {
+		g.DegradedQueueLen = config.DegradedQueueLen
 	}
 
 	if config.MaxMsgChanLen != 0 {
-		GlobalObject.MaxMsgChanLen = config.MaxMsgChanLen
+		g.MaxMsgChanLen = config.MaxMsgChanLen
 	}
 	if config.IOReadBuffSize != 0 {
-		GlobalObject.IOReadBuffSize = config.IOReadBuffSize
+		g.IOReadBuffSize = config.IOReadBuffSize
+	}
+	if config.MaxFrameAccum != 0 {
+		g.MaxFrameAccum = config.MaxFrameAccum
+	}
+	if config.FrameBuffInitCap != 0 {
+		g.FrameBuffInitCap = config.FrameBuffInitCap
+	}
+	// 指针为nil表示没有配置，用户可以显式关闭TCP_NODELAY
+	if config.TCPNoDelay != nil {
+		noDelay := *config.TCPNoDelay
+		g.TCPNoDelay = &noDelay
+	}
+	if config.TCPKeepAlivePeriod != 0 {
+		g.TCPKeepAlivePeriod = config.TCPKeepAlivePeriod
+	}
+	if config.FragmentSize != 0 {
+		g.FragmentSize = config.FragmentSize
+	}
+	if config.MaxFragmentedSize != 0 {
+		g.MaxFragmentedSize = config.MaxFragmentedSize
+	}
+	if config.FragmentTimeout != 0 {
+		g.FragmentTimeout = config.FragmentTimeout
 	}
 
 	// 默认是False, config没有初始化即使用默认配置
-	GlobalObject.LogIsolationLevel = config.LogIsolationLevel
-	if GlobalObject.LogIsolationLevel > xlog.LogDebug {
-		xlog.SetLogLevel(GlobalObject.LogIsolationLevel)
-	}
+	g.LogIsolationLevel = config.LogIsolationLevel
 
 	// 不同于上方必填项 日志目前如果没配置应该使用默认配置
 	if config.LogDir != "" {
-		GlobalObject.LogDir = config.LogDir
+		g.LogDir = config.LogDir
 	}
 
 	if config.LogFile != "" {
-		GlobalObject.LogFile = config.LogFile
-		xlog.SetLogFile(GlobalObject.LogDir, GlobalObject.LogFile)
+		g.LogFile = config.LogFile
+	}
+
+	if config.LogAsyncBuffSize > 0 {
+		g.LogAsyncBuffSize = config.LogAsyncBuffSize
+		g.LogAsyncDrop = config.LogAsyncDrop
+	}
+
+	if config.LogNoCaller {
+		g.LogNoCaller = config.LogNoCaller
 	}
 
 	// Keepalive
 	if config.HeartbeatMax != 0 {
-		GlobalObject.HeartbeatMax = config.HeartbeatMax
+		g.HeartbeatMax = config.HeartbeatMax
+	}
+	if config.HeartbeatJitter != 0 {
+		g.HeartbeatJitter = config.HeartbeatJitter
+	}
+	if config.MaxConnLifetime != 0 {
+		g.MaxConnLifetime = config.MaxConnLifetime
+	}
+	if config.FirstMessageTimeout != 0 {
+		g.FirstMessageTimeout = config.FirstMessageTimeout
+	}
+	if config.MessagePool {
+		g.MessagePool = config.MessagePool
+	}
+	if config.HandlerTimeout != 0 {
+		g.HandlerTimeout = config.HandlerTimeout
 	}
 
 	// TLS
 	if config.CertFile != "" {
-		GlobalObject.CertFile = config.CertFile
+		g.CertFile = config.CertFile
 	}
 	if config.PrivateKeyFile != "" {
-		GlobalObject.PrivateKeyFile = config.PrivateKeyFile
+		g.PrivateKeyFile = config.PrivateKeyFile
 	}
 
 	if config.Mode != "" {
-		GlobalObject.Mode = config.Mode
+		g.Mode = config.Mode
 	}
 	if config.WsPort != 0 {
-		GlobalObject.WsPort = config.WsPort
+		g.WsPort = config.WsPort
 	}
 
 	if config.RouterSlicesMode {
-		GlobalObject.RouterSlicesMode = config.RouterSlicesMode
+		g.RouterSlicesMode = config.RouterSlicesMode
+	}
+	if config.HideLogo {
+		g.HideLogo = config.HideLogo
+	}
+
+	// Decoder
+	if config.Decoder != "" {
+		g.Decoder = config.Decoder
+	}
+	if config.DecoderByteOrder != "" {
+		g.DecoderByteOrder = config.DecoderByteOrder
+	}
+	if config.LengthFieldOffset != 0 {
+		g.LengthFieldOffset = config.LengthFieldOffset
+	}
+	if config.LengthFieldLength != 0 {
+		g.LengthFieldLength = config.LengthFieldLength
+	}
+	if config.LengthAdjustment != 0 {
+		g.LengthAdjustment = config.LengthAdjustment
+	}
+	if config.InitialBytesToStrip != 0 {
+		g.InitialBytesToStrip = config.InitialBytesToStrip
+	}
+	if config.FrameDelimiter != "" {
+		g.FrameDelimiter = config.FrameDelimiter
+	}
+	if config.FixedFrameSize != 0 {
+		g.FixedFrameSize = config.FixedFrameSize
 	}
 }
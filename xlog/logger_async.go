@@ -0,0 +1,156 @@
+/**
+* @File: logger_async.go
+* @Author: Jason Woo
+* @Date: 2026/10/16 10:12
+**/
+
+package xlog
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+// 异步日志队列已满时的处理策略
+const (
+	AsyncBlock = iota // 队列已满时阻塞等待，保证日志不丢失
+	AsyncDrop         // 队列已满时丢弃当前日志，保证调用方不被阻塞
+)
+
+// 异步队列中的一条记录，done不为nil时表示这是一个flush标记
+type asyncEntry struct {
+	level int
+	data  []byte
+	done  chan struct{}
+}
+
+// asyncOutput 异步日志输出模块
+// 日志被格式化后放入有界队列，由后台协程按顺序写出到日志的输出目标
+type asyncOutput struct {
+	log     *FastLoggerCore
+	queue   chan asyncEntry // 有界日志队列
+	policy  int             // 队列已满时的处理策略
+	dropped uint64          // 因队列已满而被丢弃的日志条数
+	closed  bool            // 队列是否已经关闭
+	mu      sync.RWMutex    // 保护closed状态，防止向已关闭的队列写入
+	exit    chan struct{}   // 后台协程退出信号
+}
+
+func newAsyncOutput(log *FastLoggerCore, bufSize int, policy int) *asyncOutput {
+	a := &asyncOutput{
+		log:    log,
+		queue:  make(chan asyncEntry, bufSize),
+		policy: policy,
+		exit:   make(chan struct{}),
+	}
+
+	go a.run()
+
+	return a
+}
+
+// 后台写日志协程
+func (a *asyncOutput) run() {
+	defer close(a.exit)
+
+	for entry := range a.queue {
+		if entry.done != nil {
+			close(entry.done)
+			continue
+		}
+		_ = a.log.write(entry.level, entry.data)
+	}
+}
+
+// put 将一条日志放入队列，调用方需持有日志对象的锁
+func (a *asyncOutput) put(level int, data []byte) {
+	entry := asyncEntry{level: level, data: data}
+
+	if a.policy == AsyncDrop {
+		select {
+		case a.queue <- entry:
+		default:
+			atomic.AddUint64(&a.dropped, 1)
+		}
+		return
+	}
+
+	a.queue <- entry
+}
+
+// flush 阻塞等待，直到flush调用之前进入队列的日志全部写出
+func (a *asyncOutput) flush() {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
+	if a.closed {
+		return
+	}
+
+	done := make(chan struct{})
+	a.queue <- asyncEntry{done: done}
+	<-done
+}
+
+// stop 关闭队列，等待队列中剩余的日志全部写出后返回
+func (a *asyncOutput) stop() {
+	a.mu.Lock()
+	if a.closed {
+		a.mu.Unlock()
+		return
+	}
+	a.closed = true
+	close(a.queue)
+	a.mu.Unlock()
+
+	<-a.exit
+}
+
+// SetAsync 开启异步日志模式
+// bufSize 异步队列的最大长度，小于等于0时恢复为同步模式
+// policy  队列已满时的处理策略 AsyncBlock 或 AsyncDrop
+func (log *FastLoggerCore) SetAsync(bufSize int, policy int) {
+	// 先关闭旧的异步队列，保证切换前后日志顺序不乱
+	log.SetSync()
+
+	if bufSize <= 0 {
+		return
+	}
+
+	log.mu.Lock()
+	log.async = newAsyncOutput(log, bufSize, policy)
+	log.mu.Unlock()
+}
+
+// SetSync 恢复为同步日志模式(默认)，队列中未写出的日志会先全部写出
+func (log *FastLoggerCore) SetSync() {
+	log.mu.Lock()
+	async := log.async
+	log.async = nil
+	log.mu.Unlock()
+
+	if async != nil {
+		async.stop()
+	}
+}
+
+// IsAsync 当前是否为异步日志模式
+func (log *FastLoggerCore) IsAsync() bool {
+	log.mu.Lock()
+	defer log.mu.Unlock()
+
+	return log.async != nil
+}
+
+// DroppedCount 获取异步模式下因队列已满而被丢弃的日志条数
+func (log *FastLoggerCore) DroppedCount() uint64 {
+	log.mu.Lock()
+	async := log.async
+	log.mu.Unlock()
+
+	if async == nil {
+		return 0
+	}
+
+	return atomic.LoadUint64(&async.dropped)
+}
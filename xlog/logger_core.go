@@ -11,6 +11,7 @@ import (
 	"context"
 	"fmt"
 	"github.com/dyowoo/fastnet/xutils"
+	"io"
 	"os"
 	"path/filepath"
 	"runtime"
@@ -70,8 +71,21 @@ type FastLoggerCore struct {
 	buf            bytes.Buffer // 输出的缓冲区
 	isolationLevel int          // 日志隔离级别
 	calledDepth    int          // 获取日志文件名和代码上述的runtime.Call 的函数调用层数
+	noCaller       bool         // 是否关闭调用位置，关闭时不调用runtime.Caller，也不输出文件名和行号
+	formatter      Formatter    // 日志格式，为nil时使用默认的文本格式
 	fw             *xutils.Writer
 	onLogHook      func([]byte)
+	async          *asyncOutput  // 异步输出模块，为nil时同步输出
+	outputs        []levelOutput // 按日志级别区间注册的输出目标
+	outputsLock    sync.RWMutex  // 保护outputs和fw，异步模式下后台协程不持有mu，写出时同样通过该锁访问
+}
+
+// levelOutput 日志级别区间[minLevel, maxLevel]对应的输出目标
+type levelOutput struct {
+	minLevel int
+	maxLevel int
+	w        io.Writer
+	owned    bool // 是否由SetLevelFile创建，ClearLevelOutput时只关闭自己创建的日志文件
 }
 
 func NewFastLog(prefix string, flag int) *FastLoggerCore {
@@ -85,6 +99,7 @@ func NewFastLog(prefix string, flag int) *FastLoggerCore {
 
 // CleanFastLog Recycle log resources
 func CleanFastLog(log *FastLoggerCore) {
+	log.SetSync()
 	log.closeFile()
 }
 
@@ -144,18 +159,10 @@ func (log *FastLoggerCore) formatHeader(t time.Time, file string, line int, leve
 		}
 
 		// Short file name flag or long file name flag is set
-		if log.flag&(BitShortFile|BitLongFile) != 0 {
+		if log.withCaller() {
 			// Short file name flag is set
 			if log.flag&BitShortFile != 0 {
-				short := file
-				for i := len(file) - 1; i > 0; i-- {
-					if file[i] == '/' {
-						// Get the file name after the last '/' character, e.g. "fastnet2.go" from "/home/go/src/fastnet2.go"
-						short = file[i+1:]
-						break
-					}
-				}
-				file = short
+				file = shortFileName(file)
 			}
 			buf.WriteString(file)
 			buf.WriteByte(':')
@@ -165,19 +172,45 @@ func (log *FastLoggerCore) formatHeader(t time.Time, file string, line int, leve
 	}
 }
 
+// 完整路径中的文件名，例如 "/home/go/src/fastnet2.go" 中的 "fastnet2.go"
+func shortFileName(file string) string {
+	for i := len(file) - 1; i > 0; i-- {
+		if file[i] == '/' {
+			return file[i+1:]
+		}
+	}
+	return file
+}
+
 // OutPut outputs log file, the original method
 func (log *FastLoggerCore) OutPut(level int, s string) error {
+	return log.output(0, level, s)
+}
+
+// OutPutDepth 按level的日志隔离级别输出一条日志，调用位置额外向上跳过skip层，只影响这一条日志
+// 在封装函数中直接调用OutPutDepth(0, ...)时日志中的调用位置为封装函数的调用者，每多一层封装skip加1
+// 与SetCallerDepth不同，不会改变同一个日志对象上其他调用的调用位置
+func (log *FastLoggerCore) OutPutDepth(skip int, level int, s string) error {
+	if log.verifyLogIsolation(level) {
+		return nil
+	}
+	return log.output(skip, level, s)
+}
+
+// output 由OutPut和OutPutDepth调用，比calledDepth多跳过自身这一层
+func (log *FastLoggerCore) output(skip int, level int, s string) error {
 	now := time.Now() // get current time
 	var file string   // file name of the current caller of the log interface
 	var line int      // line number of the executed code
 	log.mu.Lock()
 	defer log.mu.Unlock()
 
-	if log.flag&(BitShortFile|BitLongFile) != 0 {
+	if log.withCaller() {
+		depth := log.calledDepth + 1 + skip
 		log.mu.Unlock()
 		var ok bool
 		// get the file name and line number of the current caller
-		_, file, line, ok = runtime.Caller(log.calledDepth)
+		_, file, line, ok = runtime.Caller(depth)
 		if !ok {
 			file = "unknown-file"
 			line = 0
@@ -187,22 +220,27 @@ func (log *FastLoggerCore) OutPut(level int, s string) error {
 
 	// reset buffer
 	log.buf.Reset()
-	// write log header
-	log.formatHeader(now, file, line, level)
-	// write log content
-	log.buf.WriteString(s)
-	// add line break
-	if len(s) > 0 && s[len(s)-1] != '\n' {
-		log.buf.WriteByte('\n')
+	if log.formatter != nil {
+		log.formatEntry(now, file, line, level, s)
+	} else {
+		// write log header
+		log.formatHeader(now, file, line, level)
+		// write log content
+		log.buf.WriteString(s)
+		// add line break
+		if len(s) > 0 && s[len(s)-1] != '\n' {
+			log.buf.WriteByte('\n')
+		}
 	}
 
 	var err error
-	if log.fw == nil {
-		// if log file is not set, output to console
-		_, _ = os.Stderr.Write(log.buf.Bytes())
+	if log.async != nil {
+		// 异步模式下拷贝一份日志内容交给后台协程写出
+		line := make([]byte, log.buf.Len())
+		copy(line, log.buf.Bytes())
+		log.async.put(level, line)
 	} else {
-		// write the filled buffer to IO output
-		_, err = log.fw.Write(log.buf.Bytes())
+		err = log.write(level, log.buf.Bytes())
 	}
 
 	if log.onLogHook != nil {
@@ -211,6 +249,40 @@ func (log *FastLoggerCore) OutPut(level int, s string) error {
 	return err
 }
 
+// write 将格式化好的日志写到输出目标
+// 如果该级别注册了输出目标则写到所有匹配的目标，否则写到默认的输出目标
+func (log *FastLoggerCore) write(level int, p []byte) error {
+	var err error
+	matched := false
+
+	log.outputsLock.RLock()
+	defer log.outputsLock.RUnlock()
+
+	for _, out := range log.outputs {
+		if level < out.minLevel || level > out.maxLevel {
+			continue
+		}
+		matched = true
+		if _, e := out.w.Write(p); e != nil {
+			err = e
+		}
+	}
+
+	if matched {
+		return err
+	}
+
+	if log.fw == nil {
+		// if log file is not set, output to console
+		_, _ = os.Stderr.Write(p)
+		return nil
+	}
+
+	// write the filled buffer to IO output
+	_, err = log.fw.Write(p)
+	return err
+}
+
 func (log *FastLoggerCore) verifyLogIsolation(logLevel int) bool {
 	if log.isolationLevel > logLevel {
 		return true
@@ -280,6 +352,7 @@ func (log *FastLoggerCore) FatalF(format string, v ...interface{}) {
 		return
 	}
 	_ = log.OutPut(LogFatal, fmt.Sprintf(format, v...))
+	log.Flush()
 	os.Exit(1)
 }
 
@@ -288,6 +361,7 @@ func (log *FastLoggerCore) Fatal(v ...interface{}) {
 		return
 	}
 	_ = log.OutPut(LogFatal, fmt.Sprintln(v...))
+	log.Flush()
 	os.Exit(1)
 }
 
@@ -297,6 +371,7 @@ func (log *FastLoggerCore) PanicF(format string, v ...interface{}) {
 	}
 	s := fmt.Sprintf(format, v...)
 	_ = log.OutPut(LogPanic, s)
+	log.Flush()
 	panic(s)
 }
 
@@ -306,6 +381,7 @@ func (log *FastLoggerCore) Panic(v ...interface{}) {
 	}
 	s := fmt.Sprintln(v...)
 	_ = log.OutPut(LogPanic, s)
+	log.Flush()
 	panic(s)
 }
 
@@ -340,6 +416,35 @@ func (log *FastLoggerCore) AddFlag(flag int) {
 	log.flag |= flag
 }
 
+// SetCallerDepth 设置获取调用位置时runtime.Caller跳过的调用层数
+// 默认NewFastLog创建的日志对象为2，StdFastLog为3；在自己的函数中封装日志方法时每多一层封装加1，日志中的文件名和行号才是封装函数的调用者
+// 修改对该日志对象上的所有调用生效，封装函数与其他代码共用同一个日志对象时应使用OutPutDepth或为封装函数单独创建日志对象
+func (log *FastLoggerCore) SetCallerDepth(depth int) {
+	log.mu.Lock()
+	defer log.mu.Unlock()
+	log.calledDepth = depth
+}
+
+// CallerDepth 获取当前获取调用位置时跳过的调用层数
+func (log *FastLoggerCore) CallerDepth() int {
+	log.mu.Lock()
+	defer log.mu.Unlock()
+	return log.calledDepth
+}
+
+// SetCallerEnabled 设置是否输出调用位置，默认按BitShortFile/BitLongFile输出
+// 关闭后不再对每条日志调用runtime.Caller，日志量很大时可以提高吞吐，标记位保持不变，重新开启后恢复原来的格式
+func (log *FastLoggerCore) SetCallerEnabled(enabled bool) {
+	log.mu.Lock()
+	defer log.mu.Unlock()
+	log.noCaller = !enabled
+}
+
+// 是否需要获取和输出调用位置，调用方需持有mu
+func (log *FastLoggerCore) withCaller() bool {
+	return !log.noCaller && log.flag&(BitShortFile|BitLongFile) != 0
+}
+
 // SetPrefix 设置日志的 用户自定义前缀字符串
 func (log *FastLoggerCore) SetPrefix(prefix string) {
 	log.mu.Lock()
@@ -349,44 +454,66 @@ func (log *FastLoggerCore) SetPrefix(prefix string) {
 
 // SetLogFile 设置日志文件输出
 func (log *FastLoggerCore) SetLogFile(fileDir string, fileName string) {
+	fw := xutils.New(filepath.Join(fileDir, fileName))
+
+	log.outputsLock.Lock()
+	defer log.outputsLock.Unlock()
+
 	if log.fw != nil {
 		_ = log.fw.Close()
 	}
-	log.fw = xutils.New(filepath.Join(fileDir, fileName))
+	log.fw = fw
 }
 
 // SetMaxAge 最大保留天数
 func (log *FastLoggerCore) SetMaxAge(ma int) {
-	if log.fw == nil {
-		return
-	}
 	log.mu.Lock()
 	defer log.mu.Unlock()
-	log.fw.SetMaxAge(ma)
+	log.rangeFileWriters(func(fw *xutils.Writer) {
+		fw.SetMaxAge(ma)
+	})
 }
 
 // SetMaxSize 单个日志最大容量 单位：字节
 func (log *FastLoggerCore) SetMaxSize(ms int64) {
-	if log.fw == nil {
-		return
-	}
 	log.mu.Lock()
 	defer log.mu.Unlock()
-	log.fw.SetMaxSize(ms)
+	log.rangeFileWriters(func(fw *xutils.Writer) {
+		fw.SetMaxSize(ms)
+	})
 }
 
 // SetConsole 同时输出控制台
 func (log *FastLoggerCore) SetConsole(b bool) {
-	if log.fw == nil {
-		return
+	log.outputsLock.RLock()
+	defer log.outputsLock.RUnlock()
+
+	if log.fw != nil {
+		log.fw.SetCons(b)
 	}
+}
+
+// Flush 将异步队列中尚未写出的日志以及文件缓冲全部刷新到输出目标
+// 程序退出前应调用此方法，保证日志不丢失
+func (log *FastLoggerCore) Flush() {
 	log.mu.Lock()
-	defer log.mu.Unlock()
-	log.fw.SetCons(b)
+	async := log.async
+	log.mu.Unlock()
+
+	if async != nil {
+		async.flush()
+	}
+
+	log.rangeFileWriters(func(fw *xutils.Writer) {
+		_ = fw.Flush()
+	})
 }
 
 // 关闭日志绑定的文件
 func (log *FastLoggerCore) closeFile() {
+	log.outputsLock.RLock()
+	defer log.outputsLock.RUnlock()
+
 	if log.fw != nil {
 		_ = log.fw.Close()
 	}
@@ -0,0 +1,118 @@
+/**
+* @File: logger_format.go
+* @Author: Jason Woo
+* @Date: 2026/10/16 13:34
+**/
+
+package xlog
+
+import (
+	"bytes"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// Entry 一条日志的内容，设置了Formatter时交给Formatter格式化
+type Entry struct {
+	Time    time.Time // 日志时间，没有设置时间相关的标记位时为零值
+	Level   int       // 日志级别 LogDebug/LogInfo/...
+	Prefix  string    // 日志对象的前缀
+	File    string    // 调用位置的文件名，按BitShortFile/BitLongFile取短文件名或完整路径，不输出调用位置时为""
+	Line    int       // 调用位置的行号
+	Message string    // 日志内容，不包含末尾的换行
+}
+
+// LevelName 日志级别的小写名称，例如 info
+func (e *Entry) LevelName() string {
+	if e.Level < 0 || e.Level >= len(levels) {
+		return "unknown"
+	}
+	return strings.ToLower(strings.Trim(levels[e.Level], "[]"))
+}
+
+// Formatter 日志格式化接口，将一条日志写入buf，需要以换行结尾
+// Format在日志对象的锁内调用，不需要自己加锁
+type Formatter interface {
+	Format(buf *bytes.Buffer, entry *Entry)
+}
+
+// LogfmtFormatter 以logfmt格式输出日志，每条日志为一行空格分隔的key=value:
+//
+//	time=2026-10-17T18:15:00.123456+08:00 level=info caller=server.go:42 msg="conn start, connID = 1"
+//
+// 值为空、包含空格、=、双引号或控制字符时用双引号包裹并转义
+type LogfmtFormatter struct{}
+
+const logfmtTimeLayout = "2006-01-02T15:04:05.000000Z07:00"
+
+func (f *LogfmtFormatter) Format(buf *bytes.Buffer, entry *Entry) {
+	if !entry.Time.IsZero() {
+		writeLogfmtPair(buf, "time", entry.Time.Format(logfmtTimeLayout))
+	}
+	writeLogfmtPair(buf, "level", entry.LevelName())
+	if entry.Prefix != "" {
+		writeLogfmtPair(buf, "prefix", entry.Prefix)
+	}
+	if entry.File != "" {
+		writeLogfmtPair(buf, "caller", entry.File+":"+strconv.Itoa(entry.Line))
+	}
+	writeLogfmtPair(buf, "msg", entry.Message)
+	buf.WriteByte('\n')
+}
+
+// 写入一个key=value，不是第一个时以空格分隔
+func writeLogfmtPair(buf *bytes.Buffer, key, value string) {
+	if buf.Len() > 0 {
+		buf.WriteByte(' ')
+	}
+	buf.WriteString(key)
+	buf.WriteByte('=')
+	if logfmtNeedsQuote(value) {
+		buf.WriteString(strconv.Quote(value))
+	} else {
+		buf.WriteString(value)
+	}
+}
+
+// 值是否需要用双引号包裹
+func logfmtNeedsQuote(value string) bool {
+	if value == "" {
+		return true
+	}
+	for _, r := range value {
+		if r <= ' ' || r == '=' || r == '"' || r == '\\' || r == utf8.RuneError || r == 0x7f {
+			return true
+		}
+	}
+	return false
+}
+
+// SetFormatter 设置日志的格式，传入nil时恢复为默认的文本格式
+// 设置Formatter后日志头部由Formatter输出，标记位只决定是否输出时间和调用位置
+func (log *FastLoggerCore) SetFormatter(formatter Formatter) {
+	log.mu.Lock()
+	defer log.mu.Unlock()
+	log.formatter = formatter
+}
+
+// 使用Formatter将日志写入buf，调用方需持有mu
+func (log *FastLoggerCore) formatEntry(t time.Time, file string, line int, level int, s string) {
+	entry := Entry{
+		Level:   level,
+		Prefix:  log.prefix,
+		Message: strings.TrimSuffix(s, "\n"),
+	}
+	if log.flag&(BitDate|BitTime|BitMicroSeconds) != 0 {
+		entry.Time = t
+	}
+	if log.withCaller() {
+		entry.File, entry.Line = file, line
+		if log.flag&BitShortFile != 0 {
+			entry.File = shortFileName(file)
+		}
+	}
+
+	log.formatter.Format(&log.buf, &entry)
+}
@@ -0,0 +1,77 @@
+/**
+* @File: logger_output.go
+* @Author: Jason Woo
+* @Date: 2026/10/16 11:05
+**/
+
+package xlog
+
+import (
+	"github.com/dyowoo/fastnet/xutils"
+	"io"
+	"path/filepath"
+)
+
+// SetLevelOutput 为日志级别区间[minLevel, maxLevel]注册一个输出目标
+// 同一级别可以注册多个输出目标，日志会写到所有匹配的目标
+// 没有注册任何输出目标的级别仍然写到默认的输出目标(日志文件或stderr)
+func (log *FastLoggerCore) SetLevelOutput(minLevel, maxLevel int, w io.Writer) {
+	if w == nil || minLevel > maxLevel {
+		return
+	}
+
+	log.addLevelOutput(levelOutput{minLevel: minLevel, maxLevel: maxLevel, w: w})
+}
+
+func (log *FastLoggerCore) addLevelOutput(out levelOutput) {
+	log.outputsLock.Lock()
+	defer log.outputsLock.Unlock()
+
+	log.outputs = append(log.outputs, out)
+}
+
+// SetLevelFile 为日志级别区间[minLevel, maxLevel]注册一个日志文件
+// 该文件与默认日志文件一样按天和大小切割，并受SetMaxAge/SetMaxSize控制
+func (log *FastLoggerCore) SetLevelFile(minLevel, maxLevel int, fileDir string, fileName string) {
+	fw := xutils.New(filepath.Join(fileDir, fileName))
+	if fw == nil {
+		return
+	}
+
+	if minLevel > maxLevel {
+		_ = fw.Close()
+		return
+	}
+
+	log.addLevelOutput(levelOutput{minLevel: minLevel, maxLevel: maxLevel, w: fw, owned: true})
+}
+
+// ClearLevelOutput 清除所有按级别注册的输出目标，恢复为单一输出目标
+// 只关闭SetLevelFile创建的日志文件，SetLevelOutput传入的输出目标由调用方自行关闭
+func (log *FastLoggerCore) ClearLevelOutput() {
+	log.outputsLock.Lock()
+	outputs := log.outputs
+	log.outputs = nil
+	log.outputsLock.Unlock()
+
+	for _, out := range outputs {
+		if fw, ok := out.w.(*xutils.Writer); ok && out.owned {
+			_ = fw.Close()
+		}
+	}
+}
+
+// 遍历所有带切割功能的日志文件，包括默认日志文件和按级别注册的日志文件
+func (log *FastLoggerCore) rangeFileWriters(f func(fw *xutils.Writer)) {
+	log.outputsLock.RLock()
+	defer log.outputsLock.RUnlock()
+
+	if log.fw != nil {
+		f(log.fw)
+	}
+	for _, out := range log.outputs {
+		if fw, ok := out.w.(*xutils.Writer); ok {
+			f(fw)
+		}
+	}
+}
@@ -7,10 +7,234 @@
 package xlog_test
 
 import (
+	"bytes"
+	"fmt"
 	"github.com/dyowoo/fastnet/xlog"
+	"github.com/dyowoo/fastnet/xutils"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
 	"testing"
 )
 
 func TestLogger(t *testing.T) {
 	xlog.Info("fastnet xlog info")
 }
+
+func TestLoggerAsyncFlush(t *testing.T) {
+	dir := t.TempDir()
+
+	log := xlog.NewFastLog("", xlog.BitDefault)
+	log.SetLogFile(dir, "async.log")
+	log.SetAsync(16, xlog.AsyncBlock)
+
+	const lines = 1000
+	for i := 0; i < lines; i++ {
+		log.InfoF("async line %d", i)
+	}
+	log.Flush()
+
+	data, err := os.ReadFile(filepath.Join(dir, "async.log"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := bytes.Count(data, []byte("\n")); n != lines {
+		t.Fatalf("expected %d lines, got %d", lines, n)
+	}
+
+	log.SetSync()
+	if log.IsAsync() {
+		t.Fatal("logger should be sync after SetSync")
+	}
+}
+
+func TestLoggerLevelOutput(t *testing.T) {
+	var errBuf, infoBuf bytes.Buffer
+
+	log := xlog.NewFastLog("", xlog.BitLevel)
+	log.SetLevelOutput(xlog.LogError, xlog.LogFatal, &errBuf)
+	log.SetLevelOutput(xlog.LogDebug, xlog.LogInfo, &infoBuf)
+
+	log.DebugF("debug line")
+	log.InfoF("info line")
+	log.ErrorF("error line")
+
+	if !bytes.Contains(errBuf.Bytes(), []byte("error line")) || bytes.Contains(errBuf.Bytes(), []byte("info line")) {
+		t.Fatalf("unexpected error output: %q", errBuf.String())
+	}
+	if !bytes.Contains(infoBuf.Bytes(), []byte("debug line")) || bytes.Contains(infoBuf.Bytes(), []byte("error line")) {
+		t.Fatalf("unexpected info output: %q", infoBuf.String())
+	}
+}
+
+// 封装了一层的日志函数
+func logWrapped(log *xlog.FastLoggerCore, msg string) {
+	log.InfoF(msg)
+}
+
+func TestLoggerCallerDepth(t *testing.T) {
+	var buf bytes.Buffer
+	log := xlog.NewFastLog("", xlog.BitTime|xlog.BitShortFile)
+	log.SetLevelOutput(xlog.LogDebug, xlog.LogFatal, &buf)
+
+	// 多一层封装时调用位置为封装函数的调用者
+	log.SetCallerDepth(log.CallerDepth() + 1)
+	_, _, line, _ := runtime.Caller(0)
+	logWrapped(log, "wrapped")
+	if want := fmt.Sprintf("logger_test.go:%d:", line+1); !strings.Contains(buf.String(), want) {
+		t.Fatalf("output %q does not contain caller %q", buf.String(), want)
+	}
+
+	buf.Reset()
+	log.SetCallerEnabled(false)
+	logWrapped(log, "no caller")
+	if strings.Contains(buf.String(), ".go:") || !strings.Contains(buf.String(), "no caller") {
+		t.Fatalf("unexpected output without caller: %q", buf.String())
+	}
+}
+
+func TestLoggerLogfmt(t *testing.T) {
+	cases := []struct {
+		msg  string
+		want string
+	}{
+		{"started", `level=info msg=started`},
+		{"conn start, connID = 1", `level=info msg="conn start, connID = 1"`},
+		{`say "hi"`, `level=info msg="say \"hi\""`},
+		{`path=C:\tmp`, `level=info msg="path=C:\\tmp"`},
+		{"line1\nline2", `level=info msg="line1\nline2"`},
+		{"", `level=info msg=""`},
+		{"中文", `level=info msg=中文`},
+	}
+
+	var buf bytes.Buffer
+	log := xlog.NewFastLog("", xlog.BitLevel)
+	log.SetLevelOutput(xlog.LogDebug, xlog.LogFatal, &buf)
+	log.SetFormatter(&xlog.LogfmtFormatter{})
+
+	for _, c := range cases {
+		buf.Reset()
+		log.InfoF("%s", c.msg)
+		if got := buf.String(); got != c.want+"\n" {
+			t.Errorf("msg %q: got %q, want %q", c.msg, got, c.want+"\n")
+		}
+	}
+
+	// 前缀和调用位置
+	buf.Reset()
+	log.SetPrefix("game server")
+	log.ResetFlags(xlog.BitTime | xlog.BitShortFile)
+	_, _, line, _ := runtime.Caller(0)
+	log.Info("with caller")
+	want := fmt.Sprintf(`level=info prefix="game server" caller=logger_test.go:%d msg="with caller"`, line+1)
+	if got := buf.String(); !strings.HasPrefix(got, "time=") || !strings.HasSuffix(got, want+"\n") {
+		t.Fatalf("got %q, want time=... %s", got, want)
+	}
+
+	// 恢复为文本格式
+	buf.Reset()
+	log.SetFormatter(nil)
+	log.Info("text")
+	if strings.Contains(buf.String(), "level=") {
+		t.Fatalf("unexpected text output: %q", buf.String())
+	}
+}
+
+// 使用OutPutDepth封装的日志函数
+func logWrappedDepth(log *xlog.FastLoggerCore, msg string) {
+	_ = log.OutPutDepth(0, xlog.LogInfo, msg)
+}
+
+func logStdWrappedDepth(msg string) {
+	_ = xlog.OutPutDepth(0, xlog.LogInfo, msg)
+}
+
+func TestLoggerOutPutDepth(t *testing.T) {
+	var buf bytes.Buffer
+	log := xlog.NewFastLog("", xlog.BitTime|xlog.BitShortFile)
+	log.SetLevelOutput(xlog.LogDebug, xlog.LogFatal, &buf)
+
+	_, _, line, _ := runtime.Caller(0)
+	logWrappedDepth(log, "wrapped")
+	log.InfoF("direct")
+	out := buf.String()
+	if want := fmt.Sprintf("logger_test.go:%d:", line+1); !strings.Contains(out, want) {
+		t.Fatalf("output %q does not contain wrapper caller %q", out, want)
+	}
+	// 同一个日志对象上的其他调用不受影响
+	if want := fmt.Sprintf("logger_test.go:%d:", line+2); !strings.Contains(out, want) {
+		t.Fatalf("output %q does not contain direct caller %q", out, want)
+	}
+
+	buf.Reset()
+	xlog.StdFastLog.SetLevelOutput(xlog.LogDebug, xlog.LogFatal, &buf)
+	defer xlog.StdFastLog.ClearLevelOutput()
+	_, _, line, _ = runtime.Caller(0)
+	logStdWrappedDepth("std wrapped")
+	if want := fmt.Sprintf("logger_test.go:%d:", line+1); !strings.Contains(buf.String(), want) {
+		t.Fatalf("output %q does not contain wrapper caller %q", buf.String(), want)
+	}
+}
+
+func TestLoggerClearLevelOutputKeepsUserWriters(t *testing.T) {
+	dir := t.TempDir()
+	userWriter := xutils.New(filepath.Join(dir, "user.log"))
+	defer userWriter.Close()
+
+	log := xlog.NewFastLog("", xlog.BitLevel)
+	log.SetLevelOutput(xlog.LogDebug, xlog.LogInfo, userWriter)
+	log.SetLevelFile(xlog.LogWarn, xlog.LogFatal, dir, "owned.log")
+	log.InfoF("user")
+	log.WarnF("owned")
+
+	log.ClearLevelOutput()
+
+	// SetLevelFile创建的文件关闭时写出了缓冲区中的日志
+	if data, err := os.ReadFile(filepath.Join(dir, "owned.log")); err != nil || !strings.Contains(string(data), "owned") {
+		t.Fatalf("owned.log = %q, %v", data, err)
+	}
+	// 调用方传入的输出目标没有被关闭，缓冲区中的日志仍未写出，之后仍可继续使用
+	if data, _ := os.ReadFile(filepath.Join(dir, "user.log")); len(data) != 0 {
+		t.Fatalf("user writer is closed by ClearLevelOutput: %q", data)
+	}
+	if err := userWriter.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	if data, _ := os.ReadFile(filepath.Join(dir, "user.log")); !strings.Contains(string(data), "user") {
+		t.Fatalf("user.log = %q", data)
+	}
+}
+
+func TestLoggerFlushWhileSettingLogFile(t *testing.T) {
+	dir := t.TempDir()
+	log := xlog.NewFastLog("", xlog.BitLevel)
+	log.SetLogFile(dir, "a.log")
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 50; i++ {
+			log.Flush()
+		}
+	}()
+	for i := 0; i < 50; i++ {
+		log.SetLogFile(dir, fmt.Sprintf("%d.log", i%2))
+	}
+	<-done
+}
+
+func TestLoggerAsyncWhileSettingLogFile(t *testing.T) {
+	dir := t.TempDir()
+	log := xlog.NewFastLog("", xlog.BitLevel)
+	log.SetLogFile(dir, "a.log")
+	log.SetAsync(16, xlog.AsyncBlock)
+	defer log.SetSync()
+
+	// 后台协程写出日志的同时切换日志文件，写出时读取的fw不能被并发替换
+	for i := 0; i < 100; i++ {
+		log.InfoF("async %d", i)
+		log.SetLogFile(dir, fmt.Sprintf("%d.log", i%2))
+	}
+	log.Flush()
+}
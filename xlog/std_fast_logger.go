@@ -6,6 +6,8 @@
 
 package xlog
 
+import "io"
+
 /*
 
    全局默认提供一个Log对外句柄，可以直接使用API系列调用
@@ -35,6 +37,39 @@ func AddFlag(flag int) {
 	StdFastLog.AddFlag(flag)
 }
 
+// SetCallerDepth 设置StdFastLog获取调用位置时跳过的调用层数，默认为3，封装xlog的日志函数时每多一层封装加1:
+//
+//	xlog.SetCallerDepth(xlog.CallerDepth() + 1)
+//
+// 框架内部同样使用StdFastLog输出日志，修改后框架日志的调用位置也会偏移，封装函数应优先使用OutPutDepth
+func SetCallerDepth(depth int) {
+	StdFastLog.SetCallerDepth(depth)
+}
+
+// OutPutDepth 使用StdFastLog输出一条日志，调用位置额外向上跳过skip层，不影响其他日志的调用位置:
+//
+//	func logInfo(format string, v ...interface{}) {
+//		_ = xlog.OutPutDepth(0, xlog.LogInfo, fmt.Sprintf(format, v...))
+//	}
+func OutPutDepth(skip int, level int, s string) error {
+	return StdFastLog.OutPutDepth(skip, level, s)
+}
+
+// CallerDepth 获取StdFastLog获取调用位置时跳过的调用层数
+func CallerDepth() int {
+	return StdFastLog.CallerDepth()
+}
+
+// SetCallerEnabled 设置StdFastLog是否输出调用位置，关闭后不再调用runtime.Caller
+func SetCallerEnabled(enabled bool) {
+	StdFastLog.SetCallerEnabled(enabled)
+}
+
+// SetFormatter 设置StdFastLog的日志格式，例如 xlog.SetFormatter(&xlog.LogfmtFormatter{})，传入nil时恢复为默认的文本格式
+func SetFormatter(formatter Formatter) {
+	StdFastLog.SetFormatter(formatter)
+}
+
 // SetPrefix sets the log prefix of StdFastLog
 func SetPrefix(prefix string) {
 	StdFastLog.SetPrefix(prefix)
@@ -45,6 +80,21 @@ func SetLogFile(fileDir string, fileName string) {
 	StdFastLog.SetLogFile(fileDir, fileName)
 }
 
+// SetLevelOutput 为StdFastLog的日志级别区间[minLevel, maxLevel]注册一个输出目标
+func SetLevelOutput(minLevel, maxLevel int, w io.Writer) {
+	StdFastLog.SetLevelOutput(minLevel, maxLevel, w)
+}
+
+// SetLevelFile 为StdFastLog的日志级别区间[minLevel, maxLevel]注册一个可切割的日志文件
+func SetLevelFile(minLevel, maxLevel int, fileDir string, fileName string) {
+	StdFastLog.SetLevelFile(minLevel, maxLevel, fileDir, fileName)
+}
+
+// ClearLevelOutput 清除StdFastLog按级别注册的输出目标
+func ClearLevelOutput() {
+	StdFastLog.ClearLevelOutput()
+}
+
 // SetMaxAge 最大保留天数
 func SetMaxAge(ma int) {
 	StdFastLog.SetMaxAge(ma)
@@ -65,6 +115,21 @@ func SetLogLevel(logLevel int) {
 	StdFastLog.SetLogLevel(logLevel)
 }
 
+// SetAsync 开启StdFastLog的异步日志模式，bufSize小于等于0时恢复为同步模式
+func SetAsync(bufSize int, policy int) {
+	StdFastLog.SetAsync(bufSize, policy)
+}
+
+// SetSync 恢复StdFastLog的同步日志模式
+func SetSync() {
+	StdFastLog.SetSync()
+}
+
+// Flush 刷新StdFastLog中尚未写出的日志，程序退出前应调用
+func Flush() {
+	StdFastLog.Flush()
+}
+
 func DebugF(format string, v ...interface{}) {
 	StdFastLog.DebugF(format, v...)
 }
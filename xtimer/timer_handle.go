@@ -0,0 +1,68 @@
+/**
+* @File: timer_handle.go
+* @Author: Jason Woo
+* @Date: 2026/10/16 13:14
+**/
+
+package xtimer
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// 定时任务的状态
+const (
+	timerPending   int32 = iota // 等待触发
+	timerFired                  // 已经触发
+	timerCancelled              // 已经取消
+)
+
+// TimerHandle Schedule返回的定时任务句柄，用于取消还没有触发的任务
+type TimerHandle struct {
+	tID   uint32          // 定时器在时间轮中的编号
+	ts    *TimerScheduler // 所属的调度器
+	state atomic.Int32    // 任务状态，触发和取消通过CAS竞争，只有一方能成功
+}
+
+// Schedule 在delay之后执行df，返回可以取消该任务的句柄
+// 与CreateTimerAfter相同，到期的任务从GetTriggerChan取出后执行，NewAutoExecTimerScheduler会自动执行
+func (ts *TimerScheduler) Schedule(delay time.Duration, df *DelayFunc) (*TimerHandle, error) {
+	handle := &TimerHandle{ts: ts}
+
+	fire := NewDelayFunc(func(v ...interface{}) {
+		// 已经被取消的任务即使从时间轮中取出也不再执行
+		if handle.state.CompareAndSwap(timerPending, timerFired) {
+			df.Call()
+		}
+	})
+
+	tID, err := ts.CreateTimerAfter(fire, delay)
+	if err != nil {
+		return nil, err
+	}
+	handle.tID = tID
+
+	return handle, nil
+}
+
+// Cancel 取消任务，任务还没有触发时返回true，之后任务不会再执行
+// 任务已经触发(正在执行或执行完成)或已经取消时返回false，可以与任务触发并发调用
+func (h *TimerHandle) Cancel() bool {
+	if !h.state.CompareAndSwap(timerPending, timerCancelled) {
+		return false
+	}
+
+	h.ts.CancelTimer(h.tID)
+	return true
+}
+
+// Fired 任务是否已经触发
+func (h *TimerHandle) Fired() bool {
+	return h.state.Load() == timerFired
+}
+
+// ID 定时器编号，与CreateTimerAfter返回的tID相同
+func (h *TimerHandle) ID() uint32 {
+	return h.tID
+}
@@ -0,0 +1,106 @@
+/**
+* @File: timer_handle_test.go
+* @Author: Jason Woo
+* @Date: 2026/10/16 13:14
+**/
+
+package xtimer
+
+import (
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+var (
+	testScheduler     *TimerScheduler
+	testSchedulerOnce sync.Once
+)
+
+// 调度器启动的时间轮协程不会退出，所有测试共用一个
+func autoScheduler() *TimerScheduler {
+	testSchedulerOnce.Do(func() {
+		testScheduler = NewAutoExecTimerScheduler()
+	})
+	return testScheduler
+}
+
+func TestScheduleCancelBeforeFire(t *testing.T) {
+	var calls int32
+	handle, err := autoScheduler().Schedule(300*time.Millisecond, NewDelayFunc(func(v ...interface{}) {
+		atomic.AddInt32(&calls, 1)
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !handle.Cancel() {
+		t.Fatal("Cancel before fire should return true")
+	}
+	if handle.Cancel() {
+		t.Fatal("second Cancel should return false")
+	}
+
+	time.Sleep(time.Second)
+	if n := atomic.LoadInt32(&calls); n != 0 {
+		t.Fatalf("cancelled task called %d times", n)
+	}
+	if handle.Fired() {
+		t.Fatal("cancelled task should not be fired")
+	}
+}
+
+func TestScheduleCancelAfterFire(t *testing.T) {
+	done := make(chan struct{})
+	handle, err := autoScheduler().Schedule(100*time.Millisecond, NewDelayFunc(func(v ...interface{}) {
+		close(done)
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case <-done:
+	case <-time.After(3 * time.Second):
+		t.Fatal("scheduled task is not called")
+	}
+
+	if handle.Cancel() {
+		t.Fatal("Cancel after fire should return false")
+	}
+	if !handle.Fired() {
+		t.Fatal("task should be fired")
+	}
+}
+
+// 取消与触发并发发生时，任务要么执行一次且Cancel返回false，要么不执行且Cancel返回true
+func TestScheduleCancelRace(t *testing.T) {
+	const n = 50
+
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		var calls int32
+		handle, err := autoScheduler().Schedule(time.Duration(i%5)*20*time.Millisecond, NewDelayFunc(func(v ...interface{}) {
+			atomic.AddInt32(&calls, 1)
+		}))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		wg.Add(1)
+		go func(delay time.Duration) {
+			defer wg.Done()
+			time.Sleep(delay)
+			cancelled := handle.Cancel()
+
+			// 等待已经触发的任务执行完成
+			time.Sleep(300 * time.Millisecond)
+			got := atomic.LoadInt32(&calls)
+			if cancelled && got != 0 || !cancelled && got != 1 {
+				t.Errorf("cancelled = %v, calls = %d", cancelled, got)
+			}
+		}(time.Duration(i%7) * 15 * time.Millisecond)
+	}
+	wg.Wait()
+}
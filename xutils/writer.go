@@ -158,7 +158,7 @@ func (w *Writer) rotate() error {
 			if err1 == nil {
 				_ = os.Remove(filepath.Join(w.fDir, fBakName))
 			} else {
-				fmt.Println(err1)
+				_, _ = fmt.Fprintln(os.Stderr, err1)
 			}
 		}
 
@@ -235,6 +235,11 @@ func (w *Writer) close() error {
 	return err
 }
 
+// Flush 将缓冲区中的数据写入文件
+func (w *Writer) Flush() error {
+	return w.flush()
+}
+
 func (w *Writer) flush() error {
 	w.mu.Lock()
 	defer w.mu.Unlock()